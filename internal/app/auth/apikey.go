@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/vancho-go/url-shortener/internal/app/models"
+)
+
+// APIKeyPrefix - префикс API ключей, по которому они отличаются от JWT.
+const APIKeyPrefix = "usk_"
+
+// APIKeyHeader - заголовок HTTP (и ключ метаданных gRPC) для передачи API ключа.
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyPrefixLen - длина начала ключа, которое хранится открыто для отображения в списке ключей.
+const apiKeyPrefixLen = len(APIKeyPrefix) + 6
+
+// Права API ключей.
+const (
+	// ScopeRead - чтение URL пользователя.
+	ScopeRead = "read"
+	// ScopeWrite - создание и изменение URL, тегов и папок.
+	ScopeWrite = "write"
+	// ScopeDelete - удаление URL, тегов и папок.
+	ScopeDelete = "delete"
+)
+
+// Scopes - все права API ключей.
+var Scopes = []string{ScopeRead, ScopeWrite, ScopeDelete}
+
+var (
+	// ErrInvalidAPIKey - тип ошибки, сигнализирующий, что API ключ не найден или отозван.
+	ErrInvalidAPIKey = errors.New("API key is not valid")
+	// ErrBadScope - тип ошибки, сигнализирующий о неизвестном праве API ключа.
+	ErrBadScope = errors.New("unknown API key scope")
+)
+
+// APIKeyStore - хранилище, по которому проверяются API ключи.
+type APIKeyStore interface {
+	// GetAPIKeyByHash извлекает API ключ по хешу. Если ключа нет, возвращает nil без ошибки.
+	GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error)
+}
+
+// GenerateAPIKey генерирует новый API ключ и возвращает его вместе с хешем для хранилища
+// и открытой частью для отображения.
+func GenerateAPIKey() (key, hash, prefix string, err error) {
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+	key = APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	return key, HashAPIKey(key), key[:apiKeyPrefixLen], nil
+}
+
+// HashAPIKey возвращает хеш API ключа. Ключ содержит 256 случайных бит,
+// поэтому медленная хеш-функция не нужна: по SHA-256 ключ ищется в хранилище напрямую.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsAPIKey проверяет, похоже ли значение на API ключ.
+func IsAPIKey(value string) bool {
+	return strings.HasPrefix(value, APIKeyPrefix)
+}
+
+// NormalizeScopes проверяет права API ключа и удаляет повторы. Пустой список означает все права.
+func NormalizeScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return append([]string(nil), Scopes...), nil
+	}
+	requested := make(map[string]bool, len(scopes))
+	for _, scope := range scopes {
+		requested[scope] = true
+	}
+	normalized := make([]string, 0, len(requested))
+	for _, scope := range Scopes {
+		if requested[scope] {
+			normalized = append(normalized, scope)
+			delete(requested, scope)
+		}
+	}
+	if len(requested) > 0 {
+		return nil, ErrBadScope
+	}
+	return normalized, nil
+}
+
+// AuthenticateAPIKey находит пользователя по API ключу.
+func AuthenticateAPIKey(ctx context.Context, store APIKeyStore, key string) (User, error) {
+	if store == nil || !IsAPIKey(key) {
+		return User{}, ErrInvalidAPIKey
+	}
+	apiKey, err := store.GetAPIKeyByHash(ctx, HashAPIKey(key))
+	if err != nil {
+		return User{}, err
+	}
+	if apiKey == nil {
+		return User{}, ErrInvalidAPIKey
+	}
+	return User{ID: apiKey.UserID, APIKeyID: apiKey.ID, Scopes: apiKey.Scopes}, nil
+}
+
+// ScopeForHTTPMethod возвращает право, необходимое API ключу для запроса с методом method.
+func ScopeForHTTPMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return ScopeRead
+	case http.MethodDelete:
+		return ScopeDelete
+	default:
+		return ScopeWrite
+	}
+}
@@ -0,0 +1,128 @@
+// Модуль auth реализует выпуск и проверку токенов аутентификации пользователя.
+// Используется и HTTP middleware, и gRPC interceptor, поэтому токен,
+// выпущенный одним транспортом, принимается другим.
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vancho-go/url-shortener/internal/app/config"
+)
+
+// TokenName - имя cookie (HTTP) и ключа метаданных (gRPC), в которых передается токен.
+const TokenName = "AuthToken"
+
+// DefaultTokenTTL - время действия токена по умолчанию. Токен короткоживущий:
+// сессия продлевается токеном обновления (см. Sessions). Анонимный пользователь, который только читал,
+// сессии не получает: после истечения токена ему выдается новый идентификатор. Это допустимо,
+// так как за таким идентификатором нет сохраненных данных.
+const DefaultTokenTTL = 15 * time.Minute
+
+// ErrInvalidToken - тип ошибки, сигнализирующий, что токен не прошел проверку.
+var ErrInvalidToken = errors.New("token is not valid")
+
+// TokenManager выпускает и проверяет токены аутентификации.
+type TokenManager interface {
+	// Issue выпускает токен для пользователя.
+	Issue(user User) (string, error)
+	// IssueSession начинает сессию пользователя и выпускает токен доступа и токен обновления.
+	IssueSession(ctx context.Context, user User) (TokenPair, error)
+	// Refresh обменивает токен обновления на новую пару токенов той же сессии.
+	Refresh(ctx context.Context, refreshToken string) (User, TokenPair, error)
+	// Validate проверяет токен и возвращает его утверждения.
+	Validate(token string) (*Claims, error)
+	// User извлекает пользователя из валидного токена.
+	User(token string) (User, error)
+	// Revoke отзывает токен, которым аутентифицирован пользователь, и завершает его сессию.
+	Revoke(ctx context.Context, user User) error
+	// RevokeRefresh завершает сессию, которой принадлежит токен обновления.
+	RevokeRefresh(ctx context.Context, refreshToken string) error
+	// TTL возвращает время действия выпускаемых токенов.
+	TTL() time.Duration
+	// RefreshTTL возвращает время действия выпускаемых токенов обновления (0 - сессии не настроены).
+	RefreshTTL() time.Duration
+	// JWKS возвращает публичные ключи, по которым другие сервисы могут проверять токены.
+	JWKS() JWKSet
+}
+
+// New создает TokenManager по конфигурации сервера.
+// Связка ключей собирается из AuthKeys (первый ключ - активный), затем AuthSecret с kid DefaultKeyID.
+// Если ключи не заданы, генерируется случайный секрет: токены перестанут приниматься после перезапуска сервера.
+// Если revocations nil, токены нельзя отозвать до истечения срока действия.
+// Если sessions nil, токены обновления не выпускаются.
+func New(cfg config.ServerConfig, revocations *RevocationList, sessions *Sessions) (TokenManager, error) {
+	keys := NewKeyRing()
+	if err := keys.loadKeys(cfg.AuthKeys); err != nil {
+		return nil, err
+	}
+
+	secret := []byte(cfg.AuthSecret)
+	if len(secret) == 0 && len(keys.keys) == 0 {
+		var err error
+		if secret, err = randomSecret(); err != nil {
+			return nil, err
+		}
+	}
+	if len(secret) > 0 {
+		if err := keys.AddSecret(DefaultKeyID, secret); err != nil {
+			return nil, err
+		}
+	}
+	if keys.active == nil {
+		return nil, errors.New("auth keys contain no private key for signing tokens")
+	}
+	return NewJWTManager(keys, cfg.AuthIssuer, cfg.AuthAudience, cfg.AuthTokenTTL, revocations, sessions), nil
+}
+
+// GenerateUserID генерирует рандомный UUID. Используется и для анонимных пользователей,
+// и для учетных записей, поэтому хранилища работают с ними одинаково.
+func GenerateUserID() string {
+	return uuid.New().String()
+}
+
+type key int
+
+// userKey - ключ, по которому пользователь запроса хранится в context.
+const userKey key = iota
+
+// User - пользователь, от имени которого выполняется запрос.
+type User struct {
+	// ID - идентификатор пользователя.
+	ID string
+	// New - пользователь создан в текущем запросе, валидного токена у клиента не было.
+	New bool
+	// Registered - пользователь вошел в учетную запись, иначе он анонимный.
+	Registered bool
+	// APIKeyID - API ключ, которым аутентифицирован запрос (0 - запрос с токеном).
+	APIKeyID int64
+	// Scopes - права API ключа.
+	Scopes []string
+	// Roles - роли учетной записи сверх RoleUser.
+	Roles []string
+	// TokenID и TokenExpiresAt - идентификатор (jti) и срок действия токена запроса, нужны для его отзыва.
+	TokenID        string
+	TokenExpiresAt time.Time
+	// SessionID - сессия, в которой выпущен токен запроса (см. Sessions).
+	SessionID string
+}
+
+// Allows проверяет, разрешено ли пользователю действие с правом scope.
+// Ограничения действуют только на запросы с API ключом.
+func (u User) Allows(scope string) bool {
+	return u.APIKeyID == 0 || contains(u.Scopes, scope)
+}
+
+// NewContext возвращает context с пользователем запроса.
+func NewContext(ctx context.Context, user User) context.Context {
+	return context.WithValue(ctx, userKey, user)
+}
+
+// FromContext извлекает пользователя запроса из context.
+func FromContext(ctx context.Context) (User, bool) {
+	user, ok := ctx.Value(userKey).(User)
+	return user, ok
+}
@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+// Claims - данные, которые в себе содержит токен.
+type Claims struct {
+	jwt.RegisteredClaims
+	UserID string
+	// Registered - токен выдан при входе в учетную запись, а не анонимному пользователю.
+	Registered bool `json:",omitempty"`
+	// Roles - роли учетной записи сверх RoleUser.
+	Roles []string `json:",omitempty"`
+	// SessionID - сессия, в которой выпущен токен.
+	SessionID string `json:",omitempty"`
+}
+
+// JWTManager - TokenManager на основе JWT, подписанных ключами из KeyRing.
+type JWTManager struct {
+	keys     *KeyRing
+	issuer   string
+	audience string
+	ttl      time.Duration
+	// revocations - список отозванных токенов (nil - отзыв не поддерживается).
+	revocations *RevocationList
+	// sessions - сессии с токенами обновления (nil - токены обновления не выпускаются).
+	sessions *Sessions
+}
+
+// NewJWTManager конструктор JWTManager.
+// Пустые issuer и audience не записываются в токен и не проверяются. Если ttl <= 0, используется DefaultTokenTTL.
+// Если revocations nil, токены нельзя отозвать до истечения срока действия.
+// Если sessions nil, токены обновления не выпускаются.
+func NewJWTManager(keys *KeyRing, issuer, audience string, ttl time.Duration, revocations *RevocationList, sessions *Sessions) *JWTManager {
+	if ttl <= 0 {
+		ttl = DefaultTokenTTL
+	}
+	return &JWTManager{keys: keys, issuer: issuer, audience: audience, ttl: ttl, revocations: revocations, sessions: sessions}
+}
+
+// Issue выпускает токен для пользователя.
+func (m *JWTManager) Issue(user User) (string, error) {
+	now := time.Now()
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Issuer:    m.issuer,
+			ExpiresAt: jwt.NewNumericDate(now.Add(m.ttl)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+		UserID:     user.ID,
+		Registered: user.Registered,
+		Roles:      user.Roles,
+		SessionID:  user.SessionID,
+	}
+	if m.audience != "" {
+		claims.Audience = jwt.ClaimStrings{m.audience}
+	}
+	return m.keys.sign(claims)
+}
+
+// IssueSession начинает сессию пользователя и выпускает токен доступа и токен обновления.
+// Если сессии не настроены, выпускается только токен доступа.
+func (m *JWTManager) IssueSession(ctx context.Context, user User) (TokenPair, error) {
+	var pair TokenPair
+	var err error
+	if user.SessionID, pair.RefreshToken, err = m.sessions.Start(ctx, user); err != nil {
+		return TokenPair{}, err
+	}
+	if pair.AccessToken, err = m.Issue(user); err != nil {
+		return TokenPair{}, err
+	}
+	return pair, nil
+}
+
+// Refresh обменивает токен обновления на новую пару токенов той же сессии.
+// Пользователь и сессия берутся из токена обновления, роли - из текущих назначений ролей.
+func (m *JWTManager) Refresh(ctx context.Context, refreshToken string) (User, TokenPair, error) {
+	next, nextToken, err := m.sessions.Rotate(ctx, refreshToken)
+	if err != nil {
+		return User{}, TokenPair{}, err
+	}
+	user := User{ID: next.UserID, Registered: next.Registered, Roles: next.Roles, SessionID: next.FamilyID}
+	accessToken, err := m.Issue(user)
+	if err != nil {
+		return User{}, TokenPair{}, err
+	}
+	return user, TokenPair{AccessToken: accessToken, RefreshToken: nextToken}, nil
+}
+
+// Validate проверяет подпись (ключом из связки по kid), срок действия, издателя и аудиторию токена,
+// а также что токен не отозван.
+func (m *JWTManager) Validate(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, m.keys.keyFunc)
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	if m.issuer != "" && !claims.VerifyIssuer(m.issuer, true) {
+		return nil, ErrInvalidToken
+	}
+	if m.audience != "" && !claims.VerifyAudience(m.audience, true) {
+		return nil, ErrInvalidToken
+	}
+	if claims.ID != "" && m.revocations.IsRevoked(claims.ID) {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// User извлекает пользователя из валидного токена.
+func (m *JWTManager) User(tokenString string) (User, error) {
+	claims, err := m.Validate(tokenString)
+	if err != nil {
+		return User{}, err
+	}
+	if claims.UserID == "" {
+		return User{}, ErrInvalidToken
+	}
+	user := User{ID: claims.UserID, Registered: claims.Registered, Roles: claims.Roles, TokenID: claims.ID, SessionID: claims.SessionID}
+	if claims.ExpiresAt != nil {
+		user.TokenExpiresAt = claims.ExpiresAt.Time
+	}
+	return user, nil
+}
+
+// Revoke отзывает токен, которым аутентифицирован пользователь, и завершает сессию токена.
+// Отзывается только предъявленный токен доступа: другие токены пользователя, в том числе выпущенные
+// ранее в той же сессии, действуют до истечения срока (не дольше TTL), но обновить их уже нельзя.
+// Токены без jti (выпущенные до появления отзыва) отозвать нельзя, они действуют до истечения срока.
+func (m *JWTManager) Revoke(ctx context.Context, user User) error {
+	if err := m.sessions.End(ctx, user.SessionID); err != nil {
+		return err
+	}
+	if user.TokenID == "" {
+		return nil
+	}
+	return m.revocations.Revoke(ctx, user.TokenID, user.TokenExpiresAt)
+}
+
+// RevokeRefresh завершает сессию, которой принадлежит токен обновления.
+func (m *JWTManager) RevokeRefresh(ctx context.Context, refreshToken string) error {
+	return m.sessions.EndByToken(ctx, refreshToken)
+}
+
+// TTL возвращает время действия выпускаемых токенов.
+func (m *JWTManager) TTL() time.Duration {
+	return m.ttl
+}
+
+// RefreshTTL возвращает время действия выпускаемых токенов обновления.
+func (m *JWTManager) RefreshTTL() time.Duration {
+	return m.sessions.TTL()
+}
+
+// JWKS возвращает публичные ключи для проверки токенов.
+func (m *JWTManager) JWKS() JWKSet {
+	return m.keys.JWKS()
+}
+
+// randomSecret генерирует случайный секрет для подписи токенов.
+func randomSecret() ([]byte, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("error generating auth secret: %w", err)
+	}
+	return secret, nil
+}
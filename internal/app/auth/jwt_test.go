@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vancho-go/url-shortener/internal/app/config"
+)
+
+// функция для генерации случайной строки заданной длины
+func randomStr(length int) string {
+	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	bytes := make([]byte, length)
+	for i := range bytes {
+		bytes[i] = letters[rand.Intn(len(letters))]
+	}
+	return string(bytes)
+}
+
+// hmacManager создает JWTManager с единственным ключом HS256.
+func hmacManager(secret, issuer, audience string, ttl time.Duration) *JWTManager {
+	keys := NewKeyRing()
+	keys.AddSecret(DefaultKeyID, []byte(secret))
+	return NewJWTManager(keys, issuer, audience, ttl, nil, nil)
+}
+
+func TestJWTManager(t *testing.T) {
+	manager := hmacManager("secret", "url-shortener", "clients", time.Hour)
+	token, err := manager.Issue(User{ID: "user", Registered: true, Roles: []string{RoleAuditor}})
+	require.NoError(t, err)
+
+	user, err := manager.User(token)
+	require.NoError(t, err)
+	assert.Equal(t, "user", user.ID)
+	assert.True(t, user.Registered)
+	assert.Equal(t, []string{RoleAuditor}, user.Roles)
+
+	tests := []struct {
+		name    string
+		manager *JWTManager
+	}{
+		{name: "other secret", manager: hmacManager("other", "url-shortener", "clients", time.Hour)},
+		{name: "other issuer", manager: hmacManager("secret", "other", "clients", time.Hour)},
+		{name: "other audience", manager: hmacManager("secret", "url-shortener", "other", time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.manager.User(token)
+			assert.ErrorIs(t, err, ErrInvalidToken)
+		})
+	}
+
+	t.Run("expired", func(t *testing.T) {
+		expired := hmacManager("secret", "", "", time.Nanosecond)
+		token, err := expired.Issue(User{ID: "user"})
+		require.NoError(t, err)
+		time.Sleep(time.Second)
+		_, err = expired.User(token)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+}
+
+func TestNew(t *testing.T) {
+	manager, err := New(config.ServerConfig{}, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultTokenTTL, manager.TTL())
+
+	token, err := manager.Issue(User{ID: "user"})
+	require.NoError(t, err)
+	other, err := New(config.ServerConfig{}, nil, nil)
+	require.NoError(t, err)
+	_, err = other.User(token)
+	assert.ErrorIs(t, err, ErrInvalidToken, "random secrets must differ")
+}
+
+func BenchmarkJWTManager_Issue(b *testing.B) {
+	manager := hmacManager("secret", "", "", time.Hour)
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		input := randomStr(20)
+		b.StartTimer()
+		manager.Issue(User{ID: input})
+	}
+}
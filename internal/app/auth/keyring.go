@@ -0,0 +1,265 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// DefaultKeyID - идентификатор ключа из AuthSecret. Им же проверяются токены без заголовка kid.
+const DefaultKeyID = "default"
+
+// ErrUnknownKey - тип ошибки, сигнализирующий, что ключа с таким kid нет в связке (или он выведен из оборота).
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// signingKey - ключ связки.
+type signingKey struct {
+	id     string
+	method jwt.SigningMethod
+	// private - ключ подписи, nil у ключей, предназначенных только для проверки.
+	private any
+	public  any
+}
+
+// KeyRing - связка ключей для подписи и проверки токенов.
+// Токены подписываются активным ключом (первым добавленным ключом с приватной частью)
+// и принимаются, если подписаны любым ключом связки. Чтобы сменить ключ без разлогина пользователей,
+// новый ключ ставится первым, а старый остается в связке, пока не истекут выпущенные им токены.
+// Ключ, убранный из связки, считается выведенным из оборота.
+type KeyRing struct {
+	active *signingKey
+	keys   map[string]*signingKey
+	order  []string
+}
+
+// NewKeyRing конструктор KeyRing.
+func NewKeyRing() *KeyRing {
+	return &KeyRing{keys: make(map[string]*signingKey)}
+}
+
+// AddSecret добавляет в связку ключ HS256.
+func (r *KeyRing) AddSecret(id string, secret []byte) error {
+	return r.add(&signingKey{id: id, method: jwt.SigningMethodHS256, private: secret, public: secret})
+}
+
+// AddKey добавляет в связку ключ в формате PEM: приватный ключ RSA (RS256) или Ed25519 (EdDSA)
+// в PKCS #8 или PKCS #1, либо публичный ключ PKIX (только для проверки).
+// Данные не в формате PEM считаются секретом HS256.
+func (r *KeyRing) AddKey(id string, material []byte) error {
+	block, _ := pem.Decode(material)
+	if block == nil {
+		secret := bytes.TrimSpace(material)
+		if len(secret) == 0 {
+			return fmt.Errorf("key %q is empty", id)
+		}
+		return r.AddSecret(id, secret)
+	}
+
+	var key any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return fmt.Errorf("key %q: unsupported PEM block %q", id, block.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("key %q: %w", id, err)
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return r.add(&signingKey{id: id, method: jwt.SigningMethodRS256, private: k, public: &k.PublicKey})
+	case *rsa.PublicKey:
+		return r.add(&signingKey{id: id, method: jwt.SigningMethodRS256, public: k})
+	case ed25519.PrivateKey:
+		return r.add(&signingKey{id: id, method: jwt.SigningMethodEdDSA, private: k, public: k.Public()})
+	case ed25519.PublicKey:
+		return r.add(&signingKey{id: id, method: jwt.SigningMethodEdDSA, public: k})
+	default:
+		return fmt.Errorf("key %q: unsupported key type %T", id, key)
+	}
+}
+
+// add добавляет ключ в связку. Первый ключ с приватной частью становится активным.
+func (r *KeyRing) add(key *signingKey) error {
+	if key.id == "" {
+		return errors.New("key id is empty")
+	}
+	if _, ok := r.keys[key.id]; ok {
+		return fmt.Errorf("duplicate key id %q", key.id)
+	}
+	r.keys[key.id] = key
+	r.order = append(r.order, key.id)
+	if r.active == nil && key.private != nil {
+		r.active = key
+	}
+	return nil
+}
+
+// sign подписывает утверждения активным ключом и проставляет его kid в заголовок.
+func (r *KeyRing) sign(claims jwt.Claims) (string, error) {
+	if r.active == nil {
+		return "", errors.New("no active signing key")
+	}
+	token := jwt.NewWithClaims(r.active.method, claims)
+	token.Header["kid"] = r.active.id
+	return token.SignedString(r.active.private)
+}
+
+// keyFunc выбирает ключ проверки по kid токена. Алгоритм токена должен совпадать с алгоритмом ключа.
+func (r *KeyRing) keyFunc(t *jwt.Token) (interface{}, error) {
+	id := DefaultKeyID
+	if kid, ok := t.Header["kid"].(string); ok {
+		id = kid
+	}
+	key, ok := r.keys[id]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if t.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+	}
+	return key.public, nil
+}
+
+// JWK - публичный ключ в формате JSON Web Key (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	// N и E - модуль и экспонента ключа RSA.
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Crv, X и Y - кривая и координаты публичной точки ключа OKP (Ed25519) или EC (только Y).
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet - набор публичных ключей, по которому другие сервисы могут проверять токены.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS возвращает публичные ключи связки. Ключи HS256 симметричные и не публикуются.
+func (r *KeyRing) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, id := range r.order {
+		key := r.keys[id]
+		jwk := JWK{Use: "sig", Kid: key.id, Alg: key.method.Alg()}
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// addJWK добавляет в связку публичный ключ из JWK (только для проверки).
+// Ключи с назначением, отличным от подписи, пропускаются.
+func (r *KeyRing) addJWK(jwk JWK) error {
+	if jwk.Use != "" && jwk.Use != "sig" {
+		return nil
+	}
+	id := jwk.Kid
+	if id == "" {
+		id = DefaultKeyID
+	}
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return fmt.Errorf("key %q: %w", id, err)
+		}
+		e, err := decode(jwk.E)
+		if err != nil {
+			return fmt.Errorf("key %q: %w", id, err)
+		}
+		public := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		return r.add(&signingKey{id: id, method: jwt.SigningMethodRS256, public: public})
+	case "EC":
+		if jwk.Crv != "P-256" {
+			return fmt.Errorf("key %q: unsupported curve %q", id, jwk.Crv)
+		}
+		x, err := decode(jwk.X)
+		if err != nil {
+			return fmt.Errorf("key %q: %w", id, err)
+		}
+		y, err := decode(jwk.Y)
+		if err != nil {
+			return fmt.Errorf("key %q: %w", id, err)
+		}
+		public := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		return r.add(&signingKey{id: id, method: jwt.SigningMethodES256, public: public})
+	case "OKP":
+		x, err := decode(jwk.X)
+		if err != nil || jwk.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return fmt.Errorf("key %q: bad Ed25519 key", id)
+		}
+		return r.add(&signingKey{id: id, method: jwt.SigningMethodEdDSA, public: ed25519.PublicKey(x)})
+	default:
+		return fmt.Errorf("key %q: unsupported key type %q", id, jwk.Kty)
+	}
+}
+
+// loadKeys добавляет в связку ключи из списка вида "kid:источник,kid:источник".
+// Источник - путь к файлу с ключом или "env:ИМЯ" для ключа из переменной окружения.
+func (r *KeyRing) loadKeys(spec string) error {
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, source, ok := strings.Cut(entry, ":")
+		if !ok || source == "" {
+			return fmt.Errorf("bad key entry %q, kid:source expected", entry)
+		}
+
+		var material []byte
+		if name, ok := strings.CutPrefix(source, "env:"); ok {
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				return fmt.Errorf("key %q: environment variable %s is not set", id, name)
+			}
+			material = []byte(value)
+		} else {
+			var err error
+			if material, err = os.ReadFile(source); err != nil {
+				return fmt.Errorf("key %q: %w", id, err)
+			}
+		}
+		if err := r.AddKey(id, material); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vancho-go/url-shortener/internal/app/config"
+)
+
+// writeKey сохраняет приватный ключ в PEM файл и возвращает путь к нему.
+func writeKey(t *testing.T, key any) string {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+	return path
+}
+
+func TestKeyRotation(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	rsaPath, edPath := writeKey(t, rsaKey), writeKey(t, edKey)
+
+	old, err := New(config.ServerConfig{AuthKeys: "k1:" + rsaPath}, nil, nil)
+	require.NoError(t, err)
+	oldToken, err := old.Issue(User{ID: "user"})
+	require.NoError(t, err)
+
+	t.Setenv("AUTH_TEST_KEY", "hmac-secret")
+	rotated, err := New(config.ServerConfig{AuthKeys: "k2:" + edPath + ",k1:" + rsaPath + ",k0:env:AUTH_TEST_KEY"}, nil, nil)
+	require.NoError(t, err)
+
+	// Старый токен принимается, новый подписывается активным ключом.
+	user, err := rotated.User(oldToken)
+	require.NoError(t, err)
+	assert.Equal(t, "user", user.ID)
+
+	newToken, err := rotated.Issue(User{ID: "user"})
+	require.NoError(t, err)
+	parsed, _, err := jwt.NewParser().ParseUnverified(newToken, &Claims{})
+	require.NoError(t, err)
+	assert.Equal(t, "k2", parsed.Header["kid"])
+	assert.Equal(t, "EdDSA", parsed.Header["alg"])
+
+	// HS256 ключ не публикуется.
+	jwks := rotated.JWKS()
+	require.Len(t, jwks.Keys, 2)
+	assert.Equal(t, JWK{Kty: "OKP", Use: "sig", Kid: "k2", Alg: "EdDSA", Crv: "Ed25519", X: jwks.Keys[0].X}, jwks.Keys[0])
+	assert.Equal(t, "RSA", jwks.Keys[1].Kty)
+	assert.Equal(t, "AQAB", jwks.Keys[1].E)
+
+	// Выведенный из оборота ключ убран из связки: его токены больше не принимаются.
+	retired, err := New(config.ServerConfig{AuthKeys: "k2:" + edPath}, nil, nil)
+	require.NoError(t, err)
+	_, err = retired.User(oldToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = retired.User(newToken)
+	assert.NoError(t, err)
+}
+
+func TestKeyRingRejectsAlgorithmMismatch(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	manager, err := New(config.ServerConfig{AuthKeys: "k1:" + writeKey(t, rsaKey)}, nil, nil)
+	require.NoError(t, err)
+
+	// Токен HS256, подписанный публичным ключом RSA, не должен приниматься.
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	require.NoError(t, err)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{UserID: "user"})
+	token.Header["kid"] = "k1"
+	forged, err := token.SignedString(der)
+	require.NoError(t, err)
+	_, err = manager.User(forged)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestLegacyTokenWithoutKid(t *testing.T) {
+	manager, err := New(config.ServerConfig{AuthSecret: "secret"}, nil, nil)
+	require.NoError(t, err)
+
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+		UserID:           "user",
+	}).SignedString([]byte("secret"))
+	require.NoError(t, err)
+
+	user, err := manager.User(legacy)
+	require.NoError(t, err)
+	assert.Equal(t, "user", user.ID)
+}
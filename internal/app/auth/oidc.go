@@ -0,0 +1,289 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+
+	"github.com/vancho-go/url-shortener/internal/app/config"
+)
+
+// OIDCStateCookie - имя cookie, в которой между /auth/login и /auth/callback хранится состояние входа.
+const OIDCStateCookie = "OIDCState"
+
+// OIDCCallbackPath - путь, на который OIDC провайдер возвращает пользователя после входа.
+const OIDCCallbackPath = "/auth/callback"
+
+// ErrOIDCLogin - тип ошибки, сигнализирующий, что провайдер отклонил вход или вернул невалидный ID токен.
+var ErrOIDCLogin = errors.New("OIDC login failed")
+
+// OIDCLogin - состояние одного входа через OIDC: state защищает callback от подделки,
+// nonce связывает ID токен со входом, verifier - секрет PKCE.
+type OIDCLogin struct {
+	State    string
+	Nonce    string
+	Verifier string
+	// Merge - после входа перенести URL текущего анонимного пользователя в учетную запись.
+	Merge bool
+}
+
+// NewOIDCLogin генерирует случайные state, nonce и verifier для нового входа.
+func NewOIDCLogin() (OIDCLogin, error) {
+	var login OIDCLogin
+	for _, value := range []*string{&login.State, &login.Nonce, &login.Verifier} {
+		random := make([]byte, 32)
+		if _, err := rand.Read(random); err != nil {
+			return OIDCLogin{}, err
+		}
+		*value = base64.RawURLEncoding.EncodeToString(random)
+	}
+	return login, nil
+}
+
+// String кодирует состояние входа для хранения в cookie.
+func (l OIDCLogin) String() string {
+	value := l.State + "." + l.Nonce + "." + l.Verifier
+	if l.Merge {
+		value += ".merge"
+	}
+	return value
+}
+
+// ParseOIDCLogin декодирует состояние входа из cookie.
+func ParseOIDCLogin(value string) (OIDCLogin, error) {
+	parts := strings.Split(value, ".")
+	if len(parts) < 3 || len(parts) > 4 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return OIDCLogin{}, ErrOIDCLogin
+	}
+	return OIDCLogin{State: parts[0], Nonce: parts[1], Verifier: parts[2], Merge: len(parts) == 4 && parts[3] == "merge"}, nil
+}
+
+// codeChallenge возвращает PKCE code_challenge по методу S256.
+func (l OIDCLogin) codeChallenge() string {
+	sum := sha256.Sum256([]byte(l.Verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// OIDCIdentity - пользователь, подтвержденный OIDC провайдером.
+type OIDCIdentity struct {
+	// Subject - идентификатор пользователя у провайдера (sub).
+	Subject string
+	// Email - email пользователя, если провайдер его передал.
+	Email string
+	// UserID - локальный идентификатор пользователя, см. OIDCUserID.
+	UserID string
+}
+
+// OIDCUserID отображает пользователя провайдера в локальный идентификатор пользователя.
+// Идентификатор детерминированный (UUID v5 от издателя и sub), поэтому повторный вход
+// возвращает того же пользователя без отдельной таблицы соответствий в хранилище.
+func OIDCUserID(issuer, subject string) string {
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte(issuer+"#"+subject)).String()
+}
+
+// idTokenClaims - утверждения ID токена, которые проверяет сервис.
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce string `json:"nonce"`
+	Email string `json:"email"`
+}
+
+// OIDCProvider - клиент OpenID Connect провайдера для входа по authorization code с PKCE.
+type OIDCProvider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	client       *http.Client
+
+	authorizationEndpoint string
+	tokenEndpoint         string
+	jwksURI               string
+
+	mu   sync.RWMutex
+	keys *KeyRing
+}
+
+// NewOIDCProvider конструктор OIDCProvider. Адреса провайдера загружаются из документа
+// /.well-known/openid-configuration издателя, callback сервиса строится от BaseHost.
+func NewOIDCProvider(ctx context.Context, cfg config.ServerConfig) (*OIDCProvider, error) {
+	if cfg.OIDCIssuer == "" || cfg.OIDCClientID == "" {
+		return nil, errors.New("OIDC issuer and client ID are required")
+	}
+	p := &OIDCProvider{
+		issuer:       cfg.OIDCIssuer,
+		clientID:     cfg.OIDCClientID,
+		clientSecret: cfg.OIDCClientSecret,
+		redirectURL:  strings.TrimSuffix(cfg.BaseHost, "/") + OIDCCallbackPath,
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+
+	var discovery struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+	if err := p.getJSON(ctx, strings.TrimSuffix(p.issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("error loading OIDC discovery document: %w", err)
+	}
+	if discovery.Issuer != p.issuer {
+		return nil, fmt.Errorf("OIDC discovery issuer %q does not match %q", discovery.Issuer, p.issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery document is incomplete")
+	}
+	p.authorizationEndpoint = discovery.AuthorizationEndpoint
+	p.tokenEndpoint = discovery.TokenEndpoint
+	p.jwksURI = discovery.JWKSURI
+
+	if err := p.refreshKeys(ctx); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// AuthCodeURL возвращает адрес провайдера, на который перенаправляется пользователь для входа.
+func (p *OIDCProvider) AuthCodeURL(login OIDCLogin) string {
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.clientID},
+		"redirect_uri":          {p.redirectURL},
+		"scope":                 {"openid email"},
+		"state":                 {login.State},
+		"nonce":                 {login.Nonce},
+		"code_challenge":        {login.codeChallenge()},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(p.authorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.authorizationEndpoint + separator + query.Encode()
+}
+
+// Exchange обменивает код авторизации на ID токен, проверяет его и возвращает пользователя.
+func (p *OIDCProvider) Exchange(ctx context.Context, code string, login OIDCLogin) (*OIDCIdentity, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURL},
+		"client_id":     {p.clientID},
+		"code_verifier": {login.Verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return nil, fmt.Errorf("%w: token endpoint returned %d: %s", ErrOIDCLogin, res.StatusCode, body)
+	}
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return nil, err
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("%w: no id_token in response", ErrOIDCLogin)
+	}
+	return p.verify(ctx, token.IDToken, login.Nonce)
+}
+
+// verify проверяет подпись, издателя, аудиторию, срок действия и nonce ID токена.
+func (p *OIDCProvider) verify(ctx context.Context, idToken, nonce string) (*OIDCIdentity, error) {
+	claims := &idTokenClaims{}
+	token, err := jwt.ParseWithClaims(idToken, claims, p.keyFunc(ctx))
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("%w: bad id_token: %v", ErrOIDCLogin, err)
+	}
+	switch {
+	case claims.Issuer != p.issuer:
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrOIDCLogin, claims.Issuer)
+	case !claims.VerifyAudience(p.clientID, true):
+		return nil, fmt.Errorf("%w: unexpected audience", ErrOIDCLogin)
+	case claims.ExpiresAt == nil:
+		return nil, fmt.Errorf("%w: id_token has no expiration", ErrOIDCLogin)
+	case claims.Nonce != nonce:
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrOIDCLogin)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: id_token has no subject", ErrOIDCLogin)
+	}
+	return &OIDCIdentity{Subject: claims.Subject, Email: claims.Email, UserID: OIDCUserID(p.issuer, claims.Subject)}, nil
+}
+
+// keyFunc выбирает ключ проверки ID токена. Если kid неизвестен, ключи провайдера
+// загружаются заново: провайдер мог сменить ключ подписи.
+func (p *OIDCProvider) keyFunc(ctx context.Context) jwt.Keyfunc {
+	return func(t *jwt.Token) (interface{}, error) {
+		p.mu.RLock()
+		keys := p.keys
+		p.mu.RUnlock()
+		key, err := keys.keyFunc(t)
+		if !errors.Is(err, ErrUnknownKey) {
+			return key, err
+		}
+		if err = p.refreshKeys(ctx); err != nil {
+			return nil, err
+		}
+		p.mu.RLock()
+		defer p.mu.RUnlock()
+		return p.keys.keyFunc(t)
+	}
+}
+
+// refreshKeys загружает публичные ключи провайдера.
+func (p *OIDCProvider) refreshKeys(ctx context.Context) error {
+	var set JWKSet
+	if err := p.getJSON(ctx, p.jwksURI, &set); err != nil {
+		return fmt.Errorf("error loading OIDC keys: %w", err)
+	}
+	// Ключи неподдерживаемых типов пропускаются: токены, подписанные ими, не пройдут проверку.
+	keys := NewKeyRing()
+	for _, jwk := range set.Keys {
+		_ = keys.addJWK(jwk)
+	}
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+	return nil
+}
+
+// getJSON выполняет GET запрос и декодирует JSON ответ.
+func (p *OIDCProvider) getJSON(ctx context.Context, target string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", target, res.StatusCode)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
@@ -0,0 +1,190 @@
+// Модуль oidctest реализует OpenID Connect провайдер для тестов входа через OIDC.
+// Провайдер запускается в процессе теста и сразу выполняет вход пользователя Subject,
+// проверяя клиента, redirect_uri и PKCE так же, как настоящий провайдер.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// keyID - kid ключа, которым провайдер подписывает ID токены.
+const keyID = "mock"
+
+// Provider - тестовый OIDC провайдер.
+type Provider struct {
+	// Issuer - издатель провайдера (адрес тестового сервера).
+	Issuer string
+	// ClientID и ClientSecret - единственный зарегистрированный клиент.
+	ClientID     string
+	ClientSecret string
+	// Subject и Email - пользователь, который входит через провайдер.
+	Subject string
+	Email   string
+
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]authorization
+}
+
+// authorization - выданный, но еще не обмененный код авторизации.
+type authorization struct {
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+}
+
+// NewProvider запускает тестовый провайдер. Его нужно остановить методом Close.
+func NewProvider(clientID, clientSecret string) *Provider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	p := &Provider{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Subject:      "user",
+		key:          key,
+		codes:        make(map[string]authorization),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	mux.HandleFunc("/jwks", p.jwks)
+	p.server = httptest.NewServer(mux)
+	p.Issuer = p.server.URL
+	return p
+}
+
+// Close останавливает провайдер.
+func (p *Provider) Close() {
+	p.server.Close()
+}
+
+// Client возвращает HTTP клиент, который не следует за перенаправлениями.
+func (p *Provider) Client() *http.Client {
+	return &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+}
+
+func (p *Provider) discovery(res http.ResponseWriter, req *http.Request) {
+	writeJSON(res, http.StatusOK, map[string]any{
+		"issuer":                           p.Issuer,
+		"authorization_endpoint":           p.Issuer + "/authorize",
+		"token_endpoint":                   p.Issuer + "/token",
+		"jwks_uri":                         p.Issuer + "/jwks",
+		"response_types_supported":         []string{"code"},
+		"code_challenge_methods_supported": []string{"S256"},
+	})
+}
+
+// authorize сразу выполняет вход пользователя и возвращает его на redirect_uri с кодом.
+func (p *Provider) authorize(res http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	if query.Get("client_id") != p.ClientID || query.Get("response_type") != "code" ||
+		query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(res, "bad authorization request", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString()
+	p.mu.Lock()
+	p.codes[code] = authorization{
+		redirectURI:   query.Get("redirect_uri"),
+		nonce:         query.Get("nonce"),
+		codeChallenge: query.Get("code_challenge"),
+	}
+	p.mu.Unlock()
+
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil {
+		http.Error(res, "bad redirect_uri", http.StatusBadRequest)
+		return
+	}
+	values := redirect.Query()
+	values.Set("code", code)
+	values.Set("state", query.Get("state"))
+	redirect.RawQuery = values.Encode()
+	http.Redirect(res, req, redirect.String(), http.StatusFound)
+}
+
+// token обменивает код на ID токен. Код одноразовый.
+func (p *Provider) token(res http.ResponseWriter, req *http.Request) {
+	clientID, clientSecret, ok := req.BasicAuth()
+	if !ok || clientID != p.ClientID || clientSecret != p.ClientSecret {
+		writeJSON(res, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	p.mu.Lock()
+	auth, ok := p.codes[req.PostFormValue("code")]
+	delete(p.codes, req.PostFormValue("code"))
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(req.PostFormValue("code_verifier")))
+	if !ok || req.PostFormValue("grant_type") != "authorization_code" ||
+		req.PostFormValue("redirect_uri") != auth.redirectURI ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != auth.codeChallenge {
+		writeJSON(res, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   p.Issuer,
+		"sub":   p.Subject,
+		"aud":   p.ClientID,
+		"exp":   now.Add(time.Minute).Unix(),
+		"iat":   now.Unix(),
+		"nonce": auth.nonce,
+		"email": p.Email,
+	})
+	token.Header["kid"] = keyID
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(res, http.StatusOK, map[string]string{"access_token": randomString(), "token_type": "Bearer", "id_token": idToken})
+}
+
+func (p *Provider) jwks(res http.ResponseWriter, req *http.Request) {
+	writeJSON(res, http.StatusOK, map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"use": "sig",
+		"alg": "RS256",
+		"kid": keyID,
+		"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+	}}})
+}
+
+func writeJSON(res http.ResponseWriter, status int, v any) {
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	_ = json.NewEncoder(res).Encode(v)
+}
+
+func randomString() string {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(random)
+}
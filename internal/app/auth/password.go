@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinPasswordLength - минимальная длина пароля учетной записи.
+const MinPasswordLength = 8
+
+// maxPasswordLength - максимальная длина пароля в байтах, bcrypt не учитывает байты после 72-го.
+const maxPasswordLength = 72
+
+var (
+	// ErrBadEmail - тип ошибки, сигнализирующий о некорректном email.
+	ErrBadEmail = errors.New("bad email")
+	// ErrBadPassword - тип ошибки, сигнализирующий, что пароль слишком короткий или слишком длинный.
+	ErrBadPassword = errors.New("password must be 8 to 72 bytes long")
+	// ErrWrongCredentials - тип ошибки, сигнализирующий о неверном email или пароле.
+	ErrWrongCredentials = errors.New("wrong email or password")
+)
+
+// dummyHash - хеш, с которым сравнивается пароль, если учетной записи нет,
+// чтобы время ответа не выдавало существование email.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
+// NormalizeEmail проверяет email и приводит его к нижнему регистру.
+func NormalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return "", ErrBadEmail
+	}
+	return email, nil
+}
+
+// HashPassword проверяет длину пароля и возвращает его хеш bcrypt.
+func HashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength || len(password) > maxPasswordLength {
+		return "", ErrBadPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword сравнивает пароль с хешем. Пустой хеш (учетной записи нет) сравнивается
+// с фиктивным хешем, чтобы проверка занимала одинаковое время.
+func CheckPassword(hash, password string) error {
+	if hash == "" {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return ErrWrongCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return ErrWrongCredentials
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Роли пользователей.
+const (
+	// RoleUser - обычный пользователь. Есть у всех пользователей, в том числе анонимных.
+	RoleUser = "user"
+	// RoleAdmin - администратор: видит и изменяет URL всех пользователей.
+	RoleAdmin = "admin"
+	// RoleAuditor - аудитор: видит URL и статистику всех пользователей без права изменения.
+	RoleAuditor = "auditor"
+)
+
+// Roles - все роли пользователей.
+var Roles = []string{RoleUser, RoleAdmin, RoleAuditor}
+
+// ErrBadRole - тип ошибки, сигнализирующий о неизвестной роли.
+var ErrBadRole = errors.New("unknown role")
+
+// HasRole проверяет, есть ли у пользователя роль role.
+// Роли действуют только на запросы с токеном: запрос с API ключом выполняется с правами обычного пользователя.
+func (u User) HasRole(role string) bool {
+	if role == RoleUser {
+		return true
+	}
+	return u.APIKeyID == 0 && contains(u.Roles, role)
+}
+
+// PolicyDefault - ключ таблицы доступа с ролями для методов, которых нет в таблице.
+const PolicyDefault = "*"
+
+// Policy - таблица доступа: метод (полное имя метода gRPC или "МЕТОД /шаблон/пути" HTTP)
+// и роли, любой из которых достаточно для вызова. Методы, которых нет в таблице, проверяются
+// по записи PolicyDefault, а если ее нет - доступны всем.
+type Policy map[string][]string
+
+// Allows проверяет, разрешен ли пользователю вызов метода method.
+func (p Policy) Allows(method string, user User) bool {
+	roles, ok := p[method]
+	if !ok {
+		roles, ok = p[PolicyDefault]
+	}
+	if !ok {
+		return true
+	}
+	for _, role := range roles {
+		if user.HasRole(role) {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleBindings - роли, назначенные учетным записям по идентификатору пользователя.
+// Роли не назначаются по email: сервис не проверяет, что email принадлежит пользователю,
+// и любой мог бы зарегистрироваться с email администратора.
+type RoleBindings map[string][]string
+
+// ErrEmailRoleBinding - тип ошибки, сигнализирующий о назначении роли по email.
+var ErrEmailRoleBinding = errors.New("roles can be bound to user IDs only, not emails")
+
+// ParseRoleBindings разбирает назначения ролей вида "идентификатор=роль,идентификатор=роль".
+// Несколько ролей одной учетной записи задаются повторением записи.
+func ParseRoleBindings(spec string) (RoleBindings, error) {
+	bindings := make(RoleBindings)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		subject, role, ok := strings.Cut(entry, "=")
+		subject = strings.ToLower(strings.TrimSpace(subject))
+		role = strings.TrimSpace(role)
+		if !ok || subject == "" {
+			return nil, fmt.Errorf("bad role entry %q, subject=role expected", entry)
+		}
+		if strings.Contains(subject, "@") {
+			return nil, fmt.Errorf("role entry %q: %w", entry, ErrEmailRoleBinding)
+		}
+		if !isRole(role) {
+			return nil, fmt.Errorf("role entry %q: %w", entry, ErrBadRole)
+		}
+		bindings[subject] = append(bindings[subject], role)
+	}
+	return bindings, nil
+}
+
+// For возвращает роли учетной записи с идентификатором userID.
+func (b RoleBindings) For(userID string) []string {
+	var roles []string
+	for _, role := range b[strings.ToLower(userID)] {
+		if role != RoleUser && !contains(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// isRole проверяет, что role - известная роль.
+func isRole(role string) bool {
+	return contains(Roles, role)
+}
+
+// contains проверяет, есть ли значение в слайсе.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRoleBindings(t *testing.T) {
+	bindings, err := ParseRoleBindings("ABC-1=admin, abc-1=auditor,42=auditor,42=user")
+	require.NoError(t, err)
+	assert.Equal(t, []string{RoleAdmin, RoleAuditor}, bindings.For("abc-1"))
+	assert.Equal(t, []string{RoleAuditor}, bindings.For("42"))
+	assert.Empty(t, bindings.For("1"))
+
+	_, err = ParseRoleBindings("42=root")
+	assert.ErrorIs(t, err, ErrBadRole)
+	// Владение email не проверяется, поэтому роли по email не назначаются.
+	_, err = ParseRoleBindings("admin@corp.com=admin")
+	assert.ErrorIs(t, err, ErrEmailRoleBinding)
+	_, err = ParseRoleBindings("admin")
+	assert.Error(t, err)
+}
+
+func TestPolicy(t *testing.T) {
+	policy := Policy{"read": {RoleAdmin, RoleAuditor}, "write": {RoleAdmin}}
+	admin := User{ID: "1", Roles: []string{RoleAdmin}}
+	auditor := User{ID: "2", Roles: []string{RoleAuditor}}
+	user := User{ID: "3"}
+
+	assert.True(t, policy.Allows("read", auditor))
+	assert.False(t, policy.Allows("write", auditor))
+	assert.True(t, policy.Allows("write", admin))
+	assert.False(t, policy.Allows("read", user))
+	assert.True(t, policy.Allows("other", user))
+
+	// Роли не действуют на запросы с API ключом.
+	admin.APIKeyID = 1
+	assert.False(t, policy.Allows("write", admin))
+
+	policy[PolicyDefault] = []string{RoleAdmin}
+	assert.False(t, policy.Allows("other", user))
+}
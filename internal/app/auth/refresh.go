@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/vancho-go/url-shortener/internal/app/models"
+)
+
+// RefreshTokenName - имя cookie (HTTP) и ключа метаданных (gRPC), в которых передается токен обновления.
+const RefreshTokenName = "RefreshToken"
+
+// DefaultRefreshTTL - время действия токена обновления по умолчанию. Отсчитывается от последнего
+// обновления, поэтому сессия активного пользователя не истекает.
+const DefaultRefreshTTL = 30 * 24 * time.Hour
+
+// DefaultSessionCleanupInterval - период удаления истекших токенов обновления из хранилища.
+const DefaultSessionCleanupInterval = time.Hour
+
+var (
+	// ErrInvalidRefreshToken - тип ошибки, сигнализирующий, что токен обновления не найден или истек.
+	ErrInvalidRefreshToken = errors.New("refresh token is not valid")
+	// ErrRefreshTokenReused - тип ошибки, сигнализирующий о повторном использовании токена обновления.
+	// Токен мог быть украден, поэтому вся сессия завершается.
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// RefreshTokenStore - хранилище токенов обновления.
+type RefreshTokenStore interface {
+	// CreateRefreshToken сохраняет токен обновления, вместо самого токена хранится его хеш.
+	CreateRefreshToken(ctx context.Context, token models.RefreshToken, hash string) error
+	// RotateRefreshToken атомарно помечает неиспользованный и неистекший токен hash использованным
+	// и сохраняет токен next с хешем nextHash, копируя в него семейство и пользователя токена hash.
+	// Возвращает токен hash в состоянии до вызова; если токен уже использован или истек, next не сохраняется.
+	// Если токена нет, возвращает nil без ошибки.
+	RotateRefreshToken(ctx context.Context, hash string, next models.RefreshToken, nextHash string) (*models.RefreshToken, error)
+	// GetRefreshTokenByHash извлекает токен обновления по хешу. Если токена нет, возвращает nil без ошибки.
+	GetRefreshTokenByHash(ctx context.Context, hash string) (*models.RefreshToken, error)
+	// DeleteRefreshTokens удаляет все токены семейства familyID.
+	DeleteRefreshTokens(ctx context.Context, familyID string) error
+	// DeleteExpiredRefreshTokens удаляет токены, истекшие до момента before.
+	DeleteExpiredRefreshTokens(ctx context.Context, before time.Time) (int64, error)
+}
+
+// TokenPair - токен доступа и токен обновления, выпущенные вместе.
+// RefreshToken пустой, если сессии не настроены.
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+}
+
+// Sessions - сессии пользователей на основе токенов обновления с ротацией.
+// Каждое обновление заменяет токен новым, а предъявление уже замененного токена
+// считается кражей и завершает всю сессию. Токены доступа, выпущенные в сессии,
+// остаются действительными до истечения своего (короткого) срока, если их не отозвать.
+type Sessions struct {
+	store RefreshTokenStore
+	ttl   time.Duration
+	roles RoleBindings
+}
+
+// NewSessions конструктор Sessions. Если ttl <= 0, используется DefaultRefreshTTL.
+// roles - назначения ролей, по которым роли пользователя определяются заново при каждом обновлении.
+func NewSessions(store RefreshTokenStore, ttl time.Duration, roles RoleBindings) *Sessions {
+	if ttl <= 0 {
+		ttl = DefaultRefreshTTL
+	}
+	return &Sessions{store: store, ttl: ttl, roles: roles}
+}
+
+// TTL возвращает время действия выпускаемых токенов обновления.
+func (s *Sessions) TTL() time.Duration {
+	if s == nil {
+		return 0
+	}
+	return s.ttl
+}
+
+// Start начинает сессию пользователя и возвращает ее идентификатор и первый токен обновления.
+// Если сессии не настроены (s nil), возвращает пустые значения.
+func (s *Sessions) Start(ctx context.Context, user User) (familyID, token string, err error) {
+	if s == nil {
+		return "", "", nil
+	}
+	token, hash, err := generateRefreshToken()
+	if err != nil {
+		return "", "", err
+	}
+	familyID = uuid.New().String()
+	err = s.store.CreateRefreshToken(ctx, models.RefreshToken{
+		FamilyID:   familyID,
+		UserID:     user.ID,
+		Registered: user.Registered,
+		ExpiresAt:  time.Now().Add(s.ttl),
+	}, hash)
+	if err != nil {
+		return "", "", err
+	}
+	return familyID, token, nil
+}
+
+// Rotate обменивает токен обновления на новый токен той же сессии с продленным сроком действия.
+// Возвращает данные нового токена и сам токен. Роли не хранятся в сессии, а определяются
+// по текущим назначениям: иначе снятая роль оставалась бы у активной сессии, пока та продлевается.
+func (s *Sessions) Rotate(ctx context.Context, token string) (*models.RefreshToken, string, error) {
+	if s == nil || token == "" {
+		return nil, "", ErrInvalidRefreshToken
+	}
+	nextToken, nextHash, err := generateRefreshToken()
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now()
+	next := models.RefreshToken{ExpiresAt: now.Add(s.ttl)}
+	previous, err := s.store.RotateRefreshToken(ctx, hashRefreshToken(token), next, nextHash)
+	if err != nil {
+		return nil, "", err
+	}
+	switch {
+	case previous == nil:
+		return nil, "", ErrInvalidRefreshToken
+	case previous.Rotated:
+		if err = s.store.DeleteRefreshTokens(ctx, previous.FamilyID); err != nil {
+			return nil, "", err
+		}
+		return nil, "", ErrRefreshTokenReused
+	case !previous.ExpiresAt.After(now):
+		return nil, "", ErrInvalidRefreshToken
+	}
+	next.FamilyID = previous.FamilyID
+	next.UserID = previous.UserID
+	next.Registered = previous.Registered
+	if next.Registered {
+		next.Roles = s.roles.For(next.UserID)
+	}
+	return &next, nextToken, nil
+}
+
+// End завершает сессию familyID: ее токены обновления больше не принимаются.
+func (s *Sessions) End(ctx context.Context, familyID string) error {
+	if s == nil || familyID == "" {
+		return nil
+	}
+	return s.store.DeleteRefreshTokens(ctx, familyID)
+}
+
+// EndByToken завершает сессию, которой принадлежит токен обновления. Неизвестный токен игнорируется.
+func (s *Sessions) EndByToken(ctx context.Context, token string) error {
+	if s == nil || token == "" {
+		return nil
+	}
+	stored, err := s.store.GetRefreshTokenByHash(ctx, hashRefreshToken(token))
+	if err != nil || stored == nil {
+		return err
+	}
+	return s.store.DeleteRefreshTokens(ctx, stored.FamilyID)
+}
+
+// Run периодически удаляет истекшие токены обновления из хранилища, пока не будет отменен ctx.
+// Ошибки пишутся в log и не останавливают цикл.
+func (s *Sessions) Run(ctx context.Context, interval time.Duration, log *zap.Logger) {
+	if interval <= 0 {
+		interval = DefaultSessionCleanupInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.store.DeleteExpiredRefreshTokens(ctx, time.Now()); err != nil {
+				log.Error("error deleting expired refresh tokens", zap.Error(err))
+			}
+		}
+	}
+}
+
+// generateRefreshToken генерирует токен обновления и его хеш для хранилища.
+func generateRefreshToken() (token, hash string, err error) {
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(secret)
+	return token, hashRefreshToken(token), nil
+}
+
+// hashRefreshToken возвращает хеш токена обновления. Как и API ключ, токен содержит
+// 256 случайных бит, поэтому достаточно SHA-256.
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultRevocationSyncInterval - период синхронизации кеша отозванных токенов с хранилищем.
+const DefaultRevocationSyncInterval = time.Minute
+
+// ErrRevocationDisabled - тип ошибки, сигнализирующий, что отзыв токенов не настроен.
+var ErrRevocationDisabled = errors.New("token revocation is not configured")
+
+// RevocationStore - хранилище списка отозванных токенов.
+type RevocationStore interface {
+	// RevokeToken добавляет токен с идентификатором jti в список отозванных до момента истечения expiresAt.
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	// GetRevokedTokens извлекает неистекшие отозванные токены: jti и время истечения.
+	GetRevokedTokens(ctx context.Context) (map[string]time.Time, error)
+	// DeleteExpiredTokens удаляет из списка токены, истекшие до момента before.
+	DeleteExpiredTokens(ctx context.Context, before time.Time) (int64, error)
+}
+
+// RevocationList - список отозванных токенов с кешем в памяти.
+// Проверка токена выполняется только по кешу, поэтому не нагружает хранилище.
+// Отзыв записывается и в хранилище, и в кеш; токены, отозванные другими экземплярами сервиса,
+// попадают в кеш при синхронизации (см. Run). Истекшие токены удаляются из кеша и хранилища:
+// такие токены и так не пройдут проверку срока действия.
+type RevocationList struct {
+	store RevocationStore
+
+	mu      sync.RWMutex
+	revoked map[string]time.Time
+}
+
+// NewRevocationList конструктор RevocationList. Кеш заполняется из хранилища.
+func NewRevocationList(ctx context.Context, store RevocationStore) (*RevocationList, error) {
+	l := &RevocationList{store: store, revoked: make(map[string]time.Time)}
+	if err := l.sync(ctx); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Revoke отзывает токен с идентификатором jti, действующий до expiresAt.
+func (l *RevocationList) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	if l == nil {
+		return ErrRevocationDisabled
+	}
+	if err := l.store.RevokeToken(ctx, jti, expiresAt); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.revoked[jti] = expiresAt
+	l.mu.Unlock()
+	return nil
+}
+
+// IsRevoked проверяет, отозван ли токен с идентификатором jti.
+func (l *RevocationList) IsRevoked(jti string) bool {
+	if l == nil {
+		return false
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	_, ok := l.revoked[jti]
+	return ok
+}
+
+// Run периодически удаляет истекшие токены из хранилища и перезагружает кеш,
+// пока не будет отменен ctx. Ошибки синхронизации пишутся в log и не останавливают цикл.
+func (l *RevocationList) Run(ctx context.Context, interval time.Duration, log *zap.Logger) {
+	if interval <= 0 {
+		interval = DefaultRevocationSyncInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := l.store.DeleteExpiredTokens(ctx, time.Now()); err != nil {
+				log.Error("error deleting expired revoked tokens", zap.Error(err))
+			}
+			if err := l.sync(ctx); err != nil {
+				log.Error("error loading revoked tokens", zap.Error(err))
+			}
+		}
+	}
+}
+
+// sync заменяет кеш неистекшими отозванными токенами из хранилища.
+func (l *RevocationList) sync(ctx context.Context) error {
+	revoked, err := l.store.GetRevokedTokens(ctx)
+	if err != nil {
+		return err
+	}
+	if revoked == nil {
+		revoked = make(map[string]time.Time)
+	}
+	now := time.Now()
+	for jti, expiresAt := range revoked {
+		if !expiresAt.After(now) {
+			delete(revoked, jti)
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// Токены, отозванные во время загрузки, сохраняются в кеше.
+	for jti, expiresAt := range l.revoked {
+		if expiresAt.After(now) {
+			revoked[jti] = expiresAt
+		}
+	}
+	l.revoked = revoked
+	return nil
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// memoryRevocations - RevocationStore в памяти.
+type memoryRevocations struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+}
+
+func (m *memoryRevocations) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.revoked[jti] = expiresAt
+	return nil
+}
+
+func (m *memoryRevocations) GetRevokedTokens(ctx context.Context) (map[string]time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	revoked := make(map[string]time.Time, len(m.revoked))
+	for jti, expiresAt := range m.revoked {
+		revoked[jti] = expiresAt
+	}
+	return revoked, nil
+}
+
+func (m *memoryRevocations) DeleteExpiredTokens(ctx context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var deleted int64
+	for jti, expiresAt := range m.revoked {
+		if !expiresAt.After(before) {
+			delete(m.revoked, jti)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func TestRevocation(t *testing.T) {
+	ctx := context.Background()
+	store := &memoryRevocations{revoked: map[string]time.Time{
+		"expired": time.Now().Add(-time.Minute),
+		"other":   time.Now().Add(time.Hour),
+	}}
+	revocations, err := NewRevocationList(ctx, store)
+	require.NoError(t, err)
+	assert.True(t, revocations.IsRevoked("other"))
+	assert.False(t, revocations.IsRevoked("expired"))
+
+	keys := NewKeyRing()
+	require.NoError(t, keys.AddSecret(DefaultKeyID, []byte("secret")))
+	manager := NewJWTManager(keys, "", "", time.Hour, revocations, nil)
+
+	token, err := manager.Issue(User{ID: "user"})
+	require.NoError(t, err)
+	user, err := manager.User(token)
+	require.NoError(t, err)
+	require.NotEmpty(t, user.TokenID)
+
+	require.NoError(t, manager.Revoke(ctx, user))
+	_, err = manager.User(token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// Другой экземпляр сервиса узнает об отзыве при синхронизации, истекшие токены удаляются.
+	other, err := NewRevocationList(ctx, store)
+	require.NoError(t, err)
+	assert.True(t, other.IsRevoked(user.TokenID))
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		other.Run(runCtx, 10*time.Millisecond, zap.NewNop())
+		close(done)
+	}()
+	assert.Eventually(t, func() bool {
+		revoked, _ := store.GetRevokedTokens(ctx)
+		_, ok := revoked["expired"]
+		return !ok
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+
+	// Без списка отзыва токен отозвать нельзя.
+	assert.ErrorIs(t, NewJWTManager(keys, "", "", time.Hour, nil, nil).Revoke(ctx, user), ErrRevocationDisabled)
+}
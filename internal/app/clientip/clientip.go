@@ -0,0 +1,168 @@
+// Модуль clientip определяет IP адрес клиента. Если запрос пришел от доверенного прокси,
+// адрес берется из заголовка X-Forwarded-For или Forwarded: цепочка адресов просматривается справа налево
+// до первого адреса, который не принадлежит доверенному прокси. Адресам, которые добавлены до недоверенного
+// узла, верить нельзя: их мог подставить сам клиент.
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+const (
+	// HeaderXForwardedFor - заголовок X-Forwarded-For: адреса через запятую.
+	HeaderXForwardedFor = "X-Forwarded-For"
+	// HeaderForwarded - заголовок Forwarded (RFC 7239): адрес в параметре for.
+	HeaderForwarded = "Forwarded"
+)
+
+// ParsePrefixes разбирает список подсетей (CIDR) и адресов IPv4 и IPv6 через запятую.
+// Адрес без маски - подсеть из одного адреса.
+func ParsePrefixes(spec string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, fmt.Errorf("bad IP address %q", item)
+			}
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("bad subnet %q", item)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// Contains проверяет вхождение адреса addr в одну из подсетей prefixes.
+func Contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolver определяет IP адрес клиента с учетом доверенных прокси.
+// Нулевой (nil) Resolver и Resolver без прокси всегда возвращают адрес соединения.
+type Resolver struct {
+	proxies []netip.Prefix
+	header  string
+}
+
+// New конструктор Resolver. proxies - подсети доверенных прокси, header - заголовок, который они
+// дополняют адресом клиента: HeaderXForwardedFor (по умолчанию) или HeaderForwarded.
+// Учитывается только заголовок header: второй заголовок прокси может пропустить от клиента как есть.
+func New(proxies []netip.Prefix, header string) (*Resolver, error) {
+	switch {
+	case header == "" || strings.EqualFold(header, HeaderXForwardedFor):
+		header = HeaderXForwardedFor
+	case strings.EqualFold(header, HeaderForwarded):
+		header = HeaderForwarded
+	default:
+		return nil, fmt.Errorf("bad trusted proxy header %q, %s or %s expected",
+			header, HeaderXForwardedFor, HeaderForwarded)
+	}
+	return &Resolver{proxies: proxies, header: header}, nil
+}
+
+// Header возвращает заголовок с адресами клиента и прокси.
+func (r *Resolver) Header() string {
+	if r == nil {
+		return HeaderXForwardedFor
+	}
+	return r.header
+}
+
+// Resolve возвращает IP адрес клиента по адресу соединения remoteAddr ("host:port" или адрес)
+// и значениям заголовка Header. Если адрес соединения некорректен, возвращает нулевой netip.Addr.
+func (r *Resolver) Resolve(remoteAddr string, values []string) netip.Addr {
+	addr, ok := parseHost(remoteAddr)
+	if !ok || r == nil || !Contains(r.proxies, addr) {
+		return addr
+	}
+
+	var hops []string
+	for _, value := range values {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if r.header == HeaderForwarded {
+			hop = forwardedFor(hop)
+		}
+		hopAddr, ok := parseHost(hop)
+		if !ok {
+			// Адрес скрыт или испорчен: дальше по цепочке идти нельзя, клиент - последний доверенный прокси.
+			return addr
+		}
+		addr = hopAddr
+		if !Contains(r.proxies, addr) {
+			return addr
+		}
+	}
+	return addr
+}
+
+// FromRequest возвращает IP адрес клиента HTTP запроса.
+func (r *Resolver) FromRequest(req *http.Request) netip.Addr {
+	return r.Resolve(req.RemoteAddr, req.Header.Values(r.Header()))
+}
+
+// parseHost разбирает адрес вида "1.2.3.4", "1.2.3.4:80", "::1", "[::1]" или "[::1]:80".
+func parseHost(host string) (netip.Addr, bool) {
+	host = strings.TrimSpace(host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap().WithZone(""), true
+}
+
+// forwardedFor возвращает значение параметра for элемента заголовка Forwarded
+// (например, `for="[2001:db8::1]:4711";proto=https`).
+func forwardedFor(element string) string {
+	for _, pair := range strings.Split(element, ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok && strings.EqualFold(strings.TrimSpace(name), "for") {
+			return strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return ""
+}
+
+// key - тип ключей context модуля.
+type key int
+
+// addrKey - ключ, по которому IP адрес клиента хранится в context.
+const addrKey key = iota
+
+// NewContext возвращает context с IP адресом клиента.
+func NewContext(ctx context.Context, addr netip.Addr) context.Context {
+	return context.WithValue(ctx, addrKey, addr)
+}
+
+// FromContext извлекает IP адрес клиента из context.
+func FromContext(ctx context.Context) (netip.Addr, bool) {
+	addr, ok := ctx.Value(addrKey).(netip.Addr)
+	return addr, ok && addr.IsValid()
+}
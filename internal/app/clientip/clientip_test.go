@@ -0,0 +1,102 @@
+package clientip
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePrefixes(t *testing.T) {
+	prefixes, err := ParsePrefixes(" 10.0.0.0/8, 192.168.1.7 ,2001:db8::/32,::1,")
+	require.NoError(t, err)
+	assert.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.168.1.7/32"),
+		netip.MustParsePrefix("2001:db8::/32"),
+		netip.MustParsePrefix("::1/128"),
+	}, prefixes)
+
+	prefixes, err = ParsePrefixes("")
+	require.NoError(t, err)
+	assert.Empty(t, prefixes)
+
+	_, err = ParsePrefixes("10.0.0.0/33")
+	assert.Error(t, err)
+	_, err = ParsePrefixes("localhost")
+	assert.Error(t, err)
+
+	prefixes, err = ParsePrefixes("192.168.1.0/24,fd00::/8")
+	require.NoError(t, err)
+	assert.True(t, Contains(prefixes, netip.MustParseAddr("192.168.1.10")))
+	assert.True(t, Contains(prefixes, netip.MustParseAddr("::ffff:192.168.1.10")))
+	assert.True(t, Contains(prefixes, netip.MustParseAddr("fd12::1")))
+	assert.False(t, Contains(prefixes, netip.MustParseAddr("192.168.2.10")))
+	assert.False(t, Contains(nil, netip.MustParseAddr("192.168.1.10")))
+}
+
+func TestResolve(t *testing.T) {
+	proxies, err := ParsePrefixes("10.0.0.0/8,fd00::/8")
+	require.NoError(t, err)
+	xff, err := New(proxies, "")
+	require.NoError(t, err)
+	forwarded, err := New(proxies, "forwarded")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		resolver   *Resolver
+		remoteAddr string
+		values     []string
+		want       string
+	}{
+		{name: "no proxy", resolver: xff, remoteAddr: "203.0.113.5:1234", values: []string{"198.51.100.1"}, want: "203.0.113.5"},
+		{name: "trusted proxy", resolver: xff, remoteAddr: "10.0.0.1:1234", values: []string{"198.51.100.1"}, want: "198.51.100.1"},
+		{name: "proxy chain", resolver: xff, remoteAddr: "10.0.0.1:1234", values: []string{"1.1.1.1, 198.51.100.1, 10.0.0.2"}, want: "198.51.100.1"},
+		{name: "multiple headers", resolver: xff, remoteAddr: "10.0.0.1:1234", values: []string{"1.1.1.1", "198.51.100.1:443"}, want: "198.51.100.1"},
+		{name: "all trusted", resolver: xff, remoteAddr: "10.0.0.1:1234", values: []string{"10.0.0.3, 10.0.0.2"}, want: "10.0.0.3"},
+		{name: "bad hop", resolver: xff, remoteAddr: "10.0.0.1:1234", values: []string{"198.51.100.1, garbage"}, want: "10.0.0.1"},
+		{name: "no header", resolver: xff, remoteAddr: "10.0.0.1:1234", want: "10.0.0.1"},
+		{name: "ipv6", resolver: xff, remoteAddr: "[fd00::1]:1234", values: []string{"[2001:db8::7]:80"}, want: "2001:db8::7"},
+		{name: "ipv4 mapped", resolver: xff, remoteAddr: "[::ffff:10.0.0.1]:1234", values: []string{"::ffff:198.51.100.1"}, want: "198.51.100.1"},
+		{name: "forwarded", resolver: forwarded, remoteAddr: "10.0.0.1:1234",
+			values: []string{`for=1.1.1.1, for="[2001:db8::7]:4711";proto=https, For=10.0.0.2`}, want: "2001:db8::7"},
+		{name: "forwarded unknown", resolver: forwarded, remoteAddr: "10.0.0.1:1234", values: []string{"for=198.51.100.1, for=unknown"}, want: "10.0.0.1"},
+		{name: "nil resolver", remoteAddr: "10.0.0.1:1234", values: []string{"198.51.100.1"}, want: "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.resolver.Resolve(tt.remoteAddr, tt.values).String())
+		})
+	}
+
+	assert.False(t, xff.Resolve("bad", nil).IsValid())
+
+	_, err = New(proxies, "X-Real-IP")
+	assert.Error(t, err)
+}
+
+func TestFromRequest(t *testing.T) {
+	proxies, err := ParsePrefixes("10.0.0.1")
+	require.NoError(t, err)
+	resolver, err := New(proxies, HeaderXForwardedFor)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	// X-Real-IP и Forwarded не учитываются.
+	req.Header.Set("X-Real-IP", "192.168.1.1")
+	req.Header.Set("Forwarded", "for=192.168.1.1")
+	assert.Equal(t, "198.51.100.1", resolver.FromRequest(req).String())
+
+	ctx := NewContext(context.Background(), resolver.FromRequest(req))
+	addr, ok := FromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "198.51.100.1", addr.String())
+	_, ok = FromContext(context.Background())
+	assert.False(t, ok)
+}
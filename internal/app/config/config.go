@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"flag"
 	"os"
+	"strconv"
+	"time"
 )
 
 // JSONConfig - cтруктура, соответствующая JSON файлу.
@@ -15,6 +17,62 @@ type JSONConfig struct {
 	DatabaseDSN     string `json:"database_dsn"`
 	EnableHTTPS     bool   `json:"enable_https"`
 	TrustedSubnet   string `json:"trusted_subnet"`
+	// TrustedProxies и TrustedProxyHeader - доверенные прокси и заголовок, по которому определяется IP адрес клиента.
+	TrustedProxies     string `json:"trusted_proxies"`
+	TrustedProxyHeader string `json:"trusted_proxy_header"`
+	// DebugAccess и DebugAddress - доступ к служебным эндпоинтам и адрес их отдельного сервера.
+	DebugAccess  string `json:"debug_access"`
+	DebugAddress string `json:"debug_address"`
+	// CORSOrigins, CORSMethods, CORSHeaders, CORSCredentials и CORSMaxAge - параметры CORS.
+	CORSOrigins     string `json:"cors_origins"`
+	CORSMethods     string `json:"cors_methods"`
+	CORSHeaders     string `json:"cors_headers"`
+	CORSCredentials bool   `json:"cors_credentials"`
+	CORSMaxAge      string `json:"cors_max_age"`
+	// HSTSMaxAge, ReferrerPolicy, RedirectReferrerPolicy и HTTPRedirectAddress - заголовки безопасности
+	// и перенаправление HTTP на HTTPS.
+	HSTSMaxAge             string `json:"hsts_max_age"`
+	ReferrerPolicy         string `json:"referrer_policy"`
+	RedirectReferrerPolicy string `json:"redirect_referrer_policy"`
+	HTTPRedirectAddress    string `json:"http_redirect_address"`
+	// GRPCBatchSize и GRPCBatchInterval - параметры пакетного сохранения потоковых gRPC запросов.
+	GRPCBatchSize     int    `json:"grpc_batch_size"`
+	GRPCBatchInterval string `json:"grpc_batch_interval"`
+	// AuthSecret, AuthKeys, AuthIssuer, AuthAudience, AuthTokenTTL, AuthRefreshTTL и AuthRoles - параметры токенов аутентификации.
+	AuthSecret     string `json:"auth_secret"`
+	AuthKeys       string `json:"auth_keys"`
+	AuthIssuer     string `json:"auth_issuer"`
+	AuthAudience   string `json:"auth_audience"`
+	AuthTokenTTL   string `json:"auth_token_ttl"`
+	AuthRefreshTTL string `json:"auth_refresh_ttl"`
+	AuthRoles      string `json:"auth_roles"`
+	// CookieSameSite и CookieDomain - атрибуты cookie сервиса.
+	CookieSameSite string `json:"cookie_samesite"`
+	CookieDomain   string `json:"cookie_domain"`
+	// CSRFDisabled - выключить проверку CSRF токена.
+	CSRFDisabled bool `json:"csrf_disabled"`
+	// URLSchemes, URLSortQuery и URLStripTracking - параметры канонизации оригинальных URL.
+	URLSchemes       string `json:"url_schemes"`
+	URLSortQuery     bool   `json:"url_sort_query"`
+	URLStripTracking bool   `json:"url_strip_tracking"`
+	// BlocklistFile, BlocklistReload и ScreeningCacheTTL - параметры проверки оригинальных URL на вредоносность.
+	BlocklistFile     string `json:"blocklist_file"`
+	BlocklistReload   string `json:"blocklist_reload"`
+	ScreeningCacheTTL string `json:"screening_cache_ttl"`
+	// RateLimitCreate, RateLimitRedirect, RateLimitRead и RateLimitAuth - лимиты частоты запросов клиента по классам.
+	RateLimitCreate   string `json:"rate_limit_create"`
+	RateLimitRedirect string `json:"rate_limit_redirect"`
+	RateLimitRead     string `json:"rate_limit_read"`
+	RateLimitAuth     string `json:"rate_limit_auth"`
+	// QuotaDaily и QuotaTotal - квоты пользователя на сокращение URL по умолчанию.
+	QuotaDaily int64 `json:"quota_daily"`
+	QuotaTotal int64 `json:"quota_total"`
+	// AbuseReportThreshold - количество жалоб, после которого URL блокируется автоматически.
+	AbuseReportThreshold int64 `json:"abuse_report_threshold"`
+	// OIDCIssuer, OIDCClientID и OIDCClientSecret - параметры входа через OpenID Connect.
+	OIDCIssuer       string `json:"oidc_issuer"`
+	OIDCClientID     string `json:"oidc_client_id"`
+	OIDCClientSecret string `json:"oidc_client_secret"`
 }
 
 // ServerConfig хранит параметры, необходимые для инициализации сервера.
@@ -31,8 +89,105 @@ type ServerConfig struct {
 	LogLevel string
 	// EnableHTTPS - включение HTTPS в веб-сервере
 	EnableHTTPS bool
-	// TrustedSubnet - доверенная подсеть
+	// TrustedSubnet - доверенные подсети IPv4 и IPv6 через запятую.
 	TrustedSubnet string
+	// TrustedProxies - подсети и адреса доверенных прокси через запятую. IP адрес клиента за доверенными
+	// прокси берется из заголовка TrustedProxyHeader. Пустой - прокси не используются.
+	TrustedProxies string
+	// TrustedProxyHeader - заголовок, который доверенные прокси дополняют адресом клиента:
+	// X-Forwarded-For или Forwarded.
+	TrustedProxyHeader string
+	// DebugAccess - доступ к служебным эндпоинтам (профилирование /debug): off - отключены,
+	// trusted (по умолчанию) - только из доверенных подсетей, admin - только администраторам,
+	// public - всем.
+	DebugAccess string
+	// DebugAddress - адрес отдельного сервера служебных эндпоинтов. Пустой - эндпоинты обслуживает
+	// основной сервер.
+	DebugAddress string
+	// CORSOrigins - источники через запятую, которым разрешены запросы из браузера с других сайтов,
+	// например "https://app.example.com,https://*.example.org". "*" - любой источник. Пустой - CORS выключен.
+	CORSOrigins string
+	// CORSMethods и CORSHeaders - разрешенные методы и заголовки запросов через запятую.
+	// Пустые - методы и заголовки API сервиса.
+	CORSMethods string
+	CORSHeaders string
+	// CORSCredentials - разрешить запросы с cookie. Несовместимо с источником "*".
+	CORSCredentials bool
+	// CORSMaxAge - время, на которое браузер запоминает ответ на предварительный запрос. 0 - по умолчанию браузера.
+	CORSMaxAge time.Duration
+	// HSTSMaxAge - время, на которое браузер запоминает, что сервис доступен только по HTTPS (заголовок
+	// Strict-Transport-Security). Отправляется только в режиме HTTPS. 0 - по умолчанию (год).
+	HSTSMaxAge time.Duration
+	// ReferrerPolicy - заголовок Referrer-Policy ответов сервиса. Пустой - strict-origin-when-cross-origin.
+	ReferrerPolicy string
+	// RedirectReferrerPolicy - заголовок Referrer-Policy перенаправлений на оригинальные URL: определяет,
+	// увидит ли сайт назначения страницу, с которой перешли по сокращенному URL. Пустой - ReferrerPolicy.
+	RedirectReferrerPolicy string
+	// HTTPRedirectAddress - адрес сервера HTTP, который перенаправляет запросы на HTTPS.
+	// Используется только в режиме HTTPS. Пустой - сервер не запускается.
+	HTTPRedirectAddress string
+	// GRPCBatchSize - размер пачки URL, сохраняемой в хранилище при batch и потоковом сокращении через gRPC.
+	GRPCBatchSize int
+	// GRPCBatchInterval - период, через который потоковое gRPC сокращение сохраняет неполную пачку.
+	GRPCBatchInterval time.Duration
+	// AuthSecret - секретный ключ для подписи токенов аутентификации.
+	AuthSecret string
+	// AuthKeys - связка ключей подписи токенов в виде "kid:источник,...", где источник - путь к файлу
+	// или "env:ИМЯ". Первый ключ подписывает новые токены, остальные только проверяют ранее выпущенные.
+	AuthKeys string
+	// AuthIssuer - издатель (iss) токенов аутентификации.
+	AuthIssuer string
+	// AuthAudience - аудитория (aud) токенов аутентификации.
+	AuthAudience string
+	// AuthTokenTTL - время действия токенов аутентификации (токенов доступа).
+	AuthTokenTTL time.Duration
+	// AuthRefreshTTL - время действия токенов обновления, отсчитывается от последнего обновления сессии.
+	AuthRefreshTTL time.Duration
+	// AuthRoles - роли учетных записей в виде "идентификатор=роль,идентификатор=роль".
+	AuthRoles string
+	// CookieSameSite - атрибут SameSite cookie сервиса: lax (по умолчанию), strict или none.
+	// Атрибут Secure включается вместе с HTTPS.
+	CookieSameSite string
+	// CookieDomain - домен cookie сервиса. Пустой - только хост сервиса.
+	CookieDomain string
+	// CSRFDisabled - выключить проверку CSRF токена в изменяющих запросах, аутентифицированных cookie
+	// (см. middlewares.CSRFMiddleware). Нужно клиентам, которые не умеют повторять токен в заголовке.
+	CSRFDisabled bool
+	// URLSchemes - разрешенные схемы оригинальных URL через запятую.
+	URLSchemes string
+	// URLSortQuery - сортировать параметры запроса оригинальных URL при канонизации.
+	URLSortQuery bool
+	// URLStripTracking - удалять параметры отслеживания переходов (utm_*, fbclid и т.п.) из оригинальных URL.
+	URLStripTracking bool
+	// BlocklistFile - путь к файлу списка блокировки оригинальных URL. Пустой - список не используется.
+	BlocklistFile string
+	// BlocklistReload - период проверки изменений файла списка блокировки.
+	BlocklistReload time.Duration
+	// ScreeningCacheTTL - время, на которое запоминаются вердикты внешних сервисов проверки URL при переходах.
+	ScreeningCacheTTL time.Duration
+	// RateLimitCreate - лимит сокращений URL клиента в виде "100/m" или "10/s:50" (см. ratelimit.ParseLimit).
+	// Пустой или "0" - без ограничений.
+	RateLimitCreate string
+	// RateLimitRedirect - лимит переходов по сокращенным URL клиента.
+	RateLimitRedirect string
+	// RateLimitRead - лимит остальных запросов API клиента.
+	RateLimitRead string
+	// RateLimitAuth - лимит входов, регистраций и обновлений сессии с одного IP адреса.
+	RateLimitAuth string
+	// QuotaDaily - сколько URL пользователь может сократить за сутки (UTC). 0 - без ограничений.
+	// Администратор может задать пользователю свои квоты.
+	QuotaDaily int64
+	// QuotaTotal - сколько действующих URL может быть у пользователя. 0 - без ограничений.
+	QuotaTotal int64
+	// AbuseReportThreshold - количество нерассмотренных жалоб разных авторов, после которого URL
+	// блокируется автоматически. 0 - URL блокирует только администратор.
+	AbuseReportThreshold int64
+	// OIDCIssuer - издатель OpenID Connect провайдера. Если пустой, вход через OIDC выключен.
+	OIDCIssuer string
+	// OIDCClientID - идентификатор клиента, зарегистрированного у OIDC провайдера.
+	OIDCClientID string
+	// OIDCClientSecret - секрет клиента OIDC.
+	OIDCClientSecret string
 }
 
 // ServerConfigBuilder - строитель для ServerConfig.
@@ -82,6 +237,127 @@ func (b *serverConfigBuilder) WithTrustedSubnet(trustedSubnet string) *serverCon
 	return b
 }
 
+// WithTrustedProxies задает доверенные прокси и заголовок с адресом клиента.
+func (b *serverConfigBuilder) WithTrustedProxies(proxies, header string) *serverConfigBuilder {
+	b.config.TrustedProxies = proxies
+	b.config.TrustedProxyHeader = header
+	return b
+}
+
+// WithDebug задает доступ к служебным эндпоинтам и адрес их сервера.
+func (b *serverConfigBuilder) WithDebug(access, address string) *serverConfigBuilder {
+	b.config.DebugAccess = access
+	b.config.DebugAddress = address
+	return b
+}
+
+// WithCORS задает параметры CORS.
+func (b *serverConfigBuilder) WithCORS(origins, methods, headers string, credentials bool, maxAge time.Duration) *serverConfigBuilder {
+	b.config.CORSOrigins = origins
+	b.config.CORSMethods = methods
+	b.config.CORSHeaders = headers
+	b.config.CORSCredentials = credentials
+	b.config.CORSMaxAge = maxAge
+	return b
+}
+
+// WithSecurityHeaders задает заголовки безопасности ответов.
+func (b *serverConfigBuilder) WithSecurityHeaders(hstsMaxAge time.Duration, referrerPolicy, redirectReferrerPolicy string) *serverConfigBuilder {
+	b.config.HSTSMaxAge = hstsMaxAge
+	b.config.ReferrerPolicy = referrerPolicy
+	b.config.RedirectReferrerPolicy = redirectReferrerPolicy
+	return b
+}
+
+// WithHTTPRedirect задает адрес сервера HTTP, который перенаправляет запросы на HTTPS.
+func (b *serverConfigBuilder) WithHTTPRedirect(address string) *serverConfigBuilder {
+	b.config.HTTPRedirectAddress = address
+	return b
+}
+
+// WithGRPCBatch задает параметры пакетного сохранения для gRPC.
+func (b *serverConfigBuilder) WithGRPCBatch(size int, interval time.Duration) *serverConfigBuilder {
+	b.config.GRPCBatchSize = size
+	b.config.GRPCBatchInterval = interval
+	return b
+}
+
+// WithAuth задает параметры токенов аутентификации.
+func (b *serverConfigBuilder) WithAuth(secret, keys, issuer, audience string, ttl, refreshTTL time.Duration) *serverConfigBuilder {
+	b.config.AuthSecret = secret
+	b.config.AuthKeys = keys
+	b.config.AuthIssuer = issuer
+	b.config.AuthAudience = audience
+	b.config.AuthTokenTTL = ttl
+	b.config.AuthRefreshTTL = refreshTTL
+	return b
+}
+
+// WithRoles задает роли учетных записей.
+func (b *serverConfigBuilder) WithRoles(roles string) *serverConfigBuilder {
+	b.config.AuthRoles = roles
+	return b
+}
+
+// WithCookies задает атрибуты cookie.
+func (b *serverConfigBuilder) WithCookies(sameSite, domain string) *serverConfigBuilder {
+	b.config.CookieSameSite = sameSite
+	b.config.CookieDomain = domain
+	return b
+}
+
+// WithCSRF задает выключение проверки CSRF токена.
+func (b *serverConfigBuilder) WithCSRF(disabled bool) *serverConfigBuilder {
+	b.config.CSRFDisabled = disabled
+	return b
+}
+
+// WithURLNormalization задает параметры канонизации оригинальных URL.
+func (b *serverConfigBuilder) WithURLNormalization(schemes string, sortQuery, stripTracking bool) *serverConfigBuilder {
+	b.config.URLSchemes = schemes
+	b.config.URLSortQuery = sortQuery
+	b.config.URLStripTracking = stripTracking
+	return b
+}
+
+// WithScreening задает параметры проверки оригинальных URL на вредоносность.
+func (b *serverConfigBuilder) WithScreening(blocklistFile string, blocklistReload, cacheTTL time.Duration) *serverConfigBuilder {
+	b.config.BlocklistFile = blocklistFile
+	b.config.BlocklistReload = blocklistReload
+	b.config.ScreeningCacheTTL = cacheTTL
+	return b
+}
+
+// WithRateLimits задает лимиты частоты запросов клиента.
+func (b *serverConfigBuilder) WithRateLimits(create, redirect, read, auth string) *serverConfigBuilder {
+	b.config.RateLimitCreate = create
+	b.config.RateLimitRedirect = redirect
+	b.config.RateLimitRead = read
+	b.config.RateLimitAuth = auth
+	return b
+}
+
+// WithQuotas задает квоты пользователя на сокращение URL по умолчанию.
+func (b *serverConfigBuilder) WithQuotas(daily, total int64) *serverConfigBuilder {
+	b.config.QuotaDaily = daily
+	b.config.QuotaTotal = total
+	return b
+}
+
+// WithAbuseReports задает порог автоматической блокировки URL по жалобам.
+func (b *serverConfigBuilder) WithAbuseReports(threshold int64) *serverConfigBuilder {
+	b.config.AbuseReportThreshold = threshold
+	return b
+}
+
+// WithOIDC задает параметры входа через OpenID Connect.
+func (b *serverConfigBuilder) WithOIDC(issuer, clientID, clientSecret string) *serverConfigBuilder {
+	b.config.OIDCIssuer = issuer
+	b.config.OIDCClientID = clientID
+	b.config.OIDCClientSecret = clientSecret
+	return b
+}
+
 // ParseServer генерирует конфигурацию для инициализации сервера.
 func ParseServer() (*ServerConfig, error) {
 	var serverHost string
@@ -107,7 +383,130 @@ func ParseServer() (*ServerConfig, error) {
 	flag.StringVar(&jsonConfigFile, "config", "", "path for json config file")
 
 	var trustedSubnet string
-	flag.StringVar(&trustedSubnet, "t", "192.168.1.0/24", "trusted subnet for server")
+	flag.StringVar(&trustedSubnet, "t", "192.168.1.0/24", "trusted subnets for server (IPv4 and IPv6 CIDRs), comma separated")
+
+	var debugAccess string
+	flag.StringVar(&debugAccess, "debug-access", "", "access to debug endpoints: off, trusted (default, trusted subnets only), admin or public")
+
+	var debugAddress string
+	flag.StringVar(&debugAddress, "debug-address", "", "separate listen address for debug endpoints (served by the main server if empty)")
+
+	var corsOrigins string
+	flag.StringVar(&corsOrigins, "cors-origins", "", "origins allowed to make cross-origin requests, comma separated, wildcards like https://*.example.com (CORS is disabled if empty)")
+
+	var corsMethods string
+	flag.StringVar(&corsMethods, "cors-methods", "", "methods allowed in cross-origin requests, comma separated (API methods if empty)")
+
+	var corsHeaders string
+	flag.StringVar(&corsHeaders, "cors-headers", "", "headers allowed in cross-origin requests, comma separated (API headers if empty)")
+
+	var corsCredentials bool
+	flag.BoolVar(&corsCredentials, "cors-credentials", false, "allow cross-origin requests with cookies")
+
+	var corsMaxAge time.Duration
+	flag.DurationVar(&corsMaxAge, "cors-max-age", 0, "how long browsers may cache preflight responses (browser default if 0)")
+
+	var hstsMaxAge time.Duration
+	flag.DurationVar(&hstsMaxAge, "hsts-max-age", 0, "max-age of Strict-Transport-Security header in HTTPS mode (one year if 0)")
+
+	var referrerPolicy string
+	flag.StringVar(&referrerPolicy, "referrer-policy", "", "Referrer-Policy header of responses (strict-origin-when-cross-origin if empty)")
+
+	var redirectReferrerPolicy string
+	flag.StringVar(&redirectReferrerPolicy, "redirect-referrer-policy", "", "Referrer-Policy header of redirects to original URLs, e.g. no-referrer (same as -referrer-policy if empty)")
+
+	var httpRedirectAddress string
+	flag.StringVar(&httpRedirectAddress, "http-redirect-address", "", "listen address of plain HTTP server redirecting to HTTPS in HTTPS mode, e.g. :80 (disabled if empty)")
+
+	var trustedProxies string
+	flag.StringVar(&trustedProxies, "trusted-proxies", "", "trusted reverse proxies as CIDRs or IPs, comma separated (client IP is taken from RemoteAddr if empty)")
+
+	var trustedProxyHeader string
+	flag.StringVar(&trustedProxyHeader, "trusted-proxy-header", "", "header appended by trusted proxies: X-Forwarded-For (default) or Forwarded")
+
+	var grpcBatchSize int
+	flag.IntVar(&grpcBatchSize, "grpc-batch-size", 100, "batch size for storing urls from gRPC streams")
+
+	var grpcBatchInterval time.Duration
+	flag.DurationVar(&grpcBatchInterval, "grpc-batch-interval", time.Second, "flush interval for incomplete gRPC stream batches")
+
+	var authSecret string
+	flag.StringVar(&authSecret, "auth-secret", "", "secret key for signing auth tokens (random if empty)")
+
+	var authKeys string
+	flag.StringVar(&authKeys, "auth-keys", "", "auth token signing keys as kid:path or kid:env:NAME, comma separated, active first")
+
+	var authIssuer string
+	flag.StringVar(&authIssuer, "auth-issuer", "", "issuer of auth tokens")
+
+	var authAudience string
+	flag.StringVar(&authAudience, "auth-audience", "", "audience of auth tokens")
+
+	var authTokenTTL time.Duration
+	flag.DurationVar(&authTokenTTL, "auth-token-ttl", 15*time.Minute, "lifetime of auth (access) tokens")
+
+	var authRefreshTTL time.Duration
+	flag.DurationVar(&authRefreshTTL, "auth-refresh-ttl", 30*24*time.Hour, "lifetime of refresh tokens, extended on every refresh")
+
+	var authRoles string
+	flag.StringVar(&authRoles, "auth-roles", "", "account roles as user_id=role, comma separated (roles: admin, auditor)")
+
+	var cookieSameSite string
+	flag.StringVar(&cookieSameSite, "cookie-samesite", "", "SameSite attribute of cookies: lax (default), strict or none (requires HTTPS)")
+
+	var cookieDomain string
+	flag.StringVar(&cookieDomain, "cookie-domain", "", "domain attribute of cookies (current host if empty)")
+
+	var csrfDisabled bool
+	flag.BoolVar(&csrfDisabled, "csrf-disabled", false, "disable CSRF token check of cookie-authenticated requests")
+
+	var urlSchemes string
+	flag.StringVar(&urlSchemes, "url-schemes", "http,https", "allowed schemes of original URLs, comma separated")
+
+	var urlSortQuery bool
+	flag.BoolVar(&urlSortQuery, "url-sort-query", false, "sort query parameters of original URLs")
+
+	var urlStripTracking bool
+	flag.BoolVar(&urlStripTracking, "url-strip-tracking", false, "remove tracking query parameters (utm_*, fbclid, gclid, ...) from original URLs")
+
+	var blocklistFile string
+	flag.StringVar(&blocklistFile, "blocklist-file", "", "path to blocklist of malicious domains and regex: patterns (disabled if empty)")
+
+	var blocklistReload time.Duration
+	flag.DurationVar(&blocklistReload, "blocklist-reload", time.Minute, "interval of checking the blocklist file for changes")
+
+	var screeningCacheTTL time.Duration
+	flag.DurationVar(&screeningCacheTTL, "screening-cache-ttl", 10*time.Minute, "lifetime of cached URL reputation verdicts used on redirects")
+
+	var rateLimitCreate string
+	flag.StringVar(&rateLimitCreate, "rate-limit-create", "60/m", "per-client limit of URL shortening requests as N/period[:burst], 0 to disable")
+
+	var rateLimitRedirect string
+	flag.StringVar(&rateLimitRedirect, "rate-limit-redirect", "600/m", "per-client limit of redirects as N/period[:burst], 0 to disable")
+
+	var rateLimitRead string
+	flag.StringVar(&rateLimitRead, "rate-limit-read", "300/m", "per-client limit of other API requests as N/period[:burst], 0 to disable")
+
+	var rateLimitAuth string
+	flag.StringVar(&rateLimitAuth, "rate-limit-auth", "10/m", "per-IP limit of sign in, sign up and session refresh requests as N/period[:burst], 0 to disable")
+
+	var quotaDaily int64
+	flag.Int64Var(&quotaDaily, "quota-daily", 0, "default number of URLs a user can shorten per day (UTC), 0 to disable")
+
+	var quotaTotal int64
+	flag.Int64Var(&quotaTotal, "quota-total", 0, "default number of active URLs a user can have, 0 to disable")
+
+	var abuseReportThreshold int64
+	flag.Int64Var(&abuseReportThreshold, "abuse-report-threshold", 5, "number of independent abuse reports that disables a short URL, 0 to disable")
+
+	var oidcIssuer string
+	flag.StringVar(&oidcIssuer, "oidc-issuer", "", "OpenID Connect issuer URL (OIDC login is disabled if empty)")
+
+	var oidcClientID string
+	flag.StringVar(&oidcClientID, "oidc-client-id", "", "OpenID Connect client ID")
+
+	var oidcClientSecret string
+	flag.StringVar(&oidcClientSecret, "oidc-client-secret", "", "OpenID Connect client secret")
 
 	flag.Parse()
 
@@ -143,6 +542,214 @@ func ParseServer() (*ServerConfig, error) {
 		trustedSubnet = envTrustedSubnet
 	}
 
+	if envDebugAccess := os.Getenv("DEBUG_ACCESS"); envDebugAccess != "" {
+		debugAccess = envDebugAccess
+	}
+
+	if envDebugAddress := os.Getenv("DEBUG_ADDRESS"); envDebugAddress != "" {
+		debugAddress = envDebugAddress
+	}
+
+	if envCORSOrigins := os.Getenv("CORS_ORIGINS"); envCORSOrigins != "" {
+		corsOrigins = envCORSOrigins
+	}
+
+	if envCORSMethods := os.Getenv("CORS_METHODS"); envCORSMethods != "" {
+		corsMethods = envCORSMethods
+	}
+
+	if envCORSHeaders := os.Getenv("CORS_HEADERS"); envCORSHeaders != "" {
+		corsHeaders = envCORSHeaders
+	}
+
+	if envCORSCredentials := os.Getenv("CORS_CREDENTIALS"); envCORSCredentials == "1" {
+		corsCredentials = true
+	}
+
+	if envCORSMaxAge := os.Getenv("CORS_MAX_AGE"); envCORSMaxAge != "" {
+		maxAge, err := time.ParseDuration(envCORSMaxAge)
+		if err != nil {
+			return nil, err
+		}
+		corsMaxAge = maxAge
+	}
+
+	if envHSTSMaxAge := os.Getenv("HSTS_MAX_AGE"); envHSTSMaxAge != "" {
+		maxAge, err := time.ParseDuration(envHSTSMaxAge)
+		if err != nil {
+			return nil, err
+		}
+		hstsMaxAge = maxAge
+	}
+
+	if envReferrerPolicy := os.Getenv("REFERRER_POLICY"); envReferrerPolicy != "" {
+		referrerPolicy = envReferrerPolicy
+	}
+
+	if envRedirectReferrerPolicy := os.Getenv("REDIRECT_REFERRER_POLICY"); envRedirectReferrerPolicy != "" {
+		redirectReferrerPolicy = envRedirectReferrerPolicy
+	}
+
+	if envHTTPRedirectAddress := os.Getenv("HTTP_REDIRECT_ADDRESS"); envHTTPRedirectAddress != "" {
+		httpRedirectAddress = envHTTPRedirectAddress
+	}
+
+	if envTrustedProxies := os.Getenv("TRUSTED_PROXIES"); envTrustedProxies != "" {
+		trustedProxies = envTrustedProxies
+	}
+
+	if envTrustedProxyHeader := os.Getenv("TRUSTED_PROXY_HEADER"); envTrustedProxyHeader != "" {
+		trustedProxyHeader = envTrustedProxyHeader
+	}
+
+	if envGRPCBatchSize := os.Getenv("GRPC_BATCH_SIZE"); envGRPCBatchSize != "" {
+		size, err := strconv.Atoi(envGRPCBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		grpcBatchSize = size
+	}
+
+	if envGRPCBatchInterval := os.Getenv("GRPC_BATCH_INTERVAL"); envGRPCBatchInterval != "" {
+		interval, err := time.ParseDuration(envGRPCBatchInterval)
+		if err != nil {
+			return nil, err
+		}
+		grpcBatchInterval = interval
+	}
+
+	if envAuthSecret := os.Getenv("AUTH_SECRET"); envAuthSecret != "" {
+		authSecret = envAuthSecret
+	}
+
+	if envAuthKeys := os.Getenv("AUTH_KEYS"); envAuthKeys != "" {
+		authKeys = envAuthKeys
+	}
+
+	if envAuthIssuer := os.Getenv("AUTH_ISSUER"); envAuthIssuer != "" {
+		authIssuer = envAuthIssuer
+	}
+
+	if envAuthAudience := os.Getenv("AUTH_AUDIENCE"); envAuthAudience != "" {
+		authAudience = envAuthAudience
+	}
+
+	if envAuthTokenTTL := os.Getenv("AUTH_TOKEN_TTL"); envAuthTokenTTL != "" {
+		ttl, err := time.ParseDuration(envAuthTokenTTL)
+		if err != nil {
+			return nil, err
+		}
+		authTokenTTL = ttl
+	}
+
+	if envAuthRefreshTTL := os.Getenv("AUTH_REFRESH_TTL"); envAuthRefreshTTL != "" {
+		ttl, err := time.ParseDuration(envAuthRefreshTTL)
+		if err != nil {
+			return nil, err
+		}
+		authRefreshTTL = ttl
+	}
+
+	if envAuthRoles := os.Getenv("AUTH_ROLES"); envAuthRoles != "" {
+		authRoles = envAuthRoles
+	}
+
+	if envCookieSameSite := os.Getenv("COOKIE_SAMESITE"); envCookieSameSite != "" {
+		cookieSameSite = envCookieSameSite
+	}
+
+	if envCookieDomain := os.Getenv("COOKIE_DOMAIN"); envCookieDomain != "" {
+		cookieDomain = envCookieDomain
+	}
+
+	if envCSRFDisabled := os.Getenv("CSRF_DISABLED"); envCSRFDisabled == "1" {
+		csrfDisabled = true
+	}
+
+	if envURLSchemes := os.Getenv("URL_SCHEMES"); envURLSchemes != "" {
+		urlSchemes = envURLSchemes
+	}
+
+	if envURLSortQuery := os.Getenv("URL_SORT_QUERY"); envURLSortQuery == "1" {
+		urlSortQuery = true
+	}
+
+	if envURLStripTracking := os.Getenv("URL_STRIP_TRACKING"); envURLStripTracking == "1" {
+		urlStripTracking = true
+	}
+
+	if envBlocklistFile := os.Getenv("BLOCKLIST_FILE"); envBlocklistFile != "" {
+		blocklistFile = envBlocklistFile
+	}
+
+	if envBlocklistReload := os.Getenv("BLOCKLIST_RELOAD"); envBlocklistReload != "" {
+		interval, err := time.ParseDuration(envBlocklistReload)
+		if err != nil {
+			return nil, err
+		}
+		blocklistReload = interval
+	}
+
+	if envScreeningCacheTTL := os.Getenv("SCREENING_CACHE_TTL"); envScreeningCacheTTL != "" {
+		ttl, err := time.ParseDuration(envScreeningCacheTTL)
+		if err != nil {
+			return nil, err
+		}
+		screeningCacheTTL = ttl
+	}
+
+	if envRateLimitCreate := os.Getenv("RATE_LIMIT_CREATE"); envRateLimitCreate != "" {
+		rateLimitCreate = envRateLimitCreate
+	}
+
+	if envRateLimitRedirect := os.Getenv("RATE_LIMIT_REDIRECT"); envRateLimitRedirect != "" {
+		rateLimitRedirect = envRateLimitRedirect
+	}
+
+	if envRateLimitRead := os.Getenv("RATE_LIMIT_READ"); envRateLimitRead != "" {
+		rateLimitRead = envRateLimitRead
+	}
+
+	if envRateLimitAuth := os.Getenv("RATE_LIMIT_AUTH"); envRateLimitAuth != "" {
+		rateLimitAuth = envRateLimitAuth
+	}
+
+	if envQuotaDaily := os.Getenv("QUOTA_DAILY"); envQuotaDaily != "" {
+		quota, err := strconv.ParseInt(envQuotaDaily, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		quotaDaily = quota
+	}
+
+	if envQuotaTotal := os.Getenv("QUOTA_TOTAL"); envQuotaTotal != "" {
+		quota, err := strconv.ParseInt(envQuotaTotal, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		quotaTotal = quota
+	}
+
+	if envAbuseReportThreshold := os.Getenv("ABUSE_REPORT_THRESHOLD"); envAbuseReportThreshold != "" {
+		threshold, err := strconv.ParseInt(envAbuseReportThreshold, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		abuseReportThreshold = threshold
+	}
+
+	if envOIDCIssuer := os.Getenv("OIDC_ISSUER"); envOIDCIssuer != "" {
+		oidcIssuer = envOIDCIssuer
+	}
+
+	if envOIDCClientID := os.Getenv("OIDC_CLIENT_ID"); envOIDCClientID != "" {
+		oidcClientID = envOIDCClientID
+	}
+
+	if envOIDCClientSecret := os.Getenv("OIDC_CLIENT_SECRET"); envOIDCClientSecret != "" {
+		oidcClientSecret = envOIDCClientSecret
+	}
+
 	if jsonConfigFile != "" {
 		jsonConfig, err := parseJSONConfig(jsonConfigFile)
 		if err != nil {
@@ -167,6 +774,157 @@ func ParseServer() (*ServerConfig, error) {
 		if trustedSubnet == "" {
 			trustedSubnet = jsonConfig.TrustedSubnet
 		}
+		if debugAccess == "" {
+			debugAccess = jsonConfig.DebugAccess
+		}
+		if debugAddress == "" {
+			debugAddress = jsonConfig.DebugAddress
+		}
+		if corsOrigins == "" {
+			corsOrigins = jsonConfig.CORSOrigins
+		}
+		if corsMethods == "" {
+			corsMethods = jsonConfig.CORSMethods
+		}
+		if corsHeaders == "" {
+			corsHeaders = jsonConfig.CORSHeaders
+		}
+		if !corsCredentials && jsonConfig.CORSCredentials {
+			corsCredentials = jsonConfig.CORSCredentials
+		}
+		if corsMaxAge == 0 && jsonConfig.CORSMaxAge != "" {
+			maxAge, err := time.ParseDuration(jsonConfig.CORSMaxAge)
+			if err != nil {
+				return nil, err
+			}
+			corsMaxAge = maxAge
+		}
+		if hstsMaxAge == 0 && jsonConfig.HSTSMaxAge != "" {
+			maxAge, err := time.ParseDuration(jsonConfig.HSTSMaxAge)
+			if err != nil {
+				return nil, err
+			}
+			hstsMaxAge = maxAge
+		}
+		if referrerPolicy == "" {
+			referrerPolicy = jsonConfig.ReferrerPolicy
+		}
+		if redirectReferrerPolicy == "" {
+			redirectReferrerPolicy = jsonConfig.RedirectReferrerPolicy
+		}
+		if httpRedirectAddress == "" {
+			httpRedirectAddress = jsonConfig.HTTPRedirectAddress
+		}
+		if trustedProxies == "" {
+			trustedProxies = jsonConfig.TrustedProxies
+		}
+		if trustedProxyHeader == "" {
+			trustedProxyHeader = jsonConfig.TrustedProxyHeader
+		}
+		if grpcBatchSize == 0 {
+			grpcBatchSize = jsonConfig.GRPCBatchSize
+		}
+		if grpcBatchInterval == 0 && jsonConfig.GRPCBatchInterval != "" {
+			interval, err := time.ParseDuration(jsonConfig.GRPCBatchInterval)
+			if err != nil {
+				return nil, err
+			}
+			grpcBatchInterval = interval
+		}
+		if authSecret == "" {
+			authSecret = jsonConfig.AuthSecret
+		}
+		if authKeys == "" {
+			authKeys = jsonConfig.AuthKeys
+		}
+		if authIssuer == "" {
+			authIssuer = jsonConfig.AuthIssuer
+		}
+		if authAudience == "" {
+			authAudience = jsonConfig.AuthAudience
+		}
+		if authTokenTTL == 0 && jsonConfig.AuthTokenTTL != "" {
+			ttl, err := time.ParseDuration(jsonConfig.AuthTokenTTL)
+			if err != nil {
+				return nil, err
+			}
+			authTokenTTL = ttl
+		}
+		if authRefreshTTL == 0 && jsonConfig.AuthRefreshTTL != "" {
+			ttl, err := time.ParseDuration(jsonConfig.AuthRefreshTTL)
+			if err != nil {
+				return nil, err
+			}
+			authRefreshTTL = ttl
+		}
+		if authRoles == "" {
+			authRoles = jsonConfig.AuthRoles
+		}
+		if cookieSameSite == "" {
+			cookieSameSite = jsonConfig.CookieSameSite
+		}
+		if cookieDomain == "" {
+			cookieDomain = jsonConfig.CookieDomain
+		}
+		if !csrfDisabled && jsonConfig.CSRFDisabled {
+			csrfDisabled = jsonConfig.CSRFDisabled
+		}
+		if urlSchemes == "" {
+			urlSchemes = jsonConfig.URLSchemes
+		}
+		if !urlSortQuery && jsonConfig.URLSortQuery {
+			urlSortQuery = jsonConfig.URLSortQuery
+		}
+		if !urlStripTracking && jsonConfig.URLStripTracking {
+			urlStripTracking = jsonConfig.URLStripTracking
+		}
+		if blocklistFile == "" {
+			blocklistFile = jsonConfig.BlocklistFile
+		}
+		if blocklistReload == 0 && jsonConfig.BlocklistReload != "" {
+			interval, err := time.ParseDuration(jsonConfig.BlocklistReload)
+			if err != nil {
+				return nil, err
+			}
+			blocklistReload = interval
+		}
+		if screeningCacheTTL == 0 && jsonConfig.ScreeningCacheTTL != "" {
+			ttl, err := time.ParseDuration(jsonConfig.ScreeningCacheTTL)
+			if err != nil {
+				return nil, err
+			}
+			screeningCacheTTL = ttl
+		}
+		if rateLimitCreate == "" {
+			rateLimitCreate = jsonConfig.RateLimitCreate
+		}
+		if rateLimitRedirect == "" {
+			rateLimitRedirect = jsonConfig.RateLimitRedirect
+		}
+		if rateLimitRead == "" {
+			rateLimitRead = jsonConfig.RateLimitRead
+		}
+		if rateLimitAuth == "" {
+			rateLimitAuth = jsonConfig.RateLimitAuth
+		}
+		if quotaDaily == 0 {
+			quotaDaily = jsonConfig.QuotaDaily
+		}
+		if quotaTotal == 0 {
+			quotaTotal = jsonConfig.QuotaTotal
+		}
+		if abuseReportThreshold == 0 {
+			abuseReportThreshold = jsonConfig.AbuseReportThreshold
+		}
+		if oidcIssuer == "" {
+			oidcIssuer = jsonConfig.OIDCIssuer
+		}
+		if oidcClientID == "" {
+			oidcClientID = jsonConfig.OIDCClientID
+		}
+		if oidcClientSecret == "" {
+			oidcClientSecret = jsonConfig.OIDCClientSecret
+		}
 	}
 
 	var builder serverConfigBuilder
@@ -177,7 +935,23 @@ func ParseServer() (*ServerConfig, error) {
 		WithDSN(dsn).
 		WithLogLevel(logLevel).
 		WithHTTPS(enableHTTPS).
-		WithTrustedSubnet(trustedSubnet)
+		WithTrustedSubnet(trustedSubnet).
+		WithTrustedProxies(trustedProxies, trustedProxyHeader).
+		WithDebug(debugAccess, debugAddress).
+		WithCORS(corsOrigins, corsMethods, corsHeaders, corsCredentials, corsMaxAge).
+		WithSecurityHeaders(hstsMaxAge, referrerPolicy, redirectReferrerPolicy).
+		WithHTTPRedirect(httpRedirectAddress).
+		WithGRPCBatch(grpcBatchSize, grpcBatchInterval).
+		WithAuth(authSecret, authKeys, authIssuer, authAudience, authTokenTTL, authRefreshTTL).
+		WithRoles(authRoles).
+		WithCookies(cookieSameSite, cookieDomain).
+		WithCSRF(csrfDisabled).
+		WithURLNormalization(urlSchemes, urlSortQuery, urlStripTracking).
+		WithScreening(blocklistFile, blocklistReload, screeningCacheTTL).
+		WithRateLimits(rateLimitCreate, rateLimitRedirect, rateLimitRead, rateLimitAuth).
+		WithQuotas(quotaDaily, quotaTotal).
+		WithAbuseReports(abuseReportThreshold).
+		WithOIDC(oidcIssuer, oidcClientID, oidcClientSecret)
 
 	return &builder.config, nil
 }
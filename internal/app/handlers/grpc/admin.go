@@ -0,0 +1,153 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/vancho-go/url-shortener/internal/app/auth"
+	"github.com/vancho-go/url-shortener/internal/app/handlers/http/middlewares"
+	"github.com/vancho-go/url-shortener/internal/app/models"
+	"github.com/vancho-go/url-shortener/internal/app/storage"
+	"github.com/vancho-go/url-shortener/pkg/proto"
+)
+
+// AdminListURLs возвращает URL всех пользователей постранично.
+func (s *URLShortenerServer) AdminListURLs(ctx context.Context, in *proto.AdminListURLsRequest) (*proto.AdminListURLsResponse, error) {
+	if in.Limit < 0 {
+		return nil, status.Error(codes.InvalidArgument, "bad limit")
+	}
+	filter := models.UserURLsFilter{
+		Limit:  pageSize(in.Limit),
+		Cursor: in.Cursor,
+		Desc:   in.Desc,
+		Domain: in.Domain,
+		Search: in.Search,
+	}
+
+	ctxWT, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	page, err := s.db.GetAllURLs(ctxWT, filter)
+	if err != nil {
+		if errors.Is(err, storage.ErrInvalidCursor) {
+			return nil, status.Error(codes.InvalidArgument, "bad cursor")
+		}
+		return nil, storageError(err)
+	}
+
+	resp := proto.AdminListURLsResponse{NextCursor: page.NextCursor}
+	for _, url := range page.URLs {
+		resp.Result = append(resp.Result, &proto.AdminListURLsResponse_Res{
+			ShortUrl:    s.addr + "/" + url.ShortenURL,
+			OriginalUrl: url.OriginalURL,
+			UserId:      url.UserID,
+			CreatedAt:   url.CreatedAt.Unix(),
+			Deleted:     url.Deleted,
+			Disabled:    url.Disabled,
+		})
+	}
+	return &resp, nil
+}
+
+// AdminSetURLDisabled блокирует или разблокирует URL любого пользователя.
+// Причина блокировки - пустая или models.DisabledReasonAbuse. Разблокировка закрывает жалобы на URL.
+func (s *URLShortenerServer) AdminSetURLDisabled(ctx context.Context, in *proto.AdminSetURLDisabledRequest) (*emptypb.Empty, error) {
+	if in.Reason != "" && in.Reason != models.DisabledReasonAbuse {
+		return nil, status.Error(codes.InvalidArgument, "bad reason")
+	}
+	ctxWT, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	if err := s.db.SetURLDisabled(ctxWT, in.ShortUrl, in.Disabled, in.Reason); err != nil {
+		return nil, storageError(err)
+	}
+	user, _ := auth.FromContext(ctx)
+	middlewares.Log.Info("url disabled by admin", zap.String("admin", user.ID),
+		zap.String("url", in.ShortUrl), zap.Bool("disabled", in.Disabled), zap.String("reason", in.Reason))
+	return &emptypb.Empty{}, nil
+}
+
+// AdminDeleteUserURLs удаляет URL любого пользователя.
+func (s *URLShortenerServer) AdminDeleteUserURLs(ctx context.Context, in *proto.AdminDeleteUserURLsRequest) (*emptypb.Empty, error) {
+	if in.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	urlsToDelete := make([]models.DeleteURLRequest, len(in.Urls))
+	for pos, url := range in.Urls {
+		urlsToDelete[pos].ShortenURL = url
+		urlsToDelete[pos].UserID = in.UserId
+	}
+
+	ctxWT, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	if err := s.db.DeleteUserURLs(ctxWT, urlsToDelete...); err != nil {
+		return nil, storageError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// AdminGetUserStats возвращает статистику URL любого пользователя.
+func (s *URLShortenerServer) AdminGetUserStats(ctx context.Context, in *proto.AdminGetUserStatsRequest) (*proto.AdminGetUserStatsResponse, error) {
+	ctxWT, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	stats, err := s.db.GetUserStats(ctxWT, in.UserId)
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return &proto.AdminGetUserStatsResponse{
+		Urls:     int64(stats.URLs),
+		Deleted:  int64(stats.Deleted),
+		Disabled: int64(stats.Disabled),
+	}, nil
+}
+
+// AdminGetUserQuota возвращает квоты любого пользователя и их текущее использование.
+func (s *URLShortenerServer) AdminGetUserQuota(ctx context.Context, in *proto.AdminGetUserQuotaRequest) (*proto.GetQuotaResponse, error) {
+	if in.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	ctxWT, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	quota, err := s.db.GetQuota(ctxWT, in.UserId)
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return quotaResponse(quota), nil
+}
+
+// AdminSetUserQuota задает квоты любого пользователя вместо квот по умолчанию.
+// Нулевая квота снимает ограничение.
+func (s *URLShortenerServer) AdminSetUserQuota(ctx context.Context, in *proto.AdminSetUserQuotaRequest) (*emptypb.Empty, error) {
+	if in.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	ctxWT, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	quota := models.Quota{Daily: in.DailyLimit, Total: in.TotalLimit}
+	if err := s.db.SetUserQuota(ctxWT, in.UserId, quota); err != nil {
+		return nil, storageError(err)
+	}
+	user, _ := auth.FromContext(ctx)
+	middlewares.Log.Info("user quota set by admin", zap.String("admin", user.ID),
+		zap.String("user", in.UserId), zap.Int64("daily", quota.Daily), zap.Int64("total", quota.Total))
+	return &emptypb.Empty{}, nil
+}
+
+// AdminDeleteUserQuota возвращает любому пользователю квоты по умолчанию.
+func (s *URLShortenerServer) AdminDeleteUserQuota(ctx context.Context, in *proto.AdminDeleteUserQuotaRequest) (*emptypb.Empty, error) {
+	if in.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	ctxWT, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	if err := s.db.DeleteUserQuota(ctxWT, in.UserId); err != nil {
+		return nil, storageError(err)
+	}
+	user, _ := auth.FromContext(ctx)
+	middlewares.Log.Info("user quota reset by admin", zap.String("admin", user.ID), zap.String("user", in.UserId))
+	return &emptypb.Empty{}, nil
+}
@@ -5,14 +5,18 @@ import (
 	"errors"
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/vancho-go/url-shortener/internal/app/auth"
 	"github.com/vancho-go/url-shortener/internal/app/base62"
 	"github.com/vancho-go/url-shortener/internal/app/handlers/grpc/interceptors"
 	"github.com/vancho-go/url-shortener/internal/app/handlers/http/middlewares"
 	"github.com/vancho-go/url-shortener/internal/app/models"
+	"github.com/vancho-go/url-shortener/internal/app/screening"
 	"github.com/vancho-go/url-shortener/internal/app/storage"
 	"github.com/vancho-go/url-shortener/pkg/proto"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 	"math/rand"
@@ -38,22 +42,36 @@ func (s *URLShortenerServer) Ping(ctx context.Context, in *emptypb.Empty) (*empt
 }
 
 // AddURL генерирует сокращенный URL для переданного оригинального URL.
+// Оригинальный URL проверяется (см. urlnorm и screening) и сохраняется в каноническом виде.
 func (s *URLShortenerServer) AddURL(ctx context.Context, in *proto.AddURLRequest) (*proto.AddURLResponse, error) {
-	originalURL := in.OriginalUrl
-	userID := ctx.Value(interceptors.UserIDKey).(string)
+	user, _ := auth.FromContext(ctx)
+	userID := user.ID
 	if userID == "" {
 		return nil, status.Error(codes.Internal, "something wrong")
 	}
+	originalURL, err := s.checkURL(ctx, in.OriginalUrl)
+	if err != nil {
+		return nil, status.Error(checkURLCode(err), err.Error())
+	}
 
-	shortenURL := base62.Base62Encode(rand.Uint64())
 	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
 	defer cancel()
+	if len(in.Tags) > 0 || in.FolderId != 0 {
+		if err := storage.CheckOrganize(ctx, s.db, userID, in.Tags, folderID(in.FolderId)); err != nil {
+			return nil, storageError(err)
+		}
+	}
+
+	shortenURL := base62.Base62Encode(rand.Uint64())
 	for !s.db.IsShortenUnique(ctx, shortenURL) {
 		shortenURL = base62.Base62Encode(rand.Uint64())
 	}
 
-	err := s.db.AddURL(ctx, originalURL, shortenURL, userID)
+	err = storage.AddOrganizedURL(ctx, s.db, userID, originalURL, shortenURL, in.Tags, folderID(in.FolderId))
 	if err != nil {
+		if errors.Is(err, storage.ErrQuotaExceeded) {
+			return nil, storageError(err)
+		}
 		if !isUniqueViolationError(err) {
 			return nil, status.Error(codes.Internal, "error adding new shorten URL")
 		}
@@ -74,18 +92,34 @@ func (s *URLShortenerServer) AddURL(ctx context.Context, in *proto.AddURLRequest
 }
 
 // AddURLs batch сокращенных URL для batch оригинальных URL.
+// Оригинальные URL проверяются до сохранения: если хотя бы один некорректен или заблокирован,
+// запрос отклоняется целиком. Если квоты пользователя хватает не на все URL, сохраняется часть
+// из них, а остальные возвращаются с ошибкой (см. storage.AddURLsPartially).
 func (s *URLShortenerServer) AddURLs(ctx context.Context, in *proto.AddURLsRequest) (*proto.AddURLsResponse, error) {
-	userID := ctx.Value(interceptors.UserIDKey).(string)
+	user, _ := auth.FromContext(ctx)
+	userID := user.ID
 	if userID == "" {
 		return nil, status.Error(codes.Internal, "something wrong")
 	}
 
+	originalURLs := make([]string, len(in.IdAndUrl))
+	for i, val := range in.IdAndUrl {
+		if val.OriginalUrl == "" {
+			continue
+		}
+		originalURL, err := s.checkURL(ctx, val.OriginalUrl)
+		if err != nil {
+			return nil, status.Errorf(checkURLCode(err), "URL with correlation_id %s: %v", val.CorrelationId, err)
+		}
+		originalURLs[i] = originalURL
+	}
+
 	var response proto.AddURLsResponse
 	var batch []models.APIBatchRequest
-	const batchSize = 100
+	batchSize := s.batchSize
 
 	for i, val := range in.IdAndUrl {
-		originalURL := val.OriginalUrl
+		originalURL := originalURLs[i]
 		if originalURL == "" {
 			continue
 		}
@@ -100,18 +134,27 @@ func (s *URLShortenerServer) AddURLs(ctx context.Context, in *proto.AddURLsReque
 			CorrelationID: val.CorrelationId,
 			OriginalURL:   originalURL,
 			ShortenURL:    shortenURL,
+			Tags:          val.Tags,
+			FolderID:      folderID(val.FolderId),
 		})
 
 		if len(batch) == batchSize || i == len(in.IdAndUrl)-1 {
-			err := s.db.AddURLs(ctxWT, userID, batch...)
+			errs, err := storage.AddURLsPartially(ctxWT, s.db, userID, batch...)
 			if err != nil {
+				if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrBadName) {
+					return nil, storageError(err)
+				}
 				return nil, status.Error(codes.Internal, "something wrong")
 			}
-			for _, b := range batch {
+			for j, b := range batch {
 
 				res := proto.AddURLsResponse_Res{
 					CorrelationId: b.CorrelationID,
-					ShortUrl:      s.addr + "/" + b.ShortenURL,
+				}
+				if errs[j] != nil {
+					res.Error = errs[j].Error()
+				} else {
+					res.ShortUrl = s.addr + "/" + b.ShortenURL
 				}
 
 				response.Result = append(response.Result, &res)
@@ -123,12 +166,21 @@ func (s *URLShortenerServer) AddURLs(ctx context.Context, in *proto.AddURLsReque
 }
 
 // GetURL генерирует сокращенный URL для переданного оригинального URL.
+// Оригинальный URL проверяется повторно (см. screening), заблокированный URL не возвращается.
+// На URL, заблокированный по жалобам, возвращается PermissionDenied.
 func (s *URLShortenerServer) GetURL(ctx context.Context, in *proto.GetURLRequest) (*proto.GetURLResponse, error) {
 	shortenURL := in.ShortUrl
 	ctxWT, cancel := context.WithTimeout(ctx, 1*time.Second)
 	defer cancel()
 	originalURL, err := s.db.GetURL(ctxWT, shortenURL)
 	if err == nil {
+		verdict, err := s.screener.Check(ctx, originalURL)
+		if err != nil {
+			middlewares.Log.Warn("error screening URL", zap.String("url", originalURL), zap.Error(err))
+		}
+		if verdict.Blocked {
+			return nil, status.Error(codes.PermissionDenied, verdict.Err().Error())
+		}
 		var resp proto.GetURLResponse
 		resp.OriginalUrl = originalURL
 		return &resp, nil
@@ -137,35 +189,77 @@ func (s *URLShortenerServer) GetURL(ctx context.Context, in *proto.GetURLRequest
 	if errors.Is(err, storage.ErrDeletedURL) {
 		return nil, status.Error(codes.NotFound, "url was deleted")
 	}
+	if errors.Is(err, storage.ErrExpiredURL) {
+		return nil, status.Error(codes.NotFound, "url has expired")
+	}
+	if errors.Is(err, storage.ErrAbusiveURL) {
+		return nil, status.Error(codes.PermissionDenied, "url was disabled for abuse")
+	}
+	if errors.Is(err, storage.ErrDisabledURL) {
+		return nil, status.Error(codes.NotFound, "url was disabled")
+	}
 	return nil, status.Error(codes.NotFound, "url not found")
 }
 
-// GetUserURLs возвращает пользователю его ранее сокращенные URL.
-func (s *URLShortenerServer) GetUserURLs(ctx context.Context, in *emptypb.Empty) (*proto.GetUserURLsResponse, error) {
-	userID := ctx.Value(interceptors.UserIDKey).(string)
+// GetUserURLs возвращает пользователю его ранее сокращенные URL постранично.
+func (s *URLShortenerServer) GetUserURLs(ctx context.Context, in *proto.GetUserURLsRequest) (*proto.GetUserURLsResponse, error) {
+	user, _ := auth.FromContext(ctx)
+	userID := user.ID
 	if userID == "" {
 		return nil, status.Error(codes.Internal, "something wrong")
 	}
 
+	if in.Limit < 0 {
+		return nil, status.Error(codes.InvalidArgument, "bad limit")
+	}
+	filter := models.UserURLsFilter{
+		Limit:    pageSize(in.Limit),
+		Cursor:   in.Cursor,
+		Desc:     in.Desc,
+		Domain:   in.Domain,
+		Search:   in.Search,
+		Tag:      in.Tag,
+		FolderID: folderID(in.FolderId),
+	}
+	switch in.Deleted {
+	case proto.GetUserURLsRequest_ACTIVE:
+		deleted := false
+		filter.Deleted = &deleted
+	case proto.GetUserURLsRequest_DELETED:
+		deleted := true
+		filter.Deleted = &deleted
+	case proto.GetUserURLsRequest_ALL:
+	}
+
 	ctxWT, cancel := context.WithTimeout(ctx, 1*time.Second)
 	defer cancel()
-	userURLs, err := s.db.GetUserURLs(ctxWT, userID)
+	page, err := s.db.GetUserURLs(ctxWT, userID, filter)
 
 	if err != nil {
+		if errors.Is(err, storage.ErrInvalidCursor) {
+			return nil, status.Error(codes.InvalidArgument, "bad cursor")
+		}
 		middlewares.Log.Error("error getting user urls", zap.Error(err))
 		return nil, status.Error(codes.Internal, "error getting user urls")
 	}
 
-	if len(userURLs) == 0 {
+	if len(page.URLs) == 0 {
 		return nil, status.Error(codes.NotFound, "not found")
 	}
 
 	var resp proto.GetUserURLsResponse
+	resp.NextCursor = page.NextCursor
 
-	for _, url := range userURLs {
+	for _, url := range page.URLs {
 		res := proto.GetUserURLsResponse_Res{
 			OriginalUrl: url.OriginalURL,
 			ShortUrl:    s.addr + "/" + url.ShortenURL,
+			CreatedAt:   url.CreatedAt.Unix(),
+			Deleted:     url.Deleted,
+			Tags:        url.Tags,
+		}
+		if url.FolderID != nil {
+			res.FolderId = *url.FolderID
 		}
 
 		resp.Result = append(resp.Result, &res)
@@ -175,7 +269,8 @@ func (s *URLShortenerServer) GetUserURLs(ctx context.Context, in *emptypb.Empty)
 
 // DeleteURLs удаляет URL пользователя.
 func (s *URLShortenerServer) DeleteURLs(ctx context.Context, in *proto.DeleteURLsRequest) (*emptypb.Empty, error) {
-	userID := ctx.Value(interceptors.UserIDKey).(string)
+	user, _ := auth.FromContext(ctx)
+	userID := user.ID
 	if userID == "" {
 		return nil, status.Error(codes.Internal, "something wrong")
 	}
@@ -210,6 +305,137 @@ func (s *URLShortenerServer) GetStats(ctx context.Context, in *emptypb.Empty) (*
 	return &resp, nil
 }
 
+// GetQuota возвращает квоты пользователя на сокращение URL и их текущее использование.
+func (s *URLShortenerServer) GetQuota(ctx context.Context, in *emptypb.Empty) (*proto.GetQuotaResponse, error) {
+	user, _ := auth.FromContext(ctx)
+	userID := user.ID
+	if userID == "" {
+		return nil, status.Error(codes.Internal, "something wrong")
+	}
+	ctxWT, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	quota, err := s.db.GetQuota(ctxWT, userID)
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return quotaResponse(quota), nil
+}
+
+// Refresh продлевает сессию: обменивает токен обновления из метаданных запроса на новую пару токенов
+// того же пользователя, которые отправляются в заголовке ответа. Использованный токен обновления
+// больше не принимается, а его повторное предъявление завершает всю сессию.
+func (s *URLShortenerServer) Refresh(ctx context.Context, in *emptypb.Empty) (*emptypb.Empty, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(auth.RefreshTokenName)
+	if len(values) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "no refresh token")
+	}
+	_, session, err := s.tokens.Refresh(ctx, values[0])
+	if err != nil {
+		middlewares.LogRefreshError(err)
+		if errors.Is(err, auth.ErrInvalidRefreshToken) || errors.Is(err, auth.ErrRefreshTokenReused) {
+			return nil, status.Error(codes.Unauthenticated, "bad refresh token")
+		}
+		return nil, status.Error(codes.Internal, "error refreshing session")
+	}
+	if err = grpc.SetHeader(ctx, interceptors.SessionMetadata(session)); err != nil {
+		return nil, status.Error(codes.Internal, "error setting session header")
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// Logout отзывает токен, с которым выполнен запрос. Отозванный токен больше не принимается
+// ни gRPC, ни HTTP, другие токены пользователя действуют до истечения срока. Запрос без валидного
+// токена тоже успешен.
+func (s *URLShortenerServer) Logout(ctx context.Context, in *emptypb.Empty) (*emptypb.Empty, error) {
+	user, _ := auth.FromContext(ctx)
+	if user.New {
+		return &emptypb.Empty{}, nil
+	}
+	if err := s.tokens.Revoke(ctx, user); err != nil {
+		middlewares.Log.Error("error revoking token", zap.Error(err))
+		return nil, status.Error(codes.Internal, "error revoking token")
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// pageSize возвращает размер страницы URL по limit из запроса: models.DefaultUserURLsPageSize,
+// если limit не передан, и не больше models.MaxUserURLsPageSize.
+func pageSize(limit int32) int {
+	if limit == 0 {
+		return models.DefaultUserURLsPageSize
+	}
+	return min(int(limit), models.MaxUserURLsPageSize)
+}
+
+// folderID переводит идентификатор папки из сообщения (0 - без папки) в указатель.
+func folderID(id int64) *int64 {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
+
+// quotaResponse преобразует квоты пользователя в ответ gRPC.
+func quotaResponse(quota *models.APIQuotaResponse) *proto.GetQuotaResponse {
+	return &proto.GetQuotaResponse{
+		DailyLimit: quota.Limits.Daily,
+		TotalLimit: quota.Limits.Total,
+		DailyUsed:  quota.Used.Daily,
+		TotalUsed:  quota.Used.Total,
+		Custom:     quota.Custom,
+		ResetAt:    quota.ResetAt.Unix(),
+	}
+}
+
+// storageError переводит ошибку хранилища в gRPC статус.
+func storageError(err error) error {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return status.Error(codes.NotFound, "not found")
+	case errors.Is(err, storage.ErrAlreadyExists):
+		return status.Error(codes.AlreadyExists, "already exists")
+	case errors.Is(err, storage.ErrBadName):
+		return status.Error(codes.InvalidArgument, "bad name")
+	case errors.Is(err, storage.ErrFolderCycle):
+		return status.Error(codes.InvalidArgument, "folder cannot be moved into itself")
+	case errors.Is(err, storage.ErrQuotaExceeded):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, storage.ErrBadQuota):
+		return status.Error(codes.InvalidArgument, "bad quota")
+	default:
+		middlewares.Log.Error("storage error", zap.Error(err))
+		return status.Error(codes.Internal, "internal DB error")
+	}
+}
+
+// checkURL приводит оригинальный URL к каноническому виду и проверяет, что он не заблокирован.
+// Ошибка внешнего сервиса проверки не мешает сокращению и только пишется в лог.
+func (s *URLShortenerServer) checkURL(ctx context.Context, rawURL string) (string, error) {
+	originalURL, err := s.urls.Normalize(rawURL)
+	if err != nil {
+		return "", err
+	}
+	verdict, err := s.screener.Screen(ctx, originalURL)
+	if err != nil {
+		middlewares.Log.Warn("error screening URL", zap.String("url", originalURL), zap.Error(err))
+	}
+	if verdict.Blocked {
+		middlewares.Log.Info("blocked URL rejected", zap.String("url", originalURL),
+			zap.String("source", verdict.Source), zap.String("reason", verdict.Reason))
+		return "", verdict.Err()
+	}
+	return originalURL, nil
+}
+
+// checkURLCode возвращает код gRPC для ошибки checkURL.
+func checkURLCode(err error) codes.Code {
+	if errors.Is(err, screening.ErrBlocked) {
+		return codes.PermissionDenied
+	}
+	return codes.InvalidArgument
+}
+
 // isUniqueViolationError проверяет является ли ошибка UniqueViolation.
 func isUniqueViolationError(err error) bool {
 	var pgErr *pgconn.PgError
@@ -0,0 +1,63 @@
+package interceptors
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"github.com/vancho-go/url-shortener/internal/app/clientip"
+)
+
+// ClientIPInterceptor выполняет роль interceptor, который определяет IP адрес клиента с учетом доверенных
+// прокси и сохраняет его в context. Адреса прокси берутся из метаданных с именем заголовка resolver.Header()
+// в нижнем регистре. Подключается первым, до логирования и ограничения частоты запросов.
+func ClientIPInterceptor(resolver *clientip.Resolver) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return handler(withClientIP(ctx, resolver), req)
+	}
+}
+
+// ClientIPStreamInterceptor - аналог ClientIPInterceptor для потоковых методов.
+func ClientIPStreamInterceptor(resolver *clientip.Resolver) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &wrappedStream{
+			ServerStream: ss,
+			ctx:          withClientIP(ss.Context(), resolver),
+		})
+	}
+}
+
+// withClientIP возвращает context с IP адресом клиента.
+func withClientIP(ctx context.Context, resolver *clientip.Resolver) context.Context {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ctx
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	addr := resolver.Resolve(p.Addr.String(), md.Get(strings.ToLower(resolver.Header())))
+	if !addr.IsValid() {
+		return ctx
+	}
+	return clientip.NewContext(ctx, addr)
+}
+
+// clientIP возвращает IP адрес клиента, определенный ClientIPInterceptor.
+// Без ClientIPInterceptor возвращает адрес соединения.
+func clientIP(ctx context.Context) string {
+	if addr, ok := clientip.FromContext(ctx); ok {
+		return addr.String()
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
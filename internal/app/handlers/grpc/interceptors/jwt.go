@@ -2,134 +2,206 @@ package interceptors
 
 import (
 	"context"
-	"fmt"
-	"github.com/golang-jwt/jwt/v4"
-	"github.com/google/uuid"
+	"errors"
+	"strings"
+
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
-	"time"
-)
-
-type key int
 
-// UserIDKey - параметр, необходимый для передачи токена через context.
-const (
-	UserIDKey key = iota
+	"github.com/vancho-go/url-shortener/internal/app/auth"
+	"github.com/vancho-go/url-shortener/internal/app/handlers/http/middlewares"
+	"github.com/vancho-go/url-shortener/pkg/proto"
 )
 
-// tokenExp - время действия сгенерированного токена (cookie).
-const tokenExp = time.Hour * 24
-
-// secretKey - секретный ключ для генерации токена (bad practice to store it here, just for study case).
-const secretKey = "temp_secret_key"
-
-// Claims - данные, которые в себе будет содержать генерируемый токен.
-type Claims struct {
-	jwt.RegisteredClaims
-	UserID string
+// sessionMethods - методы, которые работают с токенами сессии сами: interceptor не аутентифицирует
+// их вызов и не выпускает для него новый токен.
+var sessionMethods = map[string]bool{
+	proto.URLShortener_Refresh_FullMethodName: true,
 }
 
-// GenerateUserID генерирует рандомный UUID.
-func GenerateUserID() string {
-	return uuid.New().String()
+// methodScopes - права, необходимые API ключу для вызова методов. Методы, которых нет в таблице,
+// с API ключом недоступны.
+var methodScopes = map[string]string{
+	proto.URLShortener_Ping_FullMethodName:          auth.ScopeRead,
+	proto.URLShortener_AddURL_FullMethodName:        auth.ScopeWrite,
+	proto.URLShortener_AddURLs_FullMethodName:       auth.ScopeWrite,
+	proto.URLShortener_StreamAddURLs_FullMethodName: auth.ScopeWrite,
+	proto.URLShortener_GetURL_FullMethodName:        auth.ScopeRead,
+	proto.URLShortener_GetUserURLs_FullMethodName:   auth.ScopeRead,
+	proto.URLShortener_DeleteURLs_FullMethodName:    auth.ScopeDelete,
+	proto.URLShortener_GetStats_FullMethodName:      auth.ScopeRead,
 }
 
-// generateJWTToken токен для пользователя, чей userID передан в качестве параметра.
-func generateJWTToken(userID string) (string, error) {
-	// создаём новый токен с алгоритмом подписи HS256 и утверждениями — Claims
-	expirationTime := time.Now().Add(tokenExp)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
-		RegisteredClaims: jwt.RegisteredClaims{
-			// когда создан токен
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			Issuer:    "",                             // не используется
-			Subject:   "",                             // не используется
-			Audience:  []string{},                     // не используется
-			NotBefore: jwt.NewNumericDate(time.Now()), // не используется
-			IssuedAt:  jwt.NewNumericDate(time.Now()), // не используется
-			ID:        "",                             // не используется
-		},
-		// собственное утверждение
-		UserID: userID,
-	})
-	return token.SignedString([]byte(secretKey))
+// JWTInterceptor выполняет роль interceptor, который аутентифицирует пользователя по метаданным запроса
+// и передает его обработчику через context. Приоритет учетных данных такой же, как у HTTP JWTMiddleware:
+//  1. API ключ (x-api-key или authorization: Bearer usk_...). Невалидный ключ или ключ без нужного права отклоняется.
+//  2. Токен в authorization: Bearer. Невалидный, истекший или отозванный токен отклоняется с Unauthenticated:
+//     клиент с токеном должен сам обновить его методом Refresh.
+//  3. Токен в метаданных authtoken.
+//  4. Токен обновления в метаданных refreshtoken: сессия продлевается, пользователь сохраняется.
+//  5. Иначе генерируется новый пользователь.
+//
+// Как и в HTTP, сессия анонимного пользователя сохраняется только при первом вызове метода, изменяющего данные.
+// Выпущенные токены отправляются клиенту в заголовке ответа (authtoken и refreshtoken).
+func JWTInterceptor(tokens auth.TokenManager, keys auth.APIKeyStore) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		user, newToken, err := authenticate(ctx, info.FullMethod, tokens, keys)
+		if err != nil {
+			return nil, err
+		}
+		if newToken != nil {
+			// Установка метаданных для отправки с ответом
+			grpc.SetHeader(ctx, newToken)
+		}
+
+		return handler(auth.NewContext(ctx, user), req)
+	}
 }
 
-// isTokenValid проверяет токен на валидность.
-func isTokenValid(tokenString string) bool {
-	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+// JWTStreamInterceptor - аналог JWTInterceptor для потоковых методов.
+// Пользователь передается обработчику через context потока.
+func JWTStreamInterceptor(tokens auth.TokenManager, keys auth.APIKeyStore) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		user, newToken, err := authenticate(ss.Context(), info.FullMethod, tokens, keys)
+		if err != nil {
+			return err
 		}
-		return []byte(secretKey), nil
-	})
-	if err != nil {
-		return false
+		if newToken != nil {
+			if err = ss.SetHeader(newToken); err != nil {
+				return status.Error(codes.Internal, "error setting jwtToken header")
+			}
+		}
+
+		return handler(srv, &wrappedStream{
+			ServerStream: ss,
+			ctx:          auth.NewContext(ss.Context(), user),
+		})
 	}
-	return token.Valid
 }
 
-// GetUserID извлекает userID из валидного токена.
-func getUserID(tokenString string) (string, error) {
-	if !isTokenValid(tokenString) {
-		return "", fmt.Errorf("token is not valid")
-	}
-	claims := &Claims{
-		RegisteredClaims: jwt.RegisteredClaims{
-			Issuer:    "",                             // не используется
-			Subject:   "",                             // не используется
-			Audience:  []string{},                     // не используется
-			NotBefore: jwt.NewNumericDate(time.Now()), // не используется
-			IssuedAt:  jwt.NewNumericDate(time.Now()), // не используется
-			ID:        "",                             // не используется
-			ExpiresAt: nil,                            // не используется
-		},
-		UserID: "",
+// authenticate извлекает пользователя из метаданных запроса к методу method в порядке приоритета,
+// описанном у JWTInterceptor. Метаданные с новыми токенами возвращаются для отправки клиенту.
+func authenticate(ctx context.Context, method string, tokens auth.TokenManager, keys auth.APIKeyStore) (auth.User, metadata.MD, error) {
+	if sessionMethods[method] {
+		return auth.User{}, nil, nil
 	}
-	_, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
-		return []byte(secretKey), nil
-	})
-	if err != nil {
-		return "", fmt.Errorf("error parsing token")
+	md, _ := metadata.FromIncomingContext(ctx)
+	if key, ok := apiKeyFromMetadata(md); ok {
+		user, err := auth.AuthenticateAPIKey(ctx, keys, key)
+		if err != nil {
+			if errors.Is(err, auth.ErrInvalidAPIKey) {
+				return auth.User{}, nil, status.Error(codes.Unauthenticated, "bad API key")
+			}
+			return auth.User{}, nil, status.Error(codes.Internal, "error checking API key")
+		}
+		if scope, ok := methodScopes[method]; !ok || !user.Allows(scope) {
+			return auth.User{}, nil, status.Error(codes.PermissionDenied, "API key has no permission for this method")
+		}
+		return user, nil, nil
 	}
-	return claims.UserID, nil
-}
 
-// JWTInterceptor выполняет роль interceptor, который проверяет наличие токена аутентификации.
-// Если токен присутствует и он валидный, interceptor передает запрос следующему обработчику.
-// Если токена нет, генерируется новый токен, который передается следующему обработчику через context.
-func JWTInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
-	var jwtToken string
-	if md, ok := metadata.FromIncomingContext(ctx); ok {
-		values := md.Get("AuthToken")
-		if len(values) > 0 {
-			jwtToken = values[0]
+	if token, ok := bearerFromMetadata(md); ok {
+		user, err := tokens.User(token)
+		if err != nil {
+			return auth.User{}, nil, status.Error(codes.Unauthenticated, "bad token")
 		}
+		return user, nil, nil
 	}
 
-	if !isTokenValid(jwtToken) {
-		userID := GenerateUserID()
-		newJWTToken, err := generateJWTToken(userID)
-		if err != nil {
-			return nil, status.Error(codes.Internal, "error generating jwtToken")
+	if md != nil {
+		if values := md.Get(auth.TokenName); len(values) > 0 {
+			if user, err := tokens.User(values[0]); err == nil {
+				if !needsSession(method, tokens, user) {
+					return user, nil, nil
+				}
+				return startSession(ctx, tokens, user)
+			}
+		}
+		if values := md.Get(auth.RefreshTokenName); len(values) > 0 {
+			user, session, err := tokens.Refresh(ctx, values[0])
+			if err == nil {
+				return user, SessionMetadata(session), nil
+			}
+			middlewares.LogRefreshError(err)
 		}
-		jwtToken = newJWTToken
+	}
 
-		// Создание новых метаданных
-		md := metadata.Pairs("AuthToken", jwtToken)
-		// Установка метаданных для отправки с ответом
-		grpc.SetHeader(ctx, md)
+	user := auth.User{ID: auth.GenerateUserID(), New: true}
+	if needsSession(method, tokens, user) {
+		return startSession(ctx, tokens, user)
+	}
+	token, err := tokens.Issue(user)
+	if err != nil {
+		return auth.User{}, nil, status.Error(codes.Internal, "error generating jwtToken")
 	}
+	return user, SessionMetadata(auth.TokenPair{AccessToken: token}), nil
+}
+
+// needsSession проверяет, нужно ли начать сессию анонимного пользователя user без сессии:
+// сессия начинается при первом вызове метода, который создает или удаляет данные.
+func needsSession(method string, tokens auth.TokenManager, user auth.User) bool {
+	scope := methodScopes[method]
+	return tokens.RefreshTTL() > 0 && !user.Registered && user.SessionID == "" && (scope == auth.ScopeWrite || scope == auth.ScopeDelete)
+}
 
-	userID, err := getUserID(jwtToken)
+// startSession начинает сессию пользователя user и возвращает метаданные с ее токенами.
+func startSession(ctx context.Context, tokens auth.TokenManager, user auth.User) (auth.User, metadata.MD, error) {
+	session, err := tokens.IssueSession(ctx, user)
 	if err != nil {
-		return nil, status.Error(codes.Internal, "error getting data from jwtToken")
+		return auth.User{}, nil, status.Error(codes.Internal, "error generating jwtToken")
+	}
+	return user, SessionMetadata(session), nil
+}
+
+// SessionMetadata возвращает метаданные ответа с токеном аутентификации и токеном обновления, если он есть.
+func SessionMetadata(session auth.TokenPair) metadata.MD {
+	md := metadata.Pairs(auth.TokenName, session.AccessToken)
+	if session.RefreshToken != "" {
+		md.Set(auth.RefreshTokenName, session.RefreshToken)
+	}
+	return md
+}
+
+// apiKeyFromMetadata извлекает API ключ из метаданных x-api-key или authorization: Bearer.
+func apiKeyFromMetadata(md metadata.MD) (string, bool) {
+	if values := md.Get(auth.APIKeyHeader); len(values) > 0 && values[0] != "" {
+		return values[0], true
+	}
+	if credentials, ok := bearerCredentials(md); ok && auth.IsAPIKey(credentials) {
+		return credentials, true
+	}
+	return "", false
+}
+
+// bearerFromMetadata извлекает токен (но не API ключ) из метаданных authorization: Bearer.
+func bearerFromMetadata(md metadata.MD) (string, bool) {
+	if credentials, ok := bearerCredentials(md); ok && !auth.IsAPIKey(credentials) {
+		return credentials, true
 	}
+	return "", false
+}
 
-	ctxWV := context.WithValue(ctx, UserIDKey, userID)
-	resp, err := handler(ctxWV, req)
+// bearerCredentials извлекает значение из метаданных authorization со схемой Bearer.
+func bearerCredentials(md metadata.MD) (string, bool) {
+	for _, value := range md.Get("authorization") {
+		scheme, credentials, ok := strings.Cut(value, " ")
+		credentials = strings.TrimSpace(credentials)
+		if ok && strings.EqualFold(scheme, "Bearer") && credentials != "" {
+			return credentials, true
+		}
+	}
+	return "", false
+}
+
+// wrappedStream подменяет context потока, чтобы передать в него данные из interceptor.
+type wrappedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
 
-	return resp, err
+// Context возвращает context потока с данными interceptor.
+func (w *wrappedStream) Context() context.Context {
+	return w.ctx
 }
@@ -27,9 +27,32 @@ func UnaryServerInterceptor(ctx context.Context,
 	// Логируем детали запроса.
 	Log.Info("gRPC request",
 		zap.String("method", info.FullMethod),
+		zap.String("ip", clientIP(ctx)),
 		zap.String("duration", duration.String()),
 		zap.Any("error", err),
 	)
 
 	return resp, err
 }
+
+// StreamServerInterceptor создает gRPC интерсептор для логирования потоковых методов.
+func StreamServerInterceptor(srv any,
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+	// Запоминаем время начала обработки потока.
+	startTime := time.Now()
+
+	// Обработка потока.
+	err := handler(srv, ss)
+
+	// Логируем детали потока.
+	Log.Info("gRPC stream",
+		zap.String("method", info.FullMethod),
+		zap.String("ip", clientIP(ss.Context())),
+		zap.String("duration", time.Since(startTime).String()),
+		zap.Any("error", err),
+	)
+
+	return err
+}
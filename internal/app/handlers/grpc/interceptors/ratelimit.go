@@ -0,0 +1,71 @@
+package interceptors
+
+import (
+	"context"
+	"strconv"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/vancho-go/url-shortener/internal/app/auth"
+	"github.com/vancho-go/url-shortener/internal/app/ratelimit"
+	"github.com/vancho-go/url-shortener/pkg/proto"
+)
+
+// retryAfterKey - ключ метаданных ответа с временем в секундах, через которое стоит повторить запрос.
+const retryAfterKey = "retry-after"
+
+// MethodRateClasses - классы запросов методов для ограничения частоты. Остальные методы - ratelimit.ClassRead.
+var MethodRateClasses = ratelimit.Classes{
+	ratelimit.ClassDefault:                          ratelimit.ClassRead,
+	proto.URLShortener_AddURL_FullMethodName:        ratelimit.ClassCreate,
+	proto.URLShortener_AddURLs_FullMethodName:       ratelimit.ClassCreate,
+	proto.URLShortener_StreamAddURLs_FullMethodName: ratelimit.ClassCreate,
+	proto.URLShortener_GetURL_FullMethodName:        ratelimit.ClassRedirect,
+	proto.URLShortener_Refresh_FullMethodName:       ratelimit.ClassAuth,
+}
+
+// RateLimitInterceptor выполняет роль interceptor, который ограничивает частоту запросов клиента
+// по классам методов из таблицы classes. Должен подключаться после JWTInterceptor.
+// При превышении лимита возвращает ResourceExhausted и время ожидания в метаданных retry-after.
+func RateLimitInterceptor(limiter *ratelimit.Limiter, classes ratelimit.Classes) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := limit(ctx, info.FullMethod, limiter, classes); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// RateLimitStreamInterceptor - аналог RateLimitInterceptor для потоковых методов.
+// Лимит проверяется один раз при открытии потока.
+func RateLimitStreamInterceptor(limiter *ratelimit.Limiter, classes ratelimit.Classes) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := limit(ss.Context(), info.FullMethod, limiter, classes); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// limit проверяет лимит вызова метода method клиентом из context.
+func limit(ctx context.Context, method string, limiter *ratelimit.Limiter, classes ratelimit.Classes) error {
+	class, ok := classes.Of(method)
+	if !ok {
+		return nil
+	}
+	user, _ := auth.FromContext(ctx)
+	allowed, retryAfter, err := limiter.Allow(ctx, class, ratelimit.KeyOf(class, user, clientIP(ctx)))
+	if err != nil {
+		Log.Error("rate limit store error", zap.Error(err))
+	}
+	if allowed {
+		return nil
+	}
+	seconds := strconv.Itoa(ratelimit.RetryAfterSeconds(retryAfter))
+	grpc.SetHeader(ctx, metadata.Pairs(retryAfterKey, seconds))
+	return status.Errorf(codes.ResourceExhausted, "too many requests, retry after %s s", seconds)
+}
@@ -0,0 +1,53 @@
+package interceptors
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/vancho-go/url-shortener/internal/app/auth"
+	"github.com/vancho-go/url-shortener/pkg/proto"
+)
+
+// MethodRoles - роли, необходимые для вызова методов. Методы, которых нет в таблице, доступны всем.
+var MethodRoles = auth.Policy{
+	proto.URLShortener_AdminListURLs_FullMethodName:        {auth.RoleAdmin, auth.RoleAuditor},
+	proto.URLShortener_AdminSetURLDisabled_FullMethodName:  {auth.RoleAdmin},
+	proto.URLShortener_AdminDeleteUserURLs_FullMethodName:  {auth.RoleAdmin},
+	proto.URLShortener_AdminGetUserStats_FullMethodName:    {auth.RoleAdmin, auth.RoleAuditor},
+	proto.URLShortener_AdminGetUserQuota_FullMethodName:    {auth.RoleAdmin, auth.RoleAuditor},
+	proto.URLShortener_AdminSetUserQuota_FullMethodName:    {auth.RoleAdmin},
+	proto.URLShortener_AdminDeleteUserQuota_FullMethodName: {auth.RoleAdmin},
+}
+
+// RoleInterceptor выполняет роль interceptor, который проверяет роли пользователя по таблице policy.
+// Должен подключаться после JWTInterceptor.
+func RoleInterceptor(policy auth.Policy) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := authorize(ctx, info.FullMethod, policy); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// RoleStreamInterceptor - аналог RoleInterceptor для потоковых методов.
+func RoleStreamInterceptor(policy auth.Policy) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := authorize(ss.Context(), info.FullMethod, policy); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// authorize проверяет, разрешен ли пользователю из context вызов метода method.
+func authorize(ctx context.Context, method string, policy auth.Policy) error {
+	user, _ := auth.FromContext(ctx)
+	if !policy.Allows(method, user) {
+		return status.Error(codes.PermissionDenied, "no permission for this method")
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package interceptors
+
+import (
+	"context"
+	"net/netip"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/vancho-go/url-shortener/internal/app/auth"
+	"github.com/vancho-go/url-shortener/internal/app/clientip"
+	"github.com/vancho-go/url-shortener/pkg/proto"
+)
+
+// MethodSubnets - методы, доступные только из доверенных подсетей, и роли, с которыми метод доступен
+// с любого адреса. Пустой список ролей - только из доверенных подсетей. Методы, которых нет в таблице,
+// доступны с любого адреса.
+var MethodSubnets = auth.Policy{
+	proto.URLShortener_GetStats_FullMethodName: nil,
+}
+
+// TrustedSubnetInterceptor выполняет роль interceptor, который проверяет вхождение IP адреса клиента
+// в доверенные подсети для методов из таблицы policy. Адрес определяется ClientIPInterceptor с учетом
+// доверенных прокси, роли - JWTInterceptor, поэтому interceptor подключается после них.
+// Без доверенных подсетей методы из таблицы доступны только пользователям с ролями из таблицы.
+func TrustedSubnetInterceptor(subnets []netip.Prefix, policy auth.Policy) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := checkSubnet(ctx, info.FullMethod, subnets, policy); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// TrustedSubnetStreamInterceptor - аналог TrustedSubnetInterceptor для потоковых методов.
+func TrustedSubnetStreamInterceptor(subnets []netip.Prefix, policy auth.Policy) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := checkSubnet(ss.Context(), info.FullMethod, subnets, policy); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// checkSubnet проверяет, разрешен ли клиенту из context вызов метода method.
+func checkSubnet(ctx context.Context, method string, subnets []netip.Prefix, policy auth.Policy) error {
+	if addr, err := netip.ParseAddr(clientIP(ctx)); err == nil && clientip.Contains(subnets, addr) {
+		return nil
+	}
+	user, _ := auth.FromContext(ctx)
+	if !policy.Allows(method, user) {
+		return status.Error(codes.PermissionDenied, "method is available only from trusted subnets")
+	}
+	return nil
+}
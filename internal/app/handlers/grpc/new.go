@@ -1,18 +1,37 @@
 package grpc
 
 import (
+	"time"
+
+	"github.com/vancho-go/url-shortener/internal/app/auth"
+	"github.com/vancho-go/url-shortener/internal/app/screening"
 	"github.com/vancho-go/url-shortener/internal/app/storage"
+	"github.com/vancho-go/url-shortener/internal/app/urlnorm"
 	"github.com/vancho-go/url-shortener/pkg/proto"
 )
 
 // URLShortenerServer поддерживает все необходимые методы gRPC сервера.
 type URLShortenerServer struct {
 	proto.UnimplementedURLShortenerServer
-	db   storage.Storager
-	addr string
+	db     storage.Storager
+	tokens auth.TokenManager
+	addr   string
+	// batchSize - размер пачки URL, сохраняемой в хранилище за один вызов AddURLs.
+	batchSize int
+	// batchInterval - период сохранения неполной пачки в StreamAddURLs (0 - только по заполнению пачки).
+	batchInterval time.Duration
+	// urls - проверка и канонизация оригинальных URL.
+	urls *urlnorm.Normalizer
+	// screener - проверка оригинальных URL на вредоносность.
+	screener *screening.Screener
 }
 
 // New - конструктор URLShortenerServer.
-func New(store storage.Storager, addr string) *URLShortenerServer {
-	return &URLShortenerServer{db: store, addr: addr}
+func New(store storage.Storager, tokens auth.TokenManager, addr string, batchSize int, batchInterval time.Duration,
+	urls *urlnorm.Normalizer, screener *screening.Screener) *URLShortenerServer {
+	if batchSize < 1 {
+		batchSize = storage.DefaultBatchSize
+	}
+	return &URLShortenerServer{db: store, tokens: tokens, addr: addr, batchSize: batchSize, batchInterval: batchInterval,
+		urls: urls, screener: screener}
 }
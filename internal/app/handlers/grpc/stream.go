@@ -0,0 +1,104 @@
+package grpc
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/vancho-go/url-shortener/internal/app/auth"
+	"github.com/vancho-go/url-shortener/internal/app/models"
+	"github.com/vancho-go/url-shortener/internal/app/storage"
+	"github.com/vancho-go/url-shortener/pkg/proto"
+)
+
+// StreamAddURLs сокращает URL, поступающие в потоке, и возвращает в поток результат по каждому URL.
+// URL сохраняются пачками по batchSize, неполная пачка сохраняется раз в batchInterval
+// и при закрытии потока клиентом. Ошибка одного URL, в том числе некорректный или заблокированный
+// оригинальный URL, не прерывает поток.
+func (s *URLShortenerServer) StreamAddURLs(stream proto.URLShortener_StreamAddURLsServer) error {
+	ctx := stream.Context()
+	user, _ := auth.FromContext(ctx)
+	userID := user.ID
+	if userID == "" {
+		return status.Error(codes.Internal, "something wrong")
+	}
+
+	batcher := storage.NewBatchWriter(s.db, userID, s.batchSize, func(result storage.BatchResult) error {
+		resp := proto.StreamAddURLsResponse{CorrelationId: result.CorrelationID}
+		if result.Err != nil {
+			resp.Error = result.Err.Error()
+		} else {
+			resp.ShortUrl = s.addr + "/" + result.ShortenURL
+		}
+		return stream.Send(&resp)
+	})
+
+	// Recv блокируется, поэтому читаем поток в отдельной горутине,
+	// чтобы по таймеру сохранять неполные пачки.
+	type received struct {
+		in  *proto.AddURLsRequest_IDAndURL
+		err error
+	}
+	inCh := make(chan received)
+	go func() {
+		for {
+			in, err := stream.Recv()
+			select {
+			case inCh <- received{in: in, err: err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var tick <-chan time.Time
+	if s.batchInterval > 0 {
+		ticker := time.NewTicker(s.batchInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-tick:
+			if err := batcher.Flush(ctx); err != nil {
+				return err
+			}
+		case r := <-inCh:
+			if errors.Is(r.err, io.EOF) {
+				return batcher.Flush(ctx)
+			}
+			if r.err != nil {
+				return r.err
+			}
+
+			url := models.APIBatchRequest{
+				CorrelationID: r.in.CorrelationId,
+				OriginalURL:   r.in.OriginalUrl,
+				ShortenURL:    r.in.Alias,
+				Tags:          r.in.Tags,
+				FolderID:      folderID(r.in.FolderId),
+			}
+			var err error
+			if url.OriginalURL != "" {
+				url.OriginalURL, err = s.checkURL(ctx, url.OriginalURL)
+			}
+			if err != nil {
+				err = batcher.Reject(ctx, url, err)
+			} else {
+				err = batcher.Add(ctx, url)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
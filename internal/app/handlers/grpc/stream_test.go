@@ -0,0 +1,441 @@
+package grpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/vancho-go/url-shortener/internal/app/auth"
+	"github.com/vancho-go/url-shortener/internal/app/clientip"
+	"github.com/vancho-go/url-shortener/internal/app/config"
+	"github.com/vancho-go/url-shortener/internal/app/handlers/grpc/interceptors"
+	"github.com/vancho-go/url-shortener/internal/app/handlers/http/middlewares"
+	"github.com/vancho-go/url-shortener/internal/app/models"
+	"github.com/vancho-go/url-shortener/internal/app/ratelimit"
+	"github.com/vancho-go/url-shortener/internal/app/storage"
+	"github.com/vancho-go/url-shortener/pkg/proto"
+)
+
+// batchStorage - in-memory хранилище, которое запоминает сохраненные пачки.
+type batchStorage struct {
+	*storage.MapDB
+	batches [][]models.APIBatchRequest
+}
+
+func (b *batchStorage) AddURLs(ctx context.Context, userID string, urls ...models.APIBatchRequest) error {
+	b.batches = append(b.batches, urls)
+	for _, url := range urls {
+		if err := b.AddURL(ctx, url.OriginalURL, url.ShortenURL, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tokens - менеджер токенов, общий для HTTP и gRPC в тестах.
+var tokens, _ = auth.New(config.ServerConfig{AuthSecret: "secret"}, nil, nil)
+
+// startServer поднимает gRPC сервер с JWT interceptors в памяти и возвращает клиента к нему.
+func startServer(t *testing.T, db storage.Storager) proto.URLShortenerClient {
+	listener := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(interceptors.JWTInterceptor(tokens, db), interceptors.RoleInterceptor(interceptors.MethodRoles)),
+		grpc.ChainStreamInterceptor(interceptors.JWTStreamInterceptor(tokens, db), interceptors.RoleStreamInterceptor(interceptors.MethodRoles)),
+	)
+	proto.RegisterURLShortenerServer(srv, New(db, tokens, "http://localhost:8080", 2, time.Hour, nil, nil))
+	go srv.Serve(listener)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return proto.NewURLShortenerClient(conn)
+}
+
+func TestStreamAddURLs(t *testing.T) {
+	db := &batchStorage{MapDB: storage.NewMapDB()}
+	stream, err := startServer(t, db).StreamAddURLs(context.Background())
+	require.NoError(t, err)
+
+	inputs := []*proto.AddURLsRequest_IDAndURL{
+		{CorrelationId: "1", OriginalUrl: "https://ya.ru"},
+		{CorrelationId: "2", OriginalUrl: ""},
+		{CorrelationId: "3", OriginalUrl: "https://vk.com", Alias: "vk"},
+	}
+	for _, in := range inputs {
+		require.NoError(t, stream.Send(in))
+	}
+	require.NoError(t, stream.CloseSend())
+
+	var results []*proto.StreamAddURLsResponse
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		results = append(results, resp)
+	}
+
+	require.Len(t, results, 3)
+	assert.NotEmpty(t, results[0].ShortUrl)
+	assert.Equal(t, storage.ErrEmptyURL.Error(), results[1].Error)
+	assert.Equal(t, "http://localhost:8080/vk", results[2].ShortUrl)
+	// Пачка размером 2 сохраняется по заполнению, остаток - при закрытии потока.
+	assert.Len(t, db.batches, 2)
+
+	header, err := stream.Header()
+	require.NoError(t, err)
+	assert.NotEmpty(t, header.Get("AuthToken"))
+}
+
+func TestHTTPTokenAcceptedByGRPC(t *testing.T) {
+	// Токен выпускает HTTP middleware.
+	var httpUser auth.User
+	handler := middlewares.JWTMiddleware(tokens, nil)(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		httpUser, _ = auth.FromContext(req.Context())
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	require.True(t, httpUser.New)
+
+	// gRPC принимает тот же токен и не выпускает новый.
+	var header metadata.MD
+	ctx := metadata.AppendToOutgoingContext(context.Background(), auth.TokenName, cookies[0].Value)
+	_, err := startServer(t, storage.NewMapDB()).AddURL(ctx, &proto.AddURLRequest{OriginalUrl: "https://ya.ru"}, grpc.Header(&header))
+	require.NoError(t, err)
+	assert.Empty(t, header.Get(auth.TokenName))
+
+	user, err := tokens.User(cookies[0].Value)
+	require.NoError(t, err)
+	assert.Equal(t, httpUser.ID, user.ID)
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	db := storage.NewMapDB()
+	key, hash, prefix, err := auth.GenerateAPIKey()
+	require.NoError(t, err)
+	_, err = db.CreateAPIKey(context.Background(), models.APIKey{UserID: "user", Name: "ci", Prefix: prefix, Scopes: []string{auth.ScopeWrite}}, hash)
+	require.NoError(t, err)
+	client := startServer(t, db)
+
+	var header metadata.MD
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+key)
+	_, err = client.AddURL(ctx, &proto.AddURLRequest{OriginalUrl: "https://ya.ru"}, grpc.Header(&header))
+	require.NoError(t, err)
+	assert.Empty(t, header.Get(auth.TokenName))
+
+	_, err = client.DeleteURLs(ctx, &proto.DeleteURLsRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	ctx = metadata.AppendToOutgoingContext(context.Background(), auth.APIKeyHeader, auth.APIKeyPrefix+"unknown")
+	_, err = client.AddURL(ctx, &proto.AddURLRequest{OriginalUrl: "https://ya.ru"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestAdminRoles(t *testing.T) {
+	client := startServer(t, storage.NewMapDB())
+	withRoles := func(roles ...string) context.Context {
+		token, err := tokens.Issue(auth.User{ID: "user", Registered: true, Roles: roles})
+		require.NoError(t, err)
+		return metadata.AppendToOutgoingContext(context.Background(), auth.TokenName, token)
+	}
+
+	_, err := client.AdminListURLs(context.Background(), &proto.AdminListURLsRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.AdminListURLs(withRoles(), &proto.AdminListURLsRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.AdminSetURLDisabled(withRoles(auth.RoleAuditor), &proto.AdminSetURLDisabledRequest{ShortUrl: "abc"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// Роль пропускает запрос к обработчику; in-memory хранилище не поддерживает статистику пользователей.
+	_, err = client.AdminGetUserStats(withRoles(auth.RoleAuditor), &proto.AdminGetUserStatsRequest{UserId: "other"})
+	assert.Equal(t, codes.Internal, status.Code(err))
+	_, err = client.AdminSetURLDisabled(withRoles(auth.RoleAdmin), &proto.AdminSetURLDisabledRequest{ShortUrl: "abc"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+// abusiveStorage - in-memory хранилище, в котором все URL заблокированы по жалобам.
+type abusiveStorage struct {
+	*storage.MapDB
+}
+
+func (a abusiveStorage) GetURL(ctx context.Context, shortenURL string) (string, error) {
+	return "", storage.ErrAbusiveURL
+}
+
+func TestGetURLDisabledForAbuse(t *testing.T) {
+	_, err := startServer(t, abusiveStorage{MapDB: storage.NewMapDB()}).GetURL(context.Background(), &proto.GetURLRequest{ShortUrl: "abc"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = startServer(t, storage.NewMapDB()).GetURL(context.Background(), &proto.GetURLRequest{ShortUrl: "abc"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestQuota(t *testing.T) {
+	db := storage.NewMapDB()
+	db.SetDefaultQuota(models.Quota{Daily: 1})
+	client := startServer(t, db)
+	withRoles := func(roles ...string) context.Context {
+		token, err := tokens.Issue(auth.User{ID: "user", Registered: true, Roles: roles})
+		require.NoError(t, err)
+		return metadata.AppendToOutgoingContext(context.Background(), auth.TokenName, token)
+	}
+
+	_, err := client.AddURL(withRoles(), &proto.AddURLRequest{OriginalUrl: "https://ya.ru"})
+	require.NoError(t, err)
+	_, err = client.AddURL(withRoles(), &proto.AddURLRequest{OriginalUrl: "https://vk.com"})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	quota, err := client.GetQuota(withRoles(), &emptypb.Empty{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), quota.DailyLimit)
+	assert.Equal(t, int64(1), quota.DailyUsed)
+	assert.Equal(t, int64(1), quota.TotalUsed)
+	assert.False(t, quota.Custom)
+
+	_, err = client.AdminSetUserQuota(withRoles(auth.RoleAuditor), &proto.AdminSetUserQuotaRequest{UserId: "user", DailyLimit: 2})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.AdminSetUserQuota(withRoles(auth.RoleAdmin), &proto.AdminSetUserQuotaRequest{UserId: "user", DailyLimit: 2})
+	require.NoError(t, err)
+	quota, err = client.AdminGetUserQuota(withRoles(auth.RoleAuditor), &proto.AdminGetUserQuotaRequest{UserId: "user"})
+	require.NoError(t, err)
+	assert.True(t, quota.Custom)
+	_, err = client.AddURL(withRoles(), &proto.AddURLRequest{OriginalUrl: "https://vk.com"})
+	require.NoError(t, err)
+
+	_, err = client.AdminDeleteUserQuota(withRoles(auth.RoleAdmin), &proto.AdminDeleteUserQuotaRequest{UserId: "user"})
+	require.NoError(t, err)
+	_, err = client.AdminDeleteUserQuota(withRoles(auth.RoleAdmin), &proto.AdminDeleteUserQuotaRequest{UserId: "user"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestLogout(t *testing.T) {
+	db := storage.NewMapDB()
+	revocations, err := auth.NewRevocationList(context.Background(), db)
+	require.NoError(t, err)
+	tokens, err := auth.New(config.ServerConfig{AuthSecret: "secret"}, revocations, nil)
+	require.NoError(t, err)
+
+	listener := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(interceptors.JWTInterceptor(tokens, db)))
+	proto.RegisterURLShortenerServer(srv, New(db, tokens, "http://localhost:8080", 2, time.Hour, nil, nil))
+	go srv.Serve(listener)
+	defer srv.Stop()
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := proto.NewURLShortenerClient(conn)
+
+	token, err := tokens.Issue(auth.User{ID: "user", Registered: true})
+	require.NoError(t, err)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), auth.TokenName, token)
+
+	var header metadata.MD
+	_, err = client.Logout(ctx, &emptypb.Empty{}, grpc.Header(&header))
+	require.NoError(t, err)
+	assert.Empty(t, header.Get(auth.TokenName))
+
+	// Отозванный токен не принимается: interceptor выдает новый токен.
+	_, err = client.Logout(ctx, &emptypb.Empty{}, grpc.Header(&header))
+	require.NoError(t, err)
+	assert.NotEmpty(t, header.Get(auth.TokenName))
+}
+
+func TestRefresh(t *testing.T) {
+	db := storage.NewMapDB()
+	tokens, err := auth.New(config.ServerConfig{AuthSecret: "secret"}, nil, auth.NewSessions(db, time.Hour, nil))
+	require.NoError(t, err)
+
+	listener := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(interceptors.JWTInterceptor(tokens, db)))
+	proto.RegisterURLShortenerServer(srv, New(db, tokens, "http://localhost:8080", 2, time.Hour, nil, nil))
+	go srv.Serve(listener)
+	defer srv.Stop()
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := proto.NewURLShortenerClient(conn)
+
+	// Новый пользователь без изменяющего вызова получает только токен доступа: сессия не сохраняется.
+	var header metadata.MD
+	_, err = client.Logout(context.Background(), &emptypb.Empty{}, grpc.Header(&header))
+	require.NoError(t, err)
+	require.Len(t, header.Get(auth.TokenName), 1)
+	assert.Empty(t, header.Get(auth.RefreshTokenName))
+
+	// Первый изменяющий вызов начинает сессию того же пользователя.
+	user, err := tokens.User(header.Get(auth.TokenName)[0])
+	require.NoError(t, err)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), auth.TokenName, header.Get(auth.TokenName)[0])
+	_, err = client.AddURL(ctx, &proto.AddURLRequest{OriginalUrl: "https://ya.ru"}, grpc.Header(&header))
+	require.NoError(t, err)
+	require.Len(t, header.Get(auth.RefreshTokenName), 1)
+	started, err := tokens.User(header.Get(auth.TokenName)[0])
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, started.ID)
+	assert.NotEmpty(t, started.SessionID)
+
+	refresh := func(token string) (metadata.MD, error) {
+		var header metadata.MD
+		ctx := metadata.AppendToOutgoingContext(context.Background(), auth.RefreshTokenName, token)
+		_, err := client.Refresh(ctx, &emptypb.Empty{}, grpc.Header(&header))
+		return header, err
+	}
+	first := header.Get(auth.RefreshTokenName)[0]
+	header, err = refresh(first)
+	require.NoError(t, err)
+	refreshed, err := tokens.User(header.Get(auth.TokenName)[0])
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, refreshed.ID)
+
+	// Повторное использование токена обновления отклоняется и завершает сессию.
+	_, err = refresh(first)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = refresh(header.Get(auth.RefreshTokenName)[0])
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestBearerToken(t *testing.T) {
+	db := storage.NewMapDB()
+	revocations, err := auth.NewRevocationList(context.Background(), db)
+	require.NoError(t, err)
+	tokens, err := auth.New(config.ServerConfig{AuthSecret: "secret"}, revocations, nil)
+	require.NoError(t, err)
+
+	listener := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(interceptors.JWTInterceptor(tokens, db)))
+	proto.RegisterURLShortenerServer(srv, New(db, tokens, "http://localhost:8080", 2, time.Hour, nil, nil))
+	go srv.Serve(listener)
+	defer srv.Stop()
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := proto.NewURLShortenerClient(conn)
+
+	token, err := tokens.Issue(auth.User{ID: "user"})
+	require.NoError(t, err)
+
+	var header metadata.MD
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+	_, err = client.Logout(ctx, &emptypb.Empty{}, grpc.Header(&header))
+	require.NoError(t, err)
+	assert.Empty(t, header.Get(auth.TokenName))
+
+	// Невалидный токен в authorization отклоняется, а не заменяется новым пользователем.
+	ctx = metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer bad", auth.TokenName, token)
+	_, err = client.Logout(ctx, &emptypb.Empty{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestRateLimit(t *testing.T) {
+	db := storage.NewMapDB()
+	limiter := ratelimit.New(ratelimit.NewMemoryStore(), map[ratelimit.Class]ratelimit.Limit{ratelimit.ClassCreate: {Rate: 1.0 / 60, Burst: 1}})
+
+	listener := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(interceptors.JWTInterceptor(tokens, db),
+		interceptors.RateLimitInterceptor(limiter, interceptors.MethodRateClasses)))
+	proto.RegisterURLShortenerServer(srv, New(db, tokens, "http://localhost:8080", 2, time.Hour, nil, nil))
+	go srv.Serve(listener)
+	defer srv.Stop()
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := proto.NewURLShortenerClient(conn)
+
+	token, err := tokens.Issue(auth.User{ID: "user"})
+	require.NoError(t, err)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), auth.TokenName, token)
+
+	added, err := client.AddURL(ctx, &proto.AddURLRequest{OriginalUrl: "https://ya.ru"})
+	require.NoError(t, err)
+	var header metadata.MD
+	_, err = client.AddURL(ctx, &proto.AddURLRequest{OriginalUrl: "https://go.dev"}, grpc.Header(&header))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, []string{"60"}, header.Get("retry-after"))
+
+	// Лимит другого класса не исчерпан.
+	_, err = client.GetURL(ctx, &proto.GetURLRequest{ShortUrl: strings.TrimPrefix(added.Result, "http://localhost:8080/")})
+	require.NoError(t, err)
+}
+
+func TestTrustedSubnet(t *testing.T) {
+	db := storage.NewMapDB()
+	startTCPServer := func(subnets, proxies string, policy auth.Policy) proto.URLShortenerClient {
+		trustedSubnets, err := clientip.ParsePrefixes(subnets)
+		require.NoError(t, err)
+		trustedProxies, err := clientip.ParsePrefixes(proxies)
+		require.NoError(t, err)
+		resolver, err := clientip.New(trustedProxies, clientip.HeaderXForwardedFor)
+		require.NoError(t, err)
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		srv := grpc.NewServer(grpc.ChainUnaryInterceptor(interceptors.ClientIPInterceptor(resolver),
+			interceptors.JWTInterceptor(tokens, db), interceptors.TrustedSubnetInterceptor(trustedSubnets, policy)))
+		proto.RegisterURLShortenerServer(srv, New(db, tokens, "http://localhost:8080", 2, time.Hour, nil, nil))
+		go srv.Serve(listener)
+		t.Cleanup(srv.Stop)
+		conn, err := grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		return proto.NewURLShortenerClient(conn)
+	}
+	ctx := context.Background()
+
+	// Доступ пропускает запрос к обработчику; in-memory хранилище не поддерживает статистику.
+	_, err := startTCPServer("127.0.0.0/8,::1", "", interceptors.MethodSubnets).GetStats(ctx, &emptypb.Empty{})
+	assert.Equal(t, codes.Internal, status.Code(err))
+
+	client := startTCPServer("10.0.0.0/8", "", interceptors.MethodSubnets)
+	_, err = client.GetStats(ctx, &emptypb.Empty{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	// Без доверенного прокси метаданные x-forwarded-for не учитываются.
+	_, err = client.GetStats(metadata.AppendToOutgoingContext(ctx, "x-forwarded-for", "10.1.1.1"), &emptypb.Empty{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	// Остальные методы доступны с любого адреса.
+	_, err = client.AddURL(ctx, &proto.AddURLRequest{OriginalUrl: "https://ya.ru"})
+	require.NoError(t, err)
+
+	client = startTCPServer("10.0.0.0/8", "127.0.0.1", interceptors.MethodSubnets)
+	_, err = client.GetStats(metadata.AppendToOutgoingContext(ctx, "x-forwarded-for", "10.1.1.1"), &emptypb.Empty{})
+	assert.Equal(t, codes.Internal, status.Code(err))
+	_, err = client.GetStats(metadata.AppendToOutgoingContext(ctx, "x-forwarded-for", "10.1.1.1, 198.51.100.1"), &emptypb.Empty{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// Роли из таблицы открывают метод с любого адреса.
+	client = startTCPServer("", "", auth.Policy{proto.URLShortener_GetStats_FullMethodName: {auth.RoleAdmin}})
+	_, err = client.GetStats(ctx, &emptypb.Empty{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	token, err := tokens.Issue(auth.User{ID: "user", Registered: true, Roles: []string{auth.RoleAdmin}})
+	require.NoError(t, err)
+	_, err = client.GetStats(metadata.AppendToOutgoingContext(ctx, auth.TokenName, token), &emptypb.Empty{})
+	assert.Equal(t, codes.Internal, status.Code(err))
+}
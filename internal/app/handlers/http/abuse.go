@@ -0,0 +1,124 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/vancho-go/url-shortener/internal/app/auth"
+	"github.com/vancho-go/url-shortener/internal/app/handlers/http/middlewares"
+	"github.com/vancho-go/url-shortener/internal/app/models"
+	"github.com/vancho-go/url-shortener/internal/app/storage"
+)
+
+// maxReportReasonLength - максимальная длина причины жалобы.
+const maxReportReasonLength = 500
+
+// maxAbuseReportsLimit - максимальное количество жалоб, возвращаемых GetAbuseReports.
+const maxAbuseReportsLimit = 1000
+
+// ReportURL принимает жалобу на сокращенный URL от любого посетителя. Жалобы одного автора или из одной
+// сети на один URL не суммируются; набрав threshold жалоб разных авторов, URL блокируется автоматически.
+func ReportURL(db storage.AbuseStorager, threshold int64) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		var request models.APIAbuseReportRequest
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			http.Error(res, "Error decoding request", http.StatusBadRequest)
+			return
+		}
+		reason := strings.TrimSpace(request.Reason)
+		if reason == "" || utf8.RuneCountInString(reason) > maxReportReasonLength {
+			http.Error(res, "Bad reason", http.StatusBadRequest)
+			return
+		}
+
+		user, _ := auth.FromContext(req.Context())
+		network := reporterNetwork(middlewares.ClientIP(req))
+		report := models.AbuseReport{
+			ShortenURL: chi.URLParam(req, "shortenURL"),
+			Reporter:   reporter(user, network),
+			Network:    network,
+			Reason:     reason,
+		}
+
+		ctx, cancel := context.WithTimeout(req.Context(), 1*time.Second)
+		defer cancel()
+		count, err := db.AddAbuseReport(ctx, report, threshold)
+		if err != nil {
+			writeStorageError(res, err)
+			return
+		}
+		middlewares.Log.Info("abuse report", zap.String("url", report.ShortenURL),
+			zap.String("reporter", report.Reporter), zap.Int64("reports", count))
+		res.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// GetAbuseReports возвращает жалобы на URL, новые первыми. Параметры запроса: short_url - жалобы
+// на один URL, resolved - рассмотренные жалобы вместо нерассмотренных, limit - количество жалоб.
+func GetAbuseReports(db storage.AbuseStorager) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		filter := models.AbuseReportsFilter{ShortenURL: query.Get("short_url")}
+		if value := query.Get("resolved"); value != "" {
+			resolved, err := strconv.ParseBool(value)
+			if err != nil {
+				http.Error(res, "Bad resolved", http.StatusBadRequest)
+				return
+			}
+			filter.Resolved = resolved
+		}
+		if value := query.Get("limit"); value != "" {
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit < 0 {
+				http.Error(res, "Bad limit", http.StatusBadRequest)
+				return
+			}
+			filter.Limit = min(limit, maxAbuseReportsLimit)
+		}
+
+		ctx, cancel := context.WithTimeout(req.Context(), 5*time.Second)
+		defer cancel()
+		reports, err := db.GetAbuseReports(ctx, filter)
+		if err != nil {
+			writeStorageError(res, err)
+			return
+		}
+		writeJSON(res, http.StatusOK, reports)
+	}
+}
+
+// reporter возвращает автора жалобы: зарегистрированного пользователя или сеть network.
+// Анонимный идентификатор легко сменить, удалив cookie, поэтому анонимные жалобы различаются по сети.
+func reporter(user auth.User, network string) string {
+	if user.Registered {
+		return "user:" + user.ID
+	}
+	return "ip:" + network
+}
+
+// reporterNetwork возвращает сеть автора жалобы с IP адресом ip: IPv4 адрес или IPv6 подсеть /64.
+// Абонент обычно получает целую подсеть /64, поэтому адреса из нее считаются одним автором.
+func reporterNetwork(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	addr = addr.Unmap()
+	if addr.Is4() {
+		return addr.String()
+	}
+	prefix, err := addr.Prefix(64)
+	if err != nil {
+		return addr.String()
+	}
+	return prefix.String()
+}
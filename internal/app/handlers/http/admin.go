@@ -0,0 +1,178 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/vancho-go/url-shortener/internal/app/auth"
+	"github.com/vancho-go/url-shortener/internal/app/handlers/http/middlewares"
+	"github.com/vancho-go/url-shortener/internal/app/models"
+	"github.com/vancho-go/url-shortener/internal/app/storage"
+)
+
+// AdminPolicy - роли, необходимые для вызова административных эндпоинтов.
+// Применяется middlewares.RoleMiddleware, ключ - метод и шаблон пути chi.
+// Эндпоинты, которых нет в таблице, доступны только администратору.
+var AdminPolicy = auth.Policy{
+	auth.PolicyDefault:                          {auth.RoleAdmin},
+	"GET /api/admin/urls":                       {auth.RoleAdmin, auth.RoleAuditor},
+	"PUT /api/admin/urls/{shortenURL}/disabled": {auth.RoleAdmin},
+	"DELETE /api/admin/users/{userID}/urls":     {auth.RoleAdmin},
+	"GET /api/admin/users/{userID}/stats":       {auth.RoleAdmin, auth.RoleAuditor},
+	"GET /api/admin/users/{userID}/quota":       {auth.RoleAdmin, auth.RoleAuditor},
+	"PUT /api/admin/users/{userID}/quota":       {auth.RoleAdmin},
+	"DELETE /api/admin/users/{userID}/quota":    {auth.RoleAdmin},
+	"GET /api/admin/reports":                    {auth.RoleAdmin, auth.RoleAuditor},
+}
+
+// GetAllURLs возвращает URL всех пользователей с их владельцами.
+// Параметры постраничной выдачи и фильтрации те же, что у GetUserURLs.
+func GetAllURLs(db storage.AdminStorager, addr string) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		filter, err := parseUserURLsFilter(req)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(req.Context(), 5*time.Second)
+		defer cancel()
+		page, err := db.GetAllURLs(ctx, filter)
+		if err != nil {
+			if errors.Is(err, storage.ErrInvalidCursor) {
+				http.Error(res, "Bad cursor", http.StatusBadRequest)
+				return
+			}
+			writeStorageError(res, err)
+			return
+		}
+		writeURLsPage(res, req, page, addr)
+	}
+}
+
+// SetURLDisabled блокирует или разблокирует URL любого пользователя.
+// Заблокированный URL не раскрывается (410 Gone), но остается у владельца. URL, заблокированный
+// с причиной models.DisabledReasonAbuse, отвечает 451. Разблокировка закрывает жалобы на URL.
+func SetURLDisabled(db storage.AdminStorager) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		var request models.APIDisableURLRequest
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			http.Error(res, "Error decoding request", http.StatusBadRequest)
+			return
+		}
+		if request.Reason != "" && request.Reason != models.DisabledReasonAbuse {
+			http.Error(res, "Bad reason", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(req.Context(), 1*time.Second)
+		defer cancel()
+		if err := db.SetURLDisabled(ctx, chi.URLParam(req, "shortenURL"), request.Disabled, request.Reason); err != nil {
+			writeStorageError(res, err)
+			return
+		}
+		user, _ := auth.FromContext(req.Context())
+		middlewares.Log.Info("url disabled by admin", zap.String("admin", user.ID),
+			zap.String("url", chi.URLParam(req, "shortenURL")), zap.Bool("disabled", request.Disabled), zap.String("reason", request.Reason))
+		res.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// DeleteAnyUserURLs удаляет URL пользователя userID. Как и DeleteURLs, удаление асинхронное.
+func DeleteAnyUserURLs(db storage.UserStorager) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID := chi.URLParam(req, "userID")
+
+		var shortenUrls []string
+		if err := json.NewDecoder(req.Body).Decode(&shortenUrls); err != nil {
+			http.Error(res, "Error deleting shorten URLs", http.StatusBadRequest)
+			return
+		}
+		urlsToDelete := make([]models.DeleteURLRequest, len(shortenUrls))
+		for pos, url := range shortenUrls {
+			urlsToDelete[pos].ShortenURL = url
+			urlsToDelete[pos].UserID = userID
+		}
+
+		res.WriteHeader(http.StatusAccepted)
+
+		ctx, cancel := context.WithTimeout(req.Context(), 60*time.Second)
+		defer cancel()
+		if err := db.DeleteUserURLs(ctx, urlsToDelete...); err != nil {
+			middlewares.Log.Error("error deleting", zap.Error(err))
+		}
+	}
+}
+
+// GetUserStats возвращает статистику URL пользователя userID.
+func GetUserStats(db storage.AdminStorager) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		ctx, cancel := context.WithTimeout(req.Context(), 1*time.Second)
+		defer cancel()
+		stats, err := db.GetUserStats(ctx, chi.URLParam(req, "userID"))
+		if err != nil {
+			writeStorageError(res, err)
+			return
+		}
+		writeJSON(res, http.StatusOK, stats)
+	}
+}
+
+// GetAnyUserQuota возвращает квоты пользователя userID и их текущее использование.
+func GetAnyUserQuota(db storage.QuotaStorager) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		ctx, cancel := context.WithTimeout(req.Context(), 1*time.Second)
+		defer cancel()
+		quota, err := db.GetQuota(ctx, chi.URLParam(req, "userID"))
+		if err != nil {
+			writeStorageError(res, err)
+			return
+		}
+		writeJSON(res, http.StatusOK, quota)
+	}
+}
+
+// SetUserQuota задает квоты пользователя userID вместо квот по умолчанию.
+// Нулевая квота снимает ограничение.
+func SetUserQuota(db storage.QuotaStorager) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		var request models.Quota
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			http.Error(res, "Error decoding request", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(req.Context(), 1*time.Second)
+		defer cancel()
+		if err := db.SetUserQuota(ctx, chi.URLParam(req, "userID"), request); err != nil {
+			writeStorageError(res, err)
+			return
+		}
+		user, _ := auth.FromContext(req.Context())
+		middlewares.Log.Info("user quota set by admin", zap.String("admin", user.ID),
+			zap.String("user", chi.URLParam(req, "userID")), zap.Int64("daily", request.Daily), zap.Int64("total", request.Total))
+		res.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// DeleteUserQuota возвращает пользователю userID квоты по умолчанию.
+func DeleteUserQuota(db storage.QuotaStorager) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		ctx, cancel := context.WithTimeout(req.Context(), 1*time.Second)
+		defer cancel()
+		if err := db.DeleteUserQuota(ctx, chi.URLParam(req, "userID")); err != nil {
+			writeStorageError(res, err)
+			return
+		}
+		user, _ := auth.FromContext(req.Context())
+		middlewares.Log.Info("user quota reset by admin", zap.String("admin", user.ID),
+			zap.String("user", chi.URLParam(req, "userID")))
+		res.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,117 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/vancho-go/url-shortener/internal/app/auth"
+	"github.com/vancho-go/url-shortener/internal/app/handlers/http/middlewares"
+	"github.com/vancho-go/url-shortener/internal/app/models"
+	"github.com/vancho-go/url-shortener/internal/app/storage"
+)
+
+// CreateAPIKey создает API ключ пользователя. Ключ возвращается в ответе один раз,
+// в хранилище сохраняется только его хеш. Если права не переданы, ключ получает все права.
+func CreateAPIKey(db storage.APIKeyStorager) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID, ok := requireTokenUser(res, req)
+		if !ok {
+			return
+		}
+
+		var request models.APIKeyRequest
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			http.Error(res, "Error decoding API key", http.StatusBadRequest)
+			return
+		}
+		scopes, err := auth.NormalizeScopes(request.Scopes)
+		if err != nil {
+			http.Error(res, "Bad scopes", http.StatusBadRequest)
+			return
+		}
+
+		key, hash, prefix, err := auth.GenerateAPIKey()
+		if err != nil {
+			middlewares.Log.Error("error generating api key", zap.Error(err))
+			http.Error(res, "Error generating API key", http.StatusInternalServerError)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(req.Context(), 1*time.Second)
+		defer cancel()
+		created, err := db.CreateAPIKey(ctx, models.APIKey{UserID: userID, Name: request.Name, Prefix: prefix, Scopes: scopes}, hash)
+		if err != nil {
+			writeStorageError(res, err)
+			return
+		}
+		created.Key = key
+		writeJSON(res, http.StatusCreated, created)
+	}
+}
+
+// GetAPIKeys возвращает API ключи пользователя (без самих ключей).
+func GetAPIKeys(db storage.APIKeyStorager) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID, ok := requireTokenUser(res, req)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(req.Context(), 1*time.Second)
+		defer cancel()
+		keys, err := db.GetAPIKeys(ctx, userID)
+		if err != nil {
+			writeStorageError(res, err)
+			return
+		}
+		writeJSON(res, http.StatusOK, keys)
+	}
+}
+
+// RevokeAPIKey отзывает API ключ пользователя.
+func RevokeAPIKey(db storage.APIKeyStorager) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID, ok := requireTokenUser(res, req)
+		if !ok {
+			return
+		}
+
+		keyID, err := strconv.ParseInt(chi.URLParam(req, "keyID"), 10, 64)
+		if err != nil {
+			http.Error(res, "Bad key id", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(req.Context(), 1*time.Second)
+		defer cancel()
+		if err = db.RevokeAPIKey(ctx, userID, keyID); err != nil {
+			writeStorageError(res, err)
+			return
+		}
+		res.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// errAPIKeyManagement - ошибка управления API ключами с помощью API ключа.
+var errAPIKeyManagement = errors.New("API keys can only be managed with a user token")
+
+// requireTokenUser извлекает userID пользователя, аутентифицированного токеном.
+// Управлять API ключами с помощью API ключа нельзя: утекший ключ не должен позволять выпускать новые.
+func requireTokenUser(res http.ResponseWriter, req *http.Request) (string, bool) {
+	userID, ok := requireUserID(res, req)
+	if !ok {
+		return "", false
+	}
+	if user, _ := auth.FromContext(req.Context()); user.APIKeyID != 0 {
+		http.Error(res, errAPIKeyManagement.Error(), http.StatusForbidden)
+		return "", false
+	}
+	return userID, true
+}
@@ -0,0 +1,251 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vancho-go/url-shortener/internal/app/auth"
+	"github.com/vancho-go/url-shortener/internal/app/handlers/http/middlewares"
+	"github.com/vancho-go/url-shortener/internal/app/models"
+	"github.com/vancho-go/url-shortener/internal/app/storage"
+)
+
+// JWKS возвращает публичные ключи, по которым другие сервисы могут проверять токены сервиса.
+func JWKS(tokens auth.TokenManager) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Cache-Control", "public, max-age=300")
+		writeJSON(res, http.StatusOK, tokens.JWKS())
+	}
+}
+
+// SignUp регистрирует учетную запись по email и паролю и выполняет вход в нее.
+// Если передан merge, URL текущего анонимного пользователя переносятся в учетную запись.
+// Токен учетной записи содержит роли, назначенные ей в roles.
+func SignUp(db storage.AccountStorager, tokens auth.TokenManager, roles auth.RoleBindings) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		request, ok := decodeCredentials(res, req)
+		if !ok {
+			return
+		}
+		email, err := auth.NormalizeEmail(request.Email)
+		if err != nil {
+			http.Error(res, "Bad email", http.StatusBadRequest)
+			return
+		}
+		passwordHash, err := auth.HashPassword(request.Password)
+		if err != nil {
+			if errors.Is(err, auth.ErrBadPassword) {
+				http.Error(res, "Password must be 8 to 72 bytes long", http.StatusBadRequest)
+				return
+			}
+			middlewares.Log.Error("error hashing password", zap.Error(err))
+			http.Error(res, "Error hashing password", http.StatusInternalServerError)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(req.Context(), 1*time.Second)
+		defer cancel()
+		account, err := db.CreateAccount(ctx, models.Account{ID: auth.GenerateUserID(), Email: email}, passwordHash)
+		if err != nil {
+			writeStorageError(res, err)
+			return
+		}
+		signIn(ctx, res, req, db, tokens, roles, account, request.Merge, http.StatusCreated)
+	}
+}
+
+// SignIn выполняет вход в учетную запись по email и паролю.
+// Если передан merge, URL текущего анонимного пользователя переносятся в учетную запись.
+// Токен учетной записи содержит роли, назначенные ей в roles.
+func SignIn(db storage.AccountStorager, tokens auth.TokenManager, roles auth.RoleBindings) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		request, ok := decodeCredentials(res, req)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(req.Context(), 1*time.Second)
+		defer cancel()
+		// Если учетной записи нет, хеш остается пустым, и проверка пароля все равно выполняется,
+		// чтобы ответ не выдавал, зарегистрирован ли email.
+		var account *models.Account
+		var passwordHash string
+		if email, err := auth.NormalizeEmail(request.Email); err == nil {
+			account, passwordHash, err = db.GetAccountByEmail(ctx, email)
+			if err != nil && !errors.Is(err, storage.ErrNotFound) {
+				writeStorageError(res, err)
+				return
+			}
+		}
+		if err := auth.CheckPassword(passwordHash, request.Password); err != nil {
+			http.Error(res, "Wrong email or password", http.StatusUnauthorized)
+			return
+		}
+		signIn(ctx, res, req, db, tokens, roles, account, request.Merge, http.StatusOK)
+	}
+}
+
+// Refresh продлевает сессию: обменивает токен обновления из заголовка RefreshToken или cookie на новую
+// пару токенов того же пользователя и передает их в cookie и заголовках ответа. Использованный токен
+// обновления больше не принимается, а его повторное предъявление завершает всю сессию.
+func Refresh(tokens auth.TokenManager) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		refreshToken, ok := middlewares.RefreshToken(req)
+		if !ok {
+			http.Error(res, "No refresh token", http.StatusUnauthorized)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(req.Context(), 1*time.Second)
+		defer cancel()
+		_, session, err := tokens.Refresh(ctx, refreshToken)
+		if err != nil {
+			middlewares.LogRefreshError(err)
+			if errors.Is(err, auth.ErrInvalidRefreshToken) || errors.Is(err, auth.ErrRefreshTokenReused) {
+				middlewares.ClearTokenCookie(res)
+				http.Error(res, "Bad refresh token", http.StatusUnauthorized)
+				return
+			}
+			http.Error(res, "Error refreshing session", http.StatusInternalServerError)
+			return
+		}
+		middlewares.SetSession(res, session, tokens)
+		res.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Logout отзывает токен запроса (Authorization: Bearer или cookie), завершает его сессию и удаляет cookie. Отозванный токен
+// больше не принимается ни HTTP, ни gRPC, даже если клиент его сохранил. Сессия завершается и по
+// токену обновления, если токен доступа уже истек. Другие выпущенные пользователю токены доступа
+// действуют до истечения срока (см. auth.JWTManager.Revoke). Запрос без валидных токенов тоже успешен.
+func Logout(tokens auth.TokenManager) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		ctx, cancel := context.WithTimeout(req.Context(), 1*time.Second)
+		defer cancel()
+		if token, ok := middlewares.AccessToken(req); ok {
+			if user, err := tokens.User(token); err == nil {
+				if err = tokens.Revoke(ctx, user); err != nil {
+					middlewares.Log.Error("error revoking token", zap.Error(err))
+					http.Error(res, "Error revoking token", http.StatusInternalServerError)
+					return
+				}
+			}
+		}
+		if refreshToken, ok := middlewares.RefreshToken(req); ok {
+			if err := tokens.RevokeRefresh(ctx, refreshToken); err != nil {
+				middlewares.Log.Error("error revoking refresh token", zap.Error(err))
+				http.Error(res, "Error revoking token", http.StatusInternalServerError)
+				return
+			}
+		}
+		middlewares.ClearTokenCookie(res)
+		res.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// decodeCredentials декодирует тело запроса регистрации или входа.
+func decodeCredentials(res http.ResponseWriter, req *http.Request) (models.APICredentialsRequest, bool) {
+	var request models.APICredentialsRequest
+	if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+		http.Error(res, "Error decoding credentials", http.StatusBadRequest)
+		return request, false
+	}
+	return request, true
+}
+
+// signIn переносит URL анонимного пользователя из токена запроса (если запрошено), начинает сессию
+// учетной записи с ее ролями, передает токены клиенту и отвечает данными учетной записи.
+func signIn(ctx context.Context, res http.ResponseWriter, req *http.Request, db storage.AccountStorager,
+	tokens auth.TokenManager, roles auth.RoleBindings, account *models.Account, merge bool, status int) {
+	account.Roles = roles.For(account.ID)
+	response := models.APIAccountResponse{Account: *account}
+	if merge {
+		if token, ok := middlewares.AccessToken(req); ok {
+			current, err := tokens.User(token)
+			if err == nil && !current.Registered && current.ID != account.ID {
+				if response.Merged, err = db.MergeUserURLs(ctx, current.ID, account.ID); err != nil {
+					writeStorageError(res, err)
+					return
+				}
+			}
+		}
+	}
+
+	session, err := tokens.IssueSession(ctx, auth.User{ID: account.ID, Registered: true, Roles: account.Roles})
+	if err != nil {
+		middlewares.Log.Error("error building new token", zap.Error(err))
+		http.Error(res, "Error building new token", http.StatusInternalServerError)
+		return
+	}
+	middlewares.SetSession(res, session, tokens)
+	writeJSON(res, status, response)
+}
+
+// oidcLoginTTL - время, за которое пользователь должен вернуться от OIDC провайдера.
+const oidcLoginTTL = 10 * time.Minute
+
+// LoginOIDC начинает вход через OIDC провайдер: сохраняет state, nonce и verifier PKCE в cookie
+// и перенаправляет пользователя к провайдеру. Параметр merge=true переносит URL текущего
+// анонимного пользователя в учетную запись после входа.
+func LoginOIDC(provider *auth.OIDCProvider) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		login, err := auth.NewOIDCLogin()
+		if err != nil {
+			middlewares.Log.Error("error generating oidc login", zap.Error(err))
+			http.Error(res, "Error starting login", http.StatusInternalServerError)
+			return
+		}
+		login.Merge = req.URL.Query().Get("merge") == "true"
+
+		cookie := middlewares.Cookies.New(auth.OIDCStateCookie, login.String())
+		cookie.Path = auth.OIDCCallbackPath
+		cookie.MaxAge = int(oidcLoginTTL.Seconds())
+		// Lax независимо от настроек: cookie должна прийти при переходе от провайдера обратно на callback.
+		cookie.SameSite = http.SameSiteLaxMode
+		http.SetCookie(res, cookie)
+		http.Redirect(res, req, provider.AuthCodeURL(login), http.StatusFound)
+	}
+}
+
+// CallbackOIDC завершает вход через OIDC провайдер: проверяет state, обменивает код на ID токен
+// и выполняет вход пользователя, отображенного из sub провайдера в локальный идентификатор.
+func CallbackOIDC(db storage.AccountStorager, tokens auth.TokenManager, provider *auth.OIDCProvider, roles auth.RoleBindings) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		cookie, err := req.Cookie(auth.OIDCStateCookie)
+		if err != nil {
+			http.Error(res, "Login is not started", http.StatusBadRequest)
+			return
+		}
+		cleared := middlewares.Cookies.New(auth.OIDCStateCookie, "")
+		cleared.Path = auth.OIDCCallbackPath
+		cleared.MaxAge = -1
+		http.SetCookie(res, cleared)
+
+		query := req.URL.Query()
+		login, err := auth.ParseOIDCLogin(cookie.Value)
+		if err != nil || query.Get("state") != login.State {
+			http.Error(res, "Bad login state", http.StatusBadRequest)
+			return
+		}
+		if providerErr := query.Get("error"); providerErr != "" {
+			http.Error(res, "Login rejected by provider: "+providerErr, http.StatusUnauthorized)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(req.Context(), 10*time.Second)
+		defer cancel()
+		identity, err := provider.Exchange(ctx, query.Get("code"), login)
+		if err != nil {
+			middlewares.Log.Warn("oidc login failed", zap.Error(err))
+			http.Error(res, "Login failed", http.StatusUnauthorized)
+			return
+		}
+		account := &models.Account{ID: identity.UserID, Email: identity.Email}
+		signIn(ctx, res, req, db, tokens, roles, account, login.Merge, http.StatusOK)
+	}
+}
@@ -0,0 +1,273 @@
+package http
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vancho-go/url-shortener/internal/app/handlers/http/middlewares"
+	"github.com/vancho-go/url-shortener/internal/app/models"
+	"github.com/vancho-go/url-shortener/internal/app/screening"
+	"github.com/vancho-go/url-shortener/internal/app/storage"
+	"github.com/vancho-go/url-shortener/internal/app/urlnorm"
+)
+
+// csvTagSeparator - разделитель тегов внутри колонки tags.
+const csvTagSeparator = ";"
+
+// errBadExpiry - ошибка формата колонки expires_at.
+var errBadExpiry = errors.New("bad expires_at, RFC 3339 time in the future expected")
+
+// ImportURLs сокращает URL из CSV файла.
+// Первая строка файла - заголовок с колонками original_url (обязательная), alias, tags и expires_at.
+// Теги перечисляются через ";", expires_at задается в формате RFC 3339.
+// Файл читается построчно и сохраняется пачками, результат по каждой строке
+// (line, original_url, short_url, error) пишется в ответ в формате CSV по мере сохранения пачек.
+// Оригинальные URL сохраняются в каноническом виде, некорректные и заблокированные URL отклоняются
+// (см. urlnorm и screening).
+func ImportURLs(db storage.URLStorager, urls *urlnorm.Normalizer, screener *screening.Screener, addr string) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID, ok := requireUserID(res, req)
+		if !ok {
+			return
+		}
+
+		reader := csv.NewReader(req.Body)
+		reader.FieldsPerRecord = -1
+		reader.ReuseRecord = true
+		header, err := reader.Read()
+		if err != nil {
+			http.Error(res, "Error reading CSV header", http.StatusBadRequest)
+			return
+		}
+		columns := make(map[string]int, len(header))
+		for i, name := range header {
+			columns[strings.ToLower(strings.TrimSpace(name))] = i
+		}
+		if _, ok = columns["original_url"]; !ok {
+			http.Error(res, "CSV header must contain original_url column", http.StatusBadRequest)
+			return
+		}
+
+		rc := http.NewResponseController(res)
+		enableFullDuplex(rc)
+		res.Header().Set("Content-Type", "text/csv")
+		res.WriteHeader(http.StatusOK)
+		writer := csv.NewWriter(res)
+		writer.Write([]string{"line", "original_url", "short_url", "error"})
+
+		// Номер строки файла передается через CorrelationID.
+		batcher := storage.NewBatchWriter(db, userID, storage.DefaultBatchSize, func(result storage.BatchResult) error {
+			record := []string{result.CorrelationID, result.OriginalURL, "", ""}
+			if result.Err != nil {
+				record[3] = result.Err.Error()
+			} else {
+				record[2] = addr + "/" + result.ShortenURL
+			}
+			return writer.Write(record)
+		})
+
+		flush := func() error {
+			writer.Flush()
+			if err := writer.Error(); err != nil {
+				return err
+			}
+			if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+				return err
+			}
+			return nil
+		}
+
+		for line := 2; ; line++ {
+			record, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				// Ошибка чтения оставшейся части файла: сохраняем уже прочитанное и сообщаем об ошибке.
+				middlewares.Log.Warn("error reading CSV", zap.Error(err))
+				writer.Write([]string{strconv.Itoa(line), "", "", err.Error()})
+				break
+			}
+
+			url, err := parseCSVRecord(record, columns)
+			url.CorrelationID = strconv.Itoa(line)
+			if err != nil {
+				err = batcher.Reject(req.Context(), url, err)
+			} else {
+				err = addURL(req.Context(), batcher, urls, screener, url)
+			}
+			if err != nil {
+				middlewares.Log.Error("error writing import results", zap.Error(err))
+				return
+			}
+			// Каждая строка добавляет в пачку один URL, пачка сохраняется каждые DefaultBatchSize строк.
+			if (line-1)%storage.DefaultBatchSize == 0 {
+				if err = flush(); err != nil {
+					middlewares.Log.Error("error writing import results", zap.Error(err))
+					return
+				}
+			}
+		}
+
+		if err = batcher.Flush(req.Context()); err == nil {
+			err = flush()
+		}
+		if err != nil {
+			middlewares.Log.Error("error writing import results", zap.Error(err))
+		}
+	}
+}
+
+// addURL проверяет оригинальный URL (см. checkURL) и добавляет его в пачку.
+// Некорректный или заблокированный URL не сохраняется, а передается в пачку с ошибкой.
+// Пустой URL отклоняется самой пачкой.
+func addURL(ctx context.Context, batcher *storage.BatchWriter, urls *urlnorm.Normalizer, screener *screening.Screener,
+	url models.APIBatchRequest) error {
+	if url.OriginalURL != "" {
+		originalURL, err := checkURL(ctx, urls, screener, url.OriginalURL)
+		if err != nil {
+			return batcher.Reject(ctx, url, err)
+		}
+		url.OriginalURL = originalURL
+	}
+	return batcher.Add(ctx, url)
+}
+
+// parseCSVRecord разбирает строку CSV файла импорта.
+func parseCSVRecord(record []string, columns map[string]int) (models.APIBatchRequest, error) {
+	field := func(name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	url := models.APIBatchRequest{
+		OriginalURL: field("original_url"),
+		ShortenURL:  field("alias"),
+	}
+	if tags := field("tags"); tags != "" {
+		for _, tag := range strings.Split(tags, csvTagSeparator) {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				url.Tags = append(url.Tags, tag)
+			}
+		}
+	}
+	if expiry := field("expires_at"); expiry != "" {
+		expiresAt, err := time.Parse(time.RFC3339, expiry)
+		if err != nil || expiresAt.Before(time.Now()) {
+			return url, errBadExpiry
+		}
+		url.ExpiresAt = &expiresAt
+	}
+	return url, nil
+}
+
+// ExportURLs выгружает URL пользователя в формате CSV (по умолчанию) или NDJSON (format=ndjson).
+// Поддерживает те же фильтры, что и GetUserURLs. URL читаются из хранилища страницами
+// и пишутся в ответ по мере чтения.
+func ExportURLs(db storage.UserStorager, addr string) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID, ok := requireUserID(res, req)
+		if !ok {
+			return
+		}
+
+		filter, err := parseUserURLsFilter(req)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.Limit = models.MaxUserURLsPageSize
+
+		var write func(models.APIUserURLResponse) error
+		var flushWriter func() error
+		switch req.URL.Query().Get("format") {
+		case "", "csv":
+			writer := csv.NewWriter(res)
+			write = func(url models.APIUserURLResponse) error {
+				record := []string{
+					url.ShortenURL, url.OriginalURL, url.CreatedAt.Format(time.RFC3339),
+					strconv.FormatBool(url.Deleted), strings.Join(url.Tags, csvTagSeparator), "", "",
+				}
+				if url.FolderID != nil {
+					record[5] = strconv.FormatInt(*url.FolderID, 10)
+				}
+				if url.ExpiresAt != nil {
+					record[6] = url.ExpiresAt.Format(time.RFC3339)
+				}
+				return writer.Write(record)
+			}
+			flushWriter = func() error {
+				writer.Flush()
+				return writer.Error()
+			}
+			res.Header().Set("Content-Type", "text/csv")
+			res.Header().Set("Content-Disposition", `attachment; filename="urls.csv"`)
+			res.WriteHeader(http.StatusOK)
+			writer.Write([]string{"short_url", "original_url", "created_at", "deleted", "tags", "folder_id", "expires_at"})
+		case "ndjson":
+			enc := json.NewEncoder(res)
+			write = func(url models.APIUserURLResponse) error {
+				return enc.Encode(url)
+			}
+			flushWriter = func() error { return nil }
+			res.Header().Set("Content-Type", "application/x-ndjson")
+			res.Header().Set("Content-Disposition", `attachment; filename="urls.ndjson"`)
+			res.WriteHeader(http.StatusOK)
+		default:
+			http.Error(res, "bad format parameter", http.StatusBadRequest)
+			return
+		}
+
+		rc := http.NewResponseController(res)
+		for {
+			ctx, cancel := context.WithTimeout(req.Context(), 1*time.Second)
+			page, err := db.GetUserURLs(ctx, userID, filter)
+			cancel()
+			if err != nil {
+				// Заголовок уже отправлен, поэтому просто обрываем выгрузку.
+				middlewares.Log.Error("error exporting user urls", zap.Error(err))
+				return
+			}
+
+			for _, url := range page.URLs {
+				url.ShortenURL = addr + "/" + url.ShortenURL
+				if err = write(url); err != nil {
+					middlewares.Log.Error("error writing export", zap.Error(err))
+					return
+				}
+			}
+			if err = flushWriter(); err == nil {
+				err = rc.Flush()
+			}
+			if err != nil && !errors.Is(err, http.ErrNotSupported) {
+				middlewares.Log.Error("error writing export", zap.Error(err))
+				return
+			}
+
+			if page.NextCursor == "" {
+				return
+			}
+			filter.Cursor = page.NextCursor
+		}
+	}
+}
+
+// enableFullDuplex разрешает читать тело запроса после начала записи ответа. Без этого сервер HTTP/1.1
+// закрывает непрочитанное тело при первой отправке ответа, и потоковый обработчик теряет остаток запроса.
+func enableFullDuplex(rc *http.ResponseController) {
+	if err := rc.EnableFullDuplex(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		middlewares.Log.Warn("error enabling full duplex", zap.Error(err))
+	}
+}
@@ -20,7 +20,7 @@ func ExampleEncodeURL() {
 	rr := httptest.NewRecorder()
 
 	// Создаем хендлер с использованием нашего MockStorager и адреса для сокращенных URL.
-	handlerFunc := EncodeURL(&db, "http://localhost:8080")
+	handlerFunc := EncodeURL(&db, nil, nil, "http://localhost:8080")
 	handlerFunc(rr, req)
 
 	res := rr.Result()
@@ -40,7 +40,7 @@ func ExampleDecodeURL() {
 
 	// Создаем роутер chi и регистрируем хендлер.
 	r := chi.NewRouter()
-	r.Get("/{shortenURL}", DecodeURL(&db))
+	r.Get("/{shortenURL}", DecodeURL(&db, nil))
 
 	// Создаем тестовый сервер.
 	ts := httptest.NewServer(r)
@@ -72,13 +72,13 @@ func ExampleEncodeURLJSON() {
 	req := httptest.NewRequest(
 		"POST",
 		"http://localhost:8080/api/shorten",
-		strings.NewReader("{\"url\": \"vk.com\"}"))
+		strings.NewReader("{\"url\": \"https://vk.com\"}"))
 
 	// Создаем ResponseRecorder для записи ответа.
 	rr := httptest.NewRecorder()
 
 	// Создаем хендлер с использованием нашего MockStorager и адреса для сокращенных URL.
-	handlerFunc := EncodeURLJSON(&db, "localhost:8080")
+	handlerFunc := EncodeURLJSON(&db, nil, nil, "localhost:8080")
 	handlerFunc(rr, req)
 
 	res := rr.Result()
@@ -98,13 +98,13 @@ func ExampleEncodeBatch() {
 	req := httptest.NewRequest(
 		"POST",
 		"http://localhost:8080/api/shorten/batch",
-		strings.NewReader("[{\"correlation_id\": \"ddd\",\"original_url\": \"facebook.com\"},{\"correlation_id\": \"ddd\",\"original_url\": \"youtube.com\"}]"))
+		strings.NewReader("[{\"correlation_id\": \"ddd\",\"original_url\": \"https://facebook.com\"},{\"correlation_id\": \"ddd\",\"original_url\": \"https://youtube.com\"}]"))
 
 	// Создаем ResponseRecorder для записи ответа.
 	rr := httptest.NewRecorder()
 
 	// Создаем хендлер с использованием нашего MockStorager и адреса для сокращенных URL.
-	handlerFunc := EncodeBatch(&db, "localhost:8080")
+	handlerFunc := EncodeBatch(&db, nil, nil, "localhost:8080")
 	handlerFunc(rr, req)
 
 	res := rr.Result()
@@ -5,10 +5,10 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"github.com/vancho-go/url-shortener/internal/app/handlers/http/middlewares"
 	"io"
 	"math/rand"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -16,25 +16,61 @@ import (
 	"github.com/jackc/pgx/v5/pgconn"
 	"go.uber.org/zap"
 
+	"github.com/vancho-go/url-shortener/internal/app/auth"
 	"github.com/vancho-go/url-shortener/internal/app/base62"
+	"github.com/vancho-go/url-shortener/internal/app/handlers/http/middlewares"
 	"github.com/vancho-go/url-shortener/internal/app/models"
+	"github.com/vancho-go/url-shortener/internal/app/ratelimit"
+	"github.com/vancho-go/url-shortener/internal/app/screening"
 	"github.com/vancho-go/url-shortener/internal/app/storage"
+	"github.com/vancho-go/url-shortener/internal/app/urlnorm"
 )
 
+// RateClasses - классы запросов эндпоинтов для ограничения частоты (см. middlewares.RateLimitMiddleware).
+// Ключ - метод и шаблон пути chi. Остальные эндпоинты - ratelimit.ClassRead.
+var RateClasses = ratelimit.Classes{
+	ratelimit.ClassDefault:       ratelimit.ClassRead,
+	"GET /{shortenURL}":          ratelimit.ClassRedirect,
+	"POST /":                     ratelimit.ClassCreate,
+	"POST /api/shorten":          ratelimit.ClassCreate,
+	"POST /api/shorten/batch":    ratelimit.ClassCreate,
+	"POST /api/shorten/stream":   ratelimit.ClassCreate,
+	"POST /api/user/urls/import": ratelimit.ClassCreate,
+	"POST /auth/signup":          ratelimit.ClassAuth,
+	"POST /auth/signin":          ratelimit.ClassAuth,
+	"POST /auth/refresh":         ratelimit.ClassAuth,
+	"POST /report/{shortenURL}":  ratelimit.ClassCreate,
+}
+
 // DecodeURL возвращает оригинальный URL из хранилища для переданного сокращенного URL.
-func DecodeURL(db storage.URLStorager) http.HandlerFunc {
+// Перед переходом оригинальный URL проверяется повторно (см. screening): вместо перехода
+// на заблокированный URL возвращается страница с предупреждением. URL, заблокированный
+// по жалобам, отвечает 451 со страницей с предупреждением.
+func DecodeURL(db storage.URLStorager, screener *screening.Screener) http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
 		shortenURL := chi.URLParam(req, "shortenURL")
 		ctx, cancel := context.WithTimeout(req.Context(), 1*time.Second)
 		defer cancel()
 		originalURL, err := db.GetURL(ctx, shortenURL)
 		if err == nil {
+			verdict, err := screener.Check(req.Context(), originalURL)
+			if err != nil {
+				middlewares.Log.Warn("error screening URL", zap.String("url", originalURL), zap.Error(err))
+			}
+			if verdict.Blocked {
+				writeWarningPage(res, originalURL, verdict)
+				return
+			}
 			res.Header().Set("Location", originalURL)
 			res.WriteHeader(http.StatusTemporaryRedirect)
 			return
 		}
 
-		if errors.Is(err, storage.ErrDeletedURL) {
+		if errors.Is(err, storage.ErrAbusiveURL) {
+			writeAbusePage(res)
+			return
+		}
+		if errors.Is(err, storage.ErrDeletedURL) || errors.Is(err, storage.ErrExpiredURL) || errors.Is(err, storage.ErrDisabledURL) {
 			res.WriteHeader(http.StatusGone)
 			return
 		}
@@ -43,20 +79,11 @@ func DecodeURL(db storage.URLStorager) http.HandlerFunc {
 }
 
 // EncodeURL генерирует сокращенный URL для переданного оригинального URL.
-func EncodeURL(db storage.URLStorager, addr string) http.HandlerFunc {
+// Оригинальный URL проверяется (см. urlnorm и screening) и сохраняется в каноническом виде.
+func EncodeURL(db storage.URLStorager, urls *urlnorm.Normalizer, screener *screening.Screener, addr string) http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
-		cookie, err := getCookie(req)
-		if err != nil {
-			middlewares.Log.Debug("no cookie in request, got from context")
-		}
-
-		var userID string
-		if cookie != nil {
-			userID, err = middlewares.GetUserID(cookie.Value)
-			if err != nil {
-				middlewares.Log.Warn("something wrong with user_id")
-			}
-		}
+		user, _ := auth.FromContext(req.Context())
+		userID := user.ID
 
 		originalURL, err := io.ReadAll(req.Body)
 		if err != nil {
@@ -67,6 +94,11 @@ func EncodeURL(db storage.URLStorager, addr string) http.HandlerFunc {
 			http.Error(res, "URL parameter is missing", http.StatusBadRequest)
 			return
 		}
+		canonicalURL, err := checkURL(req.Context(), urls, screener, string(originalURL))
+		if err != nil {
+			http.Error(res, err.Error(), checkURLStatus(err))
+			return
+		}
 
 		shortenURL := base62.Base62Encode(rand.Uint64())
 		ctx, cancel := context.WithTimeout(req.Context(), 1*time.Second)
@@ -75,8 +107,12 @@ func EncodeURL(db storage.URLStorager, addr string) http.HandlerFunc {
 			shortenURL = base62.Base62Encode(rand.Uint64())
 		}
 
-		err = db.AddURL(ctx, string(originalURL), shortenURL, userID)
+		err = db.AddURL(ctx, canonicalURL, shortenURL, userID)
 		if err != nil {
+			if errors.Is(err, storage.ErrQuotaExceeded) {
+				writeStorageError(res, err)
+				return
+			}
 			if !isUniqueViolationError(err) {
 				http.Error(res, "Error adding new shorten URL", http.StatusBadRequest)
 				return
@@ -88,7 +124,7 @@ func EncodeURL(db storage.URLStorager, addr string) http.HandlerFunc {
 				return
 			}
 
-			shortenURL, err = pg.GetShortenURLByOriginal(ctx, string(originalURL))
+			shortenURL, err = pg.GetShortenURLByOriginal(ctx, canonicalURL)
 			if err != nil {
 				http.Error(res, "Error getting shorten URL", http.StatusInternalServerError)
 				return
@@ -106,44 +142,48 @@ func EncodeURL(db storage.URLStorager, addr string) http.HandlerFunc {
 }
 
 // EncodeURLJSON генерирует сокращенный URL для переданного оригинального URL (в json).
-func EncodeURLJSON(db storage.URLStorager, addr string) http.HandlerFunc {
+// Оригинальный URL проверяется (см. urlnorm и screening) и сохраняется в каноническом виде.
+func EncodeURLJSON(db storage.URLStorager, urls *urlnorm.Normalizer, screener *screening.Screener, addr string) http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
-		cookie, err := getCookie(req)
-		if err != nil {
-			middlewares.Log.Debug("no cookie in request, got from context")
-		}
-
-		var userID string
-		if cookie != nil {
-			userID, err = middlewares.GetUserID(cookie.Value)
-			if err != nil {
-				middlewares.Log.Warn("something wrong with user_id")
-			}
-		}
+		user, _ := auth.FromContext(req.Context())
+		userID := user.ID
 
 		var request models.APIShortenRequest
 		dec := json.NewDecoder(req.Body)
-		if err = dec.Decode(&request); err != nil {
+		if err := dec.Decode(&request); err != nil {
 			middlewares.Log.Warn("can't decode request JSON body", zap.Error(err))
 			http.Error(res, "Error adding new shorten URL", http.StatusBadRequest)
 			return
 		}
 
-		originalURL := request.URL
-		if originalURL == "" {
+		if request.URL == "" {
 			http.Error(res, "URL parameter is missing", http.StatusBadRequest)
 			return
 		}
+		originalURL, err := checkURL(req.Context(), urls, screener, request.URL)
+		if err != nil {
+			http.Error(res, err.Error(), checkURLStatus(err))
+			return
+		}
 
-		shortenURL := base62.Base62Encode(rand.Uint64())
 		ctx, cancel := context.WithTimeout(req.Context(), 1*time.Second)
 		defer cancel()
+		if err := checkOrganize(ctx, db, userID, request.Tags, request.FolderID); err != nil {
+			writeStorageError(res, err)
+			return
+		}
+
+		shortenURL := base62.Base62Encode(rand.Uint64())
 		for !db.IsShortenUnique(ctx, shortenURL) {
 			shortenURL = base62.Base62Encode(rand.Uint64())
 		}
 
-		err = db.AddURL(ctx, originalURL, shortenURL, userID)
+		err = storage.AddOrganizedURL(ctx, db, userID, originalURL, shortenURL, request.Tags, request.FolderID)
 		if err != nil {
+			if errors.Is(err, storage.ErrQuotaExceeded) {
+				writeStorageError(res, err)
+				return
+			}
 			if !isUniqueViolationError(err) {
 				http.Error(res, "Error adding new shorten URL", http.StatusBadRequest)
 				return
@@ -180,20 +220,14 @@ func EncodeURLJSON(db storage.URLStorager, addr string) http.HandlerFunc {
 }
 
 // EncodeBatch batch сокращенных URL для batch оригинальных URL.
-func EncodeBatch(db storage.URLStorager, addr string) http.HandlerFunc {
+// Оригинальные URL проверяются до сохранения: если хотя бы один некорректен или заблокирован,
+// запрос отклоняется целиком. Если квоты пользователя хватает не на все URL, сохраняется часть
+// из них, а остальные возвращаются с ошибкой (см. storage.AddURLsPartially).
+// Если не сохранен ни один URL, возвращается 429.
+func EncodeBatch(db storage.URLStorager, urls *urlnorm.Normalizer, screener *screening.Screener, addr string) http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
-		cookie, err := getCookie(req)
-		if err != nil {
-			middlewares.Log.Debug("no cookie in request, got from context")
-		}
-
-		var userID string
-		if cookie != nil {
-			userID, err = middlewares.GetUserID(cookie.Value)
-			if err != nil {
-				middlewares.Log.Warn("something wrong with user_id")
-			}
-		}
+		user, _ := auth.FromContext(req.Context())
+		userID := user.ID
 
 		var request []models.APIBatchRequest
 		dec := json.NewDecoder(req.Body)
@@ -203,8 +237,22 @@ func EncodeBatch(db storage.URLStorager, addr string) http.HandlerFunc {
 			return
 		}
 
+		for i := range request {
+			if request[i].OriginalURL == "" {
+				continue
+			}
+			originalURL, err := checkURL(req.Context(), urls, screener, request[i].OriginalURL)
+			if err != nil {
+				http.Error(res, "URL with correlation_id "+request[i].CorrelationID+": "+err.Error(), checkURLStatus(err))
+				return
+			}
+			request[i].OriginalURL = originalURL
+		}
+
 		var batch []models.APIBatchRequest
 		var response []models.APIBatchResponse
+		var saved int
+		var quotaErr error
 		const batchSize = 100
 
 		ctx, cancel := context.WithTimeout(req.Context(), 3*time.Second)
@@ -225,21 +273,40 @@ func EncodeBatch(db storage.URLStorager, addr string) http.HandlerFunc {
 				CorrelationID: url.CorrelationID,
 				OriginalURL:   originalURL,
 				ShortenURL:    shortenURL,
+				Tags:          url.Tags,
+				FolderID:      url.FolderID,
 			})
 
 			if len(batch) == batchSize || i == len(request)-1 {
-				err := db.AddURLs(ctx, userID, batch...)
+				errs, err := storage.AddURLsPartially(ctx, db, userID, batch...)
 				if err != nil {
+					if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrBadName) {
+						writeStorageError(res, err)
+						return
+					}
 					http.Error(res, "Error adding new shorten URLs", http.StatusBadRequest)
 					return
 				}
-				for _, b := range batch {
+				for j, b := range batch {
+					if errs[j] != nil {
+						if errors.Is(errs[j], storage.ErrQuotaExceeded) {
+							quotaErr = errs[j]
+						}
+						response = append(response, models.APIBatchResponse{CorrelationID: b.CorrelationID, Error: errs[j].Error()})
+						continue
+					}
+					saved++
 					response = append(response, models.APIBatchResponse{CorrelationID: b.CorrelationID, ShortenURL: addr + "/" + b.ShortenURL})
 				}
 				batch = nil // Сбросить пакет после вставки.
 			}
 		}
 
+		if saved == 0 && quotaErr != nil {
+			writeStorageError(res, quotaErr)
+			return
+		}
+
 		res.Header().Set("Content-Type", "application/json")
 		res.WriteHeader(http.StatusCreated)
 		enc := json.NewEncoder(res)
@@ -252,73 +319,86 @@ func EncodeBatch(db storage.URLStorager, addr string) http.HandlerFunc {
 }
 
 // GetUserURLs возвращает пользователю его ранее сокращенные URL.
+// Поддерживает постраничную выдачу (limit, cursor), сортировку по времени создания (order=asc|desc)
+// и фильтрацию (domain, q, deleted, tag, folder_id). Курсор следующей страницы передается в заголовке X-Next-Cursor.
+// Без limit возвращается страница из models.DefaultUserURLsPageSize URL.
 func GetUserURLs(db storage.UserStorager, addr string) http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
-		cookie, err := req.Cookie("AuthToken")
-		if err != nil {
-			middlewares.Log.Debug("error getting cookie", zap.Error(err))
-
-			// Replace it after tests repaired
+		// Новому пользователю нечего возвращать: токена в запросе не было.
+		user, ok := auth.FromContext(req.Context())
+		if !ok || user.New {
 			http.Error(res, "No cookie presented", http.StatusUnauthorized)
 			return
 		}
-		userID, err := middlewares.GetUserID(cookie.Value)
+		userID := user.ID
+
+		filter, err := parseUserURLsFilter(req)
 		if err != nil {
-			middlewares.Log.Warn("something wrong with user_id", zap.Error(err))
-			http.Error(res, "Bad user_id", http.StatusUnauthorized)
+			http.Error(res, err.Error(), http.StatusBadRequest)
 			return
 		}
+
 		ctx, cancel := context.WithTimeout(req.Context(), 1*time.Second)
 		defer cancel()
-		userURLs, err := db.GetUserURLs(ctx, userID)
-
-		if len(userURLs) == 0 {
-			res.WriteHeader(http.StatusNoContent)
-			return
-		}
-
-		for i := 0; i < len(userURLs); i++ {
-			userURLs[i].ShortenURL = addr + "/" + userURLs[i].ShortenURL
-		}
-
+		page, err := db.GetUserURLs(ctx, userID, filter)
 		if err != nil {
+			if errors.Is(err, storage.ErrInvalidCursor) {
+				http.Error(res, "Bad cursor", http.StatusBadRequest)
+				return
+			}
 			middlewares.Log.Error("error getting user urls", zap.Error(err))
 			http.Error(res, "Error getting urls", http.StatusBadRequest)
 			return
 		}
 
-		res.Header().Set("Content-Type", "application/json")
-		res.WriteHeader(http.StatusOK)
-		enc := json.NewEncoder(res)
-		if err := enc.Encode(userURLs); err != nil {
-			middlewares.Log.Error("error encoding response", zap.Error(err))
-			http.Error(res, "Error adding new shorten URL", http.StatusBadRequest)
-			return
-		}
+		writeURLsPage(res, req, page, addr)
+	}
+}
+
+// writeURLsPage отвечает страницей URL. Курсор следующей страницы передается
+// в заголовках X-Next-Cursor и Link.
+func writeURLsPage(res http.ResponseWriter, req *http.Request, page *models.UserURLsPage, addr string) {
+	if len(page.URLs) == 0 {
+		res.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	for i := 0; i < len(page.URLs); i++ {
+		page.URLs[i].ShortenURL = addr + "/" + page.URLs[i].ShortenURL
+	}
+
+	if page.NextCursor != "" {
+		next := *req.URL
+		query := next.Query()
+		query.Set("cursor", page.NextCursor)
+		next.RawQuery = query.Encode()
+		res.Header().Set("X-Next-Cursor", page.NextCursor)
+		res.Header().Set("Link", "<"+next.RequestURI()+">; rel=\"next\"")
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(res)
+	if err := enc.Encode(page.URLs); err != nil {
+		middlewares.Log.Error("error encoding response", zap.Error(err))
+		http.Error(res, "Error adding new shorten URL", http.StatusBadRequest)
+		return
 	}
 }
 
 // DeleteURLs удаляет URL пользователя.
 func DeleteURLs(db storage.UserStorager) http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
-		cookie, err := req.Cookie("AuthToken")
-		if err != nil {
-			middlewares.Log.Debug("error getting cookie", zap.Error(err))
-
-			// Replace it after tests repaired
+		user, ok := auth.FromContext(req.Context())
+		if !ok || user.New {
 			http.Error(res, "No cookie presented", http.StatusNoContent)
 			return
 		}
-		userID, err := middlewares.GetUserID(cookie.Value)
-		if err != nil {
-			middlewares.Log.Warn("something wrong with user_id", zap.Error(err))
-			http.Error(res, "Bad user_id", http.StatusUnauthorized)
-			return
-		}
+		userID := user.ID
 
 		var shortenUrls []string
 		dec := json.NewDecoder(req.Body)
-		if err = dec.Decode(&shortenUrls); err != nil {
+		if err := dec.Decode(&shortenUrls); err != nil {
 			middlewares.Log.Warn("can't decode request JSON body", zap.Error(err))
 			http.Error(res, "Error deleting shorten URLs", http.StatusBadRequest)
 			return
@@ -334,7 +414,7 @@ func DeleteURLs(db storage.UserStorager) http.HandlerFunc {
 		ctx, cancel := context.WithTimeout(req.Context(), 60*time.Second)
 		defer cancel()
 
-		err = db.DeleteUserURLs(ctx, urlsToDelete...)
+		err := db.DeleteUserURLs(ctx, urlsToDelete...)
 		if err != nil {
 			middlewares.Log.Error("error deleting", zap.Error(err))
 		}
@@ -380,24 +460,93 @@ func GetStats(store storage.StatsStorager) http.HandlerFunc {
 	}
 }
 
+// checkURL приводит оригинальный URL к каноническому виду и проверяет, что он не заблокирован.
+// Возвращает ошибку urlnorm.ErrBadURL для некорректного URL и screening.ErrBlocked для заблокированного.
+// Ошибка внешнего сервиса проверки не мешает сокращению и только пишется в лог.
+func checkURL(ctx context.Context, urls *urlnorm.Normalizer, screener *screening.Screener, rawURL string) (string, error) {
+	originalURL, err := urls.Normalize(rawURL)
+	if err != nil {
+		return "", err
+	}
+	verdict, err := screener.Screen(ctx, originalURL)
+	if err != nil {
+		middlewares.Log.Warn("error screening URL", zap.String("url", originalURL), zap.Error(err))
+	}
+	if verdict.Blocked {
+		middlewares.Log.Info("blocked URL rejected", zap.String("url", originalURL),
+			zap.String("source", verdict.Source), zap.String("reason", verdict.Reason))
+		return "", verdict.Err()
+	}
+	return originalURL, nil
+}
+
+// checkURLStatus возвращает HTTP статус для ошибки checkURL.
+func checkURLStatus(err error) int {
+	if errors.Is(err, screening.ErrBlocked) {
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
+
 // isUniqueViolationError проверяет является ли ошибка UniqueViolation.
 func isUniqueViolationError(err error) bool {
 	var pgErr *pgconn.PgError
 	return errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation
 }
 
-// getCookie возвращает cookie пользователя.
-func getCookie(req *http.Request) (*http.Cookie, error) {
-	cookie, err := req.Cookie("AuthToken")
+// checkOrganize проверяет теги и папку для нового URL до его сохранения (см. storage.CheckOrganize).
+func checkOrganize(ctx context.Context, db storage.URLStorager, userID string, tags []string, folderID *int64) error {
+	if len(tags) == 0 && folderID == nil {
+		return nil
+	}
+	tagger, ok := db.(storage.TagStorager)
+	if !ok {
+		return errors.New("tags are not supported by storage")
+	}
+	return storage.CheckOrganize(ctx, tagger, userID, tags, folderID)
+}
 
-	if cookie == nil {
-		cookie2, ok := req.Context().Value(middlewares.CookieKey).(*http.Cookie)
-		if !ok {
-			middlewares.Log.Debug("error conversion cookie")
-		} else {
-			cookie = cookie2
+// parseUserURLsFilter извлекает параметры выдачи URL пользователя из query-параметров запроса.
+func parseUserURLsFilter(req *http.Request) (models.UserURLsFilter, error) {
+	query := req.URL.Query()
+	filter := models.UserURLsFilter{
+		Cursor: query.Get("cursor"),
+		Domain: query.Get("domain"),
+		Search: query.Get("q"),
+		Tag:    query.Get("tag"),
+		Limit:  models.DefaultUserURLsPageSize,
+	}
+
+	if folder := query.Get("folder_id"); folder != "" {
+		folderID, err := strconv.ParseInt(folder, 10, 64)
+		if err != nil {
+			return filter, errors.New("bad folder_id parameter")
 		}
+		filter.FolderID = &folderID
+	}
 
+	if limit := query.Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value < 1 {
+			return filter, errors.New("bad limit parameter")
+		}
+		filter.Limit = min(value, models.MaxUserURLsPageSize)
+	}
+
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		filter.Desc = true
+	default:
+		return filter, errors.New("bad order parameter")
+	}
+
+	if deleted := query.Get("deleted"); deleted != "" {
+		value, err := strconv.ParseBool(deleted)
+		if err != nil {
+			return filter, errors.New("bad deleted parameter")
+		}
+		filter.Deleted = &value
 	}
-	return cookie, err
+	return filter, nil
 }
@@ -1,21 +1,43 @@
 package http
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"github.com/vancho-go/url-shortener/internal/app/auth"
+	"github.com/vancho-go/url-shortener/internal/app/auth/oidctest"
+	"github.com/vancho-go/url-shortener/internal/app/config"
+	"github.com/vancho-go/url-shortener/internal/app/handlers/http/middlewares"
 	"github.com/vancho-go/url-shortener/internal/app/models"
+	"github.com/vancho-go/url-shortener/internal/app/ratelimit"
+	"github.com/vancho-go/url-shortener/internal/app/screening"
+	"github.com/vancho-go/url-shortener/internal/app/screening/screeningtest"
+	"github.com/vancho-go/url-shortener/internal/app/storage"
+	"github.com/vancho-go/url-shortener/internal/app/urlnorm"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"context"
+	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 const addr = "localhost:8080"
 
+// tokens - менеджер токенов, общий для тестов с JWTMiddleware.
+var tokens, _ = auth.New(config.ServerConfig{AuthSecret: "secret"}, nil, nil)
+
 //var dbInstance = make(storage.MapDB)
 
 // MockStorager - это поддельная реализация Storager, используемая как в примере, так и в тестах.
@@ -33,15 +55,17 @@ func (m *MockStorager) Close() error {
 	return nil
 }
 
-func (m *MockStorager) GetUserURLs(ctx context.Context, s string) ([]models.APIUserURLResponse, error) {
-	return []models.APIUserURLResponse{
-		{
-			ShortenURL:  "localhost:8080/qwerty22423",
-			OriginalURL: "vk.com",
-		},
-		{
-			ShortenURL:  "localhost:8080/kslfvk4",
-			OriginalURL: "ya.ru",
+func (m *MockStorager) GetUserURLs(ctx context.Context, s string, filter models.UserURLsFilter) (*models.UserURLsPage, error) {
+	return &models.UserURLsPage{
+		URLs: []models.APIUserURLResponse{
+			{
+				ShortenURL:  "localhost:8080/qwerty22423",
+				OriginalURL: "vk.com",
+			},
+			{
+				ShortenURL:  "localhost:8080/kslfvk4",
+				OriginalURL: "ya.ru",
+			},
 		},
 	}, nil
 }
@@ -106,7 +130,7 @@ func TestEncodeURL(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			request := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.reqBody))
 			w := httptest.NewRecorder()
-			handlerFunc := EncodeURL(&MockStorager{IsUniqueFunc: nil, AddURLFunc: nil, GetURLFunc: nil}, addr)
+			handlerFunc := EncodeURL(&MockStorager{IsUniqueFunc: nil, AddURLFunc: nil, GetURLFunc: nil}, nil, nil, addr)
 			handlerFunc(w, request)
 
 			res := w.Result()
@@ -151,7 +175,7 @@ func TestDecodeURL(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			request := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.reqBody))
 			w := httptest.NewRecorder()
-			handlerFunc := DecodeURL(&MockStorager{IsUniqueFunc: nil, AddURLFunc: nil, GetURLFunc: nil})
+			handlerFunc := DecodeURL(&MockStorager{IsUniqueFunc: nil, AddURLFunc: nil, GetURLFunc: nil}, nil)
 			handlerFunc(w, request)
 
 			res := w.Result()
@@ -205,16 +229,23 @@ func TestEncodeURLJSON(t *testing.T) {
 		{
 			name:    "Test POST: created",
 			method:  http.MethodPost,
-			reqBody: `{"url": "vk.com"}`,
+			reqBody: `{"url": "https://vk.com"}`,
 			target:  "/api/shorten",
 			want:    want{code: 201, contentType: "application/json", response: ""},
 		},
+		{
+			name:    "Test POST: scheme is not allowed",
+			method:  http.MethodPost,
+			reqBody: `{"url": "javascript:alert(1)"}`,
+			target:  "/api/shorten",
+			want:    want{code: 400, response: "bad URL: scheme \"javascript\" is not allowed\n", contentType: "text/plain; charset=utf-8"},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			request := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.reqBody))
 			w := httptest.NewRecorder()
-			handlerFunc := EncodeURLJSON(&MockStorager{IsUniqueFunc: nil, AddURLFunc: nil, GetURLFunc: nil}, addr)
+			handlerFunc := EncodeURLJSON(&MockStorager{IsUniqueFunc: nil, AddURLFunc: nil, GetURLFunc: nil}, nil, nil, addr)
 			handlerFunc(w, request)
 
 			res := w.Result()
@@ -233,3 +264,1185 @@ func TestEncodeURLJSON(t *testing.T) {
 		})
 	}
 }
+
+// countingStorage - хранилище в памяти, которое считает сохраненные URL.
+type countingStorage struct {
+	*storage.MapDB
+	added int
+}
+
+func (c *countingStorage) AddURL(ctx context.Context, originalURL, shortenURL, userID string) error {
+	c.added++
+	return c.MapDB.AddURL(ctx, originalURL, shortenURL, userID)
+}
+
+func (c *countingStorage) AddURLs(ctx context.Context, userID string, urls ...models.APIBatchRequest) error {
+	c.added += len(urls)
+	return c.MapDB.AddURLs(ctx, userID, urls...)
+}
+
+func TestEncodeURLJSONOrganize(t *testing.T) {
+	db := &countingStorage{MapDB: storage.NewMapDB()}
+	own, err := db.CreateFolder(context.Background(), "user", models.Folder{Name: "own"})
+	require.NoError(t, err)
+	other, err := db.CreateFolder(context.Background(), "other", models.Folder{Name: "other"})
+	require.NoError(t, err)
+	router := chi.NewRouter()
+	router.With(middlewares.JWTMiddleware(tokens, nil)).Post("/api/shorten", EncodeURLJSON(db, nil, nil, addr))
+
+	serve := func(body string) int {
+		token, err := tokens.Issue(auth.User{ID: "user"})
+		require.NoError(t, err)
+		request := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body))
+		request.AddCookie(&http.Cookie{Name: auth.TokenName, Value: token})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w.Code
+	}
+
+	// Некорректные теги и чужая папка отклоняются до сохранения URL.
+	assert.Equal(t, http.StatusBadRequest, serve(`{"url": "https://ya.ru", "tags": ["news", " "]}`))
+	assert.Equal(t, http.StatusNotFound, serve(fmt.Sprintf(`{"url": "https://ya.ru", "folder_id": %d}`, other.ID)))
+	assert.Zero(t, db.added)
+
+	assert.Equal(t, http.StatusCreated, serve(fmt.Sprintf(`{"url": "https://ya.ru", "tags": ["news"], "folder_id": %d}`, own.ID)))
+	assert.Equal(t, 1, db.added)
+
+	// Теги и папка сохраняются вместе с URL.
+	page, err := db.GetUserURLs(context.Background(), "user", models.UserURLsFilter{})
+	require.NoError(t, err)
+	require.Len(t, page.URLs, 1)
+	assert.Equal(t, []string{"news"}, page.URLs[0].Tags)
+	assert.Equal(t, &own.ID, page.URLs[0].FolderID)
+}
+
+func TestEncodeURLCanonical(t *testing.T) {
+	var stored []string
+	db := &MockStorager{AddURLFunc: func(ctx context.Context, originalURL string, shortenURL string, userID string) error {
+		stored = append(stored, originalURL)
+		return nil
+	}}
+	urls := urlnorm.New(urlnorm.Options{StripTracking: true})
+	handlerFunc := EncodeURL(db, urls, nil, addr)
+
+	// Разные написания одного адреса сохраняются одинаково.
+	for _, originalURL := range []string{"https://Example.COM", "HTTPS://example.com:443/?utm_source=mail", "https://example.com./"} {
+		w := httptest.NewRecorder()
+		handlerFunc(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(originalURL)))
+		assert.Equal(t, http.StatusCreated, w.Code, originalURL)
+	}
+	assert.Equal(t, []string{"https://example.com/", "https://example.com/", "https://example.com/"}, stored)
+
+	for _, originalURL := range []string{"javascript:alert(1)", "https://", "example.com", "https://example.com:99999"} {
+		w := httptest.NewRecorder()
+		handlerFunc(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(originalURL)))
+		assert.Equal(t, http.StatusBadRequest, w.Code, originalURL)
+	}
+	assert.Len(t, stored, 3)
+}
+
+func TestEncodeBatchRejectsBadURL(t *testing.T) {
+	body := `[{"correlation_id": "1", "original_url": "https://ya.ru"}, {"correlation_id": "2", "original_url": "ftp://ya.ru"}]`
+	w := httptest.NewRecorder()
+	EncodeBatch(&MockStorager{}, nil, nil, addr)(w, httptest.NewRequest(http.MethodPost, "/api/shorten/batch", strings.NewReader(body)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "correlation_id 2")
+}
+
+func TestScreening(t *testing.T) {
+	provider := screeningtest.New(map[string]string{"phish.example": "phishing"})
+	screener := screening.New(nil, time.Hour, provider)
+	db := storage.NewMapDB()
+	router := chi.NewRouter()
+	router.Use(middlewares.JWTMiddleware(tokens, db))
+	router.Post("/api/shorten", EncodeURLJSON(db, nil, screener, addr))
+	router.Get("/{shortenURL}", DecodeURL(db, screener))
+
+	// Заблокированный URL не сокращается.
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url": "https://phish.example/login"}`)))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "phishing")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url": "https://later.example/login"}`)))
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created models.APIShortenResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	target := strings.TrimPrefix(created.Result, addr)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+
+	// URL, заблокированный после сокращения, открывает страницу с предупреждением, когда истечет кэш вердикта.
+	provider.Block("later.example", "malware")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+
+	screener = screening.New(nil, time.Hour, provider)
+	router = chi.NewRouter()
+	router.Get("/{shortenURL}", DecodeURL(db, screener))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, w.Header().Get("Location"))
+	assert.Contains(t, w.Body.String(), "https://later.example/login")
+	assert.Contains(t, w.Body.String(), "malware")
+}
+
+func TestAbuseReports(t *testing.T) {
+	db := storage.NewMapDB()
+	require.NoError(t, db.AddURL(context.Background(), "https://ya.ru", "abc", "owner"))
+	router := chi.NewRouter()
+	router.Group(func(r chi.Router) {
+		r.Use(middlewares.JWTMiddleware(tokens, nil))
+		r.Get("/{shortenURL}", DecodeURL(db, nil))
+		r.Post("/report/{shortenURL}", ReportURL(db, 3))
+	})
+	router.Route("/api", func(r chi.Router) {
+		r.Group(func(r chi.Router) {
+			r.Use(middlewares.JWTMiddleware(tokens, nil))
+			r.Use(middlewares.RoleMiddleware(AdminPolicy))
+			r.Get("/admin/reports", GetAbuseReports(db))
+		})
+	})
+
+	reportAs := func(target, ip, body, token string) int {
+		request := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		request.RemoteAddr = net.JoinHostPort(ip, "1234")
+		if token != "" {
+			request.AddCookie(&http.Cookie{Name: auth.TokenName, Value: token})
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w.Code
+	}
+	report := func(target, ip, body string) int {
+		return reportAs(target, ip, body, "")
+	}
+	redirect := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/abc", nil))
+		return w
+	}
+
+	assert.Equal(t, http.StatusBadRequest, report("/report/abc", "10.0.0.1", `{"reason": " "}`))
+	assert.Equal(t, http.StatusNotFound, report("/report/unknown", "10.0.0.1", `{"reason": "phishing"}`))
+
+	// Повторная жалоба того же посетителя не учитывается, даже без cookie.
+	assert.Equal(t, http.StatusAccepted, report("/report/abc", "10.0.0.1", `{"reason": "phishing"}`))
+	assert.Equal(t, http.StatusAccepted, report("/report/abc", "10.0.0.1", `{"reason": "phishing"}`))
+	assert.Equal(t, http.StatusTemporaryRedirect, redirect().Code)
+
+	// Жалоба зарегистрированного пользователя из той же сети тоже не учитывается.
+	userToken, err := tokens.Issue(auth.User{ID: "user", Registered: true})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, reportAs("/report/abc", "10.0.0.1", `{"reason": "spam"}`, userToken))
+
+	// Адреса IPv6 из одной подсети /64 считаются одним автором.
+	assert.Equal(t, http.StatusAccepted, report("/report/abc", "2001:db8::1", `{"reason": "phishing"}`))
+	assert.Equal(t, http.StatusAccepted, report("/report/abc", "2001:db8::2", `{"reason": "phishing"}`))
+	assert.Equal(t, http.StatusTemporaryRedirect, redirect().Code)
+
+	// Третья независимая жалоба блокирует URL.
+	assert.Equal(t, http.StatusAccepted, report("/report/abc", "10.0.0.2", `{"reason": "malware"}`))
+	w := redirect()
+	assert.Equal(t, http.StatusUnavailableForLegalReasons, w.Code)
+	assert.Empty(t, w.Header().Get("Location"))
+	assert.Contains(t, w.Body.String(), "reports of abuse")
+
+	token, err := tokens.Issue(auth.User{ID: "admin", Registered: true, Roles: []string{auth.RoleAuditor}})
+	require.NoError(t, err)
+	request := httptest.NewRequest(http.MethodGet, "/api/admin/reports", nil)
+	request.AddCookie(&http.Cookie{Name: auth.TokenName, Value: token})
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+	require.Equal(t, http.StatusOK, w.Code)
+	var reports []models.AbuseReport
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&reports))
+	require.Len(t, reports, 3)
+	assert.Equal(t, "malware", reports[0].Reason)
+	assert.Equal(t, "ip:2001:db8::/64", reports[1].Reporter)
+	assert.Equal(t, "ip:10.0.0.1", reports[2].Reporter)
+}
+
+func TestRateLimit(t *testing.T) {
+	limiter := ratelimit.New(ratelimit.NewMemoryStore(), map[ratelimit.Class]ratelimit.Limit{
+		ratelimit.ClassCreate: {Rate: 1.0 / 60, Burst: 2},
+		ratelimit.ClassRead:   {Rate: 1.0 / 60, Burst: 1},
+	})
+	router := chi.NewRouter()
+	router.Route("/api", func(r chi.Router) {
+		r.Group(func(r chi.Router) {
+			r.Use(middlewares.JWTMiddleware(tokens, nil))
+			r.Use(middlewares.RateLimitMiddleware(limiter, RateClasses))
+			r.Post("/shorten", EncodeURLJSON(&MockStorager{}, nil, nil, addr))
+			r.Get("/user/urls", GetUserURLs(&MockStorager{}, addr))
+		})
+	})
+	token, err := tokens.Issue(auth.User{ID: "user"})
+	require.NoError(t, err)
+	serve := func(method, target, body string, cookie bool) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		if cookie {
+			request.AddCookie(&http.Cookie{Name: auth.TokenName, Value: token})
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusCreated, serve(http.MethodPost, "/api/shorten", `{"url": "https://ya.ru"}`, true).Code)
+	}
+	w := serve(http.MethodPost, "/api/shorten", `{"url": "https://ya.ru"}`, true)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	// Чтение ограничивается отдельно от сокращения.
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/api/user/urls", "", true).Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve(http.MethodGet, "/api/user/urls", "", true).Code)
+
+	// Клиенты без cookie ограничиваются по IP адресу, а не по новому пользователю.
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusCreated, serve(http.MethodPost, "/api/shorten", `{"url": "https://ya.ru"}`, false).Code)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, serve(http.MethodPost, "/api/shorten", `{"url": "https://ya.ru"}`, false).Code)
+}
+
+// quotaStorage - in-memory хранилище с пакетным сохранением: как и Postgres, сохраняет пачку,
+// только если на нее хватает квоты.
+type quotaStorage struct {
+	*storage.MapDB
+}
+
+func (q quotaStorage) AddURLs(ctx context.Context, userID string, urls ...models.APIBatchRequest) error {
+	quota, err := q.GetQuota(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if quota.Limits.Daily > 0 && quota.Used.Daily+int64(len(urls)) > quota.Limits.Daily {
+		return storage.ErrQuotaExceeded
+	}
+	for _, url := range urls {
+		if err = q.AddURL(ctx, url.OriginalURL, url.ShortenURL, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestAuthRateLimit(t *testing.T) {
+	limiter := ratelimit.New(ratelimit.NewMemoryStore(), map[ratelimit.Class]ratelimit.Limit{
+		ratelimit.ClassAuth: {Rate: 1.0 / 60, Burst: 2},
+	})
+	db := storage.NewMapDB()
+	router := chi.NewRouter()
+	router.Group(func(r chi.Router) {
+		r.Use(middlewares.RateLimitMiddleware(limiter, RateClasses))
+		r.Post("/auth/signin", SignIn(db, tokens, nil))
+		r.Post("/auth/signup", SignUp(db, tokens, nil))
+	})
+	token, err := tokens.Issue(auth.User{ID: "user", Registered: true})
+	require.NoError(t, err)
+	serve := func(target, ip string) int {
+		request := httptest.NewRequest(http.MethodPost, target, strings.NewReader(`{"email": "a@b.c", "password": "wrong-password"}`))
+		request.RemoteAddr = ip + ":1234"
+		// Токен пользователя не дает отдельной корзины: вход ограничивается по IP адресу.
+		request.AddCookie(&http.Cookie{Name: auth.TokenName, Value: token})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, serve("/auth/signin", "10.0.0.1"))
+	assert.Equal(t, http.StatusUnauthorized, serve("/auth/signin", "10.0.0.1"))
+	assert.Equal(t, http.StatusTooManyRequests, serve("/auth/signin", "10.0.0.1"))
+	assert.Equal(t, http.StatusTooManyRequests, serve("/auth/signup", "10.0.0.1"))
+	assert.Equal(t, http.StatusUnauthorized, serve("/auth/signin", "10.0.0.2"))
+}
+
+func TestQuota(t *testing.T) {
+	db := quotaStorage{MapDB: storage.NewMapDB()}
+	db.SetDefaultQuota(models.Quota{Daily: 3})
+	router := chi.NewRouter()
+	router.Route("/api", func(r chi.Router) {
+		r.Group(func(r chi.Router) {
+			r.Use(middlewares.JWTMiddleware(tokens, nil))
+			r.Post("/shorten", EncodeURLJSON(db, nil, nil, addr))
+			r.Post("/shorten/batch", EncodeBatch(db, nil, nil, addr))
+			r.Get("/user/quota", GetQuota(db))
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(middlewares.JWTMiddleware(tokens, nil))
+			r.Use(middlewares.RoleMiddleware(AdminPolicy))
+			r.Put("/admin/users/{userID}/quota", SetUserQuota(db))
+			r.Delete("/admin/users/{userID}/quota", DeleteUserQuota(db))
+		})
+	})
+
+	serve := func(method, target, body string, roles ...string) *httptest.ResponseRecorder {
+		token, err := tokens.Issue(auth.User{ID: "user", Registered: true, Roles: roles})
+		require.NoError(t, err)
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		request.AddCookie(&http.Cookie{Name: auth.TokenName, Value: token})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w
+	}
+
+	require.Equal(t, http.StatusCreated, serve(http.MethodPost, "/api/shorten", `{"url": "https://ya.ru"}`).Code)
+
+	// Квоты хватает на два URL из трех: пачка принимается частично.
+	w := serve(http.MethodPost, "/api/shorten/batch", `[{"correlation_id": "1", "original_url": "https://a.ru"},
+		{"correlation_id": "2", "original_url": "https://b.ru"}, {"correlation_id": "3", "original_url": "https://c.ru"}]`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var batch []models.APIBatchResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&batch))
+	require.Len(t, batch, 3)
+	assert.NotEmpty(t, batch[0].ShortenURL)
+	assert.NotEmpty(t, batch[1].ShortenURL)
+	assert.Empty(t, batch[2].ShortenURL)
+	assert.Contains(t, batch[2].Error, storage.ErrQuotaExceeded.Error())
+
+	assert.Equal(t, http.StatusTooManyRequests, serve(http.MethodPost, "/api/shorten", `{"url": "https://d.ru"}`).Code)
+	assert.Equal(t, http.StatusTooManyRequests,
+		serve(http.MethodPost, "/api/shorten/batch", `[{"correlation_id": "1", "original_url": "https://d.ru"}]`).Code)
+
+	w = serve(http.MethodGet, "/api/user/quota", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var quota models.APIQuotaResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&quota))
+	assert.Equal(t, models.Quota{Daily: 3}, quota.Limits)
+	assert.Equal(t, models.Quota{Daily: 3, Total: 3}, quota.Used)
+
+	// Квоту пользователя меняет только администратор.
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPut, "/api/admin/users/user/quota", `{"daily": 5}`).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPut, "/api/admin/users/user/quota", `{"daily": -1}`, auth.RoleAdmin).Code)
+	require.Equal(t, http.StatusNoContent, serve(http.MethodPut, "/api/admin/users/user/quota", `{"daily": 5}`, auth.RoleAdmin).Code)
+	assert.Equal(t, http.StatusCreated, serve(http.MethodPost, "/api/shorten", `{"url": "https://d.ru"}`).Code)
+
+	require.Equal(t, http.StatusNoContent, serve(http.MethodDelete, "/api/admin/users/user/quota", "", auth.RoleAdmin).Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodDelete, "/api/admin/users/user/quota", "", auth.RoleAdmin).Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve(http.MethodPost, "/api/shorten", `{"url": "https://e.ru"}`).Code)
+}
+
+func TestParseUserURLsFilter(t *testing.T) {
+	deleted := true
+	tests := []struct {
+		name    string
+		target  string
+		want    models.UserURLsFilter
+		wantErr bool
+	}{
+		{
+			name:   "Test no params",
+			target: "/api/user/urls",
+			want:   models.UserURLsFilter{Limit: models.DefaultUserURLsPageSize},
+		},
+		{
+			name:   "Test all params",
+			target: "/api/user/urls?limit=10&cursor=abc&order=desc&domain=ya.ru&q=news&deleted=true",
+			want:   models.UserURLsFilter{Limit: 10, Cursor: "abc", Desc: true, Domain: "ya.ru", Search: "news", Deleted: &deleted},
+		},
+		{
+			name:   "Test limit is capped",
+			target: "/api/user/urls?limit=100000",
+			want:   models.UserURLsFilter{Limit: models.MaxUserURLsPageSize},
+		},
+		{
+			name:    "Test bad limit",
+			target:  "/api/user/urls?limit=-1",
+			wantErr: true,
+		},
+		{
+			name:    "Test bad order",
+			target:  "/api/user/urls?order=random",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			filter, err := parseUserURLsFilter(request)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, filter)
+		})
+	}
+}
+
+func TestImportURLs(t *testing.T) {
+	body := "original_url,alias,tags,expires_at\n" +
+		"https://ya.ru,,news;work,\n" +
+		",,,\n" +
+		"https://vk.com,bad alias,,\n" +
+		"https://go.dev,golang,,2000-01-01T00:00:00Z\n" +
+		"javascript:alert(1),,,\n" +
+		"https://vk.com,report,,\n"
+	request := httptest.NewRequest(http.MethodPost, "/api/user/urls/import", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler := middlewares.JWTMiddleware(tokens, nil)(ImportURLs(&MockStorager{}, nil, nil, addr))
+	handler.ServeHTTP(w, request)
+
+	res := w.Result()
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	records, err := csv.NewReader(res.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 7)
+	assert.Equal(t, "2", records[1][0])
+	assert.NotEmpty(t, records[1][2])
+	assert.Empty(t, records[1][3])
+	assert.Equal(t, storage.ErrEmptyURL.Error(), records[2][3])
+	assert.Equal(t, storage.ErrBadAlias.Error(), records[3][3])
+	assert.Equal(t, errBadExpiry.Error(), records[4][3])
+	assert.True(t, strings.HasPrefix(records[5][3], urlnorm.ErrBadURL.Error()))
+	// Сокращенный URL не может совпадать с путем сервиса.
+	assert.Equal(t, storage.ErrBadAlias.Error(), records[6][3])
+}
+
+func TestImportURLsServer(t *testing.T) {
+	// Строк больше, чем в нескольких пачках: результаты начинают отправляться до того, как прочитан весь файл.
+	// Небольшое тело сервер без full duplex дочитывает и отбрасывает при первой отправке ответа.
+	const rows = 5000
+	var body strings.Builder
+	body.WriteString("original_url\n")
+	for i := 0; i < rows; i++ {
+		fmt.Fprintf(&body, "https://ya.ru/%d\n", i)
+	}
+	server := httptest.NewServer(middlewares.JWTMiddleware(tokens, nil)(ImportURLs(&MockStorager{}, nil, nil, addr)))
+	defer server.Close()
+
+	res, err := server.Client().Post(server.URL+"/api/user/urls/import", "text/csv", strings.NewReader(body.String()))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	records, err := csv.NewReader(res.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, rows+1)
+	for _, record := range records[1:] {
+		require.Empty(t, record[3])
+	}
+	assert.Equal(t, strconv.Itoa(rows+1), records[rows][0])
+}
+
+func TestEncodeStreamGzip(t *testing.T) {
+	// Строк больше, чем в нескольких пачках: ответ начинает отправляться до того, как прочитан весь запрос.
+	const lines = 20000
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	zw.Write([]byte(`{"correlation_id": "a", "original_url": "https://ya.ru"}` + "\n" +
+		"not json\n" +
+		`{"original_url": ""}` + "\n"))
+	for i := 4; i <= lines; i++ {
+		fmt.Fprintf(zw, `{"original_url": "https://ya.ru/%d"}`+"\n", i)
+	}
+	require.NoError(t, zw.Close())
+
+	handler := middlewares.JWTMiddleware(tokens, nil)(middlewares.GzipMiddleware(EncodeStream(&MockStorager{}, nil, nil, addr)))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodPost, server.URL+"/api/shorten/stream", &body)
+	require.NoError(t, err)
+	request.Header.Set("Content-Encoding", "gzip")
+	request.Header.Set("Accept-Encoding", "gzip")
+	res, err := server.Client().Do(request)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+
+	zr, err := gzip.NewReader(res.Body)
+	require.NoError(t, err)
+	dec := json.NewDecoder(zr)
+	var results []models.APIStreamResponse
+	for dec.More() {
+		var result models.APIStreamResponse
+		require.NoError(t, dec.Decode(&result))
+		results = append(results, result)
+	}
+
+	require.Len(t, results, lines)
+	assert.Equal(t, "a", results[0].CorrelationID)
+	assert.NotEmpty(t, results[0].ShortenURL)
+	assert.Equal(t, "2", results[1].CorrelationID)
+	assert.NotEmpty(t, results[1].Error)
+	assert.Equal(t, "3", results[2].CorrelationID)
+	assert.Equal(t, storage.ErrEmptyURL.Error(), results[2].Error)
+	for _, result := range results[3:] {
+		require.Empty(t, result.Error)
+	}
+	assert.Equal(t, strconv.Itoa(lines), results[lines-1].CorrelationID)
+}
+
+func TestAPIKeys(t *testing.T) {
+	db := storage.NewMapDB()
+	router := chi.NewRouter()
+	router.Use(middlewares.JWTMiddleware(tokens, db))
+	router.Post("/api/user/keys", CreateAPIKey(db))
+	router.Get("/api/user/keys", GetAPIKeys(db))
+	router.Get("/api/user/tags", GetTags(db))
+	router.Post("/api/shorten", EncodeURLJSON(db, nil, nil, addr))
+
+	serve := func(method, target, body string, header http.Header) *http.Response {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		for name, values := range header {
+			request.Header[name] = values
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w.Result()
+	}
+
+	token, err := tokens.Issue(auth.User{ID: "user"})
+	require.NoError(t, err)
+	res := serve(http.MethodPost, "/api/user/keys", `{"name": "ci", "scopes": ["read"]}`,
+		http.Header{"Cookie": {auth.TokenName + "=" + token}})
+	defer res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	var created models.APIKey
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&created))
+	require.NotEmpty(t, created.Key)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		header http.Header
+		want   int
+	}{
+		{name: "read by X-API-Key", method: http.MethodGet, target: "/api/user/tags",
+			header: http.Header{"X-Api-Key": {created.Key}}, want: http.StatusOK},
+		{name: "read by Bearer", method: http.MethodGet, target: "/api/user/tags",
+			header: http.Header{"Authorization": {"Bearer " + created.Key}}, want: http.StatusOK},
+		{name: "write without scope", method: http.MethodPost, target: "/api/shorten",
+			header: http.Header{"X-Api-Key": {created.Key}}, want: http.StatusForbidden},
+		{name: "unknown key", method: http.MethodGet, target: "/api/user/tags",
+			header: http.Header{"X-Api-Key": {auth.APIKeyPrefix + "unknown"}}, want: http.StatusUnauthorized},
+		{name: "keys are not managed by keys", method: http.MethodGet, target: "/api/user/keys",
+			header: http.Header{"X-Api-Key": {created.Key}}, want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := serve(tt.method, tt.target, `{"url": "https://ya.ru"}`, tt.header)
+			defer res.Body.Close()
+			assert.Equal(t, tt.want, res.StatusCode)
+			// Запрос с API ключом не получает новую анонимную cookie.
+			assert.Empty(t, res.Cookies())
+		})
+	}
+}
+
+func TestSignUpSignIn(t *testing.T) {
+	db := storage.NewMapDB()
+	router := chi.NewRouter()
+	// Роль по email не назначается: владение email не проверяется.
+	roles := auth.RoleBindings{"a@b.c": {auth.RoleAdmin}}
+	router.Post("/auth/signup", SignUp(db, tokens, roles))
+	router.Post("/auth/signin", SignIn(db, tokens, roles))
+
+	serve := func(target, body, token string) *http.Response {
+		request := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		if token != "" {
+			request.AddCookie(&http.Cookie{Name: auth.TokenName, Value: token})
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w.Result()
+	}
+
+	anon, err := tokens.Issue(auth.User{ID: "anon"})
+	require.NoError(t, err)
+	require.NoError(t, db.AddURL(context.Background(), "https://ya.ru", "abc", "anon"))
+
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		want   int
+	}{
+		{name: "bad email", target: "/auth/signup", body: `{"email": "nope", "password": "password"}`, want: http.StatusBadRequest},
+		{name: "short password", target: "/auth/signup", body: `{"email": "a@b.c", "password": "short"}`, want: http.StatusBadRequest},
+		{name: "sign up", target: "/auth/signup", body: `{"email": "A@b.c", "password": "password"}`, want: http.StatusCreated},
+		{name: "duplicate", target: "/auth/signup", body: `{"email": "a@b.c", "password": "password"}`, want: http.StatusConflict},
+		{name: "wrong password", target: "/auth/signin", body: `{"email": "a@b.c", "password": "wrong-password"}`, want: http.StatusUnauthorized},
+		{name: "unknown email", target: "/auth/signin", body: `{"email": "x@b.c", "password": "password"}`, want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := serve(tt.target, tt.body, "")
+			defer res.Body.Close()
+			assert.Equal(t, tt.want, res.StatusCode)
+		})
+	}
+
+	registered, _, err := db.GetAccountByEmail(context.Background(), "a@b.c")
+	require.NoError(t, err)
+	res := serve("/auth/signin", `{"email": "a@b.c", "password": "password"}`, "")
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	user, err := tokens.User(res.Cookies()[0].Value)
+	require.NoError(t, err)
+	assert.Empty(t, user.Roles)
+	roles[registered.ID] = []string{auth.RoleAdmin}
+
+	// Вход с merge переносит URL анонимного пользователя в учетную запись.
+	res = serve("/auth/signin", `{"email": "a@b.c", "password": "password", "merge": true}`, anon)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	var account models.APIAccountResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&account))
+	assert.Equal(t, int64(1), account.Merged)
+
+	require.Len(t, res.Cookies(), 1)
+	user, err = tokens.User(res.Cookies()[0].Value)
+	require.NoError(t, err)
+	assert.Equal(t, account.ID, user.ID)
+	assert.True(t, user.Registered)
+	assert.Equal(t, []string{auth.RoleAdmin}, user.Roles)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	idp := oidctest.NewProvider("shortener", "client-secret")
+	defer idp.Close()
+	idp.Email = "user@corp.example"
+
+	provider, err := auth.NewOIDCProvider(context.Background(), config.ServerConfig{
+		BaseHost:         "http://" + addr,
+		OIDCIssuer:       idp.Issuer,
+		OIDCClientID:     idp.ClientID,
+		OIDCClientSecret: idp.ClientSecret,
+	})
+	require.NoError(t, err)
+
+	db := storage.NewMapDB()
+	router := chi.NewRouter()
+	router.Get("/auth/login", LoginOIDC(provider))
+	router.Get(auth.OIDCCallbackPath, CallbackOIDC(db, tokens, provider, nil))
+
+	// login начинает вход и возвращает адрес callback, на который провайдер вернул пользователя.
+	login := func(t *testing.T) (*http.Cookie, string) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/login", nil))
+		res := w.Result()
+		defer res.Body.Close()
+		require.Equal(t, http.StatusFound, res.StatusCode)
+		require.Len(t, res.Cookies(), 1)
+
+		idpRes, err := idp.Client().Get(res.Header.Get("Location"))
+		require.NoError(t, err)
+		defer idpRes.Body.Close()
+		require.Equal(t, http.StatusFound, idpRes.StatusCode)
+		callback, err := url.Parse(idpRes.Header.Get("Location"))
+		require.NoError(t, err)
+		return res.Cookies()[0], callback.RequestURI()
+	}
+	callback := func(target string, cookie *http.Cookie) *http.Response {
+		request := httptest.NewRequest(http.MethodGet, target, nil)
+		if cookie != nil {
+			request.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w.Result()
+	}
+
+	t.Run("login", func(t *testing.T) {
+		state, target := login(t)
+		res := callback(target, state)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		var account models.APIAccountResponse
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&account))
+		assert.Equal(t, auth.OIDCUserID(idp.Issuer, idp.Subject), account.ID)
+		assert.Equal(t, idp.Email, account.Email)
+
+		var token string
+		for _, cookie := range res.Cookies() {
+			if cookie.Name == auth.TokenName {
+				token = cookie.Value
+			}
+		}
+		user, err := tokens.User(token)
+		require.NoError(t, err)
+		assert.Equal(t, account.ID, user.ID)
+		assert.True(t, user.Registered)
+	})
+
+	t.Run("state mismatch", func(t *testing.T) {
+		state, _ := login(t)
+		_, target := login(t)
+		res := callback(target, state)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("no state cookie", func(t *testing.T) {
+		_, target := login(t)
+		res := callback(target, nil)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("code is single use", func(t *testing.T) {
+		state, target := login(t)
+		res := callback(target, state)
+		res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		res = callback(target, state)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+}
+
+func TestRoleMiddleware(t *testing.T) {
+	ok := func(res http.ResponseWriter, req *http.Request) { res.WriteHeader(http.StatusOK) }
+	router := chi.NewRouter()
+	router.Route("/api", func(r chi.Router) {
+		r.Group(func(r chi.Router) {
+			r.Use(middlewares.JWTMiddleware(tokens, nil))
+			r.Use(middlewares.RoleMiddleware(AdminPolicy))
+			r.Get("/admin/urls", ok)
+			r.Put("/admin/urls/{shortenURL}/disabled", ok)
+			r.Get("/admin/other", ok)
+		})
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		roles  []string
+		want   int
+	}{
+		{name: "user lists urls", method: http.MethodGet, target: "/api/admin/urls", want: http.StatusForbidden},
+		{name: "auditor lists urls", method: http.MethodGet, target: "/api/admin/urls", roles: []string{auth.RoleAuditor}, want: http.StatusOK},
+		{name: "auditor disables url", method: http.MethodPut, target: "/api/admin/urls/abc/disabled", roles: []string{auth.RoleAuditor}, want: http.StatusForbidden},
+		{name: "admin disables url", method: http.MethodPut, target: "/api/admin/urls/abc/disabled", roles: []string{auth.RoleAdmin}, want: http.StatusOK},
+		{name: "auditor on route without policy", method: http.MethodGet, target: "/api/admin/other", roles: []string{auth.RoleAuditor}, want: http.StatusForbidden},
+		{name: "admin on route without policy", method: http.MethodGet, target: "/api/admin/other", roles: []string{auth.RoleAdmin}, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := tokens.Issue(auth.User{ID: "user", Registered: true, Roles: tt.roles})
+			require.NoError(t, err)
+			request := httptest.NewRequest(tt.method, tt.target, nil)
+			request.AddCookie(&http.Cookie{Name: auth.TokenName, Value: token})
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, request)
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.want, res.StatusCode)
+		})
+	}
+}
+
+func TestLogout(t *testing.T) {
+	db := storage.NewMapDB()
+	revocations, err := auth.NewRevocationList(context.Background(), db)
+	require.NoError(t, err)
+	tokens, err := auth.New(config.ServerConfig{AuthSecret: "secret"}, revocations, nil)
+	require.NoError(t, err)
+
+	router := chi.NewRouter()
+	router.Post("/auth/logout", Logout(tokens))
+	router.With(middlewares.JWTMiddleware(tokens, db)).Get("/api/user/tags", GetTags(db))
+
+	token, err := tokens.Issue(auth.User{ID: "user", Registered: true})
+	require.NoError(t, err)
+	serve := func(method, target string) *http.Response {
+		request := httptest.NewRequest(method, target, nil)
+		request.AddCookie(&http.Cookie{Name: auth.TokenName, Value: token})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w.Result()
+	}
+
+	res := serve(http.MethodPost, "/auth/logout")
+	defer res.Body.Close()
+	require.Equal(t, http.StatusNoContent, res.StatusCode)
+	require.Len(t, res.Cookies(), 2)
+	for _, cookie := range res.Cookies() {
+		assert.Equal(t, -1, cookie.MaxAge, cookie.Name)
+	}
+
+	// Отозванный токен не принимается: middleware выдает новый анонимный токен.
+	res = serve(http.MethodGet, "/api/user/tags")
+	defer res.Body.Close()
+	require.Len(t, res.Cookies(), 1)
+	user, err := tokens.User(res.Cookies()[0].Value)
+	require.NoError(t, err)
+	assert.NotEqual(t, "user", user.ID)
+}
+
+func TestRefresh(t *testing.T) {
+	db := storage.NewMapDB()
+	roles := auth.RoleBindings{"admin": {auth.RoleAdmin}}
+	sessions := auth.NewSessions(db, time.Hour, roles)
+	tokens, err := auth.New(config.ServerConfig{AuthSecret: "secret", AuthTokenTTL: time.Minute}, nil, sessions)
+	require.NoError(t, err)
+
+	router := chi.NewRouter()
+	router.Post("/auth/refresh", Refresh(tokens))
+	router.With(middlewares.JWTMiddleware(tokens, db)).Get("/api/user/tags", GetTags(db))
+	router.With(middlewares.JWTMiddleware(tokens, db)).Post("/api/user/tags", func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusCreated)
+	})
+
+	serve := func(method, target string, cookies ...*http.Cookie) (*http.Response, map[string]string) {
+		request := httptest.NewRequest(method, target, nil)
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		res := w.Result()
+		res.Body.Close()
+		values := make(map[string]string)
+		for _, cookie := range res.Cookies() {
+			values[cookie.Name] = cookie.Value
+		}
+		return res, values
+	}
+
+	// Новый пользователь без изменяющего запроса получает только токен доступа: сессия не сохраняется.
+	_, anonymous := serve(http.MethodGet, "/api/user/tags")
+	require.NotEmpty(t, anonymous[auth.TokenName])
+	assert.Empty(t, anonymous[auth.RefreshTokenName])
+	user, err := tokens.User(anonymous[auth.TokenName])
+	require.NoError(t, err)
+
+	// Первый изменяющий запрос начинает сессию того же пользователя.
+	_, issued := serve(http.MethodPost, "/api/user/tags", &http.Cookie{Name: auth.TokenName, Value: anonymous[auth.TokenName]})
+	require.NotEmpty(t, issued[auth.RefreshTokenName])
+	started, err := tokens.User(issued[auth.TokenName])
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, started.ID)
+	assert.NotEmpty(t, started.SessionID)
+
+	// Без токена доступа middleware продлевает сессию того же пользователя.
+	_, refreshed := serve(http.MethodGet, "/api/user/tags", &http.Cookie{Name: auth.RefreshTokenName, Value: issued[auth.RefreshTokenName]})
+	require.NotEmpty(t, refreshed[auth.RefreshTokenName])
+	assert.NotEqual(t, issued[auth.RefreshTokenName], refreshed[auth.RefreshTokenName])
+	refreshedUser, err := tokens.User(refreshed[auth.TokenName])
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, refreshedUser.ID)
+
+	res, rotated := serve(http.MethodPost, "/auth/refresh", &http.Cookie{Name: auth.RefreshTokenName, Value: refreshed[auth.RefreshTokenName]})
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	require.NotEmpty(t, rotated[auth.RefreshTokenName])
+
+	// Повторное использование замененного токена завершает сессию: последний токен тоже перестает действовать.
+	res, _ = serve(http.MethodPost, "/auth/refresh", &http.Cookie{Name: auth.RefreshTokenName, Value: refreshed[auth.RefreshTokenName]})
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	res, _ = serve(http.MethodPost, "/auth/refresh", &http.Cookie{Name: auth.RefreshTokenName, Value: rotated[auth.RefreshTokenName]})
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	res, _ = serve(http.MethodPost, "/auth/refresh")
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	// Роли определяются при каждом обновлении: снятая роль пропадает из следующего токена доступа.
+	session, err := tokens.IssueSession(context.Background(), auth.User{ID: "admin", Registered: true, Roles: []string{auth.RoleAdmin}})
+	require.NoError(t, err)
+	_, refreshed = serve(http.MethodPost, "/auth/refresh", &http.Cookie{Name: auth.RefreshTokenName, Value: session.RefreshToken})
+	user, err = tokens.User(refreshed[auth.TokenName])
+	require.NoError(t, err)
+	assert.Equal(t, []string{auth.RoleAdmin}, user.Roles)
+	delete(roles, "admin")
+	_, refreshed = serve(http.MethodPost, "/auth/refresh", &http.Cookie{Name: auth.RefreshTokenName, Value: refreshed[auth.RefreshTokenName]})
+	user, err = tokens.User(refreshed[auth.TokenName])
+	require.NoError(t, err)
+	assert.Empty(t, user.Roles)
+}
+
+func TestCSRFMiddleware(t *testing.T) {
+	handler := middlewares.CSRFMiddleware(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusOK)
+	}))
+	session := &http.Cookie{Name: auth.TokenName, Value: "token"}
+	csrf := &http.Cookie{Name: middlewares.CSRFCookieName, Value: "csrf"}
+
+	tests := []struct {
+		name    string
+		method  string
+		cookies []*http.Cookie
+		headers map[string]string
+		want    int
+	}{
+		{name: "safe method", method: http.MethodGet, cookies: []*http.Cookie{session}, want: http.StatusOK},
+		{name: "no session cookie", method: http.MethodPost, want: http.StatusOK},
+		{name: "no csrf header", method: http.MethodPost, cookies: []*http.Cookie{session, csrf}, want: http.StatusForbidden},
+		{name: "no csrf cookie", method: http.MethodDelete, cookies: []*http.Cookie{session},
+			headers: map[string]string{middlewares.CSRFHeaderName: "csrf"}, want: http.StatusForbidden},
+		{name: "wrong csrf header", method: http.MethodPost, cookies: []*http.Cookie{session, csrf},
+			headers: map[string]string{middlewares.CSRFHeaderName: "other"}, want: http.StatusForbidden},
+		{name: "matching csrf header", method: http.MethodDelete, cookies: []*http.Cookie{session, csrf},
+			headers: map[string]string{middlewares.CSRFHeaderName: "csrf"}, want: http.StatusOK},
+		{name: "api key client", method: http.MethodPost, cookies: []*http.Cookie{session},
+			headers: map[string]string{auth.APIKeyHeader: auth.APIKeyPrefix + "key"}, want: http.StatusOK},
+		{name: "bearer token client", method: http.MethodPost, cookies: []*http.Cookie{session},
+			headers: map[string]string{"Authorization": "Bearer token"}, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, "/", nil)
+			for _, cookie := range tt.cookies {
+				request.AddCookie(cookie)
+			}
+			for name, value := range tt.headers {
+				request.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, request)
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.want, res.StatusCode)
+		})
+	}
+
+	// Клиенту без CSRF cookie она выдается, доступной скриптам страницы.
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	res := w.Result()
+	defer res.Body.Close()
+	require.Len(t, res.Cookies(), 1)
+	assert.Equal(t, middlewares.CSRFCookieName, res.Cookies()[0].Name)
+	assert.NotEmpty(t, res.Cookies()[0].Value)
+	assert.False(t, res.Cookies()[0].HttpOnly)
+	// Токен доступен и в заголовке ответа для скриптов других источников.
+	assert.Equal(t, res.Cookies()[0].Value, res.Header.Get(middlewares.CSRFHeaderName))
+}
+
+func TestNewCookieConfig(t *testing.T) {
+	cookies, err := middlewares.NewCookieConfig(config.ServerConfig{EnableHTTPS: true, CookieSameSite: "Strict", CookieDomain: "example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, middlewares.CookieConfig{Secure: true, SameSite: http.SameSiteStrictMode, Domain: "example.com"}, cookies)
+
+	cookies, err = middlewares.NewCookieConfig(config.ServerConfig{})
+	require.NoError(t, err)
+	assert.Equal(t, middlewares.CookieConfig{SameSite: http.SameSiteLaxMode}, cookies)
+
+	_, err = middlewares.NewCookieConfig(config.ServerConfig{CookieSameSite: "none"})
+	assert.Error(t, err)
+	_, err = middlewares.NewCookieConfig(config.ServerConfig{CookieSameSite: "sometimes"})
+	assert.Error(t, err)
+}
+
+func TestSecurityHeadersMiddleware(t *testing.T) {
+	security, err := middlewares.NewSecurityConfig(config.ServerConfig{EnableHTTPS: true, RedirectReferrerPolicy: "no-referrer"})
+	require.NoError(t, err)
+	r := chi.NewRouter()
+	r.Use(middlewares.SecurityHeadersMiddleware(security))
+	r.Get("/api/user/quota", func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "application/json")
+		res.Write([]byte("{}"))
+	})
+	r.Get("/{shortenURL}", func(res http.ResponseWriter, req *http.Request) {
+		if chi.URLParam(req, "shortenURL") == "blocked" {
+			writeAbusePage(res)
+			return
+		}
+		http.Redirect(res, req, "https://ya.ru", http.StatusTemporaryRedirect)
+	})
+
+	get := func(target string) *http.Response {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w.Result()
+	}
+
+	res := get("/api/user/quota")
+	defer res.Body.Close()
+	assert.Equal(t, "max-age=31536000", res.Header.Get("Strict-Transport-Security"))
+	assert.Equal(t, "nosniff", res.Header.Get("X-Content-Type-Options"))
+	assert.Equal(t, middlewares.DefaultReferrerPolicy, res.Header.Get("Referrer-Policy"))
+	assert.Empty(t, res.Header.Get("Content-Security-Policy"))
+
+	res = get("/abc")
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+	assert.Equal(t, "no-referrer", res.Header.Get("Referrer-Policy"))
+
+	res = get("/blocked")
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusUnavailableForLegalReasons, res.StatusCode)
+	assert.Equal(t, middlewares.HTMLContentSecurityPolicy, res.Header.Get("Content-Security-Policy"))
+	assert.Equal(t, "DENY", res.Header.Get("X-Frame-Options"))
+
+	// Без HTTPS заголовок HSTS не отправляется.
+	security, err = middlewares.NewSecurityConfig(config.ServerConfig{})
+	require.NoError(t, err)
+	assert.Zero(t, security.HSTSMaxAge)
+	assert.Equal(t, middlewares.DefaultReferrerPolicy, security.RedirectReferrerPolicy)
+
+	_, err = middlewares.NewSecurityConfig(config.ServerConfig{ReferrerPolicy: "everyone"})
+	assert.Error(t, err)
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		address string
+		host    string
+		want    string
+	}{
+		{address: ":443", host: "example.com", want: "https://example.com/abc?x=1"},
+		{address: ":8443", host: "example.com:8080", want: "https://example.com:8443/abc?x=1"},
+		{address: ":443", host: "[::1]:80", want: "https://[::1]/abc?x=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address+" "+tt.host, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/abc?x=1", nil)
+			request.Host = tt.host
+			w := httptest.NewRecorder()
+			RedirectToHTTPS(tt.address)(w, request)
+			assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+			assert.Equal(t, tt.want, w.Header().Get("Location"))
+		})
+	}
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	cors, err := middlewares.NewCORSConfig(config.ServerConfig{
+		CORSOrigins:     "https://app.example.com, https://*.example.org",
+		CORSCredentials: true,
+		CORSMaxAge:      10 * time.Minute,
+	})
+	require.NoError(t, err)
+	r := chi.NewRouter()
+	r.Use(middlewares.CORSMiddleware(cors))
+	r.Use(middlewares.CSRFMiddleware)
+	r.Post("/api/shorten", func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusCreated)
+	})
+
+	tests := []struct {
+		name        string
+		method      string
+		headers     map[string]string
+		want        int
+		allowOrigin string
+	}{
+		{name: "preflight", method: http.MethodOptions, headers: map[string]string{
+			"Origin": "https://app.example.com", "Access-Control-Request-Method": "POST",
+			"Access-Control-Request-Headers": "content-type, x-csrf-token"},
+			want: http.StatusNoContent, allowOrigin: "https://app.example.com"},
+		{name: "wildcard origin", method: http.MethodOptions, headers: map[string]string{
+			"Origin": "https://spa.example.org", "Access-Control-Request-Method": "POST"},
+			want: http.StatusNoContent, allowOrigin: "https://spa.example.org"},
+		{name: "unknown origin", method: http.MethodOptions, headers: map[string]string{
+			"Origin": "https://evil.example.com", "Access-Control-Request-Method": "POST"},
+			want: http.StatusForbidden},
+		{name: "unknown method", method: http.MethodOptions, headers: map[string]string{
+			"Origin": "https://app.example.com", "Access-Control-Request-Method": "TRACE"},
+			want: http.StatusForbidden},
+		{name: "unknown header", method: http.MethodOptions, headers: map[string]string{
+			"Origin": "https://app.example.com", "Access-Control-Request-Method": "POST",
+			"Access-Control-Request-Headers": "x-custom"},
+			want: http.StatusForbidden},
+		{name: "simple request", method: http.MethodPost, headers: map[string]string{"Origin": "https://app.example.com"},
+			want: http.StatusCreated, allowOrigin: "https://app.example.com"},
+		{name: "simple request from unknown origin", method: http.MethodPost, headers: map[string]string{"Origin": "https://example.org"},
+			want: http.StatusCreated},
+		{name: "same origin", method: http.MethodPost, want: http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, "/api/shorten", nil)
+			for name, value := range tt.headers {
+				request.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, request)
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.want, res.StatusCode)
+			assert.Equal(t, tt.allowOrigin, res.Header.Get("Access-Control-Allow-Origin"))
+			assert.Contains(t, res.Header.Values("Vary"), "Origin")
+			if tt.allowOrigin == "" {
+				return
+			}
+			assert.Equal(t, "true", res.Header.Get("Access-Control-Allow-Credentials"))
+			if tt.method == http.MethodOptions {
+				assert.Contains(t, res.Header.Get("Access-Control-Allow-Methods"), "POST")
+				assert.Equal(t, "600", res.Header.Get("Access-Control-Max-Age"))
+			} else {
+				assert.Contains(t, res.Header.Get("Access-Control-Expose-Headers"), middlewares.CSRFHeaderName)
+			}
+		})
+	}
+
+	// Запрос с cookie сессии с разрешенного источника по-прежнему требует CSRF токен.
+	request := httptest.NewRequest(http.MethodPost, "/api/shorten", nil)
+	request.Header.Set("Origin", "https://app.example.com")
+	request.AddCookie(&http.Cookie{Name: auth.TokenName, Value: "token"})
+	request.AddCookie(&http.Cookie{Name: middlewares.CSRFCookieName, Value: "csrf"})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	request.Header.Set(middlewares.CSRFHeaderName, "csrf")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// Любой источник без cookie.
+	cors, err = middlewares.NewCORSConfig(config.ServerConfig{CORSOrigins: "*"})
+	require.NoError(t, err)
+	request = httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set("Origin", "https://any.example.net")
+	w = httptest.NewRecorder()
+	middlewares.CORSMiddleware(cors)(http.NotFoundHandler()).ServeHTTP(w, request)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+
+	_, err = middlewares.NewCORSConfig(config.ServerConfig{CORSOrigins: "*", CORSCredentials: true})
+	assert.Error(t, err)
+	_, err = middlewares.NewCORSConfig(config.ServerConfig{CORSOrigins: "https://*.*.example.com"})
+	assert.Error(t, err)
+}
+
+func TestBearerToken(t *testing.T) {
+	db := storage.NewMapDB()
+	router := chi.NewRouter()
+	router.With(middlewares.JWTMiddleware(tokens, db)).Get("/api/user/tags", GetTags(db))
+	serve := func(authorization string, cookies ...*http.Cookie) *http.Response {
+		request := httptest.NewRequest(http.MethodGet, "/api/user/tags", nil)
+		if authorization != "" {
+			request.Header.Set("Authorization", authorization)
+		}
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		res := w.Result()
+		res.Body.Close()
+		return res
+	}
+
+	// Новый пользователь получает токен и в cookie, и в заголовке ответа.
+	res := serve("")
+	token := res.Header.Get(auth.TokenName)
+	require.NotEmpty(t, token)
+	require.Len(t, res.Cookies(), 1)
+	assert.Equal(t, token, res.Cookies()[0].Value)
+
+	res = serve("Bearer " + token)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Empty(t, res.Header.Get(auth.TokenName))
+
+	// Заголовок важнее cookie: невалидный токен в заголовке отклоняется, даже если cookie валидная.
+	res = serve("Bearer bad", &http.Cookie{Name: auth.TokenName, Value: token})
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	assert.Contains(t, res.Header.Get("WWW-Authenticate"), "invalid_token")
+	assert.Empty(t, res.Cookies())
+}
@@ -0,0 +1,30 @@
+package http
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// RedirectToHTTPS перенаправляет запрос по HTTP на тот же адрес по HTTPS. httpsAddress - адрес сервера HTTPS,
+// из которого берется порт; стандартный порт 443 в URL не указывается.
+func RedirectToHTTPS(httpsAddress string) http.HandlerFunc {
+	_, port, _ := net.SplitHostPort(httpsAddress)
+	return func(res http.ResponseWriter, req *http.Request) {
+		host := req.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		if host == "" {
+			http.Error(res, "Host header is required", http.StatusBadRequest)
+			return
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		http.Redirect(res, req, "https://"+host+req.URL.RequestURI(), http.StatusPermanentRedirect)
+	}
+}
@@ -0,0 +1,34 @@
+package middlewares
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/vancho-go/url-shortener/internal/app/clientip"
+)
+
+// ClientIPMiddleware выполняет роль middleware, которая определяет IP адрес клиента с учетом доверенных
+// прокси и сохраняет его в context запроса. Подключается первой, до логирования и ограничения частоты запросов.
+func ClientIPMiddleware(resolver *clientip.Resolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if addr := resolver.FromRequest(req); addr.IsValid() {
+				req = req.WithContext(clientip.NewContext(req.Context(), addr))
+			}
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
+// ClientIP возвращает IP адрес клиента запроса, определенный ClientIPMiddleware.
+// Без ClientIPMiddleware возвращает адрес соединения.
+func ClientIP(req *http.Request) string {
+	if addr, ok := clientip.FromContext(req.Context()); ok {
+		return addr.String()
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
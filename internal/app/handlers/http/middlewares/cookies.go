@@ -0,0 +1,88 @@
+package middlewares
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/vancho-go/url-shortener/internal/app/auth"
+	"github.com/vancho-go/url-shortener/internal/app/config"
+)
+
+// CookieConfig - атрибуты cookie, которые устанавливает сервис.
+type CookieConfig struct {
+	// Secure - cookie передаются только по HTTPS.
+	Secure bool
+	// SameSite - ограничение отправки cookie с запросами с других сайтов.
+	SameSite http.SameSite
+	// Domain - домен cookie. Пустой - только хост, выдавший cookie.
+	Domain string
+}
+
+// Cookies - атрибуты cookie сервиса. Задаются при запуске сервера по конфигурации (см. NewCookieConfig).
+var Cookies = CookieConfig{SameSite: http.SameSiteLaxMode}
+
+// NewCookieConfig собирает атрибуты cookie по конфигурации сервера. Secure включается вместе с HTTPS.
+// SameSite задается как "lax" (по умолчанию), "strict" или "none"; "none" требует HTTPS,
+// иначе браузеры отклоняют cookie.
+func NewCookieConfig(cfg config.ServerConfig) (CookieConfig, error) {
+	cookies := CookieConfig{Secure: cfg.EnableHTTPS, Domain: cfg.CookieDomain}
+	switch strings.ToLower(cfg.CookieSameSite) {
+	case "", "lax":
+		cookies.SameSite = http.SameSiteLaxMode
+	case "strict":
+		cookies.SameSite = http.SameSiteStrictMode
+	case "none":
+		if !cfg.EnableHTTPS {
+			return CookieConfig{}, errors.New("cookie SameSite=None requires HTTPS")
+		}
+		cookies.SameSite = http.SameSiteNoneMode
+	default:
+		return CookieConfig{}, fmt.Errorf("unknown cookie SameSite mode %q, lax, strict or none expected", cfg.CookieSameSite)
+	}
+	return cookies, nil
+}
+
+// New возвращает HttpOnly cookie на весь сайт с атрибутами конфигурации.
+func (c CookieConfig) New(name, value string) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   c.Domain,
+		Secure:   c.Secure,
+		HttpOnly: true,
+		SameSite: c.SameSite,
+	}
+}
+
+// SetTokenCookie устанавливает токен аутентификации в cookie ответа.
+func SetTokenCookie(res http.ResponseWriter, token string, ttl time.Duration) {
+	cookie := Cookies.New(auth.TokenName, token)
+	cookie.Expires = time.Now().Add(ttl)
+	http.SetCookie(res, cookie)
+}
+
+// SetSession передает клиенту токен аутентификации и токен обновления сессии, если он есть: в cookie
+// для браузеров и в одноименных заголовках ответа для клиентов, которые передают токен в Authorization.
+func SetSession(res http.ResponseWriter, session auth.TokenPair, tokens auth.TokenManager) {
+	SetTokenCookie(res, session.AccessToken, tokens.TTL())
+	res.Header().Set(auth.TokenName, session.AccessToken)
+	if session.RefreshToken != "" {
+		res.Header().Set(auth.RefreshTokenName, session.RefreshToken)
+		cookie := Cookies.New(auth.RefreshTokenName, session.RefreshToken)
+		cookie.Expires = time.Now().Add(tokens.RefreshTTL())
+		http.SetCookie(res, cookie)
+	}
+}
+
+// ClearTokenCookie удаляет cookie с токеном аутентификации и токеном обновления у клиента.
+func ClearTokenCookie(res http.ResponseWriter) {
+	for _, name := range []string{auth.TokenName, auth.RefreshTokenName} {
+		cookie := Cookies.New(name, "")
+		cookie.MaxAge = -1
+		http.SetCookie(res, cookie)
+	}
+}
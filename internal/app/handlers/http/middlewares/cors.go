@@ -0,0 +1,192 @@
+package middlewares
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vancho-go/url-shortener/internal/app/auth"
+	"github.com/vancho-go/url-shortener/internal/app/config"
+)
+
+// corsDefaultMethods - методы API сервиса, разрешенные по умолчанию.
+var corsDefaultMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// corsDefaultHeaders - заголовки запросов API сервиса, разрешенные по умолчанию.
+var corsDefaultHeaders = []string{"Content-Type", "Content-Encoding", "Authorization", auth.APIKeyHeader, CSRFHeaderName}
+
+// corsExposedHeaders - заголовки ответов, которые доступны скриптам других источников.
+var corsExposedHeaders = []string{
+	auth.TokenName, auth.RefreshTokenName, CSRFHeaderName,
+	"Location", "Retry-After", "Link", "X-Next-Cursor", "Content-Disposition",
+}
+
+// CORSConfig - параметры CORS.
+type CORSConfig struct {
+	// Origins - разрешенные источники. Шаблон может содержать одну "*": "https://*.example.com".
+	// "*" - любой источник. Пустой список - CORS выключен.
+	Origins []string
+	// Methods и Headers - разрешенные методы и заголовки запросов.
+	Methods []string
+	Headers []string
+	// Credentials - разрешены запросы с cookie.
+	Credentials bool
+	// MaxAge - время, на которое браузер запоминает ответ на предварительный запрос.
+	MaxAge time.Duration
+}
+
+// NewCORSConfig собирает параметры CORS по конфигурации сервера.
+// Запросы с cookie (Credentials) нельзя разрешить любому источнику: так любой сайт
+// мог бы выполнять запросы от имени пользователя.
+func NewCORSConfig(cfg config.ServerConfig) (CORSConfig, error) {
+	cors := CORSConfig{
+		Origins:     splitList(cfg.CORSOrigins),
+		Methods:     splitList(cfg.CORSMethods),
+		Headers:     splitList(cfg.CORSHeaders),
+		Credentials: cfg.CORSCredentials,
+		MaxAge:      cfg.CORSMaxAge,
+	}
+	for _, origin := range cors.Origins {
+		if strings.Count(origin, "*") > 1 {
+			return CORSConfig{}, fmt.Errorf("bad CORS origin %q, only one * allowed", origin)
+		}
+		if origin == "*" && cors.Credentials {
+			return CORSConfig{}, errors.New("CORS credentials cannot be allowed for any origin")
+		}
+	}
+	for i, method := range cors.Methods {
+		cors.Methods[i] = strings.ToUpper(method)
+	}
+	if len(cors.Methods) == 0 {
+		cors.Methods = corsDefaultMethods
+	}
+	if len(cors.Headers) == 0 {
+		cors.Headers = corsDefaultHeaders
+	}
+	return cors, nil
+}
+
+// CORSMiddleware выполняет роль middleware, которая обрабатывает запросы из браузера с других источников.
+// Предварительные запросы (OPTIONS с Access-Control-Request-Method) обрабатываются целиком и до обработчиков
+// не доходят, поэтому middleware подключается к корневому роутеру до CSRFMiddleware и JWTMiddleware.
+// Запросы с cookie с других сайтов требуют Credentials и cookie с SameSite=None; изменяющие запросы
+// с cookie должны повторять CSRF токен, который скрипт получает из заголовка ответа CSRFHeaderName.
+func CORSMiddleware(cors CORSConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(cors.Origins) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			origin := req.Header.Get("Origin")
+			preflight := req.Method == http.MethodOptions && req.Header.Get("Access-Control-Request-Method") != ""
+			header := res.Header()
+			header.Add("Vary", "Origin")
+			if preflight {
+				header.Add("Vary", "Access-Control-Request-Method")
+				header.Add("Vary", "Access-Control-Request-Headers")
+			}
+			if origin == "" {
+				next.ServeHTTP(res, req)
+				return
+			}
+			if !cors.allowsOrigin(origin) {
+				if preflight {
+					http.Error(res, "CORS request is not allowed", http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(res, req)
+				return
+			}
+
+			if cors.Credentials {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+			if !preflight {
+				header.Set("Access-Control-Allow-Origin", cors.allowedOrigin(origin))
+				header.Set("Access-Control-Expose-Headers", strings.Join(corsExposedHeaders, ", "))
+				next.ServeHTTP(res, req)
+				return
+			}
+
+			method := strings.ToUpper(req.Header.Get("Access-Control-Request-Method"))
+			requested := splitList(strings.Join(req.Header.Values("Access-Control-Request-Headers"), ","))
+			if !containsFold(cors.Methods, method) || !cors.allowsHeaders(requested) {
+				http.Error(res, "CORS request is not allowed", http.StatusForbidden)
+				return
+			}
+			header.Set("Access-Control-Allow-Origin", cors.allowedOrigin(origin))
+			header.Set("Access-Control-Allow-Methods", strings.Join(cors.Methods, ", "))
+			if len(requested) > 0 {
+				header.Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+			}
+			if cors.MaxAge > 0 {
+				header.Set("Access-Control-Max-Age", strconv.Itoa(int(cors.MaxAge.Seconds())))
+			}
+			res.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// allowsOrigin проверяет, разрешены ли запросы с источника origin.
+func (c CORSConfig) allowsOrigin(origin string) bool {
+	for _, pattern := range c.Origins {
+		prefix, suffix, wildcard := strings.Cut(pattern, "*")
+		if !wildcard {
+			if strings.EqualFold(pattern, origin) {
+				return true
+			}
+			continue
+		}
+		if len(origin) > len(prefix)+len(suffix) &&
+			strings.HasPrefix(strings.ToLower(origin), strings.ToLower(prefix)) &&
+			strings.HasSuffix(strings.ToLower(origin), strings.ToLower(suffix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedOrigin возвращает значение Access-Control-Allow-Origin для разрешенного источника origin.
+func (c CORSConfig) allowedOrigin(origin string) string {
+	if !c.Credentials && containsFold(c.Origins, "*") {
+		return "*"
+	}
+	return origin
+}
+
+// allowsHeaders проверяет, разрешены ли заголовки запроса headers.
+func (c CORSConfig) allowsHeaders(headers []string) bool {
+	if !c.Credentials && containsFold(c.Headers, "*") {
+		return true
+	}
+	for _, name := range headers {
+		if !containsFold(c.Headers, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitList разбирает список значений через запятую без пустых значений.
+func splitList(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// containsFold проверяет, есть ли значение в слайсе без учета регистра.
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
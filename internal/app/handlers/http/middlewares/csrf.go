@@ -0,0 +1,86 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/vancho-go/url-shortener/internal/app/auth"
+)
+
+// CSRFCookieName - имя cookie с CSRF токеном. Cookie доступна скриптам страницы,
+// чтобы они могли повторить токен в заголовке CSRFHeaderName.
+const CSRFCookieName = "CSRFToken"
+
+// CSRFHeaderName - заголовок, в котором клиент повторяет CSRF токен из cookie.
+const CSRFHeaderName = "X-CSRF-Token"
+
+// CSRFMiddleware выполняет роль middleware, которая защищает от CSRF запросы, аутентифицированные cookie,
+// по схеме double-submit: клиенту выдается cookie CSRFCookieName со случайным токеном, а изменяющий запрос
+// (не GET, HEAD, OPTIONS) с cookie сессии должен повторить токен в заголовке CSRFHeaderName.
+// Чужой сайт не может ни прочитать cookie, ни добавить заголовок к запросу, поэтому подделанный запрос
+// отклоняется с 403. Запросы с API ключом или токеном в Authorization и запросы без cookie сессии
+// не проверяются: браузер не подставляет такие учетные данные в запрос автоматически, а JWTMiddleware
+// предпочитает заголовок Authorization cookie.
+// Токен также отправляется в заголовке ответа CSRFHeaderName: скрипты других источников, разрешенных
+// CORSMiddleware, не могут прочитать cookie, но могут прочитать заголовок.
+func CSRFMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		var token string
+		if cookie, err := req.Cookie(CSRFCookieName); err == nil {
+			token = cookie.Value
+		}
+		issued := token
+		if token == "" {
+			var err error
+			issued, err = generateCSRFToken()
+			if err != nil {
+				Log.Error("error generating csrf token", zap.Error(err))
+				http.Error(res, "Error generating CSRF token", http.StatusInternalServerError)
+				return
+			}
+			cookie := Cookies.New(CSRFCookieName, issued)
+			cookie.HttpOnly = false
+			http.SetCookie(res, cookie)
+		}
+		res.Header().Set(CSRFHeaderName, issued)
+
+		if !isSafeMethod(req.Method) && hasSessionCookie(req) {
+			if _, ok := bearerCredentials(req); !ok && req.Header.Get(auth.APIKeyHeader) == "" {
+				header := req.Header.Get(CSRFHeaderName)
+				if token == "" || subtle.ConstantTimeCompare([]byte(header), []byte(token)) != 1 {
+					http.Error(res, "CSRF token is missing or invalid", http.StatusForbidden)
+					return
+				}
+			}
+		}
+		next.ServeHTTP(res, req)
+	})
+}
+
+// isSafeMethod проверяет, что метод не изменяет состояние сервиса.
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// hasSessionCookie проверяет, передает ли запрос cookie с токеном аутентификации или обновления.
+func hasSessionCookie(req *http.Request) bool {
+	for _, name := range []string{auth.TokenName, auth.RefreshTokenName} {
+		if _, err := req.Cookie(name); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// generateCSRFToken генерирует случайный CSRF токен.
+func generateCSRFToken() (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(random), nil
+}
@@ -9,19 +9,34 @@ import (
 )
 
 type gzipWriter struct {
-	w          http.ResponseWriter
-	gzipWriter *gzip.Writer
+	w           http.ResponseWriter
+	gzipWriter  *gzip.Writer
+	wroteHeader bool
+	compress    bool
 }
 
 // Write реализация метода Write для gzipWriter.
 func (g *gzipWriter) Write(p []byte) (int, error) {
+	if !g.wroteHeader {
+		g.WriteHeader(http.StatusOK)
+	}
+	if !g.compress {
+		return g.w.Write(p)
+	}
 	return g.gzipWriter.Write(p)
 }
 
 // WriteHeader реализация метода WriteHeader для gzipWriter.
+// Сжимаются только успешные ответы с телом, остальные отдаются как есть.
 func (g *gzipWriter) WriteHeader(statusCode int) {
-	if statusCode < 300 {
+	if g.wroteHeader {
+		return
+	}
+	g.wroteHeader = true
+	if statusCode < 300 && statusCode != http.StatusNoContent {
+		g.compress = true
 		g.w.Header().Set("Content-Encoding", "gzip")
+		g.w.Header().Del("Content-Length")
 	}
 	g.w.WriteHeader(statusCode)
 }
@@ -31,8 +46,26 @@ func (g *gzipWriter) Header() http.Header {
 	return g.w.Header()
 }
 
+// Flush отправляет клиенту уже сжатые данные, не дожидаясь конца ответа.
+// Нужен потоковым обработчикам, которые пишут ответ частями.
+func (g *gzipWriter) Flush() {
+	if g.compress {
+		g.gzipWriter.Flush()
+	}
+	http.NewResponseController(g.w).Flush()
+}
+
+// Unwrap возвращает оригинальный http.ResponseWriter, чтобы http.ResponseController мог включить
+// одновременное чтение запроса и запись ответа (EnableFullDuplex).
+func (g *gzipWriter) Unwrap() http.ResponseWriter {
+	return g.w
+}
+
 // Close реализация метода Close для gzipWriter.
 func (g *gzipWriter) Close() error {
+	if !g.compress {
+		return nil
+	}
 	return g.gzipWriter.Close()
 }
 
@@ -2,136 +2,184 @@
 package middlewares
 
 import (
-	"context"
+	"errors"
 	"fmt"
-	"github.com/golang-jwt/jwt/v4"
-	"github.com/google/uuid"
-	"go.uber.org/zap"
 	"net/http"
-	"time"
-)
+	"strings"
 
-type key int
+	"go.uber.org/zap"
 
-// CookieKey - параметр, необходимый для передачи токена через context.
-const (
-	CookieKey key = iota
+	"github.com/vancho-go/url-shortener/internal/app/auth"
 )
 
-// tokenExp - время действия сгенерированного токена (cookie).
-const tokenExp = time.Hour * 24
+// JWTMiddleware выполняет роль middleware, которая аутентифицирует пользователя запроса и передает его
+// следующему обработчику через context. Учетные данные проверяются в порядке приоритета:
+//  1. API ключ (X-API-Key или Authorization: Bearer usk_...). Невалидный ключ или ключ без нужного права
+//     отклоняется без выпуска нового токена.
+//  2. Токен в Authorization: Bearer. Невалидный, истекший или отозванный токен отклоняется с 401:
+//     клиент с токеном должен сам обновить его (POST /auth/refresh), а не получить нового пользователя.
+//  3. Токен в cookie AuthToken.
+//  4. Токен обновления в cookie RefreshToken: сессия продлевается, пользователь сохраняется.
+//  5. Иначе генерируется новый пользователь.
+//
+// Сессия (токен обновления) анонимного пользователя сохраняется в хранилище только при первом изменяющем
+// запросе: иначе каждый переход по короткой ссылке без cookie создавал бы запись. До этого пользователь
+// получает только токен доступа.
+//
+// Выпущенные токены устанавливаются в cookie и в заголовки ответа AuthToken и RefreshToken.
+func JWTMiddleware(tokens auth.TokenManager, keys auth.APIKeyStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if key, ok := apiKeyFromRequest(req); ok {
+				user, err := auth.AuthenticateAPIKey(req.Context(), keys, key)
+				if err != nil {
+					if !errors.Is(err, auth.ErrInvalidAPIKey) {
+						Log.Error("error checking api key", zap.Error(err))
+						http.Error(res, "Error checking API key", http.StatusInternalServerError)
+						return
+					}
+					http.Error(res, "Bad API key", http.StatusUnauthorized)
+					return
+				}
+				if !user.Allows(auth.ScopeForHTTPMethod(req.Method)) {
+					http.Error(res, "API key has no permission for this request", http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(res, req.WithContext(auth.NewContext(req.Context(), user)))
+				return
+			}
 
-// secretKey - секретный ключ для генерации токена (bad practice to store it here, just for study case).
-const secretKey = "temp_secret_key"
+			if token, ok := bearerToken(req); ok {
+				user, err := tokens.User(token)
+				if err != nil {
+					res.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+					http.Error(res, "Bad token", http.StatusUnauthorized)
+					return
+				}
+				next.ServeHTTP(res, req.WithContext(auth.NewContext(req.Context(), user)))
+				return
+			}
 
-// Claims - данные, которые в себе будет содержать генерируемый токен.
-type Claims struct {
-	jwt.RegisteredClaims
-	UserID string
-}
+			if cookie, err := req.Cookie(auth.TokenName); err == nil {
+				if user, err := tokens.User(cookie.Value); err == nil {
+					if needsSession(req, tokens, user) && !startSession(res, req, tokens, user) {
+						return
+					}
+					next.ServeHTTP(res, req.WithContext(auth.NewContext(req.Context(), user)))
+					return
+				}
+			}
+
+			if cookie, err := req.Cookie(auth.RefreshTokenName); err == nil {
+				user, session, err := tokens.Refresh(req.Context(), cookie.Value)
+				if err == nil {
+					SetSession(res, session, tokens)
+					next.ServeHTTP(res, req.WithContext(auth.NewContext(req.Context(), user)))
+					return
+				}
+				LogRefreshError(err)
+			}
+
+			user := auth.User{ID: auth.GenerateUserID(), New: true}
+			if needsSession(req, tokens, user) {
+				if !startSession(res, req, tokens, user) {
+					return
+				}
+			} else {
+				token, err := tokens.Issue(user)
+				if err != nil {
+					Log.Error("error building new token", zap.Error(err))
+					http.Error(res, "Error building new token", http.StatusInternalServerError)
+					return
+				}
+				SetSession(res, auth.TokenPair{AccessToken: token}, tokens)
+			}
+			Log.Debug(fmt.Sprintf("generated new jwt token for user %s", user.ID))
 
-// GenerateUserID генерирует рандомный UUID.
-func GenerateUserID() string {
-	return uuid.New().String()
+			next.ServeHTTP(res, req.WithContext(auth.NewContext(req.Context(), user)))
+		})
+	}
 }
 
-// generateJWTToken токен для пользователя, чей userID передан в качестве параметра.
-func generateJWTToken(userID string) (string, error) {
-	// создаём новый токен с алгоритмом подписи HS256 и утверждениями — Claims
-	expirationTime := time.Now().Add(tokenExp)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
-		RegisteredClaims: jwt.RegisteredClaims{
-			// когда создан токен
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			Issuer:    "",                             // не используется
-			Subject:   "",                             // не используется
-			Audience:  []string{},                     // не используется
-			NotBefore: jwt.NewNumericDate(time.Now()), // не используется
-			IssuedAt:  jwt.NewNumericDate(time.Now()), // не используется
-			ID:        "",                             // не используется
-		},
-		// собственное утверждение
-		UserID: userID,
-	})
-	return token.SignedString([]byte(secretKey))
+// needsSession проверяет, нужно ли начать сессию анонимного пользователя user без сессии:
+// сессия начинается при первом изменяющем запросе, чтобы созданные URL не потерялись с истечением токена доступа.
+// Анонимный пользователь, выполнявший только чтение, после истечения токена получает новый идентификатор.
+func needsSession(req *http.Request, tokens auth.TokenManager, user auth.User) bool {
+	return tokens.RefreshTTL() > 0 && !user.Registered && user.SessionID == "" &&
+		auth.ScopeForHTTPMethod(req.Method) != auth.ScopeRead
 }
 
-// isTokenValid проверяет токен на валидность.
-func isTokenValid(tokenString string) bool {
-	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-		}
-		return []byte(secretKey), nil
-	})
+// startSession начинает сессию пользователя user и устанавливает ее токены в ответ.
+// При ошибке отправляет клиенту 500 и возвращает false.
+func startSession(res http.ResponseWriter, req *http.Request, tokens auth.TokenManager, user auth.User) bool {
+	session, err := tokens.IssueSession(req.Context(), user)
 	if err != nil {
+		Log.Error("error building new token", zap.Error(err))
+		http.Error(res, "Error building new token", http.StatusInternalServerError)
 		return false
 	}
-	return token.Valid
+	SetSession(res, session, tokens)
+	return true
 }
 
-// GetUserID извлекает userID из валидного токена.
-func GetUserID(tokenString string) (string, error) {
-	if !isTokenValid(tokenString) {
-		return "", fmt.Errorf("token is not valid")
+// LogRefreshError пишет в лог неудачное обновление сессии. Повторное использование токена обновления
+// может означать его кражу, поэтому пишется предупреждение; невалидный токен - обычная ситуация.
+func LogRefreshError(err error) {
+	switch {
+	case errors.Is(err, auth.ErrRefreshTokenReused):
+		Log.Warn("refresh token reuse detected, session revoked")
+	case !errors.Is(err, auth.ErrInvalidRefreshToken):
+		Log.Error("error refreshing session", zap.Error(err))
 	}
-	claims := &Claims{
-		RegisteredClaims: jwt.RegisteredClaims{
-			Issuer:    "",                             // не используется
-			Subject:   "",                             // не используется
-			Audience:  []string{},                     // не используется
-			NotBefore: jwt.NewNumericDate(time.Now()), // не используется
-			IssuedAt:  jwt.NewNumericDate(time.Now()), // не используется
-			ID:        "",                             // не используется
-			ExpiresAt: nil,                            // не используется
-		},
-		UserID: "",
+}
+
+// AccessToken извлекает токен из запроса: из Authorization: Bearer, а если его нет - из cookie.
+func AccessToken(req *http.Request) (string, bool) {
+	if token, ok := bearerToken(req); ok {
+		return token, true
 	}
-	_, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
-		return []byte(secretKey), nil
-	})
-	if err != nil {
-		return "", fmt.Errorf("error parsing token")
+	if cookie, err := req.Cookie(auth.TokenName); err == nil && cookie.Value != "" {
+		return cookie.Value, true
+	}
+	return "", false
+}
+
+// RefreshToken извлекает токен обновления из заголовка RefreshToken, а если его нет - из cookie.
+func RefreshToken(req *http.Request) (string, bool) {
+	if token := req.Header.Get(auth.RefreshTokenName); token != "" {
+		return token, true
+	}
+	if cookie, err := req.Cookie(auth.RefreshTokenName); err == nil && cookie.Value != "" {
+		return cookie.Value, true
 	}
-	return claims.UserID, nil
+	return "", false
 }
 
-// JWTMiddleware выполняет роль middleware, которая проверяет наличие токена аутентификации.
-// Если токен присутствует и он валидный, middleware передает запрос следующему обработчику.
-// Если токена нет, генерируется новый токен, который передается следующему обработчику через context.
-func JWTMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
-		cookie, err := req.Cookie("AuthToken")
-		if err == nil && isTokenValid(cookie.Value) {
-			next.ServeHTTP(res, req)
-			return
-		}
-
-		userID := GenerateUserID()
-		jwtToken, err := generateJWTToken(userID)
-		if err != nil {
-			Log.Error("error building new token", zap.Error(err))
-			return
-		}
-		Log.Debug(fmt.Sprintf("generated new jwt token for user %s", userID))
-		cookieNew := &http.Cookie{
-			Name: "AuthToken",
-
-			Value:      jwtToken,
-			Expires:    time.Now().Add(tokenExp),
-			HttpOnly:   true,
-			Path:       "/",
-			Domain:     "",                       // не используется
-			Secure:     false,                    // не используется
-			SameSite:   http.SameSiteDefaultMode, // не используется
-			Raw:        "",                       // не используется
-			Unparsed:   []string{},               // не используется
-			RawExpires: "",                       // не используется
-		}
-
-		http.SetCookie(res, cookieNew)
-
-		ctx := context.WithValue(req.Context(), CookieKey, cookieNew)
-		next.ServeHTTP(res, req.WithContext(ctx))
-	})
+// apiKeyFromRequest извлекает API ключ из заголовка X-API-Key или Authorization: Bearer.
+func apiKeyFromRequest(req *http.Request) (string, bool) {
+	if key := req.Header.Get(auth.APIKeyHeader); key != "" {
+		return key, true
+	}
+	if credentials, ok := bearerCredentials(req); ok && auth.IsAPIKey(credentials) {
+		return credentials, true
+	}
+	return "", false
+}
+
+// bearerToken извлекает токен (но не API ключ) из заголовка Authorization: Bearer.
+func bearerToken(req *http.Request) (string, bool) {
+	if credentials, ok := bearerCredentials(req); ok && !auth.IsAPIKey(credentials) {
+		return credentials, true
+	}
+	return "", false
+}
+
+// bearerCredentials извлекает значение из заголовка Authorization со схемой Bearer.
+func bearerCredentials(req *http.Request) (string, bool) {
+	scheme, credentials, ok := strings.Cut(req.Header.Get("Authorization"), " ")
+	credentials = strings.TrimSpace(credentials)
+	if !ok || !strings.EqualFold(scheme, "Bearer") || credentials == "" {
+		return "", false
+	}
+	return credentials, true
 }
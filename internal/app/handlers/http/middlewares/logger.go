@@ -43,6 +43,11 @@ func (r *loggingResponseWriter) WriteHeader(statusCode int) {
 	r.responseData.status = statusCode // захватываем код статуса
 }
 
+// Unwrap возвращает оригинальный http.ResponseWriter, чтобы http.ResponseController мог добраться до Flush.
+func (r *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 // Initialize инициализирует синглтон логера с необходимым уровнем логирования.
 func Initialize(level string) error {
 	config := zap.NewDevelopmentConfig()
@@ -77,6 +82,7 @@ func RequestLogger(h http.HandlerFunc) http.HandlerFunc {
 		Log.Info("got incoming HTTP request",
 			zap.String("method", r.Method),
 			zap.String("path", r.URL.Path),
+			zap.String("ip", ClientIP(r)),
 			zap.String("processing duration", processingDuration.String()),
 			zap.String("status code", strconv.Itoa(responseData.status)),
 			zap.String("response size", strconv.Itoa(responseData.size)),
@@ -0,0 +1,45 @@
+package middlewares
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/vancho-go/url-shortener/internal/app/auth"
+	"github.com/vancho-go/url-shortener/internal/app/ratelimit"
+)
+
+// RateLimitMiddleware выполняет роль middleware, которая ограничивает частоту запросов клиента.
+// Класс запроса берется из таблицы classes по методу и шаблону пути chi, как в RoleMiddleware,
+// поэтому middleware должна подключаться внутри группы маршрутов. Клиент определяется по API ключу,
+// пользователю или IP адресу (см. ratelimit.KeyOf), поэтому middleware подключается после JWTMiddleware.
+// При превышении лимита возвращается 429 с заголовком Retry-After.
+func RateLimitMiddleware(limiter *ratelimit.Limiter, classes ratelimit.Classes) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			method := req.Method
+			if rctx := chi.RouteContext(req.Context()); rctx != nil {
+				method += " " + rctx.RoutePattern()
+			}
+			class, ok := classes.Of(method)
+			if !ok {
+				next.ServeHTTP(res, req)
+				return
+			}
+
+			user, _ := auth.FromContext(req.Context())
+			allowed, retryAfter, err := limiter.Allow(req.Context(), class, ratelimit.KeyOf(class, user, ClientIP(req)))
+			if err != nil {
+				Log.Error("rate limit store error", zap.Error(err))
+			}
+			if !allowed {
+				res.Header().Set("Retry-After", strconv.Itoa(ratelimit.RetryAfterSeconds(retryAfter)))
+				http.Error(res, "Too many requests", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(res, req)
+		})
+	}
+}
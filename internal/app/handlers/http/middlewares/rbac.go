@@ -0,0 +1,30 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/vancho-go/url-shortener/internal/app/auth"
+)
+
+// RoleMiddleware выполняет роль middleware, которая проверяет роли пользователя запроса по таблице policy.
+// Ключ таблицы - метод и шаблон пути chi ("GET /api/admin/urls"), поэтому middleware должна
+// подключаться внутри группы маршрутов (r.Group или r.With), где маршрут уже выбран.
+// Должна подключаться после JWTMiddleware.
+func RoleMiddleware(policy auth.Policy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			method := req.Method
+			if rctx := chi.RouteContext(req.Context()); rctx != nil {
+				method += " " + rctx.RoutePattern()
+			}
+			user, _ := auth.FromContext(req.Context())
+			if !policy.Allows(method, user) {
+				http.Error(res, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(res, req)
+		})
+	}
+}
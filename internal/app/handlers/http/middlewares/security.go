@@ -0,0 +1,130 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vancho-go/url-shortener/internal/app/config"
+)
+
+// DefaultHSTSMaxAge - время, на которое браузер запоминает, что сервис доступен только по HTTPS.
+const DefaultHSTSMaxAge = 365 * 24 * time.Hour
+
+// DefaultReferrerPolicy - заголовок Referrer-Policy по умолчанию.
+const DefaultReferrerPolicy = "strict-origin-when-cross-origin"
+
+// HTMLContentSecurityPolicy - заголовок Content-Security-Policy HTML страниц сервиса: страницы не загружают
+// скрипты и внешние ресурсы, не отправляют формы и не встраиваются в чужие страницы.
+const HTMLContentSecurityPolicy = "default-src 'none'; style-src 'unsafe-inline'; img-src 'self'; " +
+	"base-uri 'none'; form-action 'none'; frame-ancestors 'none'"
+
+// referrerPolicies - допустимые значения Referrer-Policy.
+var referrerPolicies = []string{
+	"no-referrer", "no-referrer-when-downgrade", "origin", "origin-when-cross-origin",
+	"same-origin", "strict-origin", "strict-origin-when-cross-origin", "unsafe-url",
+}
+
+// SecurityConfig - заголовки безопасности ответов.
+type SecurityConfig struct {
+	// HSTSMaxAge - max-age заголовка Strict-Transport-Security. 0 - заголовок не отправляется.
+	HSTSMaxAge time.Duration
+	// ReferrerPolicy - Referrer-Policy ответов.
+	ReferrerPolicy string
+	// RedirectReferrerPolicy - Referrer-Policy перенаправлений.
+	RedirectReferrerPolicy string
+}
+
+// NewSecurityConfig собирает заголовки безопасности по конфигурации сервера.
+// Strict-Transport-Security отправляется только в режиме HTTPS: по HTTP браузеры его игнорируют.
+func NewSecurityConfig(cfg config.ServerConfig) (SecurityConfig, error) {
+	security := SecurityConfig{
+		ReferrerPolicy:         strings.ToLower(cfg.ReferrerPolicy),
+		RedirectReferrerPolicy: strings.ToLower(cfg.RedirectReferrerPolicy),
+	}
+	if cfg.EnableHTTPS {
+		security.HSTSMaxAge = cfg.HSTSMaxAge
+		if security.HSTSMaxAge == 0 {
+			security.HSTSMaxAge = DefaultHSTSMaxAge
+		}
+	}
+	if security.ReferrerPolicy == "" {
+		security.ReferrerPolicy = DefaultReferrerPolicy
+	}
+	if security.RedirectReferrerPolicy == "" {
+		security.RedirectReferrerPolicy = security.ReferrerPolicy
+	}
+	for _, policy := range []string{security.ReferrerPolicy, security.RedirectReferrerPolicy} {
+		if !containsFold(referrerPolicies, policy) {
+			return SecurityConfig{}, fmt.Errorf("unknown referrer policy %q", policy)
+		}
+	}
+	return security, nil
+}
+
+// SecurityHeadersMiddleware выполняет роль middleware, которая добавляет к ответам заголовки безопасности:
+// Strict-Transport-Security, X-Content-Type-Options и Referrer-Policy, а HTML страницам - Content-Security-Policy
+// и X-Frame-Options. Перенаправления получают Referrer-Policy security.RedirectReferrerPolicy.
+// Заголовки, уже установленные обработчиком, не меняются.
+func SecurityHeadersMiddleware(security SecurityConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			header := res.Header()
+			if security.HSTSMaxAge > 0 {
+				header.Set("Strict-Transport-Security", "max-age="+strconv.Itoa(int(security.HSTSMaxAge.Seconds())))
+			}
+			header.Set("X-Content-Type-Options", "nosniff")
+			next.ServeHTTP(&securityResponseWriter{ResponseWriter: res, security: security}, req)
+		})
+	}
+}
+
+// securityResponseWriter добавляет заголовки, которые зависят от ответа, перед отправкой статуса.
+type securityResponseWriter struct {
+	http.ResponseWriter
+	security    SecurityConfig
+	wroteHeader bool
+}
+
+// WriteHeader добавляет заголовки безопасности и отправляет статус.
+func (w *securityResponseWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		header := w.Header()
+		if header.Get("Referrer-Policy") == "" {
+			policy := w.security.ReferrerPolicy
+			if statusCode >= 300 && statusCode < 400 && header.Get("Location") != "" {
+				policy = w.security.RedirectReferrerPolicy
+			}
+			header.Set("Referrer-Policy", policy)
+		}
+		if strings.HasPrefix(header.Get("Content-Type"), "text/html") && header.Get("Content-Security-Policy") == "" {
+			header.Set("Content-Security-Policy", HTMLContentSecurityPolicy)
+			header.Set("X-Frame-Options", "DENY")
+		}
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write отправляет статус 200, если обработчик не отправил статус, и записывает тело ответа.
+func (w *securityResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap возвращает оригинальный http.ResponseWriter, чтобы http.ResponseController мог добраться до Flush.
+func (w *securityResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// FlushError отправляет статус 200, если обработчик не отправил статус, и сбрасывает буфер ответа.
+func (w *securityResponseWriter) FlushError() error {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
@@ -0,0 +1,28 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/vancho-go/url-shortener/internal/app/storage"
+)
+
+// GetQuota возвращает квоты пользователя на сокращение URL и их текущее использование.
+func GetQuota(db storage.QuotaStorager) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID, ok := requireUserID(res, req)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(req.Context(), 1*time.Second)
+		defer cancel()
+		quota, err := db.GetQuota(ctx, userID)
+		if err != nil {
+			writeStorageError(res, err)
+			return
+		}
+		writeJSON(res, http.StatusOK, quota)
+	}
+}
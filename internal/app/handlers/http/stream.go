@@ -0,0 +1,105 @@
+package http
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"go.uber.org/zap"
+
+	"github.com/vancho-go/url-shortener/internal/app/handlers/http/middlewares"
+	"github.com/vancho-go/url-shortener/internal/app/models"
+	"github.com/vancho-go/url-shortener/internal/app/screening"
+	"github.com/vancho-go/url-shortener/internal/app/storage"
+	"github.com/vancho-go/url-shortener/internal/app/urlnorm"
+)
+
+// maxStreamLineSize - максимальная длина одной строки NDJSON.
+const maxStreamLineSize = 1 << 20
+
+// EncodeStream сокращает URL, переданные в формате NDJSON (одна строка - один models.APIBatchRequest).
+// Если в строке задан shorten_url, он используется как пользовательский сокращенный URL.
+// Строки читаются по одной и сохраняются пачками, на каждую строку в ответ пишется строка
+// models.APIStreamResponse, как только ее пачка сохранена. Ошибка в строке или пачке
+// не прерывает обработку остальных строк, в том числе некорректный или заблокированный оригинальный URL
+// (см. urlnorm и screening).
+func EncodeStream(db storage.URLStorager, urls *urlnorm.Normalizer, screener *screening.Screener, addr string) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID, ok := requireUserID(res, req)
+		if !ok {
+			return
+		}
+
+		rc := http.NewResponseController(res)
+		enableFullDuplex(rc)
+		res.Header().Set("Content-Type", "application/x-ndjson")
+		res.WriteHeader(http.StatusOK)
+		enc := json.NewEncoder(res)
+
+		written := false
+		batcher := storage.NewBatchWriter(db, userID, storage.DefaultBatchSize, func(result storage.BatchResult) error {
+			response := models.APIStreamResponse{CorrelationID: result.CorrelationID}
+			if result.Err != nil {
+				response.Error = result.Err.Error()
+			} else {
+				response.ShortenURL = addr + "/" + result.ShortenURL
+			}
+			written = true
+			return enc.Encode(response)
+		})
+
+		// flush отправляет клиенту результаты сохраненных пачек.
+		flush := func() error {
+			if !written {
+				return nil
+			}
+			written = false
+			if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+				return err
+			}
+			return nil
+		}
+
+		scanner := bufio.NewScanner(req.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLineSize)
+		for line := 1; scanner.Scan(); line++ {
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+
+			var url models.APIBatchRequest
+			err := json.Unmarshal(scanner.Bytes(), &url)
+			if err != nil {
+				err = batcher.Reject(req.Context(), models.APIBatchRequest{CorrelationID: strconv.Itoa(line)}, errors.New("bad JSON"))
+			} else {
+				if url.CorrelationID == "" {
+					url.CorrelationID = strconv.Itoa(line)
+				}
+				err = addURL(req.Context(), batcher, urls, screener, url)
+			}
+			if err == nil {
+				err = flush()
+			}
+			if err != nil {
+				middlewares.Log.Error("error writing stream results", zap.Error(err))
+				return
+			}
+		}
+
+		err := batcher.Flush(req.Context())
+		if err == nil && scanner.Err() != nil {
+			// Оставшуюся часть тела прочитать не удалось: сообщаем об этом последней строкой.
+			middlewares.Log.Warn("error reading NDJSON stream", zap.Error(scanner.Err()))
+			err = enc.Encode(models.APIStreamResponse{Error: scanner.Err().Error()})
+		}
+		if err == nil {
+			written = true
+			err = flush()
+		}
+		if err != nil {
+			middlewares.Log.Error("error writing stream results", zap.Error(err))
+		}
+	}
+}
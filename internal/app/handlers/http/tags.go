@@ -0,0 +1,302 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/vancho-go/url-shortener/internal/app/auth"
+	"github.com/vancho-go/url-shortener/internal/app/handlers/http/middlewares"
+	"github.com/vancho-go/url-shortener/internal/app/models"
+	"github.com/vancho-go/url-shortener/internal/app/storage"
+)
+
+// GetTags возвращает теги пользователя.
+func GetTags(db storage.TagStorager) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID, ok := requireUserID(res, req)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(req.Context(), 1*time.Second)
+		defer cancel()
+		tags, err := db.GetTags(ctx, userID)
+		if err != nil {
+			writeStorageError(res, err)
+			return
+		}
+		writeJSON(res, http.StatusOK, tags)
+	}
+}
+
+// CreateTag создает тег пользователя.
+func CreateTag(db storage.TagStorager) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID, ok := requireUserID(res, req)
+		if !ok {
+			return
+		}
+
+		var request models.Tag
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			http.Error(res, "Error decoding tag", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(req.Context(), 1*time.Second)
+		defer cancel()
+		tag, err := db.CreateTag(ctx, userID, request.Name)
+		if err != nil {
+			writeStorageError(res, err)
+			return
+		}
+		writeJSON(res, http.StatusCreated, tag)
+	}
+}
+
+// RenameTag переименовывает тег пользователя.
+func RenameTag(db storage.TagStorager) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID, ok := requireUserID(res, req)
+		if !ok {
+			return
+		}
+
+		tagID, err := strconv.ParseInt(chi.URLParam(req, "tagID"), 10, 64)
+		if err != nil {
+			http.Error(res, "Bad tag id", http.StatusBadRequest)
+			return
+		}
+		var request models.Tag
+		if err = json.NewDecoder(req.Body).Decode(&request); err != nil {
+			http.Error(res, "Error decoding tag", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(req.Context(), 1*time.Second)
+		defer cancel()
+		if err = db.RenameTag(ctx, userID, tagID, request.Name); err != nil {
+			writeStorageError(res, err)
+			return
+		}
+		writeJSON(res, http.StatusOK, models.Tag{ID: tagID, Name: request.Name})
+	}
+}
+
+// DeleteTag удаляет тег пользователя.
+func DeleteTag(db storage.TagStorager) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID, ok := requireUserID(res, req)
+		if !ok {
+			return
+		}
+
+		tagID, err := strconv.ParseInt(chi.URLParam(req, "tagID"), 10, 64)
+		if err != nil {
+			http.Error(res, "Bad tag id", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(req.Context(), 1*time.Second)
+		defer cancel()
+		if err = db.DeleteTag(ctx, userID, tagID); err != nil {
+			writeStorageError(res, err)
+			return
+		}
+		res.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// GetFolders возвращает папки пользователя.
+func GetFolders(db storage.TagStorager) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID, ok := requireUserID(res, req)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(req.Context(), 1*time.Second)
+		defer cancel()
+		folders, err := db.GetFolders(ctx, userID)
+		if err != nil {
+			writeStorageError(res, err)
+			return
+		}
+		writeJSON(res, http.StatusOK, folders)
+	}
+}
+
+// CreateFolder создает папку пользователя.
+func CreateFolder(db storage.TagStorager) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID, ok := requireUserID(res, req)
+		if !ok {
+			return
+		}
+
+		var request models.Folder
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			http.Error(res, "Error decoding folder", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(req.Context(), 1*time.Second)
+		defer cancel()
+		folder, err := db.CreateFolder(ctx, userID, request)
+		if err != nil {
+			writeStorageError(res, err)
+			return
+		}
+		writeJSON(res, http.StatusCreated, folder)
+	}
+}
+
+// UpdateFolder переименовывает папку пользователя или перемещает ее в другую папку.
+func UpdateFolder(db storage.TagStorager) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID, ok := requireUserID(res, req)
+		if !ok {
+			return
+		}
+
+		folderID, err := strconv.ParseInt(chi.URLParam(req, "folderID"), 10, 64)
+		if err != nil {
+			http.Error(res, "Bad folder id", http.StatusBadRequest)
+			return
+		}
+		var request models.Folder
+		if err = json.NewDecoder(req.Body).Decode(&request); err != nil {
+			http.Error(res, "Error decoding folder", http.StatusBadRequest)
+			return
+		}
+		request.ID = folderID
+
+		ctx, cancel := context.WithTimeout(req.Context(), 1*time.Second)
+		defer cancel()
+		if err = db.UpdateFolder(ctx, userID, request); err != nil {
+			writeStorageError(res, err)
+			return
+		}
+		writeJSON(res, http.StatusOK, request)
+	}
+}
+
+// DeleteFolder удаляет папку пользователя вместе с вложенными папками.
+func DeleteFolder(db storage.TagStorager) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID, ok := requireUserID(res, req)
+		if !ok {
+			return
+		}
+
+		folderID, err := strconv.ParseInt(chi.URLParam(req, "folderID"), 10, 64)
+		if err != nil {
+			http.Error(res, "Bad folder id", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(req.Context(), 1*time.Second)
+		defer cancel()
+		if err = db.DeleteFolder(ctx, userID, folderID); err != nil {
+			writeStorageError(res, err)
+			return
+		}
+		res.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// SetURLTags заменяет теги сокращенного URL пользователя.
+func SetURLTags(db storage.TagStorager) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID, ok := requireUserID(res, req)
+		if !ok {
+			return
+		}
+
+		var tags []string
+		if err := json.NewDecoder(req.Body).Decode(&tags); err != nil {
+			http.Error(res, "Error decoding tags", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(req.Context(), 1*time.Second)
+		defer cancel()
+		if err := db.SetURLTags(ctx, userID, chi.URLParam(req, "shortenURL"), tags); err != nil {
+			writeStorageError(res, err)
+			return
+		}
+		res.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// MoveURL перемещает сокращенный URL пользователя в папку.
+func MoveURL(db storage.TagStorager) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID, ok := requireUserID(res, req)
+		if !ok {
+			return
+		}
+
+		var request models.APIURLFolderRequest
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			http.Error(res, "Error decoding folder", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(req.Context(), 1*time.Second)
+		defer cancel()
+		if err := db.MoveURL(ctx, userID, chi.URLParam(req, "shortenURL"), request.FolderID); err != nil {
+			writeStorageError(res, err)
+			return
+		}
+		res.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// requireUserID извлекает userID пользователя запроса.
+// Если пользователь не определен, отвечает 401 и возвращает false.
+func requireUserID(res http.ResponseWriter, req *http.Request) (string, bool) {
+	user, ok := auth.FromContext(req.Context())
+	if !ok || user.ID == "" {
+		http.Error(res, "No cookie presented", http.StatusUnauthorized)
+		return "", false
+	}
+	return user.ID, true
+}
+
+// writeStorageError переводит ошибку хранилища в HTTP-ответ.
+func writeStorageError(res http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(res, "Not found", http.StatusNotFound)
+	case errors.Is(err, storage.ErrAlreadyExists):
+		http.Error(res, "Already exists", http.StatusConflict)
+	case errors.Is(err, storage.ErrBadName):
+		http.Error(res, "Bad name", http.StatusBadRequest)
+	case errors.Is(err, storage.ErrFolderCycle):
+		http.Error(res, "Folder cannot be moved into itself", http.StatusBadRequest)
+	case errors.Is(err, storage.ErrQuotaExceeded):
+		http.Error(res, err.Error(), http.StatusTooManyRequests)
+	case errors.Is(err, storage.ErrBadQuota):
+		http.Error(res, "Bad quota", http.StatusBadRequest)
+	default:
+		middlewares.Log.Error("storage error", zap.Error(err))
+		http.Error(res, "Internal DB Error", http.StatusInternalServerError)
+	}
+}
+
+// writeJSON кодирует ответ в JSON с переданным статусом.
+func writeJSON(res http.ResponseWriter, status int, response any) {
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	if err := json.NewEncoder(res).Encode(response); err != nil {
+		middlewares.Log.Error("error encoding response", zap.Error(err))
+	}
+}
@@ -0,0 +1,63 @@
+package http
+
+import (
+	"html/template"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/vancho-go/url-shortener/internal/app/handlers/http/middlewares"
+	"github.com/vancho-go/url-shortener/internal/app/screening"
+)
+
+// warningPage - страница с предупреждением, которая возвращается вместо перехода на заблокированный URL.
+// Оригинальный URL, если он известен, показывается текстом, а не ссылкой, чтобы на него нельзя было
+// перейти по ошибке.
+var warningPage = template.Must(template.New("warning").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Warning: unsafe link</title>
+</head>
+<body>
+<h1>This link has been blocked</h1>
+<p>{{.Message}}</p>
+{{if .URL}}<p>Destination: <code>{{.URL}}</code></p>{{end}}
+{{if .Reason}}<p>Reason: {{.Reason}}</p>{{end}}
+</body>
+</html>
+`))
+
+// warning - содержимое страницы с предупреждением.
+type warning struct {
+	Message string
+	URL     string
+	Reason  string
+}
+
+// writeWarningPage отвечает страницей с предупреждением об URL, заблокированном проверкой (см. screening).
+func writeWarningPage(res http.ResponseWriter, originalURL string, verdict screening.Verdict) {
+	renderWarningPage(res, http.StatusForbidden, warning{
+		Message: "The destination of this short link was flagged as potentially harmful (phishing, malware or other abuse), so you were not redirected.",
+		URL:     originalURL,
+		Reason:  verdict.Reason,
+	})
+}
+
+// writeAbusePage отвечает страницей с предупреждением об URL, заблокированном по жалобам (451).
+func writeAbusePage(res http.ResponseWriter) {
+	renderWarningPage(res, http.StatusUnavailableForLegalReasons, warning{
+		Message: "This short link was disabled after reports of abuse, so you were not redirected.",
+	})
+}
+
+// renderWarningPage отвечает страницей с предупреждением и статусом status.
+func renderWarningPage(res http.ResponseWriter, status int, page warning) {
+	res.Header().Set("Content-Type", "text/html; charset=utf-8")
+	res.Header().Set("Cache-Control", "no-store")
+	res.WriteHeader(status)
+	if err := warningPage.Execute(res, page); err != nil {
+		middlewares.Log.Error("error writing warning page", zap.Error(err))
+	}
+}
@@ -1,9 +1,13 @@
 // Модуль models содержит в себе типовые структуры Request и Response для различных handler'ов.
 package models
 
+import "time"
+
 // APIShortenRequest содержит поля, необходимые для запроса на эндпоинт, который генерирует один сокращенный URL.
 type APIShortenRequest struct {
-	URL string `json:"url"`
+	URL      string   `json:"url"`
+	Tags     []string `json:"tags,omitempty"`
+	FolderID *int64   `json:"folder_id,omitempty"`
 }
 
 // APIShortenResponse содержит сокращенный URL.
@@ -14,21 +18,78 @@ type APIShortenResponse struct {
 // APIShortenRequest содержит поля, необходимые для запроса на эндпоинт,
 // который генерирует сразу несколько сокращенных URL (batch).
 type APIBatchRequest struct {
-	CorrelationID string `json:"correlation_id"`
-	OriginalURL   string `json:"original_url"`
-	ShortenURL    string `json:"shorten_url"`
+	CorrelationID string     `json:"correlation_id"`
+	OriginalURL   string     `json:"original_url"`
+	ShortenURL    string     `json:"shorten_url"`
+	Tags          []string   `json:"tags,omitempty"`
+	FolderID      *int64     `json:"folder_id,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
 }
 
 // APIBatchResponse содержит batch из сокращенный URL.
+// Если URL не сохранен (например, из-за квоты), вместо ShortenURL заполняется Error.
 type APIBatchResponse struct {
 	CorrelationID string `json:"correlation_id"`
-	ShortenURL    string `json:"short_url"`
+	ShortenURL    string `json:"short_url,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// APIStreamResponse содержит результат сокращения одного URL при потоковом batch-сокращении.
+// Заполняется либо ShortenURL, либо Error.
+type APIStreamResponse struct {
+	CorrelationID string `json:"correlation_id"`
+	ShortenURL    string `json:"short_url,omitempty"`
+	Error         string `json:"error,omitempty"`
 }
 
 // APIUserURLResponse содержит соотношения "оригинальный URL - сокращенный URL" для конкретного пользователя.
 type APIUserURLResponse struct {
-	ShortenURL  string `json:"short_url"`
-	OriginalURL string `json:"original_url"`
+	ShortenURL  string     `json:"short_url"`
+	OriginalURL string     `json:"original_url"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Deleted     bool       `json:"is_deleted"`
+	Tags        []string   `json:"tags,omitempty"`
+	FolderID    *int64     `json:"folder_id,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	// Disabled - URL заблокирован администратором.
+	Disabled bool `json:"is_disabled,omitempty"`
+	// UserID - владелец URL, заполняется только в выдаче URL всех пользователей.
+	UserID string `json:"user_id,omitempty"`
+}
+
+// MaxUserURLsPageSize - максимальный размер страницы при постраничной выдаче URL пользователя.
+const MaxUserURLsPageSize = 1000
+
+// DefaultUserURLsPageSize - размер страницы, если клиент не передал limit.
+const DefaultUserURLsPageSize = 100
+
+// UserURLsFilter содержит параметры постраничной выдачи, сортировки и фильтрации URL пользователя.
+type UserURLsFilter struct {
+	// Limit - максимальное количество URL на странице (0 - без ограничения). Обработчики запросов
+	// всегда ограничивают страницу: DefaultUserURLsPageSize, если клиент не передал limit.
+	Limit int
+	// Cursor - курсор, полученный вместе с предыдущей страницей.
+	Cursor string
+	// Desc - сортировка по времени создания по убыванию.
+	Desc bool
+	// Domain - домен оригинального URL.
+	Domain string
+	// Search - подстрока для поиска по оригинальному и сокращенному URL.
+	Search string
+	// Deleted - фильтр по признаку удаления (nil - без фильтра).
+	Deleted *bool
+	// Tag - имя тега, которым помечен URL.
+	Tag string
+	// FolderID - папка, в которой лежит URL.
+	FolderID *int64
+}
+
+// UserURLsPage содержит страницу URL пользователя.
+type UserURLsPage struct {
+	// URLs - URL пользователя на текущей странице.
+	URLs []APIUserURLResponse
+	// NextCursor - курсор следующей страницы (пустой, если страница последняя).
+	NextCursor string
 }
 
 // DeleteURLRequest содержит поля, необходимые для запроса на эндпоинт,
@@ -43,3 +104,142 @@ type APIStatsResponse struct {
 	URLs  int `json:"urls"`
 	Users int `json:"users"`
 }
+
+// APIUserStatsResponse содержит статистику URL одного пользователя.
+type APIUserStatsResponse struct {
+	UserID   string `json:"user_id"`
+	URLs     int    `json:"urls"`
+	Deleted  int    `json:"deleted"`
+	Disabled int    `json:"disabled"`
+}
+
+// Quota - квоты пользователя на сокращение URL: Daily URL за сутки (UTC) и Total действующих URL.
+// Нулевое значение - без ограничений.
+type Quota struct {
+	Daily int64 `json:"daily"`
+	Total int64 `json:"total"`
+}
+
+// APIQuotaResponse содержит квоты пользователя и их текущее использование.
+type APIQuotaResponse struct {
+	Limits Quota `json:"limits"`
+	Used   Quota `json:"used"`
+	// Custom - квоты заданы пользователю администратором, а не взяты по умолчанию.
+	Custom bool `json:"custom"`
+	// ResetAt - момент обнуления суточной квоты.
+	ResetAt time.Time `json:"reset_at"`
+}
+
+// DisabledReasonAbuse - причина блокировки URL по жалобам на злоупотребления.
+const DisabledReasonAbuse = "abuse"
+
+// APIDisableURLRequest содержит признак блокировки URL и ее причину:
+// пустую (блокировка администратором) или DisabledReasonAbuse.
+type APIDisableURLRequest struct {
+	Disabled bool   `json:"disabled"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// APIAbuseReportRequest содержит жалобу на сокращенный URL.
+type APIAbuseReportRequest struct {
+	Reason string `json:"reason"`
+}
+
+// AbuseReport - жалоба на сокращенный URL.
+// Reporter - автор жалобы: "user:<id>" для зарегистрированных пользователей или "ip:<сеть>".
+// Network - сеть, из которой отправлена жалоба: IPv4 адрес или IPv6 подсеть /64.
+type AbuseReport struct {
+	ID         int64     `json:"id"`
+	ShortenURL string    `json:"short_url"`
+	Reporter   string    `json:"reporter"`
+	Network    string    `json:"network"`
+	Reason     string    `json:"reason"`
+	Resolved   bool      `json:"resolved"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// AbuseReportsFilter - параметры выборки жалоб: по умолчанию нерассмотренные жалобы на все URL.
+type AbuseReportsFilter struct {
+	ShortenURL string
+	Resolved   bool
+	Limit      int
+}
+
+// Tag - пользовательский тег для группировки URL.
+type Tag struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// Folder - пользовательская папка для URL. Папки образуют дерево через ParentID.
+type Folder struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	ParentID *int64 `json:"parent_id,omitempty"`
+}
+
+// APIURLFolderRequest содержит папку, в которую нужно переместить URL (null - убрать из папки).
+type APIURLFolderRequest struct {
+	FolderID *int64 `json:"folder_id"`
+}
+
+// APIKey - долгоживущий ключ доступа пользователя к API.
+type APIKey struct {
+	ID int64 `json:"id"`
+	// UserID - владелец ключа, клиенту не отдается.
+	UserID string `json:"-"`
+	Name   string `json:"name"`
+	// Prefix - начало ключа, по которому пользователь может его узнать.
+	Prefix    string    `json:"prefix"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+	// Key - сам ключ, возвращается только при создании. В хранилище сохраняется его хеш.
+	Key string `json:"key,omitempty"`
+}
+
+// APIKeyRequest содержит имя и права создаваемого API ключа.
+type APIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// Account - учетная запись пользователя. ID совпадает с UserID, которым помечаются URL пользователя.
+type Account struct {
+	ID        string    `json:"user_id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	// Roles - роли учетной записи сверх обычного пользователя.
+	Roles []string `json:"roles,omitempty"`
+}
+
+// APICredentialsRequest содержит данные для регистрации или входа в учетную запись.
+type APICredentialsRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	// Merge - перенести в учетную запись URL текущего анонимного пользователя.
+	Merge bool `json:"merge"`
+}
+
+// APIAccountResponse содержит учетную запись, в которую выполнен вход.
+type APIAccountResponse struct {
+	Account
+	// Merged - количество URL, перенесенных от анонимного пользователя.
+	Merged int64 `json:"merged"`
+}
+
+// RefreshToken - токен обновления сессии. В хранилище сохраняется его хеш.
+// Токены одной сессии образуют семейство: при каждом обновлении токен помечается
+// использованным и заменяется новым токеном того же семейства.
+type RefreshToken struct {
+	// FamilyID - идентификатор сессии, общий для всех токенов семейства.
+	FamilyID string `json:"family_id"`
+	// UserID и Registered - пользователь, для которого выпускаются токены доступа.
+	UserID     string    `json:"user_id"`
+	Registered bool      `json:"registered"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// Roles - роли пользователя на момент обмена токена. Не сохраняются: определяются
+	// по текущим назначениям при каждом обмене.
+	Roles []string `json:"-"`
+	// Rotated - токен уже обменян на новый и больше не действует.
+	Rotated bool `json:"rotated"`
+}
@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// DefaultCleanupInterval - период удаления неактивных корзин из MemoryStore по умолчанию.
+const DefaultCleanupInterval = time.Minute
+
+// bucket - корзина токенов.
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// full - момент, когда корзина снова заполнится и ее можно удалить.
+	full time.Time
+}
+
+// MemoryStore хранит корзины в памяти процесса.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// NewMemoryStore конструктор MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket)}
+}
+
+// Take забирает токен из корзины key.
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = b
+	}
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed*limit.Rate)
+		b.updated = now
+	}
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second)), nil
+	}
+	b.tokens--
+	b.full = now.Add(time.Duration((float64(limit.Burst) - b.tokens) / limit.Rate * float64(time.Second)))
+	return 0, nil
+}
+
+// Cleanup удаляет корзины, которые к моменту now заполнились: они неотличимы от новых.
+func (s *MemoryStore) Cleanup(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, b := range s.buckets {
+		if !now.Before(b.full) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// Run периодически удаляет неактивные корзины, пока не будет отменен ctx.
+func (s *MemoryStore) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultCleanupInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.Cleanup(now)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+// Модуль ratelimit ограничивает частоту запросов клиентов по алгоритму token bucket.
+// У каждого клиента (API ключа, пользователя или IP адреса) свои корзины для каждого класса запросов:
+// сокращения URL, переходов, чтения и аутентификации. Состояние корзин хранится в Store: по умолчанию в памяти
+// (MemoryStore), для нескольких экземпляров сервиса можно подключить общее хранилище.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vancho-go/url-shortener/internal/app/auth"
+	"github.com/vancho-go/url-shortener/internal/app/config"
+)
+
+// Class - класс запросов со своим лимитом.
+type Class string
+
+const (
+	// ClassCreate - сокращение URL.
+	ClassCreate Class = "create"
+	// ClassRedirect - переход по сокращенному URL.
+	ClassRedirect Class = "redirect"
+	// ClassRead - остальные запросы API.
+	ClassRead Class = "read"
+	// ClassAuth - вход, регистрация и обновление сессии. Ограничивается только по IP адресу (см. KeyOf):
+	// до входа клиент не аутентифицирован, а подбор паролей не должен обходиться сменой учетных данных.
+	ClassAuth Class = "auth"
+)
+
+// ClassDefault - ключ таблицы Classes для методов, которых нет в таблице.
+const ClassDefault = "*"
+
+// Classes - классы запросов методов. Ключ - метод HTTP и шаблон пути chi ("POST /api/shorten")
+// или полное имя метода gRPC.
+type Classes map[string]Class
+
+// Of возвращает класс метода. Если метода и ClassDefault нет в таблице, метод не ограничивается.
+func (c Classes) Of(method string) (Class, bool) {
+	class, ok := c[method]
+	if !ok {
+		class, ok = c[ClassDefault]
+	}
+	return class, ok
+}
+
+// Limit - параметры корзины: Rate токенов в секунду и не более Burst токенов в запасе.
+// Нулевой Limit не ограничивает запросы.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Unlimited проверяет, что лимит не задан.
+func (l Limit) Unlimited() bool {
+	return l.Rate <= 0 || l.Burst <= 0
+}
+
+// ParseLimit разбирает лимит вида "100/m" (100 запросов в минуту) или "10/s:50" (10 запросов в секунду,
+// до 50 подряд). Период - s, m, h или длительность ("10s"). По умолчанию запас равен числу запросов за период.
+// Пустая строка и "0" - без ограничений.
+func ParseLimit(spec string) (Limit, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "0" {
+		return Limit{}, nil
+	}
+	spec, burstSpec, hasBurst := strings.Cut(spec, ":")
+	countSpec, periodSpec, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("bad rate limit %q, N/period expected", spec)
+	}
+	count, err := strconv.Atoi(countSpec)
+	if err != nil || count < 0 {
+		return Limit{}, fmt.Errorf("bad rate limit count %q", countSpec)
+	}
+
+	var period time.Duration
+	switch periodSpec {
+	case "s":
+		period = time.Second
+	case "m":
+		period = time.Minute
+	case "h":
+		period = time.Hour
+	default:
+		period, err = time.ParseDuration(periodSpec)
+		if err != nil || period <= 0 {
+			return Limit{}, fmt.Errorf("bad rate limit period %q", periodSpec)
+		}
+	}
+
+	burst := count
+	if hasBurst {
+		burst, err = strconv.Atoi(burstSpec)
+		if err != nil || burst < 1 {
+			return Limit{}, fmt.Errorf("bad rate limit burst %q", burstSpec)
+		}
+	}
+	if count == 0 {
+		return Limit{}, nil
+	}
+	return Limit{Rate: float64(count) / period.Seconds(), Burst: burst}, nil
+}
+
+// LimitsFromConfig разбирает лимиты классов запросов из конфигурации сервера.
+func LimitsFromConfig(cfg config.ServerConfig) (map[Class]Limit, error) {
+	specs := map[Class]string{
+		ClassCreate:   cfg.RateLimitCreate,
+		ClassRedirect: cfg.RateLimitRedirect,
+		ClassRead:     cfg.RateLimitRead,
+		ClassAuth:     cfg.RateLimitAuth,
+	}
+	limits := make(map[Class]Limit, len(specs))
+	for class, spec := range specs {
+		limit, err := ParseLimit(spec)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", class, err)
+		}
+		limits[class] = limit
+	}
+	return limits, nil
+}
+
+// Store - хранилище корзин.
+type Store interface {
+	// Take забирает токен из корзины key с параметрами limit в момент now.
+	// Возвращает 0, если токен получен, иначе время до появления токена.
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (time.Duration, error)
+}
+
+// Limiter ограничивает частоту запросов по классам. Нулевой (nil) Limiter не ограничивает запросы.
+type Limiter struct {
+	store  Store
+	limits map[Class]Limit
+}
+
+// New конструктор Limiter. Классы, которых нет в limits, не ограничиваются.
+func New(store Store, limits map[Class]Limit) *Limiter {
+	return &Limiter{store: store, limits: limits}
+}
+
+// Allow проверяет, можно ли выполнить запрос класса class клиента key.
+// Если нельзя, возвращает время, через которое стоит повторить запрос.
+// Ошибка хранилища не мешает выполнению запроса.
+func (l *Limiter) Allow(ctx context.Context, class Class, key string) (bool, time.Duration, error) {
+	if l == nil {
+		return true, 0, nil
+	}
+	limit := l.limits[class]
+	if limit.Unlimited() {
+		return true, 0, nil
+	}
+	retryAfter, err := l.store.Take(ctx, string(class)+"|"+key, limit, time.Now())
+	if err != nil {
+		return true, 0, err
+	}
+	return retryAfter <= 0, retryAfter, nil
+}
+
+// Key возвращает ключ клиента: API ключ, пользователь или IP адрес ip.
+// Пользователь, созданный в этом же запросе, ограничивается по IP адресу:
+// иначе клиент без cookie получал бы новую корзину на каждый запрос.
+func Key(user auth.User, ip string) string {
+	switch {
+	case user.APIKeyID != 0:
+		return "key:" + strconv.FormatInt(user.APIKeyID, 10)
+	case user.ID != "" && !user.New:
+		return "user:" + user.ID
+	default:
+		return "ip:" + ip
+	}
+}
+
+// KeyOf возвращает ключ клиента для запроса класса class: для ClassAuth - IP адрес ip, иначе см. Key.
+func KeyOf(class Class, user auth.User, ip string) string {
+	if class == ClassAuth {
+		return "ip:" + ip
+	}
+	return Key(user, ip)
+}
+
+// RetryAfterSeconds округляет время ожидания вверх до целых секунд для заголовка Retry-After.
+func RetryAfterSeconds(retryAfter time.Duration) int {
+	return int(math.Ceil(retryAfter.Seconds()))
+}
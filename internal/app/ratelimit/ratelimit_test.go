@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vancho-go/url-shortener/internal/app/auth"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Limit
+		wantErr bool
+	}{
+		{spec: "", want: Limit{}},
+		{spec: "0", want: Limit{}},
+		{spec: "60/m", want: Limit{Rate: 1, Burst: 60}},
+		{spec: "10/s:50", want: Limit{Rate: 10, Burst: 50}},
+		{spec: "5/10s", want: Limit{Rate: 0.5, Burst: 5}},
+		{spec: "3600/h", want: Limit{Rate: 1, Burst: 3600}},
+		{spec: "60", wantErr: true},
+		{spec: "x/m", wantErr: true},
+		{spec: "1/week", wantErr: true},
+		{spec: "1/s:0", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			limit, err := ParseLimit(tt.spec)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, limit)
+		})
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	limit := Limit{Rate: 1, Burst: 2}
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		retryAfter, err := store.Take(ctx, "a", limit, now)
+		require.NoError(t, err)
+		assert.Zero(t, retryAfter)
+	}
+	retryAfter, err := store.Take(ctx, "a", limit, now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, retryAfter)
+
+	// Корзины клиентов независимы.
+	retryAfter, err = store.Take(ctx, "b", limit, now)
+	require.NoError(t, err)
+	assert.Zero(t, retryAfter)
+
+	// За полсекунды накапливается половина токена.
+	retryAfter, err = store.Take(ctx, "a", limit, now.Add(500*time.Millisecond))
+	require.NoError(t, err)
+	assert.Equal(t, 500*time.Millisecond, retryAfter)
+	retryAfter, err = store.Take(ctx, "a", limit, now.Add(time.Second))
+	require.NoError(t, err)
+	assert.Zero(t, retryAfter)
+
+	// Заполненные корзины удаляются.
+	store.Cleanup(now.Add(500 * time.Millisecond))
+	assert.Len(t, store.buckets, 2)
+	store.Cleanup(now.Add(3 * time.Second))
+	assert.Empty(t, store.buckets)
+}
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	limiter := New(NewMemoryStore(), map[Class]Limit{ClassCreate: {Rate: 1, Burst: 1}})
+
+	allowed, _, err := limiter.Allow(ctx, ClassCreate, "user:1")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	allowed, retryAfter, err := limiter.Allow(ctx, ClassCreate, "user:1")
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.Equal(t, 1, RetryAfterSeconds(retryAfter))
+
+	// Классы без лимита не ограничиваются.
+	for i := 0; i < 3; i++ {
+		allowed, _, err = limiter.Allow(ctx, ClassRead, "user:1")
+		require.NoError(t, err)
+		assert.True(t, allowed)
+	}
+
+	var disabled *Limiter
+	allowed, _, err = disabled.Allow(ctx, ClassCreate, "user:1")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+}
+
+func TestKey(t *testing.T) {
+	assert.Equal(t, "key:7", Key(auth.User{ID: "u", APIKeyID: 7}, "10.0.0.1"))
+	assert.Equal(t, "user:u", Key(auth.User{ID: "u"}, "10.0.0.1"))
+	assert.Equal(t, "ip:10.0.0.1", Key(auth.User{ID: "u", New: true}, "10.0.0.1"))
+	assert.Equal(t, "ip:10.0.0.1", Key(auth.User{}, "10.0.0.1"))
+	assert.Equal(t, "ip:10.0.0.1", KeyOf(ClassAuth, auth.User{ID: "u", APIKeyID: 7}, "10.0.0.1"))
+	assert.Equal(t, "user:u", KeyOf(ClassRead, auth.User{ID: "u"}, "10.0.0.1"))
+}
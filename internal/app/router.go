@@ -0,0 +1,119 @@
+package app
+
+import (
+	"net/netip"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/vancho-go/url-shortener/internal/app/auth"
+	"github.com/vancho-go/url-shortener/internal/app/clientip"
+	"github.com/vancho-go/url-shortener/internal/app/config"
+	http2 "github.com/vancho-go/url-shortener/internal/app/handlers/http"
+	"github.com/vancho-go/url-shortener/internal/app/handlers/http/middlewares"
+	"github.com/vancho-go/url-shortener/internal/app/ratelimit"
+	"github.com/vancho-go/url-shortener/internal/app/screening"
+	"github.com/vancho-go/url-shortener/internal/app/storage"
+	"github.com/vancho-go/url-shortener/internal/app/urlnorm"
+	"github.com/vancho-go/url-shortener/internal/app/utils"
+)
+
+// routerDeps - зависимости HTTP роутера сервиса.
+type routerDeps struct {
+	db             storage.Storager
+	tokens         auth.TokenManager
+	roles          auth.RoleBindings
+	resolver       *clientip.Resolver
+	security       middlewares.SecurityConfig
+	cors           middlewares.CORSConfig
+	urls           *urlnorm.Normalizer
+	screener       *screening.Screener
+	limiter        *ratelimit.Limiter
+	trustedSubnets []netip.Prefix
+	// oidc - провайдер входа через OpenID Connect (nil - вход через OIDC выключен).
+	oidc *auth.OIDCProvider
+}
+
+// newRouter собирает HTTP роутер сервиса без служебных эндпоинтов.
+func newRouter(configuration config.ServerConfig, deps routerDeps) chi.Router {
+	rateLimitMiddleware := middlewares.RateLimitMiddleware(deps.limiter, http2.RateClasses)
+	compressMiddleware := middlewares.GzipMiddleware
+
+	r := chi.NewRouter()
+	r.Use(middlewares.ClientIPMiddleware(deps.resolver))
+	r.Use(middlewares.SecurityHeadersMiddleware(deps.security))
+	r.Use(middlewares.CORSMiddleware(deps.cors))
+	if !configuration.CSRFDisabled {
+		r.Use(middlewares.CSRFMiddleware)
+	}
+
+	r.Get("/ping", middlewares.RequestLogger(http2.CheckDBConnection(deps.db)))
+	r.Get("/.well-known/jwks.json", middlewares.RequestLogger(http2.JWKS(deps.tokens)))
+	r.Group(func(r chi.Router) {
+		// Вход, регистрация и обновление сессии ограничиваются по IP адресу (ratelimit.ClassAuth).
+		r.Use(rateLimitMiddleware)
+		r.Post("/auth/signup", middlewares.RequestLogger(http2.SignUp(deps.db, deps.tokens, deps.roles)))
+		r.Post("/auth/signin", middlewares.RequestLogger(http2.SignIn(deps.db, deps.tokens, deps.roles)))
+		r.Post("/auth/refresh", middlewares.RequestLogger(http2.Refresh(deps.tokens)))
+	})
+	r.Post("/auth/logout", middlewares.RequestLogger(http2.Logout(deps.tokens)))
+	if deps.oidc != nil {
+		r.Get("/auth/login", middlewares.RequestLogger(http2.LoginOIDC(deps.oidc)))
+		r.Get(auth.OIDCCallbackPath, middlewares.RequestLogger(http2.CallbackOIDC(deps.db, deps.tokens, deps.oidc, deps.roles)))
+	}
+
+	r.Group(func(r chi.Router) {
+		r.Use(middlewares.JWTMiddleware(deps.tokens, deps.db))
+		r.Use(rateLimitMiddleware)
+		r.Get("/{shortenURL}", middlewares.RequestLogger(compressMiddleware(http2.DecodeURL(deps.db, deps.screener))))
+		r.Post("/", middlewares.RequestLogger(compressMiddleware(http2.EncodeURL(deps.db, deps.urls, deps.screener, configuration.BaseHost))))
+		r.Post("/report/{shortenURL}", middlewares.RequestLogger(http2.ReportURL(deps.db, configuration.AbuseReportThreshold)))
+	})
+
+	r.Route("/api", func(r chi.Router) {
+		r.Group(func(r chi.Router) {
+			r.Use(middlewares.JWTMiddleware(deps.tokens, deps.db))
+			r.Use(rateLimitMiddleware)
+			r.Post("/shorten", middlewares.RequestLogger(compressMiddleware(http2.EncodeURLJSON(deps.db, deps.urls, deps.screener, configuration.BaseHost))))
+			r.Post("/shorten/batch", middlewares.RequestLogger(compressMiddleware(http2.EncodeBatch(deps.db, deps.urls, deps.screener, configuration.BaseHost))))
+			r.Post("/shorten/stream", middlewares.RequestLogger(compressMiddleware(http2.EncodeStream(deps.db, deps.urls, deps.screener, configuration.BaseHost))))
+			r.Get("/user/urls", middlewares.RequestLogger(http2.GetUserURLs(deps.db, configuration.BaseHost)))
+			r.Get("/user/quota", middlewares.RequestLogger(http2.GetQuota(deps.db)))
+			r.Post("/user/urls/import", middlewares.RequestLogger(http2.ImportURLs(deps.db, deps.urls, deps.screener, configuration.BaseHost)))
+			r.Get("/user/urls/export", middlewares.RequestLogger(http2.ExportURLs(deps.db, configuration.BaseHost)))
+			r.Delete("/user/urls", middlewares.RequestLogger(http2.DeleteURLs(deps.db)))
+			r.Put("/user/urls/{shortenURL}/tags", middlewares.RequestLogger(http2.SetURLTags(deps.db)))
+			r.Put("/user/urls/{shortenURL}/folder", middlewares.RequestLogger(http2.MoveURL(deps.db)))
+			r.Get("/user/tags", middlewares.RequestLogger(http2.GetTags(deps.db)))
+			r.Post("/user/tags", middlewares.RequestLogger(http2.CreateTag(deps.db)))
+			r.Patch("/user/tags/{tagID}", middlewares.RequestLogger(http2.RenameTag(deps.db)))
+			r.Delete("/user/tags/{tagID}", middlewares.RequestLogger(http2.DeleteTag(deps.db)))
+			r.Get("/user/folders", middlewares.RequestLogger(http2.GetFolders(deps.db)))
+			r.Post("/user/folders", middlewares.RequestLogger(http2.CreateFolder(deps.db)))
+			r.Patch("/user/folders/{folderID}", middlewares.RequestLogger(http2.UpdateFolder(deps.db)))
+			r.Delete("/user/folders/{folderID}", middlewares.RequestLogger(http2.DeleteFolder(deps.db)))
+			r.Get("/user/keys", middlewares.RequestLogger(http2.GetAPIKeys(deps.db)))
+			r.Post("/user/keys", middlewares.RequestLogger(http2.CreateAPIKey(deps.db)))
+			r.Delete("/user/keys/{keyID}", middlewares.RequestLogger(http2.RevokeAPIKey(deps.db)))
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(middlewares.JWTMiddleware(deps.tokens, deps.db))
+			r.Use(middlewares.RoleMiddleware(http2.AdminPolicy))
+			r.Use(rateLimitMiddleware)
+			r.Get("/admin/urls", middlewares.RequestLogger(http2.GetAllURLs(deps.db, configuration.BaseHost)))
+			r.Get("/admin/reports", middlewares.RequestLogger(http2.GetAbuseReports(deps.db)))
+			r.Put("/admin/urls/{shortenURL}/disabled", middlewares.RequestLogger(http2.SetURLDisabled(deps.db)))
+			r.Delete("/admin/users/{userID}/urls", middlewares.RequestLogger(http2.DeleteAnyUserURLs(deps.db)))
+			r.Get("/admin/users/{userID}/stats", middlewares.RequestLogger(http2.GetUserStats(deps.db)))
+			r.Get("/admin/users/{userID}/quota", middlewares.RequestLogger(http2.GetAnyUserQuota(deps.db)))
+			r.Put("/admin/users/{userID}/quota", middlewares.RequestLogger(http2.SetUserQuota(deps.db)))
+			r.Delete("/admin/users/{userID}/quota", middlewares.RequestLogger(http2.DeleteUserQuota(deps.db)))
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(utils.TrustedSubnetMiddleware(deps.trustedSubnets))
+			r.Get("/internal/stats", middlewares.RequestLogger(http2.GetStats(deps.db)))
+		})
+
+	})
+
+	return r
+}
@@ -0,0 +1,74 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vancho-go/url-shortener/internal/app/auth"
+	"github.com/vancho-go/url-shortener/internal/app/clientip"
+	"github.com/vancho-go/url-shortener/internal/app/config"
+	"github.com/vancho-go/url-shortener/internal/app/handlers/http/middlewares"
+	"github.com/vancho-go/url-shortener/internal/app/ratelimit"
+	"github.com/vancho-go/url-shortener/internal/app/screening"
+	"github.com/vancho-go/url-shortener/internal/app/storage"
+	"github.com/vancho-go/url-shortener/internal/app/urlnorm"
+)
+
+func TestRouterCSRF(t *testing.T) {
+	tokens, err := auth.New(config.ServerConfig{AuthSecret: "secret"}, nil, nil)
+	require.NoError(t, err)
+	token, err := tokens.Issue(auth.User{ID: auth.GenerateUserID()})
+	require.NoError(t, err)
+	resolver, err := clientip.New(nil, "")
+	require.NoError(t, err)
+	security, err := middlewares.NewSecurityConfig(config.ServerConfig{})
+	require.NoError(t, err)
+	cors, err := middlewares.NewCORSConfig(config.ServerConfig{})
+	require.NoError(t, err)
+
+	newDeps := func() routerDeps {
+		return routerDeps{
+			db:       storage.NewMapDB(),
+			tokens:   tokens,
+			resolver: resolver,
+			security: security,
+			cors:     cors,
+			urls:     urlnorm.New(urlnorm.Options{}),
+			screener: screening.New(nil, 0),
+			limiter:  ratelimit.New(ratelimit.NewMemoryStore(), nil),
+		}
+	}
+
+	tests := []struct {
+		name     string
+		disabled bool
+		header   string
+		want     int
+	}{
+		{name: "no csrf header", want: http.StatusForbidden},
+		{name: "matching csrf header", header: "csrf", want: http.StatusCreated},
+		{name: "csrf disabled", disabled: true, want: http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configuration := config.ServerConfig{BaseHost: "http://localhost:8080", CSRFDisabled: tt.disabled}
+			r := newRouter(configuration, newDeps())
+
+			// Запрос аутентифицирован cookie, как запрос браузера.
+			request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://example.com/page"))
+			request.AddCookie(&http.Cookie{Name: auth.TokenName, Value: token})
+			request.AddCookie(&http.Cookie{Name: middlewares.CSRFCookieName, Value: "csrf"})
+			if tt.header != "" {
+				request.Header.Set(middlewares.CSRFHeaderName, tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, request)
+			assert.Equal(t, tt.want, w.Code, w.Body.String())
+		})
+	}
+}
@@ -5,12 +5,17 @@ import (
 	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
+	"github.com/vancho-go/url-shortener/internal/app/auth"
+	"github.com/vancho-go/url-shortener/internal/app/clientip"
 	"github.com/vancho-go/url-shortener/internal/app/config"
 	grpc2 "github.com/vancho-go/url-shortener/internal/app/handlers/grpc"
 	"github.com/vancho-go/url-shortener/internal/app/handlers/grpc/interceptors"
 	http2 "github.com/vancho-go/url-shortener/internal/app/handlers/http"
 	"github.com/vancho-go/url-shortener/internal/app/handlers/http/middlewares"
+	"github.com/vancho-go/url-shortener/internal/app/ratelimit"
+	"github.com/vancho-go/url-shortener/internal/app/screening"
 	"github.com/vancho-go/url-shortener/internal/app/storage"
+	"github.com/vancho-go/url-shortener/internal/app/urlnorm"
 	"github.com/vancho-go/url-shortener/internal/app/utils"
 	"github.com/vancho-go/url-shortener/pkg/proto"
 	"go.uber.org/zap"
@@ -21,6 +26,7 @@ import (
 	"os"
 	"os/signal"
 	"path"
+	"strings"
 	"syscall"
 )
 
@@ -42,8 +48,102 @@ func Run() error {
 	}
 	defer dbInstance.Close()
 
-	middlewares.Log.Info("Configuring http compress middleware")
-	compressMiddleware := middlewares.GzipMiddleware
+	if configuration.AuthSecret == "" {
+		middlewares.Log.Warn("auth secret is not set, tokens will not survive server restart")
+	}
+	revocations, err := auth.NewRevocationList(context.Background(), dbInstance)
+	if err != nil {
+		return fmt.Errorf("error loading revoked tokens: %w", err)
+	}
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	go revocations.Run(jobsCtx, auth.DefaultRevocationSyncInterval, middlewares.Log)
+
+	roles, err := auth.ParseRoleBindings(configuration.AuthRoles)
+	if err != nil {
+		return err
+	}
+
+	sessions := auth.NewSessions(dbInstance, configuration.AuthRefreshTTL, roles)
+	go sessions.Run(jobsCtx, auth.DefaultSessionCleanupInterval, middlewares.Log)
+
+	tokens, err := auth.New(*configuration, revocations, sessions)
+	if err != nil {
+		return err
+	}
+
+	middlewares.Cookies, err = middlewares.NewCookieConfig(*configuration)
+	if err != nil {
+		return err
+	}
+
+	cors, err := middlewares.NewCORSConfig(*configuration)
+	if err != nil {
+		return err
+	}
+
+	security, err := middlewares.NewSecurityConfig(*configuration)
+	if err != nil {
+		return err
+	}
+
+	urls := urlnorm.New(urlnorm.Options{
+		Schemes:       urlnorm.ParseSchemes(configuration.URLSchemes),
+		SortQuery:     configuration.URLSortQuery,
+		StripTracking: configuration.URLStripTracking,
+	})
+
+	var blocklist *screening.Blocklist
+	if configuration.BlocklistFile != "" {
+		blocklist, err = screening.LoadBlocklist(configuration.BlocklistFile)
+		if err != nil {
+			return fmt.Errorf("error loading blocklist: %w", err)
+		}
+		go blocklist.Run(jobsCtx, configuration.BlocklistReload, middlewares.Log)
+	}
+	// Внешние сервисы репутации URL подключаются через screening.Provider.
+	screener := screening.New(blocklist, configuration.ScreeningCacheTTL)
+
+	rateLimits, err := ratelimit.LimitsFromConfig(*configuration)
+	if err != nil {
+		return err
+	}
+	// Общее хранилище корзин для нескольких экземпляров сервиса подключается через ratelimit.Store.
+	rateStore := ratelimit.NewMemoryStore()
+	go rateStore.Run(jobsCtx, ratelimit.DefaultCleanupInterval)
+	limiter := ratelimit.New(rateStore, rateLimits)
+
+	trustedSubnets, err := clientip.ParsePrefixes(configuration.TrustedSubnet)
+	if err != nil {
+		return fmt.Errorf("error parsing trusted subnets: %w", err)
+	}
+	trustedProxies, err := clientip.ParsePrefixes(configuration.TrustedProxies)
+	if err != nil {
+		return fmt.Errorf("error parsing trusted proxies: %w", err)
+	}
+	resolver, err := clientip.New(trustedProxies, configuration.TrustedProxyHeader)
+	if err != nil {
+		return err
+	}
+
+	internalAccess, err := utils.InternalAccessMiddleware(configuration.DebugAccess, trustedSubnets, tokens, dbInstance)
+	if err != nil {
+		return err
+	}
+	// Служебные эндпоинты: профилирование, а также будущие метрики и административные обработчики.
+	internalRoutes := func(r chi.Router) {
+		r.Use(internalAccess)
+		r.Mount("/debug", http2.PprofHandler())
+	}
+	debugEnabled := !utils.InternalAccessDisabled(configuration.DebugAccess)
+
+	var oidcProvider *auth.OIDCProvider
+	if configuration.OIDCIssuer != "" {
+		oidcProvider, err = auth.NewOIDCProvider(context.Background(), *configuration)
+		if err != nil {
+			return err
+		}
+	}
 
 	// Канал для передачи потенциальной ошибки от серверов
 	errChan := make(chan error, 1)
@@ -56,32 +156,36 @@ func Run() error {
 	// регистрируем перенаправление прерываний
 	signal.Notify(sigint, os.Interrupt, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
 
-	r := chi.NewRouter()
-
-	r.Get("/ping", middlewares.RequestLogger(http2.CheckDBConnection(dbInstance)))
-
-	r.Group(func(r chi.Router) {
-		r.Use(middlewares.JWTMiddleware)
-		r.Get("/{shortenURL}", middlewares.RequestLogger(compressMiddleware(http2.DecodeURL(dbInstance))))
-		r.Post("/", middlewares.RequestLogger(compressMiddleware(http2.EncodeURL(dbInstance, configuration.BaseHost))))
+	r := newRouter(*configuration, routerDeps{
+		db:             dbInstance,
+		tokens:         tokens,
+		roles:          roles,
+		resolver:       resolver,
+		security:       security,
+		cors:           cors,
+		urls:           urls,
+		screener:       screener,
+		limiter:        limiter,
+		trustedSubnets: trustedSubnets,
+		oidc:           oidcProvider,
 	})
 
-	r.Route("/api", func(r chi.Router) {
-		r.Group(func(r chi.Router) {
-			r.Use(middlewares.JWTMiddleware)
-			r.Post("/shorten", middlewares.RequestLogger(compressMiddleware(http2.EncodeURLJSON(dbInstance, configuration.BaseHost))))
-			r.Post("/shorten/batch", middlewares.RequestLogger(compressMiddleware(http2.EncodeBatch(dbInstance, configuration.BaseHost))))
-			r.Get("/user/urls", middlewares.RequestLogger(http2.GetUserURLs(dbInstance, configuration.BaseHost)))
-			r.Delete("/user/urls", middlewares.RequestLogger(http2.DeleteURLs(dbInstance)))
-		})
-		r.Group(func(r chi.Router) {
-			r.Use(utils.TrustedSubnetMiddleware(configuration.TrustedSubnet))
-			r.Get("/internal/stats", middlewares.RequestLogger(http2.GetStats(dbInstance)))
-		})
+	var debugSrv *http.Server
+	if debugEnabled && configuration.DebugAddress == "" {
+		r.Group(internalRoutes)
+	}
 
+	// Первые сегменты путей сервиса нельзя занять пользовательскими сокращенными URL.
+	err = chi.Walk(r, func(_, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		segment, _, _ := strings.Cut(strings.TrimPrefix(route, "/"), "/")
+		if segment != "" && !strings.HasPrefix(segment, "{") && segment != "*" {
+			storage.ReserveAliases(segment)
+		}
+		return nil
 	})
-
-	r.Mount("/debug", http2.PprofHandler())
+	if err != nil {
+		return err
+	}
 
 	httpSrv := &http.Server{
 		Addr:    configuration.ServerHost,
@@ -107,19 +211,58 @@ func Run() error {
 		}()
 	}
 
+	var redirectSrv *http.Server
+	if configuration.EnableHTTPS && configuration.HTTPRedirectAddress != "" {
+		redirectSrv = &http.Server{
+			Addr:    configuration.HTTPRedirectAddress,
+			Handler: http2.RedirectToHTTPS(configuration.ServerHost),
+		}
+		middlewares.Log.Info("Starting http to https redirect server", zap.String("address", configuration.HTTPRedirectAddress))
+		go func() {
+			if err := redirectSrv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				errChan <- errors.New("error starting http redirect server")
+			}
+		}()
+	}
+
+	if debugEnabled && configuration.DebugAddress != "" {
+		debugRouter := chi.NewRouter()
+		debugRouter.Use(middlewares.ClientIPMiddleware(resolver))
+		debugRouter.Use(middlewares.SecurityHeadersMiddleware(security))
+		debugRouter.Group(internalRoutes)
+		debugSrv = &http.Server{
+			Addr:    configuration.DebugAddress,
+			Handler: debugRouter,
+		}
+		middlewares.Log.Info("Starting debug server", zap.String("address", configuration.DebugAddress))
+		go func() {
+			if err := debugSrv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				errChan <- errors.New("error starting debug server")
+			}
+		}()
+	}
+
 	// определяем порт для grpc сервера
 	listen, err := net.Listen("tcp", ":3200")
 	if err != nil {
 		return fmt.Errorf("error listening grpc port %v", err)
 	}
 
-	// создаём gRPC-сервер без зарегистрированной службы
+	// создаём gRPC-сервер без зарегистрированной службы. Логгер стоит сразу за определением IP клиента,
+	// чтобы в лог попадали и вызовы, отклоненные авторизацией или ограничением частоты запросов.
 	grpcSrv := grpc.NewServer(
-		grpc.ChainUnaryInterceptor(interceptors.JWTInterceptor),
-		grpc.ChainUnaryInterceptor(interceptors.UnaryServerInterceptor),
+		grpc.ChainUnaryInterceptor(interceptors.ClientIPInterceptor(resolver), interceptors.UnaryServerInterceptor,
+			interceptors.JWTInterceptor(tokens, dbInstance), interceptors.RoleInterceptor(interceptors.MethodRoles),
+			interceptors.TrustedSubnetInterceptor(trustedSubnets, interceptors.MethodSubnets),
+			interceptors.RateLimitInterceptor(limiter, interceptors.MethodRateClasses)),
+		grpc.ChainStreamInterceptor(interceptors.ClientIPStreamInterceptor(resolver), interceptors.StreamServerInterceptor,
+			interceptors.JWTStreamInterceptor(tokens, dbInstance), interceptors.RoleStreamInterceptor(interceptors.MethodRoles),
+			interceptors.TrustedSubnetStreamInterceptor(trustedSubnets, interceptors.MethodSubnets),
+			interceptors.RateLimitStreamInterceptor(limiter, interceptors.MethodRateClasses)),
 	)
 	// регистрируем сервис
-	proto.RegisterURLShortenerServer(grpcSrv, grpc2.New(dbInstance, configuration.BaseHost))
+	proto.RegisterURLShortenerServer(grpcSrv, grpc2.New(dbInstance, tokens, configuration.BaseHost,
+		configuration.GRPCBatchSize, configuration.GRPCBatchInterval, urls, screener))
 
 	middlewares.Log.Info("Starting grpc server")
 	// получаем запрос gRPC
@@ -144,6 +287,16 @@ func Run() error {
 			log.Printf("HTTP server Shutdown: %v", err)
 		}
 		fmt.Println("HTTP Server Shutdown gracefully")
+		if redirectSrv != nil {
+			if err = redirectSrv.Shutdown(context.Background()); err != nil {
+				log.Printf("HTTP redirect server Shutdown: %v", err)
+			}
+		}
+		if debugSrv != nil {
+			if err = debugSrv.Shutdown(context.Background()); err != nil {
+				log.Printf("Debug server Shutdown: %v", err)
+			}
+		}
 		grpcSrv.GracefulStop()
 		fmt.Println("gRPC Server Shutdown gracefully")
 	}
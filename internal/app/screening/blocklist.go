@@ -0,0 +1,158 @@
+package screening
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/net/idna"
+)
+
+// BlocklistSource - значение Verdict.Source для вердиктов списка блокировки.
+const BlocklistSource = "blocklist"
+
+// DefaultBlocklistReloadInterval - период проверки изменений файла списка блокировки по умолчанию.
+const DefaultBlocklistReloadInterval = time.Minute
+
+// regexPrefix - префикс строки файла списка блокировки с регулярным выражением.
+const regexPrefix = "regex:"
+
+// Blocklist - локальный список блокировки из файла.
+// Каждая непустая строка файла - домен (блокируется вместе с поддоменами) или регулярное выражение
+// с префиксом "regex:", которое проверяется на всем URL. Строки, начинающиеся с "#", игнорируются.
+// Файл перечитывается при изменении (см. Run), при ошибке разбора остается прежний список.
+// Нулевой (nil) Blocklist ничего не блокирует.
+type Blocklist struct {
+	path string
+
+	mu       sync.RWMutex
+	domains  map[string]struct{}
+	patterns []*regexp.Regexp
+	modTime  time.Time
+	size     int64
+}
+
+// LoadBlocklist загружает список блокировки из файла path.
+func LoadBlocklist(path string) (*Blocklist, error) {
+	b := &Blocklist{path: path}
+	if _, err := b.Reload(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Reload перечитывает файл, если он изменился с момента последней загрузки.
+// Возвращает true, если список обновлен.
+func (b *Blocklist) Reload() (bool, error) {
+	info, err := os.Stat(b.path)
+	if err != nil {
+		return false, err
+	}
+	b.mu.RLock()
+	unchanged := info.ModTime().Equal(b.modTime) && info.Size() == b.size
+	b.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	domains, patterns, err := parseBlocklist(b.path)
+	if err != nil {
+		return false, err
+	}
+	b.mu.Lock()
+	b.domains, b.patterns = domains, patterns
+	b.modTime, b.size = info.ModTime(), info.Size()
+	b.mu.Unlock()
+	return true, nil
+}
+
+// Run периодически перечитывает измененный файл списка блокировки, пока не будет отменен ctx.
+// Ошибки пишутся в log и не останавливают цикл.
+func (b *Blocklist) Run(ctx context.Context, interval time.Duration, log *zap.Logger) {
+	if interval <= 0 {
+		interval = DefaultBlocklistReloadInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := b.Reload()
+			if err != nil {
+				log.Error("error reloading blocklist", zap.String("path", b.path), zap.Error(err))
+			} else if reloaded {
+				log.Info("blocklist reloaded", zap.String("path", b.path))
+			}
+		}
+	}
+}
+
+// Match проверяет URL по списку блокировки.
+func (b *Blocklist) Match(rawURL string) Verdict {
+	if b == nil {
+		return Verdict{}
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if u, err := url.Parse(rawURL); err == nil {
+		host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+		for host != "" {
+			if _, ok := b.domains[host]; ok {
+				return Verdict{Blocked: true, Reason: fmt.Sprintf("domain %s is blocklisted", host), Source: BlocklistSource}
+			}
+			_, host, _ = strings.Cut(host, ".")
+		}
+	}
+	for _, pattern := range b.patterns {
+		if pattern.MatchString(rawURL) {
+			return Verdict{Blocked: true, Reason: "URL matches blocklist pattern " + pattern.String(), Source: BlocklistSource}
+		}
+	}
+	return Verdict{}
+}
+
+// parseBlocklist разбирает файл списка блокировки.
+func parseBlocklist(path string) (map[string]struct{}, []*regexp.Regexp, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	domains := make(map[string]struct{})
+	var patterns []*regexp.Regexp
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		switch {
+		case entry == "" || strings.HasPrefix(entry, "#"):
+		case strings.HasPrefix(entry, regexPrefix):
+			pattern, err := regexp.Compile(strings.TrimSpace(strings.TrimPrefix(entry, regexPrefix)))
+			if err != nil {
+				return nil, nil, fmt.Errorf("blocklist %s, line %d: %w", path, line, err)
+			}
+			patterns = append(patterns, pattern)
+		default:
+			// URL хранятся с хостом в punycode (см. urlnorm), поэтому IDN домены тоже переводятся в punycode.
+			domain := strings.TrimSuffix(strings.ToLower(entry), ".")
+			if ascii, err := idna.Lookup.ToASCII(domain); err == nil {
+				domain = ascii
+			}
+			domains[domain] = struct{}{}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return domains, patterns, nil
+}
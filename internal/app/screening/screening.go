@@ -0,0 +1,150 @@
+// Модуль screening проверяет оригинальные URL на вредоносность (фишинг, malware и т.п.).
+// URL проверяются локальным списком блокировки (Blocklist) и внешними сервисами репутации (Provider)
+// при сокращении и повторно при переходе по сокращенному URL.
+package screening
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultCacheTTL - время, на которое по умолчанию запоминаются вердикты внешних сервисов при переходах.
+const DefaultCacheTTL = 10 * time.Minute
+
+// DefaultFailureTTL - время, на которое при переходах запоминается ошибка внешних сервисов.
+// Пока ошибка запомнена, URL пропускаются без обращения к сервисам.
+const DefaultFailureTTL = 30 * time.Second
+
+// checkTimeout - время на опрос внешних сервисов при переходе.
+const checkTimeout = time.Second
+
+// maxCacheSize - максимальное число вердиктов в кэше, при переполнении кэш очищается.
+const maxCacheSize = 10000
+
+// ErrBlocked - тип ошибки, сигнализирующий, что оригинальный URL заблокирован.
+var ErrBlocked = errors.New("URL is blocked")
+
+// Verdict - результат проверки URL.
+type Verdict struct {
+	// Blocked - URL признан вредоносным.
+	Blocked bool
+	// Reason - причина блокировки.
+	Reason string
+	// Source - источник вердикта (список блокировки или внешний сервис).
+	Source string
+}
+
+// Err возвращает ошибку ErrBlocked с причиной блокировки или nil, если URL не заблокирован.
+func (v Verdict) Err() error {
+	if !v.Blocked {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrBlocked, v.Reason)
+}
+
+// Provider - источник вердиктов, например внешний сервис репутации URL.
+type Provider interface {
+	// Name возвращает имя источника для Verdict.Source.
+	Name() string
+	// Check проверяет URL.
+	Check(ctx context.Context, url string) (Verdict, error)
+}
+
+// cachedVerdict - вердикт внешних сервисов в кэше.
+type cachedVerdict struct {
+	verdict   Verdict
+	expiresAt time.Time
+}
+
+// Screener проверяет URL списком блокировки и внешними сервисами.
+// Список блокировки проверяется всегда, а вердикты внешних сервисов при переходах кэшируются.
+// Нулевой (nil) Screener пропускает любые URL.
+type Screener struct {
+	blocklist *Blocklist
+	providers []Provider
+	ttl       time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedVerdict
+}
+
+// New конструктор Screener. blocklist может быть nil. Если ttl <= 0, используется DefaultCacheTTL.
+func New(blocklist *Blocklist, ttl time.Duration, providers ...Provider) *Screener {
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	return &Screener{blocklist: blocklist, providers: providers, ttl: ttl, cache: make(map[string]cachedVerdict)}
+}
+
+// Screen проверяет URL при сокращении, внешние сервисы опрашиваются без кэша.
+// Ошибка внешнего сервиса не блокирует URL: вердикт остальных источников возвращается вместе с ошибкой.
+func (s *Screener) Screen(ctx context.Context, url string) (Verdict, error) {
+	if s == nil {
+		return Verdict{}, nil
+	}
+	if verdict := s.blocklist.Match(url); verdict.Blocked {
+		return verdict, nil
+	}
+	return s.checkProviders(ctx, url)
+}
+
+// Check проверяет URL при переходе. На опрос внешних сервисов отводится checkTimeout, чтобы
+// недоступный сервис не задерживал переход. Вердикты внешних сервисов запоминаются на время ttl.
+// При ошибке URL пропускается, а ошибка возвращается и запоминается на время DefaultFailureTTL
+// (но не дольше ttl): до его истечения сервисы по этому URL не опрашиваются.
+func (s *Screener) Check(ctx context.Context, url string) (Verdict, error) {
+	if s == nil {
+		return Verdict{}, nil
+	}
+	if verdict := s.blocklist.Match(url); verdict.Blocked {
+		return verdict, nil
+	}
+	if len(s.providers) == 0 {
+		return Verdict{}, nil
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	cached, ok := s.cache[url]
+	s.mu.Unlock()
+	if ok && now.Before(cached.expiresAt) {
+		return cached.verdict, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	verdict, err := s.checkProviders(ctx, url)
+	ttl := s.ttl
+	if err != nil {
+		ttl = min(ttl, DefaultFailureTTL)
+	}
+	s.mu.Lock()
+	if len(s.cache) >= maxCacheSize {
+		s.cache = make(map[string]cachedVerdict)
+	}
+	s.cache[url] = cachedVerdict{verdict: verdict, expiresAt: now.Add(ttl)}
+	s.mu.Unlock()
+	return verdict, err
+}
+
+// checkProviders опрашивает внешние сервисы по порядку до первого блокирующего вердикта.
+func (s *Screener) checkProviders(ctx context.Context, url string) (Verdict, error) {
+	var errs []error
+	for _, provider := range s.providers {
+		verdict, err := provider.Check(ctx, url)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", provider.Name(), err))
+			continue
+		}
+		if verdict.Blocked {
+			if verdict.Source == "" {
+				verdict.Source = provider.Name()
+			}
+			return verdict, nil
+		}
+	}
+	return Verdict{}, errors.Join(errs...)
+}
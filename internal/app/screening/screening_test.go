@@ -0,0 +1,107 @@
+package screening_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vancho-go/url-shortener/internal/app/screening"
+	"github.com/vancho-go/url-shortener/internal/app/screening/screeningtest"
+)
+
+func TestBlocklist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# phishing\nEvil.example\nпример.рф\nregex:/wp-login\\.php$\n"), 0o600))
+	blocklist, err := screening.LoadBlocklist(path)
+	require.NoError(t, err)
+
+	tests := []struct {
+		url     string
+		blocked bool
+	}{
+		{url: "https://evil.example/", blocked: true},
+		{url: "https://login.evil.example/a", blocked: true},
+		{url: "https://notevil.example/", blocked: false},
+		{url: "https://xn--e1afmkfd.xn--p1ai/", blocked: true},
+		{url: "https://blog.example/wp-login.php", blocked: true},
+		{url: "https://blog.example/", blocked: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			verdict := blocklist.Match(tt.url)
+			assert.Equal(t, tt.blocked, verdict.Blocked)
+			if tt.blocked {
+				assert.Equal(t, screening.BlocklistSource, verdict.Source)
+				assert.ErrorIs(t, verdict.Err(), screening.ErrBlocked)
+			}
+		})
+	}
+
+	// Измененный файл перечитывается, файл с ошибкой не заменяет список.
+	require.NoError(t, os.WriteFile(path, []byte("regex:("), 0o600))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)))
+	_, err = blocklist.Reload()
+	assert.Error(t, err)
+	assert.True(t, blocklist.Match("https://evil.example/").Blocked)
+
+	require.NoError(t, os.WriteFile(path, []byte("good.example\n"), 0o600))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(2*time.Minute)))
+	reloaded, err := blocklist.Reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.False(t, blocklist.Match("https://evil.example/").Blocked)
+	assert.True(t, blocklist.Match("https://good.example/").Blocked)
+
+	reloaded, err = blocklist.Reload()
+	require.NoError(t, err)
+	assert.False(t, reloaded)
+}
+
+func TestScreener(t *testing.T) {
+	ctx := context.Background()
+	provider := screeningtest.New(map[string]string{"phish.example": "phishing"})
+	screener := screening.New(nil, time.Hour, provider)
+
+	verdict, err := screener.Screen(ctx, "https://phish.example/")
+	require.NoError(t, err)
+	assert.True(t, verdict.Blocked)
+	assert.Equal(t, "phishing", verdict.Reason)
+	assert.Equal(t, screeningtest.Name, verdict.Source)
+
+	// При переходах вердикт кэшируется.
+	for i := 0; i < 3; i++ {
+		verdict, err = screener.Check(ctx, "https://ok.example/")
+		require.NoError(t, err)
+		assert.False(t, verdict.Blocked)
+	}
+	assert.Equal(t, 2, provider.Calls())
+
+	// Ошибка сервиса не блокирует URL и кэшируется ненадолго.
+	provider.Fail(errors.New("unavailable"))
+	short := screening.New(nil, 50*time.Millisecond, provider)
+	verdict, err = short.Check(ctx, "https://other.example/")
+	assert.Error(t, err)
+	assert.False(t, verdict.Blocked)
+	calls := provider.Calls()
+	verdict, err = short.Check(ctx, "https://other.example/")
+	require.NoError(t, err)
+	assert.False(t, verdict.Blocked)
+	assert.Equal(t, calls, provider.Calls())
+	provider.Fail(nil)
+	provider.Block("other.example", "malware")
+	time.Sleep(60 * time.Millisecond)
+	verdict, err = short.Check(ctx, "https://other.example/")
+	require.NoError(t, err)
+	assert.True(t, verdict.Blocked)
+
+	var disabled *screening.Screener
+	verdict, err = disabled.Check(ctx, "https://phish.example/")
+	require.NoError(t, err)
+	assert.False(t, verdict.Blocked)
+}
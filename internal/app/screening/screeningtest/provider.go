@@ -0,0 +1,76 @@
+// Модуль screeningtest реализует сервис репутации URL для тестов проверки URL.
+// Сервис блокирует заданные домены и считает обращения, чтобы тесты могли проверить кэширование.
+package screeningtest
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/vancho-go/url-shortener/internal/app/screening"
+)
+
+// Name - имя тестового сервиса в Verdict.Source.
+const Name = "fake"
+
+// Provider - тестовый сервис репутации URL.
+type Provider struct {
+	mu      sync.Mutex
+	blocked map[string]string
+	err     error
+	calls   int
+}
+
+// New конструктор Provider. blocked - заблокированные домены и причины блокировки.
+func New(blocked map[string]string) *Provider {
+	p := &Provider{blocked: make(map[string]string, len(blocked))}
+	for domain, reason := range blocked {
+		p.blocked[domain] = reason
+	}
+	return p
+}
+
+// Block блокирует домен.
+func (p *Provider) Block(domain, reason string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.blocked[domain] = reason
+}
+
+// Fail задает ошибку, которую возвращают последующие проверки (nil - проверки работают).
+func (p *Provider) Fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
+
+// Calls возвращает число выполненных проверок.
+func (p *Provider) Calls() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls
+}
+
+// Name возвращает имя сервиса.
+func (p *Provider) Name() string {
+	return Name
+}
+
+// Check блокирует URL, если его хост заблокирован.
+func (p *Provider) Check(ctx context.Context, rawURL string) (screening.Verdict, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	if p.err != nil {
+		return screening.Verdict{}, p.err
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return screening.Verdict{}, err
+	}
+	if reason, ok := p.blocked[strings.ToLower(u.Hostname())]; ok {
+		return screening.Verdict{Blocked: true, Reason: reason, Source: Name}, nil
+	}
+	return screening.Verdict{}, nil
+}
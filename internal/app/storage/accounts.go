@@ -0,0 +1,343 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vancho-go/url-shortener/internal/app/models"
+)
+
+// accounts хранит в памяти учетные данные пользователей: учетные записи, API ключи,
+// отозванные токены и токены обновления.
+// Используется in-memory и файловым хранилищами. Если задан path,
+// состояние сохраняется в файл после каждого изменения.
+type accounts struct {
+	mu    sync.RWMutex
+	path  string
+	state accountsState
+	// defaultQuota - квоты пользователей, которым администратор не задал свои.
+	defaultQuota models.Quota
+}
+
+// accountsState - сериализуемое состояние accounts.
+type accountsState struct {
+	NextID int64 `json:"next_id"`
+	// Users - учетные записи по email.
+	Users map[string]storedAccount `json:"users"`
+	// APIKeys - API ключи по хешу.
+	APIKeys map[string]storedAPIKey `json:"api_keys"`
+	// RevokedTokens - время истечения отозванных токенов по jti.
+	RevokedTokens map[string]time.Time `json:"revoked_tokens"`
+	// RefreshTokens - токены обновления по хешу.
+	RefreshTokens map[string]models.RefreshToken `json:"refresh_tokens"`
+	// Quotas - квоты, заданные пользователям администратором.
+	Quotas map[string]models.Quota `json:"quotas"`
+	// Created - количество URL, сокращенных пользователями за текущие сутки.
+	Created map[string]storedDailyCount `json:"created"`
+}
+
+// storedAccount - учетная запись в файле состояния.
+type storedAccount struct {
+	ID           string    `json:"id"`
+	PasswordHash string    `json:"password_hash"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// storedAPIKey - API ключ в файле состояния. В отличие от models.APIKey, сохраняет владельца.
+type storedAPIKey struct {
+	ID        int64     `json:"id"`
+	UserID    string    `json:"user_id"`
+	Name      string    `json:"name"`
+	Prefix    string    `json:"prefix"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// model преобразует сохраненный API ключ в модель.
+func (k storedAPIKey) model() models.APIKey {
+	return models.APIKey{ID: k.ID, UserID: k.UserID, Name: k.Name, Prefix: k.Prefix, Scopes: k.Scopes, CreatedAt: k.CreatedAt}
+}
+
+// newAccounts конструктор accounts. Если path не пустой, состояние загружается из файла.
+func newAccounts(path string) (*accounts, error) {
+	a := &accounts{
+		path: path,
+		state: accountsState{
+			NextID:        1,
+			Users:         make(map[string]storedAccount),
+			APIKeys:       make(map[string]storedAPIKey),
+			RevokedTokens: make(map[string]time.Time),
+			RefreshTokens: make(map[string]models.RefreshToken),
+			Quotas:        make(map[string]models.Quota),
+			Created:       make(map[string]storedDailyCount),
+		},
+	}
+	if path == "" {
+		return a, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &a.state); err != nil {
+		return nil, err
+	}
+	// Файлы, сохраненные до появления новых разделов состояния, не содержат их.
+	if a.state.Users == nil {
+		a.state.Users = make(map[string]storedAccount)
+	}
+	if a.state.RevokedTokens == nil {
+		a.state.RevokedTokens = make(map[string]time.Time)
+	}
+	if a.state.RefreshTokens == nil {
+		a.state.RefreshTokens = make(map[string]models.RefreshToken)
+	}
+	if a.state.Quotas == nil {
+		a.state.Quotas = make(map[string]models.Quota)
+	}
+	if a.state.Created == nil {
+		a.state.Created = make(map[string]storedDailyCount)
+	}
+	return a, nil
+}
+
+// save сохраняет состояние в файл. Вызывается под блокировкой.
+func (a *accounts) save() error {
+	if a.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(&a.state)
+	if err != nil {
+		return err
+	}
+	tmp := a.path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, a.path)
+}
+
+// CreateAccount создает учетную запись с хешем пароля passwordHash.
+func (a *accounts) CreateAccount(ctx context.Context, account models.Account, passwordHash string) (*models.Account, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.state.Users[account.Email]; ok {
+		return nil, ErrAlreadyExists
+	}
+	account.CreatedAt = time.Now().UTC()
+	a.state.Users[account.Email] = storedAccount{ID: account.ID, PasswordHash: passwordHash, CreatedAt: account.CreatedAt}
+	return &account, a.save()
+}
+
+// GetAccountByEmail извлекает учетную запись и хеш ее пароля по email.
+func (a *accounts) GetAccountByEmail(ctx context.Context, email string) (*models.Account, string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	stored, ok := a.state.Users[email]
+	if !ok {
+		return nil, "", ErrNotFound
+	}
+	return &models.Account{ID: stored.ID, Email: email, CreatedAt: stored.CreatedAt}, stored.PasswordHash, nil
+}
+
+// mergeUser переносит API ключи пользователя from пользователю to.
+func (a *accounts) mergeUser(from, to string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for hash, key := range a.state.APIKeys {
+		if key.UserID == from {
+			key.UserID = to
+			a.state.APIKeys[hash] = key
+		}
+	}
+	return a.save()
+}
+
+// RevokeToken добавляет токен в список отозванных до момента его истечения.
+func (a *accounts) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.state.RevokedTokens[jti] = expiresAt
+	return a.save()
+}
+
+// GetRevokedTokens извлекает неистекшие отозванные токены.
+func (a *accounts) GetRevokedTokens(ctx context.Context) (map[string]time.Time, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	now := time.Now()
+	revoked := make(map[string]time.Time, len(a.state.RevokedTokens))
+	for jti, expiresAt := range a.state.RevokedTokens {
+		if expiresAt.After(now) {
+			revoked[jti] = expiresAt
+		}
+	}
+	return revoked, nil
+}
+
+// DeleteExpiredTokens удаляет из списка токены, истекшие до момента before.
+func (a *accounts) DeleteExpiredTokens(ctx context.Context, before time.Time) (int64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var deleted int64
+	for jti, expiresAt := range a.state.RevokedTokens {
+		if !expiresAt.After(before) {
+			delete(a.state.RevokedTokens, jti)
+			deleted++
+		}
+	}
+	if deleted == 0 {
+		return 0, nil
+	}
+	return deleted, a.save()
+}
+
+// CreateRefreshToken сохраняет токен обновления, вместо самого токена хранится его хеш.
+func (a *accounts) CreateRefreshToken(ctx context.Context, token models.RefreshToken, hash string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.state.RefreshTokens[hash]; ok {
+		return ErrAlreadyExists
+	}
+	a.state.RefreshTokens[hash] = token
+	return a.save()
+}
+
+// RotateRefreshToken помечает неиспользованный и неистекший токен hash использованным и сохраняет
+// токен next того же семейства и пользователя. Возвращает токен hash в состоянии до вызова.
+func (a *accounts) RotateRefreshToken(ctx context.Context, hash string, next models.RefreshToken, nextHash string) (*models.RefreshToken, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	previous, ok := a.state.RefreshTokens[hash]
+	if !ok {
+		return nil, nil
+	}
+	if previous.Rotated || !previous.ExpiresAt.After(time.Now()) {
+		return &previous, nil
+	}
+	rotated := previous
+	rotated.Rotated = true
+	a.state.RefreshTokens[hash] = rotated
+	a.state.RefreshTokens[nextHash] = models.RefreshToken{
+		FamilyID:   previous.FamilyID,
+		UserID:     previous.UserID,
+		Registered: previous.Registered,
+		ExpiresAt:  next.ExpiresAt,
+	}
+	return &previous, a.save()
+}
+
+// GetRefreshTokenByHash извлекает токен обновления по хешу. Если токена нет, возвращает nil без ошибки.
+func (a *accounts) GetRefreshTokenByHash(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	token, ok := a.state.RefreshTokens[hash]
+	if !ok {
+		return nil, nil
+	}
+	return &token, nil
+}
+
+// DeleteRefreshTokens удаляет все токены семейства familyID.
+func (a *accounts) DeleteRefreshTokens(ctx context.Context, familyID string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for hash, token := range a.state.RefreshTokens {
+		if token.FamilyID == familyID {
+			delete(a.state.RefreshTokens, hash)
+		}
+	}
+	return a.save()
+}
+
+// DeleteExpiredRefreshTokens удаляет токены, истекшие до момента before.
+func (a *accounts) DeleteExpiredRefreshTokens(ctx context.Context, before time.Time) (int64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var deleted int64
+	for hash, token := range a.state.RefreshTokens {
+		if !token.ExpiresAt.After(before) {
+			delete(a.state.RefreshTokens, hash)
+			deleted++
+		}
+	}
+	if deleted == 0 {
+		return 0, nil
+	}
+	return deleted, a.save()
+}
+
+// CreateAPIKey сохраняет API ключ пользователя, вместо самого ключа хранится его хеш.
+func (a *accounts) CreateAPIKey(ctx context.Context, key models.APIKey, hash string) (*models.APIKey, error) {
+	name, err := normalizeName(key.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.state.APIKeys[hash]; ok {
+		return nil, ErrAlreadyExists
+	}
+	stored := storedAPIKey{
+		ID:        a.state.NextID,
+		UserID:    key.UserID,
+		Name:      name,
+		Prefix:    key.Prefix,
+		Scopes:    key.Scopes,
+		CreatedAt: time.Now().UTC(),
+	}
+	a.state.NextID++
+	a.state.APIKeys[hash] = stored
+	created := stored.model()
+	return &created, a.save()
+}
+
+// GetAPIKeys извлекает API ключи пользователя.
+func (a *accounts) GetAPIKeys(ctx context.Context, userID string) ([]models.APIKey, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	var keys []models.APIKey
+	for _, key := range a.state.APIKeys {
+		if key.UserID == userID {
+			keys = append(keys, key.model())
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+// RevokeAPIKey отзывает API ключ пользователя.
+func (a *accounts) RevokeAPIKey(ctx context.Context, userID string, keyID int64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for hash, key := range a.state.APIKeys {
+		if key.ID == keyID && key.UserID == userID {
+			delete(a.state.APIKeys, hash)
+			return a.save()
+		}
+	}
+	return ErrNotFound
+}
+
+// GetAPIKeyByHash извлекает API ключ по хешу. Если ключа нет, возвращает nil без ошибки.
+func (a *accounts) GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	stored, ok := a.state.APIKeys[hash]
+	if !ok {
+		return nil, nil
+	}
+	key := stored.model()
+	return &key, nil
+}
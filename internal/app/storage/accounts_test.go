@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vancho-go/url-shortener/internal/app/models"
+)
+
+func TestAccountsAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "db.json.accounts")
+	a, err := newAccounts(path)
+	require.NoError(t, err)
+
+	_, err = a.CreateAPIKey(ctx, models.APIKey{UserID: "user", Name: " ", Scopes: []string{"read"}}, "hash")
+	assert.ErrorIs(t, err, ErrBadName)
+	created, err := a.CreateAPIKey(ctx, models.APIKey{UserID: "user", Name: "ci", Prefix: "usk_abc", Scopes: []string{"read"}}, "hash")
+	require.NoError(t, err)
+	assert.NotZero(t, created.ID)
+
+	// Ключи (вместе с владельцем) переживают перезапуск.
+	a, err = newAccounts(path)
+	require.NoError(t, err)
+	key, err := a.GetAPIKeyByHash(ctx, "hash")
+	require.NoError(t, err)
+	require.NotNil(t, key)
+	assert.Equal(t, "user", key.UserID)
+	assert.Equal(t, []string{"read"}, key.Scopes)
+
+	keys, err := a.GetAPIKeys(ctx, "other")
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+
+	assert.ErrorIs(t, a.RevokeAPIKey(ctx, "other", created.ID), ErrNotFound)
+	require.NoError(t, a.RevokeAPIKey(ctx, "user", created.ID))
+	key, err = a.GetAPIKeyByHash(ctx, "hash")
+	require.NoError(t, err)
+	assert.Nil(t, key)
+}
+
+func TestAccountsRefreshTokens(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "db.json.accounts")
+	a, err := newAccounts(path)
+	require.NoError(t, err)
+
+	expiresAt := time.Now().Add(time.Hour)
+	token := models.RefreshToken{FamilyID: "family", UserID: "user", Registered: true, ExpiresAt: expiresAt}
+	require.NoError(t, a.CreateRefreshToken(ctx, token, "first"))
+	require.NoError(t, a.CreateRefreshToken(ctx, models.RefreshToken{FamilyID: "expired", ExpiresAt: time.Now().Add(-time.Minute)}, "expired"))
+
+	// Обмен копирует семейство и пользователя в новый токен и помечает старый использованным.
+	previous, err := a.RotateRefreshToken(ctx, "first", models.RefreshToken{ExpiresAt: expiresAt.Add(time.Hour)}, "second")
+	require.NoError(t, err)
+	require.NotNil(t, previous)
+	assert.False(t, previous.Rotated)
+
+	// Токены переживают перезапуск.
+	a, err = newAccounts(path)
+	require.NoError(t, err)
+	second, err := a.GetRefreshTokenByHash(ctx, "second")
+	require.NoError(t, err)
+	require.NotNil(t, second)
+	assert.Equal(t, "family", second.FamilyID)
+	assert.Equal(t, "user", second.UserID)
+
+	// Повторный обмен не выпускает токен.
+	previous, err = a.RotateRefreshToken(ctx, "first", models.RefreshToken{ExpiresAt: expiresAt}, "third")
+	require.NoError(t, err)
+	assert.True(t, previous.Rotated)
+	third, err := a.GetRefreshTokenByHash(ctx, "third")
+	require.NoError(t, err)
+	assert.Nil(t, third)
+
+	previous, err = a.RotateRefreshToken(ctx, "unknown", models.RefreshToken{ExpiresAt: expiresAt}, "third")
+	require.NoError(t, err)
+	assert.Nil(t, previous)
+
+	deleted, err := a.DeleteExpiredRefreshTokens(ctx, time.Now())
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, deleted)
+
+	require.NoError(t, a.DeleteRefreshTokens(ctx, "family"))
+	second, err = a.GetRefreshTokenByHash(ctx, "second")
+	require.NoError(t, err)
+	assert.Nil(t, second)
+}
+
+func TestQuota(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "db.json")
+	db, err := NewEncoderDecoder(path)
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetDefaultQuota(models.Quota{Daily: 2})
+
+	require.NoError(t, db.AddURL(ctx, "https://a.ru", "a", "user"))
+	require.NoError(t, db.AddURL(ctx, "https://b.ru", "b", "user"))
+	assert.ErrorIs(t, db.AddURL(ctx, "https://c.ru", "c", "user"), ErrQuotaExceeded)
+	// Квоты пользователей независимы.
+	require.NoError(t, db.AddURL(ctx, "https://c.ru", "c", "other"))
+
+	usage, err := db.GetQuota(ctx, "user")
+	require.NoError(t, err)
+	assert.Equal(t, models.Quota{Daily: 2}, usage.Limits)
+	assert.Equal(t, models.Quota{Daily: 2, Total: 2}, usage.Used)
+	assert.False(t, usage.Custom)
+	assert.True(t, usage.ResetAt.After(time.Now()))
+
+	// Квота, заданная администратором, заменяет квоту по умолчанию и переживает перезапуск.
+	assert.ErrorIs(t, db.SetUserQuota(ctx, "user", models.Quota{Daily: -1}), ErrBadQuota)
+	require.NoError(t, db.SetUserQuota(ctx, "user", models.Quota{Total: 3}))
+	a, err := newAccounts(path + ".accounts")
+	require.NoError(t, err)
+	usage = a.quotaUsage("user", 2, time.Now())
+	assert.True(t, usage.Custom)
+	assert.Equal(t, models.Quota{Daily: 2, Total: 2}, usage.Used)
+
+	require.NoError(t, db.AddURL(ctx, "https://d.ru", "d", "user"))
+	assert.ErrorIs(t, db.AddURL(ctx, "https://e.ru", "e", "user"), ErrQuotaExceeded)
+
+	// Суточная квота обнуляется на следующие сутки.
+	assert.Zero(t, a.quotaUsage("user", 2, time.Now().Add(24*time.Hour)).Used.Daily)
+
+	require.NoError(t, db.DeleteUserQuota(ctx, "user"))
+	assert.ErrorIs(t, db.DeleteUserQuota(ctx, "user"), ErrNotFound)
+	usage, err = db.GetQuota(ctx, "user")
+	require.NoError(t, err)
+	assert.False(t, usage.Custom)
+}
@@ -0,0 +1,219 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/vancho-go/url-shortener/internal/app/base62"
+	"github.com/vancho-go/url-shortener/internal/app/models"
+)
+
+// DefaultBatchSize - размер пачки по умолчанию при пакетном сохранении URL.
+const DefaultBatchSize = 100
+
+// batchTimeout - время на сохранение одной пачки URL.
+const batchTimeout = 3 * time.Second
+
+var (
+	// ErrEmptyURL - тип ошибки, сигнализирующий, что оригинальный URL не передан.
+	ErrEmptyURL = errors.New("URL parameter is missing")
+	// ErrBadAlias - тип ошибки, сигнализирующий, что пользовательский сокращенный URL некорректен.
+	ErrBadAlias = errors.New("bad alias")
+	// ErrAliasTaken - тип ошибки, сигнализирующий, что пользовательский сокращенный URL уже занят.
+	ErrAliasTaken = errors.New("alias is already taken")
+	// ErrURLConflict - тип ошибки, сигнализирующий, что оригинальный URL уже был сокращен.
+	ErrURLConflict = errors.New("URL is already shortened")
+)
+
+// aliasPattern - допустимый формат пользовательского сокращенного URL.
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+var (
+	// reservedAliases - сокращенные URL, совпадающие с путями сервиса. Пути, зарегистрированные в роутере,
+	// добавляются при запуске сервера (см. ReserveAliases).
+	reservedAliases = map[string]struct{}{
+		"api": {}, "ping": {}, "debug": {}, "auth": {}, "report": {}, ".well-known": {},
+	}
+	// reservedAliasesMu защищает reservedAliases: ValidateAlias читает их из обработчиков запросов.
+	reservedAliasesMu sync.RWMutex
+)
+
+// ReserveAliases запрещает пользовательские сокращенные URL aliases, например первые сегменты путей
+// сервиса.
+func ReserveAliases(aliases ...string) {
+	reservedAliasesMu.Lock()
+	defer reservedAliasesMu.Unlock()
+	for _, alias := range aliases {
+		reservedAliases[alias] = struct{}{}
+	}
+}
+
+// BatchResult - результат сохранения одного URL из пачки.
+type BatchResult struct {
+	models.APIBatchRequest
+	// Err - ошибка сохранения URL (nil - URL сохранен).
+	Err error
+}
+
+// BatchWriter накапливает URL пользователя и сохраняет их в хранилище пачками через AddURLs.
+// Результат по каждому URL передается в onResult в порядке добавления, сразу после сохранения пачки.
+// Если пачка не сохранилась целиком, URL из нее сохраняются по одному, чтобы ошибка
+// одного URL не влияла на остальные.
+type BatchWriter struct {
+	db       URLStorager
+	userID   string
+	size     int
+	pending  []BatchResult
+	aliases  map[string]struct{}
+	onResult func(BatchResult) error
+}
+
+// NewBatchWriter конструктор BatchWriter. Если size < 1, используется DefaultBatchSize.
+func NewBatchWriter(db URLStorager, userID string, size int, onResult func(BatchResult) error) *BatchWriter {
+	if size < 1 {
+		size = DefaultBatchSize
+	}
+	return &BatchWriter{
+		db:       db,
+		userID:   userID,
+		size:     size,
+		aliases:  make(map[string]struct{}),
+		onResult: onResult,
+	}
+}
+
+// Add добавляет URL в пачку и сохраняет пачку, если она заполнена.
+// Если ShortenURL не задан, он генерируется, иначе используется как пользовательский сокращенный URL.
+// Возвращает ошибку только если ее вернул onResult.
+func (w *BatchWriter) Add(ctx context.Context, url models.APIBatchRequest) error {
+	result := BatchResult{APIBatchRequest: url}
+	result.Err = w.prepare(ctx, &result.APIBatchRequest)
+	w.pending = append(w.pending, result)
+
+	if len(w.pending) >= w.size {
+		return w.Flush(ctx)
+	}
+	return nil
+}
+
+// Reject добавляет в пачку URL, который не прошел проверку вызывающей стороной.
+// Такой URL не сохраняется, но его результат с ошибкой err передается в onResult в общем порядке.
+func (w *BatchWriter) Reject(ctx context.Context, url models.APIBatchRequest, err error) error {
+	w.pending = append(w.pending, BatchResult{APIBatchRequest: url, Err: err})
+
+	if len(w.pending) >= w.size {
+		return w.Flush(ctx)
+	}
+	return nil
+}
+
+// prepare проверяет URL и назначает ему сокращенный URL.
+func (w *BatchWriter) prepare(ctx context.Context, url *models.APIBatchRequest) error {
+	if url.OriginalURL == "" {
+		return ErrEmptyURL
+	}
+
+	if url.ShortenURL != "" {
+		if err := ValidateAlias(url.ShortenURL); err != nil {
+			return err
+		}
+		if _, ok := w.aliases[url.ShortenURL]; ok || !w.db.IsShortenUnique(ctx, url.ShortenURL) {
+			return ErrAliasTaken
+		}
+	} else {
+		url.ShortenURL = base62.Base62Encode(rand.Uint64())
+		_, ok := w.aliases[url.ShortenURL]
+		for ok || !w.db.IsShortenUnique(ctx, url.ShortenURL) {
+			url.ShortenURL = base62.Base62Encode(rand.Uint64())
+			_, ok = w.aliases[url.ShortenURL]
+		}
+	}
+	w.aliases[url.ShortenURL] = struct{}{}
+	return nil
+}
+
+// Flush сохраняет накопленную пачку и передает результаты в onResult.
+func (w *BatchWriter) Flush(ctx context.Context) error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, batchTimeout)
+	defer cancel()
+
+	batch := make([]models.APIBatchRequest, 0, len(w.aliases))
+	for _, result := range w.pending {
+		if result.Err == nil {
+			batch = append(batch, result.APIBatchRequest)
+		}
+	}
+
+	if err := w.db.AddURLs(ctx, w.userID, batch...); err != nil {
+		// Пачка не сохранилась целиком: сохраняем URL по одному, чтобы найти ошибочные.
+		for i := range w.pending {
+			if w.pending[i].Err == nil {
+				w.pending[i].Err = batchError(w.db.AddURLs(ctx, w.userID, w.pending[i].APIBatchRequest))
+			}
+		}
+	}
+
+	pending := w.pending
+	w.pending = nil
+	w.aliases = make(map[string]struct{})
+	for _, result := range pending {
+		if err := w.onResult(result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddURLsPartially сохраняет пачку URL пользователя. Если квоты пользователя не хватает на всю пачку,
+// URL сохраняются по одному, пока квота не закончится, и возвращаются ошибки отдельных URL
+// (nil - URL сохранен). Остальные ошибки относятся ко всей пачке.
+func AddURLsPartially(ctx context.Context, db URLStorager, userID string, urls ...models.APIBatchRequest) ([]error, error) {
+	errs := make([]error, len(urls))
+	err := db.AddURLs(ctx, userID, urls...)
+	if !errors.Is(err, ErrQuotaExceeded) {
+		return errs, err
+	}
+
+	var quotaErr error
+	for i := range urls {
+		if quotaErr != nil {
+			// Квота закончилась: остальные URL не поместятся.
+			errs[i] = quotaErr
+			continue
+		}
+		errs[i] = batchError(db.AddURLs(ctx, userID, urls[i]))
+		if errors.Is(errs[i], ErrQuotaExceeded) {
+			quotaErr = errs[i]
+		}
+	}
+	return errs, nil
+}
+
+// ValidateAlias проверяет пользовательский сокращенный URL.
+func ValidateAlias(alias string) error {
+	if !aliasPattern.MatchString(alias) {
+		return ErrBadAlias
+	}
+	reservedAliasesMu.RLock()
+	_, reserved := reservedAliases[alias]
+	reservedAliasesMu.RUnlock()
+	if reserved {
+		return ErrBadAlias
+	}
+	return nil
+}
+
+// batchError переводит ошибку сохранения одного URL в понятную клиенту.
+func batchError(err error) error {
+	if err != nil && isUniqueViolation(err) {
+		return ErrURLConflict
+	}
+	return err
+}
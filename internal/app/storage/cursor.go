@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor - тип ошибки, сигнализирующий, что передан некорректный курсор страницы.
+var ErrInvalidCursor = errors.New("invalid page cursor")
+
+// pageCursor - позиция последней записи на странице, с которой продолжается выдача.
+type pageCursor struct {
+	createdAt time.Time
+	id        int64
+}
+
+// encodeCursor кодирует позицию записи в непрозрачную для клиента строку.
+func encodeCursor(createdAt time.Time, id int64) string {
+	raw := strconv.FormatInt(createdAt.UnixNano(), 10) + ":" + strconv.FormatInt(id, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor декодирует курсор, полученный от клиента.
+func decodeCursor(cursor string) (*pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	ts, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+
+	nanos, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	rowID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &pageCursor{createdAt: time.Unix(0, nanos), id: rowID}, nil
+}
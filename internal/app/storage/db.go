@@ -7,7 +7,10 @@ import (
 	"errors"
 	"fmt"
 	"github.com/vancho-go/url-shortener/internal/app/handlers/http/middlewares"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"go.uber.org/zap"
@@ -18,9 +21,21 @@ import (
 // ErrDeletedURL - тип ошибки, сигнализирующий, что URL был удален.
 var ErrDeletedURL = errors.New("URL was deleted")
 
+// ErrExpiredURL - тип ошибки, сигнализирующий, что срок действия URL истек.
+var ErrExpiredURL = errors.New("URL has expired")
+
+// ErrDisabledURL - тип ошибки, сигнализирующий, что URL заблокирован администратором.
+var ErrDisabledURL = errors.New("URL was disabled")
+
+// ErrAbusiveURL - тип ошибки, сигнализирующий, что URL заблокирован по жалобам на злоупотребления.
+// Является частным случаем ErrDisabledURL.
+var ErrAbusiveURL = fmt.Errorf("%w for abuse", ErrDisabledURL)
+
 // Database - объект, содержащий информацию о БД.
 type Database struct {
 	DB *sql.DB
+	// defaultQuota - квоты пользователей, которым администратор не задал свои.
+	defaultQuota models.Quota
 }
 
 // Initialize создает соединение с БД и создает схему таблиц, если ее нет.
@@ -44,7 +59,7 @@ func Initialize(dsn string) (*Database, error) {
 
 // CreateIfNotExists создает схему таблиц, если ее нет.
 func CreateIfNotExists(db *sql.DB) error {
-	createTableQuery := `
+	queries := []string{`
 		CREATE TABLE IF NOT EXISTS urls (
 			id SERIAL PRIMARY KEY,
 			user_id VARCHAR NOT NULL,
@@ -53,16 +68,85 @@ func CreateIfNotExists(db *sql.DB) error {
 			deleted BOOLEAN DEFAULT FALSE NOT NULL,
 			UNIQUE (shorten_url),
 		    UNIQUE (original_url)
-		);`
-
-	_, err := db.Exec(createTableQuery)
-	if err != nil {
-		return err
+		);`,
+		`ALTER TABLE urls ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ DEFAULT now() NOT NULL;`,
+		`CREATE INDEX IF NOT EXISTS urls_user_created_idx ON urls (user_id, created_at, id);`,
+		`CREATE TABLE IF NOT EXISTS tags (
+			id SERIAL PRIMARY KEY,
+			user_id VARCHAR NOT NULL,
+			name VARCHAR NOT NULL,
+			UNIQUE (user_id, name)
+		);`,
+		`CREATE TABLE IF NOT EXISTS url_tags (
+			url_id INTEGER NOT NULL REFERENCES urls (id) ON DELETE CASCADE,
+			tag_id INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+			PRIMARY KEY (url_id, tag_id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS folders (
+			id SERIAL PRIMARY KEY,
+			user_id VARCHAR NOT NULL,
+			name VARCHAR NOT NULL,
+			parent_id INTEGER REFERENCES folders (id) ON DELETE CASCADE
+		);`,
+		`ALTER TABLE urls ADD COLUMN IF NOT EXISTS folder_id INTEGER REFERENCES folders (id) ON DELETE SET NULL;`,
+		`ALTER TABLE urls ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;`,
+		`CREATE TABLE IF NOT EXISTS api_keys (
+			id SERIAL PRIMARY KEY,
+			user_id VARCHAR NOT NULL,
+			name VARCHAR NOT NULL,
+			prefix VARCHAR NOT NULL,
+			hash VARCHAR NOT NULL UNIQUE,
+			scopes VARCHAR NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT now() NOT NULL
+		);`,
+		`ALTER TABLE urls ADD COLUMN IF NOT EXISTS disabled BOOLEAN DEFAULT FALSE NOT NULL;`,
+		`CREATE TABLE IF NOT EXISTS revoked_tokens (
+			jti VARCHAR PRIMARY KEY,
+			expires_at TIMESTAMPTZ NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS refresh_tokens (
+			hash VARCHAR PRIMARY KEY,
+			family_id VARCHAR NOT NULL,
+			user_id VARCHAR NOT NULL,
+			registered BOOLEAN NOT NULL,
+			expires_at TIMESTAMPTZ NOT NULL,
+			rotated BOOLEAN DEFAULT FALSE NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS refresh_tokens_family_id ON refresh_tokens (family_id);`,
+		`CREATE TABLE IF NOT EXISTS users (
+			id VARCHAR PRIMARY KEY,
+			email VARCHAR NOT NULL UNIQUE,
+			password_hash VARCHAR NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT now() NOT NULL
+		);`,
+		`ALTER TABLE urls ADD COLUMN IF NOT EXISTS disabled_reason VARCHAR DEFAULT '' NOT NULL;`,
+		`CREATE TABLE IF NOT EXISTS abuse_reports (
+			id SERIAL PRIMARY KEY,
+			shorten_url VARCHAR NOT NULL REFERENCES urls (shorten_url) ON DELETE CASCADE,
+			reporter VARCHAR NOT NULL,
+			network VARCHAR NOT NULL,
+			reason VARCHAR NOT NULL,
+			resolved BOOLEAN DEFAULT FALSE NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT now() NOT NULL
+		);`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS abuse_reports_open_idx ON abuse_reports (shorten_url, reporter) WHERE NOT resolved;`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS abuse_reports_open_network_idx ON abuse_reports (shorten_url, network) WHERE NOT resolved;`,
+		`CREATE TABLE IF NOT EXISTS user_quotas (
+			user_id VARCHAR PRIMARY KEY,
+			daily_limit BIGINT NOT NULL,
+			total_limit BIGINT NOT NULL
+		);`,
+	}
+
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-// AddURL сохраняет оригинальный и сокращенный URL в хранилище.
+// AddURL сохраняет оригинальный и сокращенный URL в хранилище, если пользователю хватает квоты.
 func (db *Database) AddURL(ctx context.Context, originalURL, shortenURL, userID string) error {
 	tx, err := db.DB.Begin()
 	if err != nil {
@@ -70,8 +154,12 @@ func (db *Database) AddURL(ctx context.Context, originalURL, shortenURL, userID
 	}
 	defer tx.Rollback()
 
+	if err = db.reserveQuota(ctx, tx, userID, 1); err != nil {
+		return err
+	}
+
 	insertQuery := "INSERT INTO urls (shorten_url, original_url, user_id) VALUES ($1, $2, $3)"
-	stmt, err := db.DB.PrepareContext(ctx, insertQuery)
+	stmt, err := tx.PrepareContext(ctx, insertQuery)
 	if err != nil {
 		return err
 	}
@@ -84,7 +172,7 @@ func (db *Database) AddURL(ctx context.Context, originalURL, shortenURL, userID
 	return tx.Commit()
 }
 
-// AddURLs сохраняет batch оригинальных и сокращенных URL в хранилище.
+// AddURLs сохраняет batch оригинальных и сокращенных URL в хранилище вместе с их тегами и папками.
 func (db *Database) AddURLs(ctx context.Context, userID string, urls ...models.APIBatchRequest) error {
 	// Проверка на пустой слайс.
 	if len(urls) == 0 {
@@ -97,7 +185,13 @@ func (db *Database) AddURLs(ctx context.Context, userID string, urls ...models.A
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.PrepareContext(ctx, "INSERT INTO urls (shorten_url, original_url, user_id) VALUES ($1, $2, $3)")
+	// Пачка сохраняется целиком или не сохраняется вовсе, в том числе при нехватке квоты.
+	if err = db.reserveQuota(ctx, tx, userID, int64(len(urls))); err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx,
+		"INSERT INTO urls (shorten_url, original_url, user_id, folder_id, expires_at) VALUES ($1, $2, $3, $4, $5) RETURNING id")
 	if err != nil {
 		return err
 	}
@@ -105,10 +199,23 @@ func (db *Database) AddURLs(ctx context.Context, userID string, urls ...models.A
 
 	// Для каждого URL в слайсе.
 	for _, url := range urls {
-		_, err = stmt.ExecContext(ctx, url.ShortenURL, url.OriginalURL, userID)
+		if url.FolderID != nil {
+			if err = checkFolder(ctx, tx, userID, *url.FolderID); err != nil {
+				return err
+			}
+		}
+
+		var urlID int64
+		err = stmt.QueryRowContext(ctx, url.ShortenURL, url.OriginalURL, userID, url.FolderID, url.ExpiresAt).Scan(&urlID)
 		if err != nil {
 			return err
 		}
+
+		if len(url.Tags) > 0 {
+			if err = attachTags(ctx, tx, userID, urlID, url.Tags); err != nil {
+				return err
+			}
+		}
 	}
 
 	return tx.Commit()
@@ -116,7 +223,7 @@ func (db *Database) AddURLs(ctx context.Context, userID string, urls ...models.A
 
 // GetURL извлекает сокращенный URL для переданного оригинального URL из хранилища.
 func (db *Database) GetURL(ctx context.Context, shortenURL string) (string, error) {
-	selectQuery := "SELECT original_url, deleted FROM urls WHERE shorten_url=$1"
+	selectQuery := "SELECT original_url, deleted, disabled, disabled_reason, expires_at FROM urls WHERE shorten_url=$1"
 	stmt, err := db.DB.Prepare(selectQuery)
 	if err != nil {
 		return "", err
@@ -126,51 +233,144 @@ func (db *Database) GetURL(ctx context.Context, shortenURL string) (string, erro
 	row := stmt.QueryRowContext(ctx, shortenURL)
 
 	var originalURL string
-	var deleted bool
-	err = row.Scan(&originalURL, &deleted)
+	var deleted, disabled bool
+	var disabledReason string
+	var expiresAt sql.NullTime
+	err = row.Scan(&originalURL, &deleted, &disabled, &disabledReason, &expiresAt)
 	if deleted {
 		return "", ErrDeletedURL
 	}
+	if disabled && disabledReason == models.DisabledReasonAbuse {
+		return "", ErrAbusiveURL
+	}
+	if disabled {
+		return "", ErrDisabledURL
+	}
 	if err != nil {
 		return "", err
 	}
+	if expiresAt.Valid && expiresAt.Time.Before(time.Now()) {
+		return "", ErrExpiredURL
+	}
 	return originalURL, nil
 
 }
 
-// GetUserURLs извлекает URL из хранилища для конкретного пользователя.
-func (db *Database) GetUserURLs(ctx context.Context, userID string) ([]models.APIUserURLResponse, error) {
-	selectQuery := "SELECT shorten_url, original_url FROM urls WHERE user_id=$1"
-	stmt, err := db.DB.Prepare(selectQuery)
-	if err != nil {
-		return nil, err
+// GetUserURLs извлекает страницу URL из хранилища для конкретного пользователя.
+func (db *Database) GetUserURLs(ctx context.Context, userID string, filter models.UserURLsFilter) (*models.UserURLsPage, error) {
+	return db.listURLs(ctx, &userID, filter)
+}
+
+// GetAllURLs извлекает страницу URL всех пользователей.
+func (db *Database) GetAllURLs(ctx context.Context, filter models.UserURLsFilter) (*models.UserURLsPage, error) {
+	return db.listURLs(ctx, nil, filter)
+}
+
+// listURLs извлекает страницу URL пользователя userID или, если он nil, всех пользователей.
+func (db *Database) listURLs(ctx context.Context, userID *string, filter models.UserURLsFilter) (*models.UserURLsPage, error) {
+	var args []any
+	arg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+	conditions := []string{"TRUE"}
+	if userID != nil {
+		conditions = append(conditions, "user_id = "+arg(*userID))
 	}
-	defer stmt.Close()
 
-	rows, err := stmt.QueryContext(ctx, userID)
+	if filter.Cursor != "" {
+		cursor, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		op := ">"
+		if filter.Desc {
+			op = "<"
+		}
+		conditions = append(conditions, "(created_at, id) "+op+" ("+arg(cursor.createdAt)+", "+arg(cursor.id)+")")
+	}
+	if filter.Domain != "" {
+		conditions = append(conditions,
+			"lower(substring(original_url from '^(?:[^:/?#]+://)?([^/:?#]+)')) = lower("+arg(filter.Domain)+")")
+	}
+	if filter.Search != "" {
+		search := arg(filter.Search)
+		conditions = append(conditions,
+			"(strpos(lower(original_url), lower("+search+")) > 0 OR strpos(lower(shorten_url), lower("+search+")) > 0)")
+	}
+	if filter.Deleted != nil {
+		conditions = append(conditions, "deleted = "+arg(*filter.Deleted))
+	}
+	if filter.Tag != "" {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM url_tags JOIN tags ON tags.id = url_tags.tag_id "+
+			"WHERE url_tags.url_id = urls.id AND tags.name = "+arg(filter.Tag)+")")
+	}
+	if filter.FolderID != nil {
+		conditions = append(conditions, "folder_id = "+arg(*filter.FolderID))
+	}
 
-	if rows.Err() != nil {
-		return nil, rows.Err()
+	order := "ASC"
+	if filter.Desc {
+		order = "DESC"
+	}
+	selectQuery := "SELECT id, user_id, shorten_url, original_url, created_at, deleted, disabled, folder_id, expires_at FROM urls WHERE " +
+		strings.Join(conditions, " AND ") + " ORDER BY created_at " + order + ", id " + order
+	if filter.Limit > 0 {
+		// Выбираем на одну запись больше, чтобы понять, есть ли следующая страница.
+		selectQuery += " LIMIT " + arg(filter.Limit+1)
 	}
-	defer rows.Close()
 
+	rows, err := db.DB.QueryContext(ctx, selectQuery, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	var userURLs []models.APIUserURLResponse
+	var page models.UserURLsPage
+	var ids []int64
 	for rows.Next() {
+		if filter.Limit > 0 && len(page.URLs) == filter.Limit {
+			last := page.URLs[len(page.URLs)-1]
+			page.NextCursor = encodeCursor(last.CreatedAt, ids[len(ids)-1])
+			break
+		}
+
+		var id int64
+		var owner string
+		var folderID sql.NullInt64
+		var expiresAt sql.NullTime
 		var userURL models.APIUserURLResponse
-		err := rows.Scan(&userURL.ShortenURL, &userURL.OriginalURL)
+		err = rows.Scan(&id, &owner, &userURL.ShortenURL, &userURL.OriginalURL, &userURL.CreatedAt, &userURL.Deleted,
+			&userURL.Disabled, &folderID, &expiresAt)
 		if err != nil {
 			return nil, err
 		}
-		userURLs = append(userURLs, userURL)
+		if userID == nil {
+			userURL.UserID = owner
+		}
+		if folderID.Valid {
+			userURL.FolderID = &folderID.Int64
+		}
+		if expiresAt.Valid {
+			userURL.ExpiresAt = &expiresAt.Time
+		}
+		ids = append(ids, id)
+		page.URLs = append(page.URLs, userURL)
 	}
 	if rows.Err() != nil {
 		return nil, rows.Err()
 	}
-	return userURLs, nil
+
+	if len(ids) > 0 {
+		tags, err := db.getURLsTags(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		for i, id := range ids {
+			page.URLs[i].Tags = tags[id]
+		}
+	}
+	return &page, nil
 }
 
 // DeleteUserURLs удаляет URL из хранилища для конкретного пользователя.
@@ -358,6 +558,47 @@ func (db *Database) GetStats(ctx context.Context) (*models.APIStatsResponse, err
 	return &response, nil
 }
 
+// GetUserStats извлекает статистику URL пользователя.
+func (db *Database) GetUserStats(ctx context.Context, userID string) (*models.APIUserStatsResponse, error) {
+	response := models.APIUserStatsResponse{UserID: userID}
+	err := db.DB.QueryRowContext(ctx, `
+		SELECT COUNT(*) FILTER (WHERE NOT deleted), COUNT(*) FILTER (WHERE deleted), COUNT(*) FILTER (WHERE disabled)
+		FROM urls WHERE user_id = $1`, userID).Scan(&response.URLs, &response.Deleted, &response.Disabled)
+	if err != nil {
+		return nil, fmt.Errorf("getUserStats: error scanning row: %w", err)
+	}
+	return &response, nil
+}
+
+// SetURLDisabled блокирует или разблокирует URL любого пользователя, при блокировке с причиной reason.
+// Разблокировка закрывает жалобы на URL как рассмотренные.
+func (db *Database) SetURLDisabled(ctx context.Context, shortenURL string, disabled bool, reason string) error {
+	if !disabled {
+		reason = ""
+	}
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "UPDATE urls SET disabled = $2, disabled_reason = $3 WHERE shorten_url = $1",
+		shortenURL, disabled, reason)
+	if err != nil {
+		return err
+	}
+	if err = checkAffected(res); err != nil {
+		return err
+	}
+	if !disabled {
+		_, err = tx.ExecContext(ctx, "UPDATE abuse_reports SET resolved = TRUE WHERE shorten_url = $1 AND NOT resolved", shortenURL)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
 // Close закрывает хранилище.
 func (db *Database) Close() error {
 	return db.DB.Close()
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/vancho-go/url-shortener/internal/app/models"
+)
+
+// defaultAbuseReportsLimit - количество жалоб, возвращаемых GetAbuseReports, если лимит не задан.
+const defaultAbuseReportsLimit = 100
+
+// AddAbuseReport сохраняет жалобу на URL, повторная жалоба того же автора или из той же сети не учитывается.
+// Если нерассмотренных жалоб разных авторов набралось не меньше threshold (0 - не блокировать),
+// URL блокируется с причиной models.DisabledReasonAbuse. Возвращает количество нерассмотренных жалоб.
+func (db *Database) AddAbuseReport(ctx context.Context, report models.AbuseReport, threshold int64) (int64, error) {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Жалобы на URL блокируются до конца транзакции: иначе параллельные жалобы при READ COMMITTED
+	// не видят друг друга и порог блокировки может быть не достигнут.
+	if _, err = tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext('abuse:' || $1::text))", report.ShortenURL); err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO abuse_reports (shorten_url, reporter, network, reason) VALUES ($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING`,
+		report.ShortenURL, report.Reporter, report.Network, report.Reason)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return 0, ErrNotFound
+		}
+		return 0, err
+	}
+
+	var count int64
+	err = tx.QueryRowContext(ctx, "SELECT count(*) FROM abuse_reports WHERE shorten_url = $1 AND NOT resolved",
+		report.ShortenURL).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	if threshold > 0 && count >= threshold {
+		_, err = tx.ExecContext(ctx, "UPDATE urls SET disabled = TRUE, disabled_reason = $2 WHERE shorten_url = $1",
+			report.ShortenURL, models.DisabledReasonAbuse)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return count, tx.Commit()
+}
+
+// GetAbuseReports извлекает жалобы, новые первыми.
+func (db *Database) GetAbuseReports(ctx context.Context, filter models.AbuseReportsFilter) ([]models.AbuseReport, error) {
+	query := "SELECT id, shorten_url, reporter, network, reason, resolved, created_at FROM abuse_reports WHERE resolved = $1"
+	args := []any{filter.Resolved}
+	if filter.ShortenURL != "" {
+		args = append(args, filter.ShortenURL)
+		query += " AND shorten_url = $" + strconv.Itoa(len(args))
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultAbuseReportsLimit
+	}
+	args = append(args, limit)
+	query += " ORDER BY id DESC LIMIT $" + strconv.Itoa(len(args))
+
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := make([]models.AbuseReport, 0)
+	for rows.Next() {
+		var report models.AbuseReport
+		err = rows.Scan(&report.ID, &report.ShortenURL, &report.Reporter, &report.Network, &report.Reason, &report.Resolved, &report.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, rows.Err()
+}
+
+// isForeignKeyViolation проверяет является ли ошибка ForeignKeyViolation.
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgerrcode.ForeignKeyViolation
+}
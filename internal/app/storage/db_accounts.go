@@ -0,0 +1,279 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/vancho-go/url-shortener/internal/app/models"
+)
+
+// scopesSeparator - разделитель прав API ключа в колонке scopes и ролей в колонке roles.
+const scopesSeparator = ","
+
+// CreateAccount создает учетную запись с хешем пароля passwordHash.
+func (db *Database) CreateAccount(ctx context.Context, account models.Account, passwordHash string) (*models.Account, error) {
+	created := account
+	err := db.DB.QueryRowContext(ctx,
+		"INSERT INTO users (id, email, password_hash) VALUES ($1, $2, $3) RETURNING created_at",
+		account.ID, account.Email, passwordHash).Scan(&created.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrAlreadyExists
+		}
+		return nil, err
+	}
+	return &created, nil
+}
+
+// GetAccountByEmail извлекает учетную запись и хеш ее пароля по email.
+func (db *Database) GetAccountByEmail(ctx context.Context, email string) (*models.Account, string, error) {
+	account := models.Account{Email: email}
+	var passwordHash string
+	err := db.DB.QueryRowContext(ctx,
+		"SELECT id, password_hash, created_at FROM users WHERE email = $1", email).
+		Scan(&account.ID, &passwordHash, &account.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", ErrNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return &account, passwordHash, nil
+}
+
+// MergeUserURLs переносит URL, теги, папки и API ключи пользователя from пользователю to.
+// Одноименные теги объединяются. Возвращает количество перенесенных URL.
+func (db *Database) MergeUserURLs(ctx context.Context, from, to string) (int64, error) {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Ссылки на одноименные теги переводятся на теги получателя, сами дубли удаляются.
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO url_tags (url_id, tag_id)
+		SELECT ut.url_id, dst.id FROM url_tags ut
+		JOIN tags src ON src.id = ut.tag_id AND src.user_id = $1
+		JOIN tags dst ON dst.name = src.name AND dst.user_id = $2
+		ON CONFLICT DO NOTHING`, from, to)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM tags src USING tags dst
+		WHERE src.user_id = $1 AND dst.user_id = $2 AND dst.name = src.name`, from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, query := range []string{
+		"UPDATE tags SET user_id = $2 WHERE user_id = $1",
+		"UPDATE folders SET user_id = $2 WHERE user_id = $1",
+		"UPDATE api_keys SET user_id = $2 WHERE user_id = $1",
+	} {
+		if _, err = tx.ExecContext(ctx, query, from, to); err != nil {
+			return 0, err
+		}
+	}
+	res, err := tx.ExecContext(ctx, "UPDATE urls SET user_id = $2 WHERE user_id = $1", from, to)
+	if err != nil {
+		return 0, err
+	}
+	merged, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return merged, tx.Commit()
+}
+
+// RevokeToken добавляет токен в список отозванных до момента его истечения.
+func (db *Database) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	_, err := db.DB.ExecContext(ctx,
+		"INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2) ON CONFLICT (jti) DO NOTHING", jti, expiresAt)
+	return err
+}
+
+// GetRevokedTokens извлекает неистекшие отозванные токены.
+func (db *Database) GetRevokedTokens(ctx context.Context) (map[string]time.Time, error) {
+	rows, err := db.DB.QueryContext(ctx, "SELECT jti, expires_at FROM revoked_tokens WHERE expires_at > now()")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revoked := make(map[string]time.Time)
+	for rows.Next() {
+		var jti string
+		var expiresAt time.Time
+		if err = rows.Scan(&jti, &expiresAt); err != nil {
+			return nil, err
+		}
+		revoked[jti] = expiresAt
+	}
+	return revoked, rows.Err()
+}
+
+// DeleteExpiredTokens удаляет из списка токены, истекшие до момента before.
+func (db *Database) DeleteExpiredTokens(ctx context.Context, before time.Time) (int64, error) {
+	res, err := db.DB.ExecContext(ctx, "DELETE FROM revoked_tokens WHERE expires_at <= $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// CreateRefreshToken сохраняет токен обновления, вместо самого токена хранится его хеш.
+func (db *Database) CreateRefreshToken(ctx context.Context, token models.RefreshToken, hash string) error {
+	_, err := db.DB.ExecContext(ctx, `
+		INSERT INTO refresh_tokens (hash, family_id, user_id, registered, expires_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+		hash, token.FamilyID, token.UserID, token.Registered, token.ExpiresAt)
+	return err
+}
+
+// RotateRefreshToken помечает неиспользованный и неистекший токен hash использованным и сохраняет
+// токен next того же семейства и пользователя. Возвращает токен hash в состоянии до вызова.
+func (db *Database) RotateRefreshToken(ctx context.Context, hash string, next models.RefreshToken, nextHash string) (*models.RefreshToken, error) {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Блокировка строки не дает двум одновременным обновлениям обменять один токен дважды.
+	row := tx.QueryRowContext(ctx, `
+		SELECT family_id, user_id, registered, expires_at, rotated
+		FROM refresh_tokens WHERE hash = $1 FOR UPDATE`, hash)
+	previous, err := scanRefreshToken(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if previous.Rotated || !previous.ExpiresAt.After(time.Now()) {
+		return previous, nil
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE refresh_tokens SET rotated = TRUE WHERE hash = $1", hash); err != nil {
+		return nil, err
+	}
+	if _, err = tx.ExecContext(ctx, `
+		INSERT INTO refresh_tokens (hash, family_id, user_id, registered, expires_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+		nextHash, previous.FamilyID, previous.UserID, previous.Registered, next.ExpiresAt); err != nil {
+		return nil, err
+	}
+	return previous, tx.Commit()
+}
+
+// GetRefreshTokenByHash извлекает токен обновления по хешу. Если токена нет, возвращает nil без ошибки.
+func (db *Database) GetRefreshTokenByHash(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	row := db.DB.QueryRowContext(ctx,
+		"SELECT family_id, user_id, registered, expires_at, rotated FROM refresh_tokens WHERE hash = $1", hash)
+	token, err := scanRefreshToken(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return token, err
+}
+
+// DeleteRefreshTokens удаляет все токены семейства familyID.
+func (db *Database) DeleteRefreshTokens(ctx context.Context, familyID string) error {
+	_, err := db.DB.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE family_id = $1", familyID)
+	return err
+}
+
+// DeleteExpiredRefreshTokens удаляет токены, истекшие до момента before.
+func (db *Database) DeleteExpiredRefreshTokens(ctx context.Context, before time.Time) (int64, error) {
+	res, err := db.DB.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE expires_at <= $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// scanRefreshToken читает токен обновления из строки результата запроса.
+func scanRefreshToken(row interface{ Scan(...any) error }) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	if err := row.Scan(&token.FamilyID, &token.UserID, &token.Registered, &token.ExpiresAt, &token.Rotated); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// CreateAPIKey сохраняет API ключ пользователя, вместо самого ключа хранится его хеш.
+func (db *Database) CreateAPIKey(ctx context.Context, key models.APIKey, hash string) (*models.APIKey, error) {
+	name, err := normalizeName(key.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	created := key
+	created.Name = name
+	err = db.DB.QueryRowContext(ctx, `
+		INSERT INTO api_keys (user_id, name, prefix, hash, scopes) VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`,
+		key.UserID, name, key.Prefix, hash, strings.Join(key.Scopes, scopesSeparator)).Scan(&created.ID, &created.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// GetAPIKeys извлекает API ключи пользователя.
+func (db *Database) GetAPIKeys(ctx context.Context, userID string) ([]models.APIKey, error) {
+	rows, err := db.DB.QueryContext(ctx,
+		"SELECT id, user_id, name, prefix, scopes, created_at FROM api_keys WHERE user_id = $1 ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey отзывает API ключ пользователя.
+func (db *Database) RevokeAPIKey(ctx context.Context, userID string, keyID int64) error {
+	res, err := db.DB.ExecContext(ctx, "DELETE FROM api_keys WHERE id = $1 AND user_id = $2", keyID, userID)
+	if err != nil {
+		return err
+	}
+	return checkAffected(res)
+}
+
+// GetAPIKeyByHash извлекает API ключ по хешу. Если ключа нет, возвращает nil без ошибки.
+func (db *Database) GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	row := db.DB.QueryRowContext(ctx,
+		"SELECT id, user_id, name, prefix, scopes, created_at FROM api_keys WHERE hash = $1", hash)
+	key, err := scanAPIKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return key, err
+}
+
+// scanAPIKey читает API ключ из строки результата запроса.
+func scanAPIKey(row interface{ Scan(...any) error }) (*models.APIKey, error) {
+	var key models.APIKey
+	var scopes string
+	if err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &scopes, &key.CreatedAt); err != nil {
+		return nil, err
+	}
+	if scopes != "" {
+		key.Scopes = strings.Split(scopes, scopesSeparator)
+	}
+	return &key, nil
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/vancho-go/url-shortener/internal/app/models"
+)
+
+// SetDefaultQuota задает квоты пользователей, которым администратор не задал свои.
+// Вызывается при создании хранилища, до начала работы с ним.
+func (db *Database) SetDefaultQuota(quota models.Quota) {
+	db.defaultQuota = quota
+}
+
+// GetQuota извлекает квоты пользователя и их текущее использование.
+func (db *Database) GetQuota(ctx context.Context, userID string) (*models.APIQuotaResponse, error) {
+	return db.quotaUsage(ctx, db.DB, userID, time.Now())
+}
+
+// SetUserQuota задает квоты пользователя вместо квот по умолчанию.
+func (db *Database) SetUserQuota(ctx context.Context, userID string, quota models.Quota) error {
+	if err := validateQuota(quota); err != nil {
+		return err
+	}
+	_, err := db.DB.ExecContext(ctx, `
+		INSERT INTO user_quotas (user_id, daily_limit, total_limit) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET daily_limit = EXCLUDED.daily_limit, total_limit = EXCLUDED.total_limit`,
+		userID, quota.Daily, quota.Total)
+	return err
+}
+
+// DeleteUserQuota возвращает пользователю квоты по умолчанию.
+func (db *Database) DeleteUserQuota(ctx context.Context, userID string) error {
+	result, err := db.DB.ExecContext(ctx, "DELETE FROM user_quotas WHERE user_id = $1", userID)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// quotaUsage извлекает квоты пользователя и их использование в момент now.
+// Суточная квота учитывает и удаленные с тех пор URL, общая - только действующие.
+func (db *Database) quotaUsage(ctx context.Context, q execer, userID string, now time.Time) (*models.APIQuotaResponse, error) {
+	day := quotaDay(now)
+	usage := &models.APIQuotaResponse{Limits: db.defaultQuota, ResetAt: day.Add(24 * time.Hour)}
+
+	err := q.QueryRowContext(ctx, "SELECT daily_limit, total_limit FROM user_quotas WHERE user_id = $1", userID).
+		Scan(&usage.Limits.Daily, &usage.Limits.Total)
+	switch {
+	case err == nil:
+		usage.Custom = true
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	}
+
+	err = q.QueryRowContext(ctx, `
+		SELECT
+			count(*) FILTER (WHERE created_at >= $2),
+			count(*) FILTER (WHERE NOT deleted AND (expires_at IS NULL OR expires_at > $3))
+		FROM urls WHERE user_id = $1`, userID, day, now).Scan(&usage.Used.Daily, &usage.Used.Total)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// reserveQuota проверяет, что пользователь может сократить еще n URL. Квоты пользователя блокируются
+// до конца транзакции tx, чтобы параллельные запросы не превысили их.
+func (db *Database) reserveQuota(ctx context.Context, tx *sql.Tx, userID string, n int64) error {
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", userID); err != nil {
+		return err
+	}
+	usage, err := db.quotaUsage(ctx, tx, userID, time.Now())
+	if err != nil {
+		return err
+	}
+	return checkQuota(usage, n)
+}
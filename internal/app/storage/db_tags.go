@@ -0,0 +1,314 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/vancho-go/url-shortener/internal/app/models"
+)
+
+// execer - общий интерфейс *sql.DB и *sql.Tx для вспомогательных запросов.
+type execer interface {
+	ExecContext(context.Context, string, ...any) (sql.Result, error)
+	QueryContext(context.Context, string, ...any) (*sql.Rows, error)
+	QueryRowContext(context.Context, string, ...any) *sql.Row
+}
+
+// checkFolder проверяет, что папка существует и принадлежит пользователю.
+func checkFolder(ctx context.Context, q execer, userID string, folderID int64) error {
+	var exists bool
+	err := q.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM folders WHERE id = $1 AND user_id = $2)",
+		folderID, userID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// attachTags заменяет теги URL, недостающие теги пользователя создаются.
+func attachTags(ctx context.Context, q execer, userID string, urlID int64, names []string) error {
+	names, err := normalizeTags(names)
+	if err != nil {
+		return err
+	}
+
+	if _, err = q.ExecContext(ctx, "DELETE FROM url_tags WHERE url_id = $1", urlID); err != nil {
+		return err
+	}
+	for _, name := range names {
+		var tagID int64
+		err = q.QueryRowContext(ctx, `
+			INSERT INTO tags (user_id, name) VALUES ($1, $2)
+			ON CONFLICT (user_id, name) DO UPDATE SET name = EXCLUDED.name
+			RETURNING id`, userID, name).Scan(&tagID)
+		if err != nil {
+			return err
+		}
+		_, err = q.ExecContext(ctx, "INSERT INTO url_tags (url_id, tag_id) VALUES ($1, $2)", urlID, tagID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getURLsTags извлекает имена тегов для переданных URL.
+func (db *Database) getURLsTags(ctx context.Context, urlIDs []int64) (map[int64][]string, error) {
+	rows, err := db.DB.QueryContext(ctx, `
+		SELECT url_tags.url_id, tags.name FROM url_tags
+		JOIN tags ON tags.id = url_tags.tag_id
+		WHERE url_tags.url_id = ANY($1)
+		ORDER BY tags.name`, urlIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make(map[int64][]string)
+	for rows.Next() {
+		var urlID int64
+		var name string
+		if err = rows.Scan(&urlID, &name); err != nil {
+			return nil, err
+		}
+		tags[urlID] = append(tags[urlID], name)
+	}
+	return tags, rows.Err()
+}
+
+// CreateTag создает тег пользователя.
+func (db *Database) CreateTag(ctx context.Context, userID, name string) (*models.Tag, error) {
+	name, err := normalizeName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	tag := models.Tag{Name: name}
+	err = db.DB.QueryRowContext(ctx,
+		"INSERT INTO tags (user_id, name) VALUES ($1, $2) ON CONFLICT (user_id, name) DO NOTHING RETURNING id",
+		userID, name).Scan(&tag.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAlreadyExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// GetTags извлекает теги пользователя.
+func (db *Database) GetTags(ctx context.Context, userID string) ([]models.Tag, error) {
+	rows, err := db.DB.QueryContext(ctx, "SELECT id, name FROM tags WHERE user_id = $1 ORDER BY name", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []models.Tag
+	for rows.Next() {
+		var tag models.Tag
+		if err = rows.Scan(&tag.ID, &tag.Name); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// RenameTag переименовывает тег пользователя.
+func (db *Database) RenameTag(ctx context.Context, userID string, tagID int64, name string) error {
+	name, err := normalizeName(name)
+	if err != nil {
+		return err
+	}
+
+	res, err := db.DB.ExecContext(ctx, "UPDATE tags SET name = $1 WHERE id = $2 AND user_id = $3", name, tagID, userID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrAlreadyExists
+		}
+		return err
+	}
+	return checkAffected(res)
+}
+
+// DeleteTag удаляет тег пользователя и снимает его со всех URL.
+func (db *Database) DeleteTag(ctx context.Context, userID string, tagID int64) error {
+	res, err := db.DB.ExecContext(ctx, "DELETE FROM tags WHERE id = $1 AND user_id = $2", tagID, userID)
+	if err != nil {
+		return err
+	}
+	return checkAffected(res)
+}
+
+// checkParent проверяет, что родительская папка существует и не является
+// самой папкой или ее потомком.
+func checkParent(ctx context.Context, q execer, userID string, folderID int64, parentID *int64) error {
+	if parentID == nil {
+		return nil
+	}
+	if err := checkFolder(ctx, q, userID, *parentID); err != nil {
+		return err
+	}
+
+	var cycle bool
+	err := q.QueryRowContext(ctx, `
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id FROM folders WHERE id = $1
+			UNION ALL
+			SELECT folders.id, folders.parent_id FROM folders JOIN ancestors ON folders.id = ancestors.parent_id
+		)
+		SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $2)`, *parentID, folderID).Scan(&cycle)
+	if err != nil {
+		return err
+	}
+	if cycle {
+		return ErrFolderCycle
+	}
+	return nil
+}
+
+// CreateFolder создает папку пользователя.
+func (db *Database) CreateFolder(ctx context.Context, userID string, folder models.Folder) (*models.Folder, error) {
+	name, err := normalizeName(folder.Name)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkParent(ctx, db.DB, userID, 0, folder.ParentID); err != nil {
+		return nil, err
+	}
+
+	created := models.Folder{Name: name, ParentID: folder.ParentID}
+	err = db.DB.QueryRowContext(ctx,
+		"INSERT INTO folders (user_id, name, parent_id) VALUES ($1, $2, $3) RETURNING id",
+		userID, name, folder.ParentID).Scan(&created.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// GetFolders извлекает папки пользователя.
+func (db *Database) GetFolders(ctx context.Context, userID string) ([]models.Folder, error) {
+	rows, err := db.DB.QueryContext(ctx, "SELECT id, name, parent_id FROM folders WHERE user_id = $1 ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var folders []models.Folder
+	for rows.Next() {
+		var folder models.Folder
+		var parentID sql.NullInt64
+		if err = rows.Scan(&folder.ID, &folder.Name, &parentID); err != nil {
+			return nil, err
+		}
+		if parentID.Valid {
+			folder.ParentID = &parentID.Int64
+		}
+		folders = append(folders, folder)
+	}
+	return folders, rows.Err()
+}
+
+// UpdateFolder переименовывает или перемещает папку пользователя.
+func (db *Database) UpdateFolder(ctx context.Context, userID string, folder models.Folder) error {
+	name, err := normalizeName(folder.Name)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = checkFolder(ctx, tx, userID, folder.ID); err != nil {
+		return err
+	}
+	if err = checkParent(ctx, tx, userID, folder.ID, folder.ParentID); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE folders SET name = $1, parent_id = $2 WHERE id = $3",
+		name, folder.ParentID, folder.ID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteFolder удаляет папку пользователя вместе с вложенными папками.
+// URL из удаленных папок остаются без папки.
+func (db *Database) DeleteFolder(ctx context.Context, userID string, folderID int64) error {
+	res, err := db.DB.ExecContext(ctx, "DELETE FROM folders WHERE id = $1 AND user_id = $2", folderID, userID)
+	if err != nil {
+		return err
+	}
+	return checkAffected(res)
+}
+
+// SetURLTags заменяет теги URL пользователя, недостающие теги создаются.
+func (db *Database) SetURLTags(ctx context.Context, userID, shortenURL string, names []string) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var urlID int64
+	err = tx.QueryRowContext(ctx, "SELECT id FROM urls WHERE shorten_url = $1 AND user_id = $2",
+		shortenURL, userID).Scan(&urlID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = attachTags(ctx, tx, userID, urlID, names); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MoveURL перемещает URL пользователя в папку (nil - убрать из папки).
+func (db *Database) MoveURL(ctx context.Context, userID, shortenURL string, folderID *int64) error {
+	if folderID != nil {
+		if err := checkFolder(ctx, db.DB, userID, *folderID); err != nil {
+			return err
+		}
+	}
+
+	res, err := db.DB.ExecContext(ctx, "UPDATE urls SET folder_id = $1 WHERE shorten_url = $2 AND user_id = $3",
+		folderID, shortenURL, userID)
+	if err != nil {
+		return err
+	}
+	return checkAffected(res)
+}
+
+// checkAffected возвращает ErrNotFound, если запрос не затронул ни одной строки.
+func checkAffected(res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// isUniqueViolation проверяет является ли ошибка UniqueViolation.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation
+}
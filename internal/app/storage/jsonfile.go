@@ -6,6 +6,7 @@ import (
 	"errors"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/vancho-go/url-shortener/internal/app/models"
 )
@@ -14,10 +15,18 @@ import (
 type Data struct {
 	ShortURL    string `json:"short_url"`
 	OriginalURL string `json:"original_url"`
+	UserID      string `json:"user_id,omitempty"`
+	// CreatedAt - время добавления URL. В записях, сохраненных до его появления, нулевое.
+	CreatedAt time.Time `json:"created_at"`
+	// ExpiresAt - срок действия URL (nil - бессрочный).
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
 }
 
 // EncoderDecoder объект, реализующий интерфейс storage.
 type EncoderDecoder struct {
+	*organizer
+	*accounts
+	*moderation
 	file    *os.File
 	storage map[string]string
 	encoder *json.Encoder
@@ -26,18 +35,41 @@ type EncoderDecoder struct {
 }
 
 // NewEncoderDecoder конструктор EncoderDecoder объекта.
+// Теги и папки хранятся рядом с основным файлом, в файле с суффиксом .meta,
+// учетные данные пользователей - в файле с суффиксом .accounts, жалобы и блокировки URL - в файле с суффиксом .moderation.
 func NewEncoderDecoder(filename string) (*EncoderDecoder, error) {
 	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 	if err != nil {
 		return nil, err
 	}
 
+	o, err := newOrganizer(filename + ".meta")
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	a, err := newAccounts(filename + ".accounts")
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	m, err := newModeration(filename + ".moderation")
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
 	return &EncoderDecoder{
-		file:    file,
-		storage: make(map[string]string),
-		encoder: json.NewEncoder(file),
-		decoder: json.NewDecoder(file),
-		mu:      sync.Mutex{},
+		organizer:  o,
+		accounts:   a,
+		moderation: m,
+		file:       file,
+		storage:    make(map[string]string),
+		encoder:    json.NewEncoder(file),
+		decoder:    json.NewDecoder(file),
+		mu:         sync.Mutex{},
 	}, nil
 }
 
@@ -51,18 +83,59 @@ func (ed *EncoderDecoder) Initialize() error {
 			return err
 		}
 		ed.storage[data.ShortURL] = data.OriginalURL
+		ed.restoreOwner(data.ShortURL, data.UserID, data.CreatedAt, data.ExpiresAt)
 	}
 	return nil
 }
 
+// MergeUserURLs переносит URL, теги, папки и API ключи пользователя from пользователю to.
+func (ed *EncoderDecoder) MergeUserURLs(ctx context.Context, from, to string) (int64, error) {
+	merged, err := ed.organizer.mergeUser(from, to)
+	if err != nil {
+		return 0, err
+	}
+	return merged, ed.accounts.mergeUser(from, to)
+}
+
+// GetAllURLs извлекает страницу URL всех пользователей.
+func (ed *EncoderDecoder) GetAllURLs(ctx context.Context, filter models.UserURLsFilter) (*models.UserURLsPage, error) {
+	return nil, errors.New("method not implemented for this type of storage")
+}
+
+// GetUserStats извлекает статистику URL пользователя.
+func (ed *EncoderDecoder) GetUserStats(ctx context.Context, userID string) (*models.APIUserStatsResponse, error) {
+	return nil, errors.New("method not implemented for this type of storage")
+}
+
+// SetURLDisabled блокирует или разблокирует URL любого пользователя, при блокировке с причиной reason.
+// Разблокировка закрывает жалобы на URL как рассмотренные.
+func (ed *EncoderDecoder) SetURLDisabled(ctx context.Context, shortenURL string, disabled bool, reason string) error {
+	if ed.IsShortenUnique(ctx, shortenURL) {
+		return ErrNotFound
+	}
+	return ed.setDisabled(shortenURL, disabled, reason)
+}
+
+// AddAbuseReport сохраняет жалобу на URL, повторная жалоба того же автора или из той же сети не учитывается.
+// Если нерассмотренных жалоб разных авторов набралось не меньше threshold (0 - не блокировать),
+// URL блокируется с причиной models.DisabledReasonAbuse. Возвращает количество нерассмотренных жалоб.
+func (ed *EncoderDecoder) AddAbuseReport(ctx context.Context, report models.AbuseReport, threshold int64) (int64, error) {
+	if ed.IsShortenUnique(ctx, report.ShortenURL) {
+		return 0, ErrNotFound
+	}
+	return ed.addReport(report, threshold)
+}
+
 // Close закрывает хранилище.
 func (ed *EncoderDecoder) Close() error {
 	return ed.file.Close()
 }
 
-// GetUserURLs извлекает URL из хранилища для конкретного пользователя.
-func (ed *EncoderDecoder) GetUserURLs(ctx context.Context, userID string) ([]models.APIUserURLResponse, error) {
-	return nil, errors.New("method not implemented for this type of storage")
+// GetUserURLs извлекает страницу URL из хранилища для конкретного пользователя.
+func (ed *EncoderDecoder) GetUserURLs(ctx context.Context, userID string, filter models.UserURLsFilter) (*models.UserURLsPage, error) {
+	ed.mu.Lock()
+	defer ed.mu.Unlock()
+	return ed.listURLs(userID, ed.storage, filter)
 }
 
 // DeleteUserURLs удаляет URL из хранилища для конкретного пользователя.
@@ -70,18 +143,50 @@ func (ed *EncoderDecoder) DeleteUserURLs(ctx context.Context, urlsToDelete ...mo
 	return errors.New("method not implemented for this type of storage")
 }
 
-// AddURLs сохраняет batch оригинальных и сокращенных URL в хранилище.
+// AddURLs сохраняет batch оригинальных и сокращенных URL в хранилище вместе с их тегами и папками.
+// Пачка сохраняется целиком или не сохраняется вовсе, в том числе при нехватке квоты.
 func (ed *EncoderDecoder) AddURLs(ctx context.Context, userID string, urls ...models.APIBatchRequest) error {
-	return errors.New("method not implemented for this type of storage")
+	if len(urls) == 0 {
+		return nil
+	}
+	ed.mu.Lock()
+	defer ed.mu.Unlock()
+	for _, url := range urls {
+		if _, ok := ed.storage[url.ShortenURL]; ok {
+			return ErrAliasTaken
+		}
+	}
+	if err := ed.checkNewURLs(userID, urls); err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := ed.reserveQuota(userID, ed.countOwned(userID), int64(len(urls)), now); err != nil {
+		return err
+	}
+	for _, url := range urls {
+		data := &Data{ShortURL: url.ShortenURL, OriginalURL: url.OriginalURL, UserID: userID, CreatedAt: now, ExpiresAt: url.ExpiresAt}
+		if err := ed.encoder.Encode(data); err != nil {
+			return err
+		}
+		ed.storage[url.ShortenURL] = url.OriginalURL
+	}
+	return ed.addURLs(userID, urls, now)
 }
 
-// AddURL сохраняет оригинальный и сокращенный URL в хранилище.
+// AddURL сохраняет оригинальный и сокращенный URL в хранилище, если пользователю хватает квоты.
 func (ed *EncoderDecoder) AddURL(ctx context.Context, originalURL, shortenURL, userID string) error {
-	data := &Data{ShortURL: shortenURL, OriginalURL: originalURL}
+	data := &Data{ShortURL: shortenURL, OriginalURL: originalURL, UserID: userID, CreatedAt: time.Now()}
 	ed.mu.Lock()
-	ed.storage[shortenURL] = originalURL
 	defer ed.mu.Unlock()
-	return ed.encoder.Encode(&data)
+	if err := ed.reserveQuota(userID, ed.countOwned(userID), 1, time.Now()); err != nil {
+		return err
+	}
+	ed.storage[shortenURL] = originalURL
+	if err := ed.encoder.Encode(&data); err != nil {
+		return err
+	}
+	ed.setOwner(shortenURL, userID, data.CreatedAt)
+	return nil
 }
 
 // GetURL извлекает сокращенный URL для переданного оригинального URL из хранилища.
@@ -92,15 +197,28 @@ func (ed *EncoderDecoder) GetURL(ctx context.Context, shortenURL string) (string
 	if !ok {
 		return "", errors.New("no such shorten URL")
 	}
+	if err := ed.checkExpired(shortenURL, time.Now()); err != nil {
+		return "", err
+	}
+	if err := ed.checkDisabled(shortenURL); err != nil {
+		return "", err
+	}
 	return originalURL, nil
 }
 
 // IsShortenUnique проверяет сокращенный URL на уникальность.
 func (ed *EncoderDecoder) IsShortenUnique(ctx context.Context, shortenURL string) bool {
+	ed.mu.Lock()
+	defer ed.mu.Unlock()
 	_, ok := ed.storage[shortenURL]
 	return !ok
 }
 
+// GetQuota извлекает квоты пользователя и их текущее использование.
+func (ed *EncoderDecoder) GetQuota(ctx context.Context, userID string) (*models.APIQuotaResponse, error) {
+	return ed.quotaUsage(userID, ed.countOwned(userID), time.Now()), nil
+}
+
 // GetStats извлекает статистику хранилища.
 func (ed *EncoderDecoder) GetStats(ctx context.Context) (*models.APIStatsResponse, error) {
 	return nil, errors.New("method not implemented for this type of storage")
@@ -3,55 +3,153 @@ package storage
 import (
 	"context"
 	"errors"
+	"sync"
+	"time"
 
 	"github.com/vancho-go/url-shortener/internal/app/models"
 )
 
 // MapDB - key-value хранилище для URL.
-type MapDB map[string]string
+type MapDB struct {
+	*organizer
+	*accounts
+	*moderation
+	mu   sync.RWMutex
+	urls map[string]string
+}
+
+// NewMapDB конструктор MapDB.
+func NewMapDB() *MapDB {
+	o, _ := newOrganizer("")
+	a, _ := newAccounts("")
+	m, _ := newModeration("")
+	return &MapDB{organizer: o, accounts: a, moderation: m, urls: make(map[string]string)}
+}
 
-// AddURL сохраняет оригинальный и сокращенный URL в хранилище.
-func (storage MapDB) AddURL(ctx context.Context, originalURL, shortenURL, userID string) error {
-	storage[shortenURL] = originalURL
+// AddURL сохраняет оригинальный и сокращенный URL в хранилище, если пользователю хватает квоты.
+func (storage *MapDB) AddURL(ctx context.Context, originalURL, shortenURL, userID string) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	if err := storage.reserveQuota(userID, storage.countOwned(userID), 1, time.Now()); err != nil {
+		return err
+	}
+	storage.urls[shortenURL] = originalURL
+	storage.setOwner(shortenURL, userID, time.Now())
 	return nil
 }
 
+// GetQuota извлекает квоты пользователя и их текущее использование.
+func (storage *MapDB) GetQuota(ctx context.Context, userID string) (*models.APIQuotaResponse, error) {
+	return storage.quotaUsage(userID, storage.countOwned(userID), time.Now()), nil
+}
+
 // GetURL извлекает сокращенный URL для переданного оригинального URL из хранилища.
-func (storage MapDB) GetURL(ctx context.Context, shortenURL string) (string, error) {
-	originalURL, ok := storage[shortenURL]
+func (storage *MapDB) GetURL(ctx context.Context, shortenURL string) (string, error) {
+	storage.mu.RLock()
+	defer storage.mu.RUnlock()
+	originalURL, ok := storage.urls[shortenURL]
 	if !ok {
 		return "", errors.New("no such shorten URL")
 	}
+	if err := storage.checkExpired(shortenURL, time.Now()); err != nil {
+		return "", err
+	}
+	if err := storage.checkDisabled(shortenURL); err != nil {
+		return "", err
+	}
 	return originalURL, nil
 }
 
 // IsShortenUnique проверяет сокращенный URL на уникальность.
-func (storage MapDB) IsShortenUnique(ctx context.Context, shortenURL string) bool {
-	_, ok := storage[shortenURL]
+func (storage *MapDB) IsShortenUnique(ctx context.Context, shortenURL string) bool {
+	storage.mu.RLock()
+	defer storage.mu.RUnlock()
+	_, ok := storage.urls[shortenURL]
 	return !ok
 }
 
-// GetUserURLs извлекает URL из хранилища для конкретного пользователя.
-func (storage MapDB) GetUserURLs(ctx context.Context, userID string) ([]models.APIUserURLResponse, error) {
-	return nil, errors.New("method not implemented for this type of storage")
+// GetUserURLs извлекает страницу URL из хранилища для конкретного пользователя.
+func (storage *MapDB) GetUserURLs(ctx context.Context, userID string, filter models.UserURLsFilter) (*models.UserURLsPage, error) {
+	storage.mu.RLock()
+	defer storage.mu.RUnlock()
+	return storage.listURLs(userID, storage.urls, filter)
 }
 
 // DeleteUserURLs удаляет URL из хранилища для конкретного пользователя.
-func (storage MapDB) DeleteUserURLs(ctx context.Context, urlsToDelete ...models.DeleteURLRequest) error {
+func (storage *MapDB) DeleteUserURLs(ctx context.Context, urlsToDelete ...models.DeleteURLRequest) error {
 	return errors.New("method not implemented for this type of storage")
 }
 
-// AddURLs сохраняет batch оригинальных и сокращенных URL в хранилище.
-func (storage MapDB) AddURLs(ctx context.Context, userID string, urls ...models.APIBatchRequest) error {
-	return errors.New("method not implemented for this type of storage")
+// AddURLs сохраняет batch оригинальных и сокращенных URL в хранилище вместе с их тегами и папками.
+// Пачка сохраняется целиком или не сохраняется вовсе, в том числе при нехватке квоты.
+func (storage *MapDB) AddURLs(ctx context.Context, userID string, urls ...models.APIBatchRequest) error {
+	if len(urls) == 0 {
+		return nil
+	}
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	for _, url := range urls {
+		if _, ok := storage.urls[url.ShortenURL]; ok {
+			return ErrAliasTaken
+		}
+	}
+	if err := storage.checkNewURLs(userID, urls); err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := storage.reserveQuota(userID, storage.countOwned(userID), int64(len(urls)), now); err != nil {
+		return err
+	}
+	for _, url := range urls {
+		storage.urls[url.ShortenURL] = url.OriginalURL
+	}
+	return storage.addURLs(userID, urls, now)
 }
 
 // GetStats извлекает статистику хранилища.
-func (storage MapDB) GetStats(ctx context.Context) (*models.APIStatsResponse, error) {
+func (storage *MapDB) GetStats(ctx context.Context) (*models.APIStatsResponse, error) {
 	return nil, errors.New("method not implemented for this type of storage")
 }
 
+// MergeUserURLs переносит URL, теги, папки и API ключи пользователя from пользователю to.
+func (storage *MapDB) MergeUserURLs(ctx context.Context, from, to string) (int64, error) {
+	merged, err := storage.organizer.mergeUser(from, to)
+	if err != nil {
+		return 0, err
+	}
+	return merged, storage.accounts.mergeUser(from, to)
+}
+
+// GetAllURLs извлекает страницу URL всех пользователей.
+func (storage *MapDB) GetAllURLs(ctx context.Context, filter models.UserURLsFilter) (*models.UserURLsPage, error) {
+	return nil, errors.New("method not implemented for this type of storage")
+}
+
+// GetUserStats извлекает статистику URL пользователя.
+func (storage *MapDB) GetUserStats(ctx context.Context, userID string) (*models.APIUserStatsResponse, error) {
+	return nil, errors.New("method not implemented for this type of storage")
+}
+
+// SetURLDisabled блокирует или разблокирует URL любого пользователя, при блокировке с причиной reason.
+// Разблокировка закрывает жалобы на URL как рассмотренные.
+func (storage *MapDB) SetURLDisabled(ctx context.Context, shortenURL string, disabled bool, reason string) error {
+	if storage.IsShortenUnique(ctx, shortenURL) {
+		return ErrNotFound
+	}
+	return storage.setDisabled(shortenURL, disabled, reason)
+}
+
+// AddAbuseReport сохраняет жалобу на URL, повторная жалоба того же автора или из той же сети не учитывается.
+// Если нерассмотренных жалоб разных авторов набралось не меньше threshold (0 - не блокировать),
+// URL блокируется с причиной models.DisabledReasonAbuse. Возвращает количество нерассмотренных жалоб.
+func (storage *MapDB) AddAbuseReport(ctx context.Context, report models.AbuseReport, threshold int64) (int64, error) {
+	if storage.IsShortenUnique(ctx, report.ShortenURL) {
+		return 0, ErrNotFound
+	}
+	return storage.addReport(report, threshold)
+}
+
 // Close закрывает хранилище.
-func (storage MapDB) Close() error {
+func (storage *MapDB) Close() error {
 	return nil
 }
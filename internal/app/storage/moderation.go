@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/vancho-go/url-shortener/internal/app/models"
+)
+
+// moderation хранит в памяти жалобы на URL и блокировки URL.
+// Используется in-memory и файловым хранилищами. Если задан path,
+// состояние сохраняется в файл после каждого изменения.
+type moderation struct {
+	mu    sync.RWMutex
+	path  string
+	state moderationState
+}
+
+// moderationState - сериализуемое состояние moderation.
+type moderationState struct {
+	NextID int64 `json:"next_id"`
+	// Reports - жалобы в порядке поступления.
+	Reports []models.AbuseReport `json:"reports"`
+	// Disabled - причины блокировки заблокированных URL.
+	Disabled map[string]string `json:"disabled"`
+}
+
+// newModeration конструктор moderation. Если path не пустой, состояние загружается из файла.
+func newModeration(path string) (*moderation, error) {
+	m := &moderation{
+		path: path,
+		state: moderationState{
+			NextID:   1,
+			Disabled: make(map[string]string),
+		},
+	}
+	if path == "" {
+		return m, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &m.state); err != nil {
+		return nil, err
+	}
+	if m.state.Disabled == nil {
+		m.state.Disabled = make(map[string]string)
+	}
+	return m, nil
+}
+
+// save сохраняет состояние в файл. Вызывается под блокировкой.
+func (m *moderation) save() error {
+	if m.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(&m.state)
+	if err != nil {
+		return err
+	}
+	tmp := m.path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.path)
+}
+
+// checkDisabled возвращает ErrAbusiveURL или ErrDisabledURL, если URL заблокирован.
+func (m *moderation) checkDisabled(shortenURL string) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	reason, ok := m.state.Disabled[shortenURL]
+	switch {
+	case !ok:
+		return nil
+	case reason == models.DisabledReasonAbuse:
+		return ErrAbusiveURL
+	default:
+		return ErrDisabledURL
+	}
+}
+
+// setDisabled блокирует URL с причиной reason или разблокирует его.
+// Разблокировка закрывает жалобы на URL как рассмотренные.
+func (m *moderation) setDisabled(shortenURL string, disabled bool, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if disabled {
+		m.state.Disabled[shortenURL] = reason
+		return m.save()
+	}
+	delete(m.state.Disabled, shortenURL)
+	for i := range m.state.Reports {
+		if m.state.Reports[i].ShortenURL == shortenURL {
+			m.state.Reports[i].Resolved = true
+		}
+	}
+	return m.save()
+}
+
+// addReport сохраняет жалобу на существующий URL, повторная жалоба того же автора или из той же сети не учитывается.
+// Если нерассмотренных жалоб разных авторов набралось не меньше threshold (0 - не блокировать),
+// URL блокируется с причиной models.DisabledReasonAbuse. Возвращает количество нерассмотренных жалоб.
+func (m *moderation) addReport(report models.AbuseReport, threshold int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var count int64
+	duplicate := false
+	for _, r := range m.state.Reports {
+		if r.ShortenURL == report.ShortenURL && !r.Resolved {
+			count++
+			duplicate = duplicate || r.Reporter == report.Reporter || r.Network == report.Network
+		}
+	}
+	if !duplicate {
+		report.ID = m.state.NextID
+		m.state.NextID++
+		report.Resolved = false
+		report.CreatedAt = time.Now().UTC()
+		m.state.Reports = append(m.state.Reports, report)
+		count++
+	}
+	if threshold > 0 && count >= threshold {
+		m.state.Disabled[report.ShortenURL] = models.DisabledReasonAbuse
+	}
+	return count, m.save()
+}
+
+// GetAbuseReports извлекает жалобы, новые первыми.
+func (m *moderation) GetAbuseReports(ctx context.Context, filter models.AbuseReportsFilter) ([]models.AbuseReport, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultAbuseReportsLimit
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	reports := make([]models.AbuseReport, 0)
+	for i := len(m.state.Reports) - 1; i >= 0 && len(reports) < limit; i-- {
+		report := m.state.Reports[i]
+		if report.Resolved != filter.Resolved || (filter.ShortenURL != "" && report.ShortenURL != filter.ShortenURL) {
+			continue
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vancho-go/url-shortener/internal/app/models"
+)
+
+func TestEncoderDecoderAbuseReports(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "db.json")
+	db, err := NewEncoderDecoder(path)
+	require.NoError(t, err)
+	require.NoError(t, db.AddURL(ctx, "https://ya.ru", "abc", "owner"))
+
+	_, err = db.AddAbuseReport(ctx, models.AbuseReport{ShortenURL: "unknown", Reporter: "ip:10.0.0.1", Network: "10.0.0.1"}, 2)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Повторная жалоба того же автора или из той же сети не учитывается, вторая независимая блокирует URL.
+	for _, report := range []models.AbuseReport{
+		{Reporter: "ip:10.0.0.1", Network: "10.0.0.1"},
+		{Reporter: "ip:10.0.0.1", Network: "10.0.0.1"},
+		{Reporter: "user:other", Network: "10.0.0.1"},
+	} {
+		report.ShortenURL, report.Reason = "abc", "phishing"
+		count, err := db.AddAbuseReport(ctx, report, 2)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+	}
+	_, err = db.AddAbuseReport(ctx, models.AbuseReport{ShortenURL: "abc", Reporter: "user:user", Network: "10.0.0.2"}, 2)
+	require.NoError(t, err)
+	_, err = db.GetURL(ctx, "abc")
+	assert.ErrorIs(t, err, ErrAbusiveURL)
+	require.NoError(t, db.Close())
+
+	// Жалобы и блокировка переживают перезапуск.
+	db, err = NewEncoderDecoder(path)
+	require.NoError(t, err)
+	require.NoError(t, db.Initialize())
+	defer db.Close()
+	_, err = db.GetURL(ctx, "abc")
+	assert.ErrorIs(t, err, ErrAbusiveURL)
+	reports, err := db.GetAbuseReports(ctx, models.AbuseReportsFilter{})
+	require.NoError(t, err)
+	require.Len(t, reports, 2)
+	assert.Equal(t, "user:user", reports[0].Reporter)
+	reports, err = db.GetAbuseReports(ctx, models.AbuseReportsFilter{ShortenURL: "abc", Limit: 1})
+	require.NoError(t, err)
+	assert.Len(t, reports, 1)
+
+	// Разблокировка закрывает жалобы.
+	assert.ErrorIs(t, db.SetURLDisabled(ctx, "unknown", false, ""), ErrNotFound)
+	require.NoError(t, db.SetURLDisabled(ctx, "abc", false, ""))
+	originalURL, err := db.GetURL(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://ya.ru", originalURL)
+	reports, err = db.GetAbuseReports(ctx, models.AbuseReportsFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, reports)
+	reports, err = db.GetAbuseReports(ctx, models.AbuseReportsFilter{Resolved: true})
+	require.NoError(t, err)
+	assert.Len(t, reports, 2)
+
+	require.NoError(t, db.SetURLDisabled(ctx, "abc", true, ""))
+	_, err = db.GetURL(ctx, "abc")
+	assert.ErrorIs(t, err, ErrDisabledURL)
+	assert.NotErrorIs(t, err, ErrAbusiveURL)
+}
@@ -3,6 +3,8 @@ package storage
 import (
 	"context"
 	"errors"
+	"time"
+
 	"github.com/vancho-go/url-shortener/internal/app/config"
 	"github.com/vancho-go/url-shortener/internal/app/handlers/http/middlewares"
 	"github.com/vancho-go/url-shortener/internal/app/models"
@@ -24,8 +26,8 @@ type URLStorager interface {
 
 // UserStorager реализует методы для работы с пользователями.
 type UserStorager interface {
-	// GetUserURLs извлекает URL из хранилища для конкретного пользователя.
-	GetUserURLs(context.Context, string) ([]models.APIUserURLResponse, error)
+	// GetUserURLs извлекает страницу URL из хранилища для конкретного пользователя.
+	GetUserURLs(context.Context, string, models.UserURLsFilter) (*models.UserURLsPage, error)
 	// DeleteUserURLs удаляет URL из хранилища для конкретного пользователя.
 	DeleteUserURLs(context.Context, ...models.DeleteURLRequest) error
 }
@@ -36,15 +38,116 @@ type StatsStorager interface {
 	GetStats(context.Context) (*models.APIStatsResponse, error)
 }
 
+// TagStorager реализует методы для работы с тегами и папками пользователя.
+type TagStorager interface {
+	// CreateTag создает тег пользователя.
+	CreateTag(context.Context, string, string) (*models.Tag, error)
+	// GetTags извлекает теги пользователя.
+	GetTags(context.Context, string) ([]models.Tag, error)
+	// RenameTag переименовывает тег пользователя.
+	RenameTag(context.Context, string, int64, string) error
+	// DeleteTag удаляет тег пользователя и снимает его со всех URL.
+	DeleteTag(context.Context, string, int64) error
+	// CreateFolder создает папку пользователя.
+	CreateFolder(context.Context, string, models.Folder) (*models.Folder, error)
+	// GetFolders извлекает папки пользователя.
+	GetFolders(context.Context, string) ([]models.Folder, error)
+	// UpdateFolder переименовывает или перемещает папку пользователя.
+	UpdateFolder(context.Context, string, models.Folder) error
+	// DeleteFolder удаляет папку пользователя вместе с вложенными папками.
+	DeleteFolder(context.Context, string, int64) error
+	// SetURLTags заменяет теги URL пользователя, недостающие теги создаются.
+	SetURLTags(context.Context, string, string, []string) error
+	// MoveURL перемещает URL пользователя в папку (nil - убрать из папки).
+	MoveURL(context.Context, string, string, *int64) error
+}
+
+// APIKeyStorager реализует методы для работы с API ключами пользователя.
+type APIKeyStorager interface {
+	// CreateAPIKey сохраняет API ключ пользователя, вместо самого ключа хранится его хеш.
+	CreateAPIKey(context.Context, models.APIKey, string) (*models.APIKey, error)
+	// GetAPIKeys извлекает API ключи пользователя.
+	GetAPIKeys(context.Context, string) ([]models.APIKey, error)
+	// RevokeAPIKey отзывает API ключ пользователя.
+	RevokeAPIKey(context.Context, string, int64) error
+	// GetAPIKeyByHash извлекает API ключ по хешу. Если ключа нет, возвращает nil без ошибки.
+	GetAPIKeyByHash(context.Context, string) (*models.APIKey, error)
+}
+
+// AccountStorager реализует методы для работы с учетными записями пользователей.
+type AccountStorager interface {
+	// CreateAccount создает учетную запись, вместо пароля хранится его хеш.
+	CreateAccount(context.Context, models.Account, string) (*models.Account, error)
+	// GetAccountByEmail извлекает учетную запись и хеш ее пароля по email.
+	GetAccountByEmail(context.Context, string) (*models.Account, string, error)
+	// MergeUserURLs переносит URL, теги, папки и API ключи одного пользователя другому.
+	// Возвращает количество перенесенных URL.
+	MergeUserURLs(context.Context, string, string) (int64, error)
+}
+
+// AdminStorager реализует методы администрирования URL всех пользователей.
+type AdminStorager interface {
+	// GetAllURLs извлекает страницу URL всех пользователей.
+	GetAllURLs(context.Context, models.UserURLsFilter) (*models.UserURLsPage, error)
+	// GetUserStats извлекает статистику URL пользователя.
+	GetUserStats(context.Context, string) (*models.APIUserStatsResponse, error)
+	// SetURLDisabled блокирует или разблокирует URL любого пользователя, при блокировке с причиной
+	// (см. models.DisabledReasonAbuse). Разблокировка закрывает жалобы на URL как рассмотренные.
+	SetURLDisabled(context.Context, string, bool, string) error
+}
+
+// AbuseStorager реализует методы для работы с жалобами на сокращенные URL.
+type AbuseStorager interface {
+	// AddAbuseReport сохраняет жалобу на URL, повторная жалоба того же автора или из той же сети не учитывается.
+	// Если нерассмотренных жалоб разных авторов набралось не меньше порога (0 - не блокировать),
+	// URL блокируется с причиной models.DisabledReasonAbuse. Возвращает количество нерассмотренных жалоб.
+	AddAbuseReport(context.Context, models.AbuseReport, int64) (int64, error)
+	// GetAbuseReports извлекает жалобы, новые первыми.
+	GetAbuseReports(context.Context, models.AbuseReportsFilter) ([]models.AbuseReport, error)
+}
+
+// RevocationStorager реализует методы для работы со списком отозванных токенов.
+type RevocationStorager interface {
+	// RevokeToken добавляет токен в список отозванных до момента его истечения.
+	RevokeToken(context.Context, string, time.Time) error
+	// GetRevokedTokens извлекает неистекшие отозванные токены.
+	GetRevokedTokens(context.Context) (map[string]time.Time, error)
+	// DeleteExpiredTokens удаляет из списка токены, истекшие до переданного момента.
+	DeleteExpiredTokens(context.Context, time.Time) (int64, error)
+}
+
+// RefreshTokenStorager реализует методы для работы с токенами обновления сессий.
+type RefreshTokenStorager interface {
+	// CreateRefreshToken сохраняет токен обновления, вместо самого токена хранится его хеш.
+	CreateRefreshToken(context.Context, models.RefreshToken, string) error
+	// RotateRefreshToken помечает токен использованным и сохраняет следующий токен его семейства.
+	RotateRefreshToken(context.Context, string, models.RefreshToken, string) (*models.RefreshToken, error)
+	// GetRefreshTokenByHash извлекает токен обновления по хешу. Если токена нет, возвращает nil без ошибки.
+	GetRefreshTokenByHash(context.Context, string) (*models.RefreshToken, error)
+	// DeleteRefreshTokens удаляет все токены семейства.
+	DeleteRefreshTokens(context.Context, string) error
+	// DeleteExpiredRefreshTokens удаляет токены, истекшие до переданного момента.
+	DeleteExpiredRefreshTokens(context.Context, time.Time) (int64, error)
+}
+
 // Storager реализует методы для работы с пользователями и URL.
 type Storager interface {
 	URLStorager
 	UserStorager
 	StatsStorager
+	TagStorager
+	APIKeyStorager
+	AccountStorager
+	AdminStorager
+	RevocationStorager
+	RefreshTokenStorager
+	QuotaStorager
+	AbuseStorager
 }
 
-// New создает новое хранилище.
+// New создает новое хранилище с квотами пользователей по умолчанию из конфигурации.
 func New(serverConfig config.ServerConfig) (Storager, error) {
+	quota := models.Quota{Daily: serverConfig.QuotaDaily, Total: serverConfig.QuotaTotal}
 	switch {
 	case serverConfig.DBDSN != "":
 		middlewares.Log.Info("Initializing postgres storage")
@@ -52,6 +155,7 @@ func New(serverConfig config.ServerConfig) (Storager, error) {
 		if err != nil {
 			return nil, errors.New("error Postgres DB initializing")
 		}
+		db.SetDefaultQuota(quota)
 		return db, nil
 
 	case serverConfig.FileStorage != "":
@@ -65,10 +169,13 @@ func New(serverConfig config.ServerConfig) (Storager, error) {
 		if err != nil {
 			return nil, errors.New("error in FileStorage initializing")
 		}
+		dbInstance.SetDefaultQuota(quota)
 		return dbInstance, nil
 
 	default:
 		middlewares.Log.Info("Initializing in-memory storage")
-		return MapDB{}, nil
+		db := NewMapDB()
+		db.SetDefaultQuota(quota)
+		return db, nil
 	}
 }
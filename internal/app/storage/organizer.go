@@ -0,0 +1,615 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vancho-go/url-shortener/internal/app/models"
+)
+
+// organizer хранит в памяти владельцев URL, теги и папки пользователей.
+// Используется in-memory и файловым хранилищами. Если задан path,
+// состояние сохраняется в файл после каждого изменения тегов, папок или владельцев при переносе URL.
+// Владелец нового URL в файл состояния не пишется: файловое хранилище сохраняет его вместе с URL.
+type organizer struct {
+	mu    sync.RWMutex
+	path  string
+	state organizerState
+	// added - порядок и время добавления URL для постраничной выдачи. В файл состояния не пишется:
+	// файловое хранилище восстанавливает его из своих записей.
+	added map[string]addedURL
+}
+
+// addedURL - позиция URL в порядке добавления и срок его действия (nil - бессрочный).
+type addedURL struct {
+	seq       int64
+	createdAt time.Time
+	expiresAt *time.Time
+}
+
+// organizerState - сериализуемое состояние organizer.
+type organizerState struct {
+	NextID    int64                  `json:"next_id"`
+	Owners    map[string]string      `json:"owners"`
+	Tags      map[int64]storedTag    `json:"tags"`
+	Folders   map[int64]storedFolder `json:"folders"`
+	URLTags   map[string][]int64     `json:"url_tags"`
+	URLFolder map[string]int64       `json:"url_folder"`
+}
+
+type storedTag struct {
+	UserID string `json:"user_id"`
+	Name   string `json:"name"`
+}
+
+type storedFolder struct {
+	UserID   string `json:"user_id"`
+	Name     string `json:"name"`
+	ParentID *int64 `json:"parent_id,omitempty"`
+}
+
+// newOrganizer конструктор organizer. Если path не пустой, состояние загружается из файла.
+func newOrganizer(path string) (*organizer, error) {
+	o := &organizer{
+		path: path,
+		state: organizerState{
+			NextID:    1,
+			Owners:    make(map[string]string),
+			Tags:      make(map[int64]storedTag),
+			Folders:   make(map[int64]storedFolder),
+			URLTags:   make(map[string][]int64),
+			URLFolder: make(map[string]int64),
+		},
+		added: make(map[string]addedURL),
+	}
+	if path == "" {
+		return o, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return o, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &o.state); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// save сохраняет состояние в файл. Вызывается под блокировкой.
+func (o *organizer) save() error {
+	if o.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(&o.state)
+	if err != nil {
+		return err
+	}
+	tmp := o.path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, o.path)
+}
+
+// nextID выдает идентификатор для нового тега или папки. Вызывается под блокировкой.
+func (o *organizer) nextID() int64 {
+	id := o.state.NextID
+	o.state.NextID++
+	return id
+}
+
+// setOwner запоминает владельца и время добавления нового URL. Состояние в файл не сохраняется: иначе каждое
+// добавление URL переписывало бы файл целиком и массовое добавление становилось бы квадратичным.
+func (o *organizer) setOwner(shortenURL, userID string, createdAt time.Time) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.state.Owners[shortenURL] = userID
+	o.addURL(shortenURL, createdAt, nil)
+}
+
+// restoreOwner восстанавливает владельца, время добавления и срок действия URL из записи файлового хранилища.
+// Владелец из файла состояния приоритетнее: он меняется при переносе URL в учетную запись.
+func (o *organizer) restoreOwner(shortenURL, userID string, createdAt time.Time, expiresAt *time.Time) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, ok := o.state.Owners[shortenURL]; !ok && userID != "" {
+		o.state.Owners[shortenURL] = userID
+	}
+	o.addURL(shortenURL, createdAt, expiresAt)
+}
+
+// checkNewURLs проверяет теги и папки новых URL пользователя до их сохранения (см. CheckOrganize).
+func (o *organizer) checkNewURLs(userID string, urls []models.APIBatchRequest) error {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	for _, url := range urls {
+		if _, err := normalizeTags(url.Tags); err != nil {
+			return err
+		}
+		if url.FolderID != nil {
+			if folder, ok := o.state.Folders[*url.FolderID]; !ok || folder.UserID != userID {
+				return ErrNotFound
+			}
+		}
+	}
+	return nil
+}
+
+// addURLs запоминает владельца, время добавления и срок действия новых URL пользователя и назначает им
+// теги и папки, заранее проверенные checkNewURLs. Состояние сохраняется в файл, только если назначены
+// теги или папки (см. setOwner).
+func (o *organizer) addURLs(userID string, urls []models.APIBatchRequest, createdAt time.Time) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	organized := false
+	for _, url := range urls {
+		o.state.Owners[url.ShortenURL] = userID
+		o.addURL(url.ShortenURL, createdAt, url.ExpiresAt)
+		if names, err := normalizeTags(url.Tags); err == nil && len(names) > 0 {
+			o.state.URLTags[url.ShortenURL] = o.tagIDs(userID, names)
+			organized = true
+		}
+		// Папку могли удалить после проверки, тогда URL остается без папки.
+		if url.FolderID != nil {
+			if folder, ok := o.state.Folders[*url.FolderID]; ok && folder.UserID == userID {
+				o.state.URLFolder[url.ShortenURL] = *url.FolderID
+				organized = true
+			}
+		}
+	}
+	if !organized {
+		return nil
+	}
+	return o.save()
+}
+
+// addURL запоминает позицию URL в порядке добавления и срок его действия. Вызывается под блокировкой.
+func (o *organizer) addURL(shortenURL string, createdAt time.Time, expiresAt *time.Time) {
+	if _, ok := o.added[shortenURL]; !ok {
+		o.added[shortenURL] = addedURL{seq: int64(len(o.added)) + 1, createdAt: createdAt, expiresAt: expiresAt}
+	}
+}
+
+// checkExpired возвращает ErrExpiredURL, если срок действия URL истек к моменту now.
+func (o *organizer) checkExpired(shortenURL string, now time.Time) error {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if expiresAt := o.added[shortenURL].expiresAt; expiresAt != nil && !expiresAt.After(now) {
+		return ErrExpiredURL
+	}
+	return nil
+}
+
+// countOwned возвращает количество URL пользователя.
+func (o *organizer) countOwned(userID string) int64 {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	var count int64
+	for _, owner := range o.state.Owners {
+		if owner == userID {
+			count++
+		}
+	}
+	return count
+}
+
+// tagByName ищет тег пользователя по имени. Вызывается под блокировкой.
+func (o *organizer) tagByName(userID, name string) (int64, bool) {
+	for id, tag := range o.state.Tags {
+		if tag.UserID == userID && tag.Name == name {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// CreateTag создает тег пользователя.
+func (o *organizer) CreateTag(ctx context.Context, userID, name string) (*models.Tag, error) {
+	name, err := normalizeName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, ok := o.tagByName(userID, name); ok {
+		return nil, ErrAlreadyExists
+	}
+	id := o.nextID()
+	o.state.Tags[id] = storedTag{UserID: userID, Name: name}
+	return &models.Tag{ID: id, Name: name}, o.save()
+}
+
+// GetTags извлекает теги пользователя.
+func (o *organizer) GetTags(ctx context.Context, userID string) ([]models.Tag, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	var tags []models.Tag
+	for id, tag := range o.state.Tags {
+		if tag.UserID == userID {
+			tags = append(tags, models.Tag{ID: id, Name: tag.Name})
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags, nil
+}
+
+// RenameTag переименовывает тег пользователя.
+func (o *organizer) RenameTag(ctx context.Context, userID string, tagID int64, name string) error {
+	name, err := normalizeName(name)
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	tag, ok := o.state.Tags[tagID]
+	if !ok || tag.UserID != userID {
+		return ErrNotFound
+	}
+	if id, ok := o.tagByName(userID, name); ok && id != tagID {
+		return ErrAlreadyExists
+	}
+	tag.Name = name
+	o.state.Tags[tagID] = tag
+	return o.save()
+}
+
+// DeleteTag удаляет тег пользователя и снимает его со всех URL.
+func (o *organizer) DeleteTag(ctx context.Context, userID string, tagID int64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	tag, ok := o.state.Tags[tagID]
+	if !ok || tag.UserID != userID {
+		return ErrNotFound
+	}
+	delete(o.state.Tags, tagID)
+	for shortenURL, tagIDs := range o.state.URLTags {
+		o.state.URLTags[shortenURL] = removeID(tagIDs, tagID)
+	}
+	return o.save()
+}
+
+// checkParent проверяет, что родительская папка существует и не является
+// самой папкой или ее потомком. Вызывается под блокировкой.
+func (o *organizer) checkParent(userID string, folderID int64, parentID *int64) error {
+	for id := parentID; id != nil; {
+		if *id == folderID {
+			return ErrFolderCycle
+		}
+		parent, ok := o.state.Folders[*id]
+		if !ok || parent.UserID != userID {
+			return ErrNotFound
+		}
+		id = parent.ParentID
+	}
+	return nil
+}
+
+// CreateFolder создает папку пользователя.
+func (o *organizer) CreateFolder(ctx context.Context, userID string, folder models.Folder) (*models.Folder, error) {
+	name, err := normalizeName(folder.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err = o.checkParent(userID, 0, folder.ParentID); err != nil {
+		return nil, err
+	}
+	id := o.nextID()
+	o.state.Folders[id] = storedFolder{UserID: userID, Name: name, ParentID: folder.ParentID}
+	return &models.Folder{ID: id, Name: name, ParentID: folder.ParentID}, o.save()
+}
+
+// GetFolders извлекает папки пользователя.
+func (o *organizer) GetFolders(ctx context.Context, userID string) ([]models.Folder, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	var folders []models.Folder
+	for id, folder := range o.state.Folders {
+		if folder.UserID == userID {
+			folders = append(folders, models.Folder{ID: id, Name: folder.Name, ParentID: folder.ParentID})
+		}
+	}
+	sort.Slice(folders, func(i, j int) bool { return folders[i].ID < folders[j].ID })
+	return folders, nil
+}
+
+// UpdateFolder переименовывает или перемещает папку пользователя.
+func (o *organizer) UpdateFolder(ctx context.Context, userID string, folder models.Folder) error {
+	name, err := normalizeName(folder.Name)
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	stored, ok := o.state.Folders[folder.ID]
+	if !ok || stored.UserID != userID {
+		return ErrNotFound
+	}
+	if err = o.checkParent(userID, folder.ID, folder.ParentID); err != nil {
+		return err
+	}
+	o.state.Folders[folder.ID] = storedFolder{UserID: userID, Name: name, ParentID: folder.ParentID}
+	return o.save()
+}
+
+// DeleteFolder удаляет папку пользователя вместе с вложенными папками.
+// URL из удаленных папок остаются без папки.
+func (o *organizer) DeleteFolder(ctx context.Context, userID string, folderID int64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	folder, ok := o.state.Folders[folderID]
+	if !ok || folder.UserID != userID {
+		return ErrNotFound
+	}
+
+	removed := map[int64]bool{folderID: true}
+	for changed := true; changed; {
+		changed = false
+		for id, f := range o.state.Folders {
+			if f.ParentID != nil && removed[*f.ParentID] && !removed[id] {
+				removed[id] = true
+				changed = true
+			}
+		}
+	}
+	for id := range removed {
+		delete(o.state.Folders, id)
+	}
+	for shortenURL, id := range o.state.URLFolder {
+		if removed[id] {
+			delete(o.state.URLFolder, shortenURL)
+		}
+	}
+	return o.save()
+}
+
+// SetURLTags заменяет теги URL пользователя, недостающие теги создаются.
+func (o *organizer) SetURLTags(ctx context.Context, userID, shortenURL string, names []string) error {
+	names, err := normalizeTags(names)
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.state.Owners[shortenURL] != userID {
+		return ErrNotFound
+	}
+	o.state.URLTags[shortenURL] = o.tagIDs(userID, names)
+	return o.save()
+}
+
+// tagIDs возвращает идентификаторы тегов пользователя с именами names, недостающие теги создаются.
+// Вызывается под блокировкой.
+func (o *organizer) tagIDs(userID string, names []string) []int64 {
+	ids := make([]int64, 0, len(names))
+	for _, name := range names {
+		id, ok := o.tagByName(userID, name)
+		if !ok {
+			id = o.nextID()
+			o.state.Tags[id] = storedTag{UserID: userID, Name: name}
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// MoveURL перемещает URL пользователя в папку (nil - убрать из папки).
+func (o *organizer) MoveURL(ctx context.Context, userID, shortenURL string, folderID *int64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.state.Owners[shortenURL] != userID {
+		return ErrNotFound
+	}
+
+	if folderID == nil {
+		delete(o.state.URLFolder, shortenURL)
+		return o.save()
+	}
+	folder, ok := o.state.Folders[*folderID]
+	if !ok || folder.UserID != userID {
+		return ErrNotFound
+	}
+	o.state.URLFolder[shortenURL] = *folderID
+	return o.save()
+}
+
+// mergeUser переносит URL, теги и папки пользователя from пользователю to.
+// Одноименные теги объединяются. Возвращает количество перенесенных URL.
+func (o *organizer) mergeUser(from, to string) (int64, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var merged int64
+	for shortenURL, userID := range o.state.Owners {
+		if userID == from {
+			o.state.Owners[shortenURL] = to
+			merged++
+		}
+	}
+
+	for id, tag := range o.state.Tags {
+		if tag.UserID != from {
+			continue
+		}
+		existing, ok := o.tagByName(to, tag.Name)
+		if !ok {
+			tag.UserID = to
+			o.state.Tags[id] = tag
+			continue
+		}
+		delete(o.state.Tags, id)
+		for shortenURL, tagIDs := range o.state.URLTags {
+			if containsID(tagIDs, id) {
+				tagIDs = removeID(tagIDs, id)
+				if !containsID(tagIDs, existing) {
+					tagIDs = append(tagIDs, existing)
+				}
+				o.state.URLTags[shortenURL] = tagIDs
+			}
+		}
+	}
+
+	for id, folder := range o.state.Folders {
+		if folder.UserID == from {
+			folder.UserID = to
+			o.state.Folders[id] = folder
+		}
+	}
+	return merged, o.save()
+}
+
+// listURLs извлекает страницу URL пользователя userID в порядке добавления с фильтрами filter
+// (см. Database.GetUserURLs). originals - оригинальные URL хранилища по сокращенным.
+// URL этих хранилищ не удаляются, поэтому фильтр Deleted = true возвращает пустую страницу.
+func (o *organizer) listURLs(userID string, originals map[string]string, filter models.UserURLsFilter) (*models.UserURLsPage, error) {
+	var cursor *pageCursor
+	if filter.Cursor != "" {
+		var err error
+		if cursor, err = decodeCursor(filter.Cursor); err != nil {
+			return nil, err
+		}
+	}
+
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	var shortenURLs []string
+	for shortenURL, owner := range o.state.Owners {
+		originalURL, ok := originals[shortenURL]
+		if owner != userID || !ok {
+			continue
+		}
+		if cursor != nil {
+			seq := o.added[shortenURL].seq
+			if filter.Desc && seq >= cursor.id || !filter.Desc && seq <= cursor.id {
+				continue
+			}
+		}
+		if o.matches(shortenURL, originalURL, filter) {
+			shortenURLs = append(shortenURLs, shortenURL)
+		}
+	}
+	sort.Slice(shortenURLs, func(i, j int) bool {
+		if filter.Desc {
+			return o.added[shortenURLs[i]].seq > o.added[shortenURLs[j]].seq
+		}
+		return o.added[shortenURLs[i]].seq < o.added[shortenURLs[j]].seq
+	})
+
+	var page models.UserURLsPage
+	for _, shortenURL := range shortenURLs {
+		if filter.Limit > 0 && len(page.URLs) == filter.Limit {
+			last := o.added[page.URLs[len(page.URLs)-1].ShortenURL]
+			page.NextCursor = encodeCursor(last.createdAt, last.seq)
+			break
+		}
+		page.URLs = append(page.URLs, o.userURL(shortenURL, originals[shortenURL]))
+	}
+	return &page, nil
+}
+
+// matches проверяет URL на соответствие фильтрам filter. Вызывается под блокировкой.
+func (o *organizer) matches(shortenURL, originalURL string, filter models.UserURLsFilter) bool {
+	if filter.Deleted != nil && *filter.Deleted {
+		return false
+	}
+	if filter.Domain != "" && !strings.EqualFold(urlDomain(originalURL), filter.Domain) {
+		return false
+	}
+	if filter.Search != "" {
+		search := strings.ToLower(filter.Search)
+		if !strings.Contains(strings.ToLower(originalURL), search) && !strings.Contains(strings.ToLower(shortenURL), search) {
+			return false
+		}
+	}
+	if filter.Tag != "" && !o.hasTag(shortenURL, filter.Tag) {
+		return false
+	}
+	if filter.FolderID != nil {
+		if folderID, ok := o.state.URLFolder[shortenURL]; !ok || folderID != *filter.FolderID {
+			return false
+		}
+	}
+	return true
+}
+
+// hasTag проверяет, помечен ли URL тегом name. Вызывается под блокировкой.
+func (o *organizer) hasTag(shortenURL, name string) bool {
+	for _, id := range o.state.URLTags[shortenURL] {
+		if o.state.Tags[id].Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// userURL собирает URL пользователя для выдачи. Теги сортируются по имени. Вызывается под блокировкой.
+func (o *organizer) userURL(shortenURL, originalURL string) models.APIUserURLResponse {
+	userURL := models.APIUserURLResponse{
+		ShortenURL:  shortenURL,
+		OriginalURL: originalURL,
+		CreatedAt:   o.added[shortenURL].createdAt,
+		ExpiresAt:   o.added[shortenURL].expiresAt,
+	}
+	for _, id := range o.state.URLTags[shortenURL] {
+		if tag, ok := o.state.Tags[id]; ok {
+			userURL.Tags = append(userURL.Tags, tag.Name)
+		}
+	}
+	sort.Strings(userURL.Tags)
+	if folderID, ok := o.state.URLFolder[shortenURL]; ok {
+		userURL.FolderID = &folderID
+	}
+	return userURL
+}
+
+// domainPattern выделяет домен так же, как фильтр по домену в Postgres, в том числе из URL без схемы.
+var domainPattern = regexp.MustCompile(`^(?:[^:/?#]+://)?([^/:?#]+)`)
+
+// urlDomain возвращает домен оригинального URL.
+func urlDomain(originalURL string) string {
+	match := domainPattern.FindStringSubmatch(originalURL)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+// containsID проверяет, есть ли идентификатор в слайсе.
+func containsID(ids []int64, id int64) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// removeID удаляет идентификатор из слайса.
+func removeID(ids []int64, id int64) []int64 {
+	result := ids[:0]
+	for _, v := range ids {
+		if v != id {
+			result = append(result, v)
+		}
+	}
+	return result
+}
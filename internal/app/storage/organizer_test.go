@@ -0,0 +1,246 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vancho-go/url-shortener/internal/app/models"
+)
+
+func TestOrganizerFolders(t *testing.T) {
+	ctx := context.Background()
+	o, err := newOrganizer("")
+	require.NoError(t, err)
+
+	root, err := o.CreateFolder(ctx, "user", models.Folder{Name: "root"})
+	require.NoError(t, err)
+	child, err := o.CreateFolder(ctx, "user", models.Folder{Name: "child", ParentID: &root.ID})
+	require.NoError(t, err)
+
+	// Папку нельзя переместить внутрь ее потомка.
+	err = o.UpdateFolder(ctx, "user", models.Folder{ID: root.ID, Name: "root", ParentID: &child.ID})
+	assert.ErrorIs(t, err, ErrFolderCycle)
+
+	// Чужая папка не видна.
+	_, err = o.CreateFolder(ctx, "other", models.Folder{Name: "x", ParentID: &root.ID})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	o.setOwner("abc", "user", time.Now())
+	require.NoError(t, o.MoveURL(ctx, "user", "abc", &child.ID))
+
+	// Удаление корня удаляет вложенные папки и освобождает URL.
+	require.NoError(t, o.DeleteFolder(ctx, "user", root.ID))
+	folders, err := o.GetFolders(ctx, "user")
+	require.NoError(t, err)
+	assert.Empty(t, folders)
+	assert.NotContains(t, o.state.URLFolder, "abc")
+}
+
+func TestOrganizerTagsPersistence(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "db.json.meta")
+	o, err := newOrganizer(path)
+	require.NoError(t, err)
+
+	o.setOwner("abc", "user", time.Now())
+	assert.ErrorIs(t, o.SetURLTags(ctx, "other", "abc", []string{"news"}), ErrNotFound)
+	assert.ErrorIs(t, o.SetURLTags(ctx, "user", "abc", []string{" "}), ErrBadName)
+	require.NoError(t, o.SetURLTags(ctx, "user", "abc", []string{"news", " work ", "news"}))
+
+	restored, err := newOrganizer(path)
+	require.NoError(t, err)
+	tags, err := restored.GetTags(ctx, "user")
+	require.NoError(t, err)
+	require.Len(t, tags, 2)
+	assert.Equal(t, "news", tags[0].Name)
+	assert.Equal(t, "work", tags[1].Name)
+	assert.Len(t, restored.state.URLTags["abc"], 2)
+
+	_, err = restored.CreateTag(ctx, "user", "news")
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+}
+
+func TestOrganizerMergeUser(t *testing.T) {
+	ctx := context.Background()
+	o, err := newOrganizer("")
+	require.NoError(t, err)
+
+	o.setOwner("abc", "anon", time.Now())
+	o.setOwner("def", "account", time.Now())
+	require.NoError(t, o.SetURLTags(ctx, "anon", "abc", []string{"work", "news"}))
+	require.NoError(t, o.SetURLTags(ctx, "account", "def", []string{"work"}))
+	_, err = o.CreateFolder(ctx, "anon", models.Folder{Name: "inbox"})
+	require.NoError(t, err)
+
+	merged, err := o.mergeUser("anon", "account")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), merged)
+	assert.Equal(t, "account", o.state.Owners["abc"])
+
+	// Одноименные теги объединены, URL ссылается на тег учетной записи.
+	tags, err := o.GetTags(ctx, "account")
+	require.NoError(t, err)
+	assert.Len(t, tags, 2)
+	assert.Contains(t, o.state.URLTags["abc"], o.state.URLTags["def"][0])
+
+	folders, err := o.GetFolders(ctx, "account")
+	require.NoError(t, err)
+	assert.Len(t, folders, 1)
+	tags, err = o.GetTags(ctx, "anon")
+	require.NoError(t, err)
+	assert.Empty(t, tags)
+}
+
+func TestFileOwnersPersistence(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "urls.json")
+	ed, err := NewEncoderDecoder(path)
+	require.NoError(t, err)
+	require.NoError(t, ed.Initialize())
+
+	// Владелец пишется вместе с URL, файл состояния при добавлении URL не переписывается.
+	for _, shortenURL := range []string{"abc", "def"} {
+		require.NoError(t, ed.AddURL(ctx, "https://ya.ru", shortenURL, "user"))
+	}
+	_, err = os.Stat(path + ".meta")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	require.NoError(t, ed.Close())
+
+	restored, err := NewEncoderDecoder(path)
+	require.NoError(t, err)
+	defer restored.Close()
+	require.NoError(t, restored.Initialize())
+	assert.Equal(t, int64(2), restored.countOwned("user"))
+	require.NoError(t, restored.SetURLTags(ctx, "user", "abc", []string{"news"}))
+
+	// Порядок добавления восстанавливается из записей файла.
+	page, err := restored.GetUserURLs(ctx, "user", models.UserURLsFilter{Desc: true})
+	require.NoError(t, err)
+	require.Len(t, page.URLs, 2)
+	assert.Equal(t, "def", page.URLs[0].ShortenURL)
+	assert.Equal(t, []string{"news"}, page.URLs[1].Tags)
+	assert.False(t, page.URLs[1].CreatedAt.IsZero())
+}
+
+func TestFileAddURLs(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "urls.json")
+	ed, err := NewEncoderDecoder(path)
+	require.NoError(t, err)
+	require.NoError(t, ed.Initialize())
+	folder, err := ed.CreateFolder(ctx, "user", models.Folder{Name: "inbox"})
+	require.NoError(t, err)
+	other, err := ed.CreateFolder(ctx, "other", models.Folder{Name: "other"})
+	require.NoError(t, err)
+	expired := time.Now().Add(-time.Minute)
+
+	// Пачка с чужой папкой, некорректным тегом или занятым сокращенным URL не сохраняется целиком.
+	assert.ErrorIs(t, ed.AddURLs(ctx, "user",
+		models.APIBatchRequest{OriginalURL: "https://ya.ru", ShortenURL: "abc"},
+		models.APIBatchRequest{OriginalURL: "https://vk.com", ShortenURL: "def", FolderID: &other.ID}), ErrNotFound)
+	assert.ErrorIs(t, ed.AddURLs(ctx, "user",
+		models.APIBatchRequest{OriginalURL: "https://ya.ru", ShortenURL: "abc", Tags: []string{" "}}), ErrBadName)
+	assert.True(t, ed.IsShortenUnique(ctx, "abc"))
+
+	require.NoError(t, ed.AddURLs(ctx, "user",
+		models.APIBatchRequest{OriginalURL: "https://ya.ru", ShortenURL: "abc", Tags: []string{"news"}, FolderID: &folder.ID},
+		models.APIBatchRequest{OriginalURL: "https://vk.com", ShortenURL: "def", ExpiresAt: &expired}))
+	assert.ErrorIs(t, ed.AddURLs(ctx, "user", models.APIBatchRequest{OriginalURL: "https://ya.ru", ShortenURL: "abc"}), ErrAliasTaken)
+
+	// Квоты не хватает на всю пачку - не сохраняется ни один URL.
+	ed.SetDefaultQuota(models.Quota{Total: 3})
+	assert.ErrorIs(t, ed.AddURLs(ctx, "user",
+		models.APIBatchRequest{OriginalURL: "https://a.ru", ShortenURL: "a"},
+		models.APIBatchRequest{OriginalURL: "https://b.ru", ShortenURL: "b"}), ErrQuotaExceeded)
+	assert.True(t, ed.IsShortenUnique(ctx, "a"))
+	require.NoError(t, ed.Close())
+
+	// URL, их теги, папки и сроки действия переживают перезапуск.
+	restored, err := NewEncoderDecoder(path)
+	require.NoError(t, err)
+	defer restored.Close()
+	require.NoError(t, restored.Initialize())
+	originalURL, err := restored.GetURL(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://ya.ru", originalURL)
+	_, err = restored.GetURL(ctx, "def")
+	assert.ErrorIs(t, err, ErrExpiredURL)
+
+	page, err := restored.GetUserURLs(ctx, "user", models.UserURLsFilter{})
+	require.NoError(t, err)
+	require.Len(t, page.URLs, 2)
+	assert.Equal(t, []string{"news"}, page.URLs[0].Tags)
+	assert.Equal(t, &folder.ID, page.URLs[0].FolderID)
+	require.NotNil(t, page.URLs[1].ExpiresAt)
+	assert.True(t, expired.Equal(*page.URLs[1].ExpiresAt))
+}
+
+func TestMapDBUserURLs(t *testing.T) {
+	ctx := context.Background()
+	db := NewMapDB()
+	for _, shortenURL := range []string{"a1", "b2", "c3"} {
+		require.NoError(t, db.AddURL(ctx, "https://"+shortenURL+".ya.ru/path", shortenURL, "user"))
+	}
+	require.NoError(t, db.AddURL(ctx, "https://vk.com", "d4", "other"))
+	folder, err := db.CreateFolder(ctx, "user", models.Folder{Name: "inbox"})
+	require.NoError(t, err)
+	require.NoError(t, db.SetURLTags(ctx, "user", "a1", []string{"work", "news"}))
+	require.NoError(t, db.SetURLTags(ctx, "user", "c3", []string{"news"}))
+	require.NoError(t, db.MoveURL(ctx, "user", "b2", &folder.ID))
+
+	shortenURLs := func(filter models.UserURLsFilter) ([]string, string) {
+		page, err := db.GetUserURLs(ctx, "user", filter)
+		require.NoError(t, err)
+		var urls []string
+		for _, url := range page.URLs {
+			urls = append(urls, url.ShortenURL)
+		}
+		return urls, page.NextCursor
+	}
+
+	urls, _ := shortenURLs(models.UserURLsFilter{})
+	assert.Equal(t, []string{"a1", "b2", "c3"}, urls)
+	urls, _ = shortenURLs(models.UserURLsFilter{Tag: "news", Desc: true})
+	assert.Equal(t, []string{"c3", "a1"}, urls)
+	urls, _ = shortenURLs(models.UserURLsFilter{FolderID: &folder.ID})
+	assert.Equal(t, []string{"b2"}, urls)
+	urls, _ = shortenURLs(models.UserURLsFilter{Domain: "C3.YA.RU"})
+	assert.Equal(t, []string{"c3"}, urls)
+	urls, _ = shortenURLs(models.UserURLsFilter{Search: "B2"})
+	assert.Equal(t, []string{"b2"}, urls)
+	deleted := true
+	urls, _ = shortenURLs(models.UserURLsFilter{Deleted: &deleted})
+	assert.Empty(t, urls)
+
+	// Постраничная выдача продолжается с курсора.
+	urls, cursor := shortenURLs(models.UserURLsFilter{Limit: 2})
+	assert.Equal(t, []string{"a1", "b2"}, urls)
+	require.NotEmpty(t, cursor)
+	urls, cursor = shortenURLs(models.UserURLsFilter{Limit: 2, Cursor: cursor})
+	assert.Equal(t, []string{"c3"}, urls)
+	assert.Empty(t, cursor)
+
+	page, err := db.GetUserURLs(ctx, "user", models.UserURLsFilter{Tag: "work"})
+	require.NoError(t, err)
+	require.Len(t, page.URLs, 1)
+	assert.Equal(t, []string{"news", "work"}, page.URLs[0].Tags)
+	_, err = db.GetUserURLs(ctx, "user", models.UserURLsFilter{Cursor: "bad"})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestURLDomain(t *testing.T) {
+	tests := map[string]string{
+		"https://Ya.ru:8080/path?q=1": "Ya.ru",
+		"ya.ru/path":                  "ya.ru",
+		"":                            "",
+	}
+	for originalURL, want := range tests {
+		assert.Equal(t, want, urlDomain(originalURL), originalURL)
+	}
+}
@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vancho-go/url-shortener/internal/app/models"
+)
+
+var (
+	// ErrQuotaExceeded - тип ошибки, сигнализирующий, что пользователь исчерпал квоту на сокращение URL.
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	// ErrBadQuota - тип ошибки, сигнализирующий, что квота некорректна.
+	ErrBadQuota = errors.New("bad quota")
+)
+
+// QuotaStorager реализует методы для работы с квотами пользователей на сокращение URL.
+// Квоты проверяются при сохранении URL методами AddURL и AddURLs.
+type QuotaStorager interface {
+	// SetDefaultQuota задает квоты пользователей, которым администратор не задал свои.
+	SetDefaultQuota(models.Quota)
+	// GetQuota извлекает квоты пользователя и их текущее использование.
+	GetQuota(context.Context, string) (*models.APIQuotaResponse, error)
+	// SetUserQuota задает квоты пользователя вместо квот по умолчанию.
+	SetUserQuota(context.Context, string, models.Quota) error
+	// DeleteUserQuota возвращает пользователю квоты по умолчанию.
+	DeleteUserQuota(context.Context, string) error
+}
+
+// storedDailyCount - количество URL, сокращенных пользователем за сутки Day (UTC, 2006-01-02).
+type storedDailyCount struct {
+	Day   string `json:"day"`
+	Count int64  `json:"count"`
+}
+
+// quotaDay возвращает начало суток (UTC), к которым относится момент now.
+func quotaDay(now time.Time) time.Time {
+	return now.UTC().Truncate(24 * time.Hour)
+}
+
+// validateQuota проверяет квоту, заданную администратором.
+func validateQuota(quota models.Quota) error {
+	if quota.Daily < 0 || quota.Total < 0 {
+		return ErrBadQuota
+	}
+	return nil
+}
+
+// checkQuota проверяет, что пользователь с использованием квот usage может сократить еще n URL.
+func checkQuota(usage *models.APIQuotaResponse, n int64) error {
+	if limit := usage.Limits.Daily; limit > 0 && usage.Used.Daily+n > limit {
+		return fmt.Errorf("%w: daily limit of %d URLs", ErrQuotaExceeded, limit)
+	}
+	if limit := usage.Limits.Total; limit > 0 && usage.Used.Total+n > limit {
+		return fmt.Errorf("%w: limit of %d active URLs", ErrQuotaExceeded, limit)
+	}
+	return nil
+}
+
+// SetDefaultQuota задает квоты пользователей, которым администратор не задал свои.
+func (a *accounts) SetDefaultQuota(quota models.Quota) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.defaultQuota = quota
+}
+
+// SetUserQuota задает квоты пользователя вместо квот по умолчанию.
+func (a *accounts) SetUserQuota(ctx context.Context, userID string, quota models.Quota) error {
+	if err := validateQuota(quota); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.state.Quotas[userID] = quota
+	return a.save()
+}
+
+// DeleteUserQuota возвращает пользователю квоты по умолчанию.
+func (a *accounts) DeleteUserQuota(ctx context.Context, userID string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.state.Quotas[userID]; !ok {
+		return ErrNotFound
+	}
+	delete(a.state.Quotas, userID)
+	return a.save()
+}
+
+// quotaUsage возвращает квоты пользователя, у которого total действующих URL, и их использование
+// в момент now.
+func (a *accounts) quotaUsage(userID string, total int64, now time.Time) *models.APIQuotaResponse {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.quotaUsageLocked(userID, total, now)
+}
+
+// quotaUsageLocked - quotaUsage, вызываемый под блокировкой.
+func (a *accounts) quotaUsageLocked(userID string, total int64, now time.Time) *models.APIQuotaResponse {
+	day := quotaDay(now)
+	usage := &models.APIQuotaResponse{
+		Limits:  a.defaultQuota,
+		Used:    models.Quota{Total: total},
+		ResetAt: day.Add(24 * time.Hour),
+	}
+	if quota, ok := a.state.Quotas[userID]; ok {
+		usage.Limits = quota
+		usage.Custom = true
+	}
+	if created := a.state.Created[userID]; created.Day == day.Format(time.DateOnly) {
+		usage.Used.Daily = created.Count
+	}
+	return usage
+}
+
+// reserveQuota проверяет квоты пользователя, у которого total действующих URL, и учитывает n новых URL
+// в суточной квоте. Если квоты не хватает, ничего не учитывается.
+func (a *accounts) reserveQuota(userID string, total, n int64, now time.Time) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	usage := a.quotaUsageLocked(userID, total, now)
+	if err := checkQuota(usage, n); err != nil {
+		return err
+	}
+	a.state.Created[userID] = storedDailyCount{
+		Day:   quotaDay(now).Format(time.DateOnly),
+		Count: usage.Used.Daily + n,
+	}
+	return a.save()
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/vancho-go/url-shortener/internal/app/models"
+)
+
+// maxNameLength - максимальная длина имени тега или папки.
+const maxNameLength = 64
+
+var (
+	// ErrNotFound - тип ошибки, сигнализирующий, что запись не найдена или принадлежит другому пользователю.
+	ErrNotFound = errors.New("not found")
+	// ErrAlreadyExists - тип ошибки, сигнализирующий, что запись с таким именем уже существует.
+	ErrAlreadyExists = errors.New("already exists")
+	// ErrBadName - тип ошибки, сигнализирующий, что имя тега или папки некорректно.
+	ErrBadName = errors.New("bad name")
+	// ErrFolderCycle - тип ошибки, сигнализирующий, что папку пытаются переместить внутрь самой себя.
+	ErrFolderCycle = errors.New("folder cannot be moved into itself")
+)
+
+// normalizeName проверяет имя тега или папки и убирает пробелы по краям.
+func normalizeName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxNameLength {
+		return "", ErrBadName
+	}
+	return name, nil
+}
+
+// normalizeTags проверяет имена тегов и убирает дубликаты с сохранением порядка.
+func normalizeTags(names []string) ([]string, error) {
+	seen := make(map[string]struct{}, len(names))
+	tags := make([]string, 0, len(names))
+	for _, name := range names {
+		tag, err := normalizeName(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := seen[tag]; ok {
+			continue
+		}
+		seen[tag] = struct{}{}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// CheckOrganize проверяет теги и папку, которые назначаются новому URL, до его сохранения:
+// имена тегов должны быть корректны, а папка - существовать и принадлежать пользователю.
+// Иначе URL сохранялся бы, а запрос завершался ошибкой, и повтор запроса получал бы конфликт.
+func CheckOrganize(ctx context.Context, db TagStorager, userID string, tags []string, folderID *int64) error {
+	if _, err := normalizeTags(tags); err != nil {
+		return err
+	}
+	if folderID == nil {
+		return nil
+	}
+	folders, err := db.GetFolders(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, folder := range folders {
+		if folder.ID == *folderID {
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// AddOrganizedURL сохраняет новый URL пользователя с тегами tags и папкой folderID, заранее проверенными
+// CheckOrganize. URL с тегами или папкой сохраняется через AddURLs: теги и папка записываются тем же
+// вызовом хранилища, что и URL (в Postgres - в одной транзакции), и URL не останется без них при ошибке.
+func AddOrganizedURL(ctx context.Context, db URLStorager, userID, originalURL, shortenURL string, tags []string, folderID *int64) error {
+	if len(tags) == 0 && folderID == nil {
+		return db.AddURL(ctx, originalURL, shortenURL, userID)
+	}
+	return db.AddURLs(ctx, userID, models.APIBatchRequest{
+		OriginalURL: originalURL,
+		ShortenURL:  shortenURL,
+		Tags:        tags,
+		FolderID:    folderID,
+	})
+}
@@ -0,0 +1,202 @@
+// Модуль urlnorm проверяет оригинальные URL и приводит их к каноническому виду.
+// Канонический URL используется как ключ уникальности, поэтому разные написания
+// одного адреса (регистр хоста, порт по умолчанию, IDN) не создают дубликатов.
+package urlnorm
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// ErrBadURL - тип ошибки, сигнализирующий, что оригинальный URL некорректен.
+var ErrBadURL = errors.New("bad URL")
+
+// DefaultSchemes - схемы URL, разрешенные по умолчанию.
+var DefaultSchemes = []string{"http", "https"}
+
+// defaultPorts - порты по умолчанию, которые удаляются из URL.
+var defaultPorts = map[string]string{"http": "80", "https": "443", "ftp": "21", "ws": "80", "wss": "443"}
+
+// trackingParams - параметры запроса, которые используются только для отслеживания переходов.
+var trackingParams = map[string]struct{}{
+	"fbclid": {}, "gclid": {}, "dclid": {}, "msclkid": {}, "yclid": {}, "ysclid": {},
+	"mc_cid": {}, "mc_eid": {}, "igshid": {}, "_openstat": {},
+}
+
+// trackingPrefixes - префиксы параметров запроса для отслеживания переходов.
+var trackingPrefixes = []string{"utm_"}
+
+// Options - настройки канонизации URL.
+type Options struct {
+	// Schemes - разрешенные схемы URL. Пустой список - DefaultSchemes.
+	Schemes []string
+	// SortQuery - сортировать параметры запроса по имени.
+	SortQuery bool
+	// StripTracking - удалять параметры отслеживания переходов (utm_*, fbclid, gclid и т.п.).
+	StripTracking bool
+}
+
+// Normalizer проверяет URL и приводит их к каноническому виду.
+// Нулевой (nil) Normalizer использует настройки по умолчанию.
+type Normalizer struct {
+	schemes       map[string]struct{}
+	sortQuery     bool
+	stripTracking bool
+}
+
+// New конструктор Normalizer.
+func New(opts Options) *Normalizer {
+	schemes := opts.Schemes
+	if len(schemes) == 0 {
+		schemes = DefaultSchemes
+	}
+	n := &Normalizer{schemes: make(map[string]struct{}, len(schemes)), sortQuery: opts.SortQuery, stripTracking: opts.StripTracking}
+	for _, scheme := range schemes {
+		n.schemes[strings.ToLower(strings.TrimSpace(scheme))] = struct{}{}
+	}
+	return n
+}
+
+// ParseSchemes разбирает список разрешенных схем вида "http,https".
+func ParseSchemes(spec string) []string {
+	var schemes []string
+	for _, scheme := range strings.Split(spec, ",") {
+		if scheme = strings.TrimSpace(scheme); scheme != "" {
+			schemes = append(schemes, scheme)
+		}
+	}
+	return schemes
+}
+
+// Normalize проверяет URL и возвращает его канонический вид:
+//   - URL абсолютный, схема из списка разрешенных, хост обязателен;
+//   - схема и хост в нижнем регистре, IDN хост переводится в punycode, точка в конце хоста удаляется;
+//   - порт по умолчанию для схемы удаляется;
+//   - пустой путь заменяется на "/", пустой запрос ("?") удаляется;
+//   - параметры отслеживания удаляются и параметры сортируются, если это включено в настройках.
+func (n *Normalizer) Normalize(raw string) (string, error) {
+	if n == nil {
+		n = New(Options{})
+	}
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", fmt.Errorf("%w: URL is empty", ErrBadURL)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrBadURL, err)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if _, ok := n.schemes[u.Scheme]; !ok {
+		return "", fmt.Errorf("%w: scheme %q is not allowed", ErrBadURL, u.Scheme)
+	}
+	if u.Opaque != "" || u.Host == "" {
+		return "", fmt.Errorf("%w: host is required", ErrBadURL)
+	}
+	if u.Host, err = normalizeHost(u.Scheme, u.Host); err != nil {
+		return "", err
+	}
+
+	if u.Path == "" {
+		u.Path = "/"
+		u.RawPath = ""
+	}
+	if n.stripTracking || n.sortQuery {
+		u.RawQuery = n.normalizeQuery(u.RawQuery)
+	}
+	u.ForceQuery = false
+	return u.String(), nil
+}
+
+// normalizeHost приводит хост (с портом) к каноническому виду.
+func normalizeHost(scheme, host string) (string, error) {
+	hostname, port := host, ""
+	if i := strings.LastIndexByte(host, ':'); i != -1 && !strings.Contains(host[i:], "]") {
+		hostname, port = host[:i], host[i+1:]
+	}
+
+	if port != "" {
+		number, err := strconv.Atoi(port)
+		if err != nil || number < 1 || number > 65535 {
+			return "", fmt.Errorf("%w: bad port %q", ErrBadURL, port)
+		}
+		port = strconv.Itoa(number)
+		if defaultPorts[scheme] == port {
+			port = ""
+		}
+	}
+
+	if strings.HasPrefix(hostname, "[") {
+		ip := net.ParseIP(strings.Trim(hostname, "[]"))
+		if ip == nil || ip.To4() != nil {
+			return "", fmt.Errorf("%w: bad IPv6 address %q", ErrBadURL, hostname)
+		}
+		hostname = "[" + ip.String() + "]"
+	} else {
+		hostname = strings.TrimSuffix(hostname, ".")
+		ascii, err := idna.Lookup.ToASCII(hostname)
+		if err != nil || ascii == "" {
+			return "", fmt.Errorf("%w: bad host %q", ErrBadURL, hostname)
+		}
+		hostname = ascii
+	}
+
+	if port != "" {
+		return hostname + ":" + port, nil
+	}
+	return hostname, nil
+}
+
+// normalizeQuery удаляет параметры отслеживания и сортирует параметры запроса по имени
+// (порядок значений одного параметра сохраняется).
+func (n *Normalizer) normalizeQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	params := strings.Split(rawQuery, "&")
+	kept := params[:0]
+	for _, param := range params {
+		if param == "" {
+			continue
+		}
+		if n.stripTracking && isTrackingParam(param) {
+			continue
+		}
+		kept = append(kept, param)
+	}
+	if n.sortQuery {
+		sort.SliceStable(kept, func(i, j int) bool { return paramName(kept[i]) < paramName(kept[j]) })
+	}
+	return strings.Join(kept, "&")
+}
+
+// isTrackingParam проверяет, что параметр запроса служит для отслеживания переходов.
+func isTrackingParam(param string) bool {
+	name := strings.ToLower(paramName(param))
+	if _, ok := trackingParams[name]; ok {
+		return true
+	}
+	for _, prefix := range trackingPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// paramName возвращает декодированное имя параметра запроса "имя=значение".
+func paramName(param string) string {
+	name, _, _ := strings.Cut(param, "=")
+	if unescaped, err := url.QueryUnescape(name); err == nil {
+		return unescaped
+	}
+	return name
+}
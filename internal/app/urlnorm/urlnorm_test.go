@@ -0,0 +1,65 @@
+package urlnorm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		raw  string
+		want string
+	}{
+		{name: "empty path", raw: "https://ya.ru", want: "https://ya.ru/"},
+		{name: "case folding", raw: "HTTPS://Ya.RU/Path", want: "https://ya.ru/Path"},
+		{name: "default port", raw: "http://ya.ru:80/a", want: "http://ya.ru/a"},
+		{name: "custom port", raw: "http://ya.ru:8080/a", want: "http://ya.ru:8080/a"},
+		{name: "trailing dot", raw: "https://ya.ru./", want: "https://ya.ru/"},
+		{name: "IDN", raw: "https://Пример.рф/путь", want: "https://xn--e1afmkfd.xn--p1ai/%D0%BF%D1%83%D1%82%D1%8C"},
+		{name: "IPv6", raw: "https://[2001:DB8::0001]:443/", want: "https://[2001:db8::1]/"},
+		{name: "empty query", raw: "https://ya.ru/?", want: "https://ya.ru/"},
+		{name: "spaces", raw: "  https://ya.ru/a  ", want: "https://ya.ru/a"},
+		{name: "query is kept by default", raw: "https://ya.ru/?b=2&utm_source=x&a=1", want: "https://ya.ru/?b=2&utm_source=x&a=1"},
+		{name: "sort query", opts: Options{SortQuery: true}, raw: "https://ya.ru/?b=2&a=1&b=1", want: "https://ya.ru/?a=1&b=2&b=1"},
+		{name: "strip tracking", opts: Options{StripTracking: true}, raw: "https://ya.ru/?utm_source=x&id=1&fbclid=y&UTM_Medium=z", want: "https://ya.ru/?id=1"},
+		{name: "custom schemes", opts: Options{Schemes: []string{"ftp"}}, raw: "FTP://files.ya.ru:21", want: "ftp://files.ya.ru/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(tt.opts).Normalize(tt.raw)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNormalizeErrors(t *testing.T) {
+	for _, raw := range []string{
+		"",
+		"ya.ru",
+		"/relative",
+		"javascript:alert(1)",
+		"mailto:user@ya.ru",
+		"ftp://ya.ru",
+		"https://",
+		"https://ya.ru:0",
+		"https://ya.ru:65536",
+		"https://[::ffff:1.2.3.4]/",
+		"https://bad_host!.ru",
+	} {
+		t.Run(raw, func(t *testing.T) {
+			var n *Normalizer
+			_, err := n.Normalize(raw)
+			assert.ErrorIs(t, err, ErrBadURL)
+		})
+	}
+}
+
+func TestParseSchemes(t *testing.T) {
+	assert.Equal(t, []string{"http", "https"}, ParseSchemes(" http, ,https "))
+	assert.Empty(t, ParseSchemes(""))
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/vancho-go/url-shortener/internal/app/auth"
+	"github.com/vancho-go/url-shortener/internal/app/handlers/http/middlewares"
+)
+
+// Режимы доступа к служебным эндпоинтам.
+const (
+	// InternalAccessOff - служебные эндпоинты отключены.
+	InternalAccessOff = "off"
+	// InternalAccessTrusted - доступ только из доверенных подсетей.
+	InternalAccessTrusted = "trusted"
+	// InternalAccessAdmin - доступ только пользователям с ролью администратора.
+	InternalAccessAdmin = "admin"
+	// InternalAccessPublic - доступ без ограничений.
+	InternalAccessPublic = "public"
+)
+
+// internalPolicy - таблица доступа к служебным эндпоинтам в режиме InternalAccessAdmin.
+var internalPolicy = auth.Policy{auth.PolicyDefault: {auth.RoleAdmin}}
+
+// InternalAccessMiddleware возвращает middleware, которая ограничивает доступ к служебным эндпоинтам
+// (профилированию, метрикам и т.п.) в режиме mode. Пустой режим - InternalAccessTrusted.
+// В режиме InternalAccessOff эндпоинты отвечают 404, но лучше не подключать их вовсе.
+func InternalAccessMiddleware(mode string, trustedSubnets []netip.Prefix, tokens auth.TokenManager, keys auth.APIKeyStore) (func(http.Handler) http.Handler, error) {
+	switch strings.ToLower(mode) {
+	case InternalAccessOff:
+		return func(http.Handler) http.Handler { return http.NotFoundHandler() }, nil
+	case "", InternalAccessTrusted:
+		return TrustedSubnetMiddleware(trustedSubnets), nil
+	case InternalAccessAdmin:
+		jwt, roles := middlewares.JWTMiddleware(tokens, keys), middlewares.RoleMiddleware(internalPolicy)
+		return func(next http.Handler) http.Handler { return jwt(roles(next)) }, nil
+	case InternalAccessPublic:
+		return func(next http.Handler) http.Handler { return next }, nil
+	default:
+		return nil, fmt.Errorf("bad debug access %q, %s, %s, %s or %s expected",
+			mode, InternalAccessOff, InternalAccessTrusted, InternalAccessAdmin, InternalAccessPublic)
+	}
+}
+
+// InternalAccessDisabled проверяет, что режим mode отключает служебные эндпоинты.
+func InternalAccessDisabled(mode string) bool {
+	return strings.EqualFold(mode, InternalAccessOff)
+}
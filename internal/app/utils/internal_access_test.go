@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vancho-go/url-shortener/internal/app/auth"
+	"github.com/vancho-go/url-shortener/internal/app/config"
+)
+
+func TestInternalAccessMiddleware(t *testing.T) {
+	tokens, err := auth.New(config.ServerConfig{AuthSecret: "secret"}, nil, nil)
+	require.NoError(t, err)
+	subnets := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	admin, err := tokens.Issue(auth.User{ID: "admin", Registered: true, Roles: []string{auth.RoleAdmin}})
+	require.NoError(t, err)
+	user, err := tokens.Issue(auth.User{ID: "user", Registered: true})
+	require.NoError(t, err)
+
+	tests := []struct {
+		mode       string
+		remoteAddr string
+		token      string
+		want       int
+	}{
+		{mode: "", remoteAddr: "10.1.2.3:1234", want: http.StatusOK},
+		{mode: InternalAccessTrusted, remoteAddr: "203.0.113.1:1234", want: http.StatusForbidden},
+		{mode: InternalAccessAdmin, remoteAddr: "203.0.113.1:1234", token: admin, want: http.StatusOK},
+		{mode: InternalAccessAdmin, remoteAddr: "10.1.2.3:1234", token: user, want: http.StatusForbidden},
+		{mode: InternalAccessPublic, remoteAddr: "203.0.113.1:1234", want: http.StatusOK},
+		{mode: InternalAccessOff, remoteAddr: "10.1.2.3:1234", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode+" "+tt.remoteAddr, func(t *testing.T) {
+			access, err := InternalAccessMiddleware(tt.mode, subnets, tokens, nil)
+			require.NoError(t, err)
+			r := chi.NewRouter()
+			r.Group(func(r chi.Router) {
+				r.Use(access)
+				r.Get("/debug/", func(w http.ResponseWriter, r *http.Request) {})
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/debug/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+			assert.Equal(t, tt.want, res.Code)
+		})
+	}
+
+	_, err = InternalAccessMiddleware("internal", subnets, tokens, nil)
+	assert.Error(t, err)
+}
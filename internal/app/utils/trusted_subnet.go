@@ -1,16 +1,20 @@
 package utils
 
 import (
-	"net"
 	"net/http"
+	"net/netip"
+
+	"github.com/vancho-go/url-shortener/internal/app/clientip"
+	"github.com/vancho-go/url-shortener/internal/app/handlers/http/middlewares"
 )
 
-// TrustedSubnetMiddleware выполняет проверку вхождения X-Real-IP из запроса в доверенную подсеть
-func TrustedSubnetMiddleware(trustedSubnet string) func(http.Handler) http.Handler {
+// TrustedSubnetMiddleware выполняет проверку вхождения IP адреса клиента в одну из доверенных подсетей.
+// Адрес определяется middlewares.ClientIPMiddleware с учетом доверенных прокси.
+// Без доверенных подсетей доступ запрещен всем.
+func TrustedSubnetMiddleware(trustedSubnets []netip.Prefix) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			realIP := r.Header.Get("X-Real-IP")
-			if !isIPTrusted(realIP, trustedSubnet) {
+			if !isIPTrusted(middlewares.ClientIP(r), trustedSubnets) {
 				http.Error(w, "Forbidden", http.StatusForbidden)
 				return
 			}
@@ -19,18 +23,11 @@ func TrustedSubnetMiddleware(trustedSubnet string) func(http.Handler) http.Handl
 	}
 }
 
-// isIPTrusted проверяет IP на вхождение в доверенную подсеть.
-func isIPTrusted(ip string, trustedSubnet string) bool {
-	if trustedSubnet == "" {
-		return false
-	}
-	_, subnet, err := net.ParseCIDR(trustedSubnet)
+// isIPTrusted проверяет IP на вхождение в доверенные подсети.
+func isIPTrusted(ip string, trustedSubnets []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
 	if err != nil {
 		return false
 	}
-	if !subnet.Contains(net.ParseIP(ip)) {
-		return false
-	}
-
-	return true
+	return clientip.Contains(trustedSubnets, addr)
 }
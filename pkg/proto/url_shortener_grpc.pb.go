@@ -20,13 +20,24 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	URLShortener_Ping_FullMethodName        = "/url_shortener.URLShortener/Ping"
-	URLShortener_AddURL_FullMethodName      = "/url_shortener.URLShortener/AddURL"
-	URLShortener_AddURLs_FullMethodName     = "/url_shortener.URLShortener/AddURLs"
-	URLShortener_GetURL_FullMethodName      = "/url_shortener.URLShortener/GetURL"
-	URLShortener_GetUserURLs_FullMethodName = "/url_shortener.URLShortener/GetUserURLs"
-	URLShortener_DeleteURLs_FullMethodName  = "/url_shortener.URLShortener/DeleteURLs"
-	URLShortener_GetStats_FullMethodName    = "/url_shortener.URLShortener/GetStats"
+	URLShortener_Ping_FullMethodName                 = "/url_shortener.URLShortener/Ping"
+	URLShortener_AddURL_FullMethodName               = "/url_shortener.URLShortener/AddURL"
+	URLShortener_AddURLs_FullMethodName              = "/url_shortener.URLShortener/AddURLs"
+	URLShortener_StreamAddURLs_FullMethodName        = "/url_shortener.URLShortener/StreamAddURLs"
+	URLShortener_GetURL_FullMethodName               = "/url_shortener.URLShortener/GetURL"
+	URLShortener_GetUserURLs_FullMethodName          = "/url_shortener.URLShortener/GetUserURLs"
+	URLShortener_DeleteURLs_FullMethodName           = "/url_shortener.URLShortener/DeleteURLs"
+	URLShortener_GetStats_FullMethodName             = "/url_shortener.URLShortener/GetStats"
+	URLShortener_Logout_FullMethodName               = "/url_shortener.URLShortener/Logout"
+	URLShortener_Refresh_FullMethodName              = "/url_shortener.URLShortener/Refresh"
+	URLShortener_AdminListURLs_FullMethodName        = "/url_shortener.URLShortener/AdminListURLs"
+	URLShortener_AdminSetURLDisabled_FullMethodName  = "/url_shortener.URLShortener/AdminSetURLDisabled"
+	URLShortener_AdminDeleteUserURLs_FullMethodName  = "/url_shortener.URLShortener/AdminDeleteUserURLs"
+	URLShortener_AdminGetUserStats_FullMethodName    = "/url_shortener.URLShortener/AdminGetUserStats"
+	URLShortener_GetQuota_FullMethodName             = "/url_shortener.URLShortener/GetQuota"
+	URLShortener_AdminGetUserQuota_FullMethodName    = "/url_shortener.URLShortener/AdminGetUserQuota"
+	URLShortener_AdminSetUserQuota_FullMethodName    = "/url_shortener.URLShortener/AdminSetUserQuota"
+	URLShortener_AdminDeleteUserQuota_FullMethodName = "/url_shortener.URLShortener/AdminDeleteUserQuota"
 )
 
 // URLShortenerClient is the client API for URLShortener service.
@@ -36,10 +47,21 @@ type URLShortenerClient interface {
 	Ping(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*emptypb.Empty, error)
 	AddURL(ctx context.Context, in *AddURLRequest, opts ...grpc.CallOption) (*AddURLResponse, error)
 	AddURLs(ctx context.Context, in *AddURLsRequest, opts ...grpc.CallOption) (*AddURLsResponse, error)
+	StreamAddURLs(ctx context.Context, opts ...grpc.CallOption) (URLShortener_StreamAddURLsClient, error)
 	GetURL(ctx context.Context, in *GetURLRequest, opts ...grpc.CallOption) (*GetURLResponse, error)
-	GetUserURLs(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*GetUserURLsResponse, error)
+	GetUserURLs(ctx context.Context, in *GetUserURLsRequest, opts ...grpc.CallOption) (*GetUserURLsResponse, error)
 	DeleteURLs(ctx context.Context, in *DeleteURLsRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
 	GetStats(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*GetStatsResponse, error)
+	Logout(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	Refresh(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	AdminListURLs(ctx context.Context, in *AdminListURLsRequest, opts ...grpc.CallOption) (*AdminListURLsResponse, error)
+	AdminSetURLDisabled(ctx context.Context, in *AdminSetURLDisabledRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	AdminDeleteUserURLs(ctx context.Context, in *AdminDeleteUserURLsRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	AdminGetUserStats(ctx context.Context, in *AdminGetUserStatsRequest, opts ...grpc.CallOption) (*AdminGetUserStatsResponse, error)
+	GetQuota(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*GetQuotaResponse, error)
+	AdminGetUserQuota(ctx context.Context, in *AdminGetUserQuotaRequest, opts ...grpc.CallOption) (*GetQuotaResponse, error)
+	AdminSetUserQuota(ctx context.Context, in *AdminSetUserQuotaRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	AdminDeleteUserQuota(ctx context.Context, in *AdminDeleteUserQuotaRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
 }
 
 type uRLShortenerClient struct {
@@ -77,6 +99,37 @@ func (c *uRLShortenerClient) AddURLs(ctx context.Context, in *AddURLsRequest, op
 	return out, nil
 }
 
+func (c *uRLShortenerClient) StreamAddURLs(ctx context.Context, opts ...grpc.CallOption) (URLShortener_StreamAddURLsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &URLShortener_ServiceDesc.Streams[0], URLShortener_StreamAddURLs_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &uRLShortenerStreamAddURLsClient{stream}
+	return x, nil
+}
+
+type URLShortener_StreamAddURLsClient interface {
+	Send(*AddURLsRequest_IDAndURL) error
+	Recv() (*StreamAddURLsResponse, error)
+	grpc.ClientStream
+}
+
+type uRLShortenerStreamAddURLsClient struct {
+	grpc.ClientStream
+}
+
+func (x *uRLShortenerStreamAddURLsClient) Send(m *AddURLsRequest_IDAndURL) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *uRLShortenerStreamAddURLsClient) Recv() (*StreamAddURLsResponse, error) {
+	m := new(StreamAddURLsResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (c *uRLShortenerClient) GetURL(ctx context.Context, in *GetURLRequest, opts ...grpc.CallOption) (*GetURLResponse, error) {
 	out := new(GetURLResponse)
 	err := c.cc.Invoke(ctx, URLShortener_GetURL_FullMethodName, in, out, opts...)
@@ -86,7 +139,7 @@ func (c *uRLShortenerClient) GetURL(ctx context.Context, in *GetURLRequest, opts
 	return out, nil
 }
 
-func (c *uRLShortenerClient) GetUserURLs(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*GetUserURLsResponse, error) {
+func (c *uRLShortenerClient) GetUserURLs(ctx context.Context, in *GetUserURLsRequest, opts ...grpc.CallOption) (*GetUserURLsResponse, error) {
 	out := new(GetUserURLsResponse)
 	err := c.cc.Invoke(ctx, URLShortener_GetUserURLs_FullMethodName, in, out, opts...)
 	if err != nil {
@@ -113,6 +166,96 @@ func (c *uRLShortenerClient) GetStats(ctx context.Context, in *emptypb.Empty, op
 	return out, nil
 }
 
+func (c *uRLShortenerClient) Logout(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, URLShortener_Logout_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uRLShortenerClient) Refresh(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, URLShortener_Refresh_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uRLShortenerClient) AdminListURLs(ctx context.Context, in *AdminListURLsRequest, opts ...grpc.CallOption) (*AdminListURLsResponse, error) {
+	out := new(AdminListURLsResponse)
+	err := c.cc.Invoke(ctx, URLShortener_AdminListURLs_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uRLShortenerClient) AdminSetURLDisabled(ctx context.Context, in *AdminSetURLDisabledRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, URLShortener_AdminSetURLDisabled_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uRLShortenerClient) AdminDeleteUserURLs(ctx context.Context, in *AdminDeleteUserURLsRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, URLShortener_AdminDeleteUserURLs_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uRLShortenerClient) AdminGetUserStats(ctx context.Context, in *AdminGetUserStatsRequest, opts ...grpc.CallOption) (*AdminGetUserStatsResponse, error) {
+	out := new(AdminGetUserStatsResponse)
+	err := c.cc.Invoke(ctx, URLShortener_AdminGetUserStats_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uRLShortenerClient) GetQuota(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*GetQuotaResponse, error) {
+	out := new(GetQuotaResponse)
+	err := c.cc.Invoke(ctx, URLShortener_GetQuota_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uRLShortenerClient) AdminGetUserQuota(ctx context.Context, in *AdminGetUserQuotaRequest, opts ...grpc.CallOption) (*GetQuotaResponse, error) {
+	out := new(GetQuotaResponse)
+	err := c.cc.Invoke(ctx, URLShortener_AdminGetUserQuota_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uRLShortenerClient) AdminSetUserQuota(ctx context.Context, in *AdminSetUserQuotaRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, URLShortener_AdminSetUserQuota_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uRLShortenerClient) AdminDeleteUserQuota(ctx context.Context, in *AdminDeleteUserQuotaRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, URLShortener_AdminDeleteUserQuota_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // URLShortenerServer is the server API for URLShortener service.
 // All implementations must embed UnimplementedURLShortenerServer
 // for forward compatibility
@@ -120,10 +263,21 @@ type URLShortenerServer interface {
 	Ping(context.Context, *emptypb.Empty) (*emptypb.Empty, error)
 	AddURL(context.Context, *AddURLRequest) (*AddURLResponse, error)
 	AddURLs(context.Context, *AddURLsRequest) (*AddURLsResponse, error)
+	StreamAddURLs(URLShortener_StreamAddURLsServer) error
 	GetURL(context.Context, *GetURLRequest) (*GetURLResponse, error)
-	GetUserURLs(context.Context, *emptypb.Empty) (*GetUserURLsResponse, error)
+	GetUserURLs(context.Context, *GetUserURLsRequest) (*GetUserURLsResponse, error)
 	DeleteURLs(context.Context, *DeleteURLsRequest) (*emptypb.Empty, error)
 	GetStats(context.Context, *emptypb.Empty) (*GetStatsResponse, error)
+	Logout(context.Context, *emptypb.Empty) (*emptypb.Empty, error)
+	Refresh(context.Context, *emptypb.Empty) (*emptypb.Empty, error)
+	AdminListURLs(context.Context, *AdminListURLsRequest) (*AdminListURLsResponse, error)
+	AdminSetURLDisabled(context.Context, *AdminSetURLDisabledRequest) (*emptypb.Empty, error)
+	AdminDeleteUserURLs(context.Context, *AdminDeleteUserURLsRequest) (*emptypb.Empty, error)
+	AdminGetUserStats(context.Context, *AdminGetUserStatsRequest) (*AdminGetUserStatsResponse, error)
+	GetQuota(context.Context, *emptypb.Empty) (*GetQuotaResponse, error)
+	AdminGetUserQuota(context.Context, *AdminGetUserQuotaRequest) (*GetQuotaResponse, error)
+	AdminSetUserQuota(context.Context, *AdminSetUserQuotaRequest) (*emptypb.Empty, error)
+	AdminDeleteUserQuota(context.Context, *AdminDeleteUserQuotaRequest) (*emptypb.Empty, error)
 	mustEmbedUnimplementedURLShortenerServer()
 }
 
@@ -140,10 +294,13 @@ func (UnimplementedURLShortenerServer) AddURL(context.Context, *AddURLRequest) (
 func (UnimplementedURLShortenerServer) AddURLs(context.Context, *AddURLsRequest) (*AddURLsResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method AddURLs not implemented")
 }
+func (UnimplementedURLShortenerServer) StreamAddURLs(URLShortener_StreamAddURLsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamAddURLs not implemented")
+}
 func (UnimplementedURLShortenerServer) GetURL(context.Context, *GetURLRequest) (*GetURLResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetURL not implemented")
 }
-func (UnimplementedURLShortenerServer) GetUserURLs(context.Context, *emptypb.Empty) (*GetUserURLsResponse, error) {
+func (UnimplementedURLShortenerServer) GetUserURLs(context.Context, *GetUserURLsRequest) (*GetUserURLsResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetUserURLs not implemented")
 }
 func (UnimplementedURLShortenerServer) DeleteURLs(context.Context, *DeleteURLsRequest) (*emptypb.Empty, error) {
@@ -152,6 +309,36 @@ func (UnimplementedURLShortenerServer) DeleteURLs(context.Context, *DeleteURLsRe
 func (UnimplementedURLShortenerServer) GetStats(context.Context, *emptypb.Empty) (*GetStatsResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetStats not implemented")
 }
+func (UnimplementedURLShortenerServer) Logout(context.Context, *emptypb.Empty) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Logout not implemented")
+}
+func (UnimplementedURLShortenerServer) Refresh(context.Context, *emptypb.Empty) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Refresh not implemented")
+}
+func (UnimplementedURLShortenerServer) AdminListURLs(context.Context, *AdminListURLsRequest) (*AdminListURLsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AdminListURLs not implemented")
+}
+func (UnimplementedURLShortenerServer) AdminSetURLDisabled(context.Context, *AdminSetURLDisabledRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AdminSetURLDisabled not implemented")
+}
+func (UnimplementedURLShortenerServer) AdminDeleteUserURLs(context.Context, *AdminDeleteUserURLsRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AdminDeleteUserURLs not implemented")
+}
+func (UnimplementedURLShortenerServer) AdminGetUserStats(context.Context, *AdminGetUserStatsRequest) (*AdminGetUserStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AdminGetUserStats not implemented")
+}
+func (UnimplementedURLShortenerServer) GetQuota(context.Context, *emptypb.Empty) (*GetQuotaResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetQuota not implemented")
+}
+func (UnimplementedURLShortenerServer) AdminGetUserQuota(context.Context, *AdminGetUserQuotaRequest) (*GetQuotaResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AdminGetUserQuota not implemented")
+}
+func (UnimplementedURLShortenerServer) AdminSetUserQuota(context.Context, *AdminSetUserQuotaRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AdminSetUserQuota not implemented")
+}
+func (UnimplementedURLShortenerServer) AdminDeleteUserQuota(context.Context, *AdminDeleteUserQuotaRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AdminDeleteUserQuota not implemented")
+}
 func (UnimplementedURLShortenerServer) mustEmbedUnimplementedURLShortenerServer() {}
 
 // UnsafeURLShortenerServer may be embedded to opt out of forward compatibility for this service.
@@ -219,6 +406,32 @@ func _URLShortener_AddURLs_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _URLShortener_StreamAddURLs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(URLShortenerServer).StreamAddURLs(&uRLShortenerStreamAddURLsServer{stream})
+}
+
+type URLShortener_StreamAddURLsServer interface {
+	Send(*StreamAddURLsResponse) error
+	Recv() (*AddURLsRequest_IDAndURL, error)
+	grpc.ServerStream
+}
+
+type uRLShortenerStreamAddURLsServer struct {
+	grpc.ServerStream
+}
+
+func (x *uRLShortenerStreamAddURLsServer) Send(m *StreamAddURLsResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *uRLShortenerStreamAddURLsServer) Recv() (*AddURLsRequest_IDAndURL, error) {
+	m := new(AddURLsRequest_IDAndURL)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func _URLShortener_GetURL_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(GetURLRequest)
 	if err := dec(in); err != nil {
@@ -238,7 +451,7 @@ func _URLShortener_GetURL_Handler(srv interface{}, ctx context.Context, dec func
 }
 
 func _URLShortener_GetUserURLs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(emptypb.Empty)
+	in := new(GetUserURLsRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
@@ -250,7 +463,7 @@ func _URLShortener_GetUserURLs_Handler(srv interface{}, ctx context.Context, dec
 		FullMethod: URLShortener_GetUserURLs_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(URLShortenerServer).GetUserURLs(ctx, req.(*emptypb.Empty))
+		return srv.(URLShortenerServer).GetUserURLs(ctx, req.(*GetUserURLsRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
@@ -291,6 +504,186 @@ func _URLShortener_GetStats_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _URLShortener_Logout_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(URLShortenerServer).Logout(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: URLShortener_Logout_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(URLShortenerServer).Logout(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _URLShortener_Refresh_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(URLShortenerServer).Refresh(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: URLShortener_Refresh_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(URLShortenerServer).Refresh(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _URLShortener_AdminListURLs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AdminListURLsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(URLShortenerServer).AdminListURLs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: URLShortener_AdminListURLs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(URLShortenerServer).AdminListURLs(ctx, req.(*AdminListURLsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _URLShortener_AdminSetURLDisabled_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AdminSetURLDisabledRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(URLShortenerServer).AdminSetURLDisabled(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: URLShortener_AdminSetURLDisabled_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(URLShortenerServer).AdminSetURLDisabled(ctx, req.(*AdminSetURLDisabledRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _URLShortener_AdminDeleteUserURLs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AdminDeleteUserURLsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(URLShortenerServer).AdminDeleteUserURLs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: URLShortener_AdminDeleteUserURLs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(URLShortenerServer).AdminDeleteUserURLs(ctx, req.(*AdminDeleteUserURLsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _URLShortener_AdminGetUserStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AdminGetUserStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(URLShortenerServer).AdminGetUserStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: URLShortener_AdminGetUserStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(URLShortenerServer).AdminGetUserStats(ctx, req.(*AdminGetUserStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _URLShortener_GetQuota_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(URLShortenerServer).GetQuota(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: URLShortener_GetQuota_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(URLShortenerServer).GetQuota(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _URLShortener_AdminGetUserQuota_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AdminGetUserQuotaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(URLShortenerServer).AdminGetUserQuota(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: URLShortener_AdminGetUserQuota_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(URLShortenerServer).AdminGetUserQuota(ctx, req.(*AdminGetUserQuotaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _URLShortener_AdminSetUserQuota_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AdminSetUserQuotaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(URLShortenerServer).AdminSetUserQuota(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: URLShortener_AdminSetUserQuota_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(URLShortenerServer).AdminSetUserQuota(ctx, req.(*AdminSetUserQuotaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _URLShortener_AdminDeleteUserQuota_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AdminDeleteUserQuotaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(URLShortenerServer).AdminDeleteUserQuota(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: URLShortener_AdminDeleteUserQuota_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(URLShortenerServer).AdminDeleteUserQuota(ctx, req.(*AdminDeleteUserQuotaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // URLShortener_ServiceDesc is the grpc.ServiceDesc for URLShortener service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -326,7 +719,54 @@ var URLShortener_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetStats",
 			Handler:    _URLShortener_GetStats_Handler,
 		},
+		{
+			MethodName: "Logout",
+			Handler:    _URLShortener_Logout_Handler,
+		},
+		{
+			MethodName: "Refresh",
+			Handler:    _URLShortener_Refresh_Handler,
+		},
+		{
+			MethodName: "AdminListURLs",
+			Handler:    _URLShortener_AdminListURLs_Handler,
+		},
+		{
+			MethodName: "AdminSetURLDisabled",
+			Handler:    _URLShortener_AdminSetURLDisabled_Handler,
+		},
+		{
+			MethodName: "AdminDeleteUserURLs",
+			Handler:    _URLShortener_AdminDeleteUserURLs_Handler,
+		},
+		{
+			MethodName: "AdminGetUserStats",
+			Handler:    _URLShortener_AdminGetUserStats_Handler,
+		},
+		{
+			MethodName: "GetQuota",
+			Handler:    _URLShortener_GetQuota_Handler,
+		},
+		{
+			MethodName: "AdminGetUserQuota",
+			Handler:    _URLShortener_AdminGetUserQuota_Handler,
+		},
+		{
+			MethodName: "AdminSetUserQuota",
+			Handler:    _URLShortener_AdminSetUserQuota_Handler,
+		},
+		{
+			MethodName: "AdminDeleteUserQuota",
+			Handler:    _URLShortener_AdminDeleteUserQuota_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamAddURLs",
+			Handler:       _URLShortener_StreamAddURLs_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "api/proto/url_shortener.proto",
 }